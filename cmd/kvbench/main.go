@@ -5,6 +5,10 @@ import (
 	"os"
 
 	"github.com/hatlonely/kvclient/pkg/kvcfg"
+	_ "github.com/hatlonely/kvclient/pkg/kvotel"   // OpenTelemetry tracing
+	_ "github.com/hatlonely/kvclient/pkg/kvprom"   // Prometheus metrics sink
+	_ "github.com/hatlonely/kvclient/pkg/kvserver" // RemoteCache
+	_ "github.com/hatlonely/kvclient/pkg/kvsql"    // drivers of SQLCache
 	"github.com/spf13/pflag"
 )
 
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hatlonely/kvclient/pkg/kvcfg"
+	"github.com/hatlonely/kvclient/pkg/kvctl"
+	_ "github.com/hatlonely/kvclient/pkg/kvotel"   // OpenTelemetry tracing
+	_ "github.com/hatlonely/kvclient/pkg/kvprom"   // Prometheus metrics sink
+	_ "github.com/hatlonely/kvclient/pkg/kvserver" // RemoteCache
+	_ "github.com/hatlonely/kvclient/pkg/kvsql"    // drivers of SQLCache
+	"github.com/spf13/pflag"
+)
+
+// AppVersion version info from scripts/version.sh
+var AppVersion = "unknown"
+
+func main() {
+	version := pflag.BoolP("version", "v", false, "print current version")
+	config := pflag.StringP("filename", "f", "configs/kvctl.json", "configuration filename of a kvclient")
+	pflag.StringP("format", "o", kvctl.FormatRaw, "format of values, raw, hex or json")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: kvctl [options] <command> [args]\n       kvctl shell [options] [--script file] [--history file] [--timing]\n\noptions:\n%v\n%v", pflag.CommandLine.FlagUsages(), kvctl.Usage)
+	}
+	// flags after the command belong to the command
+	pflag.CommandLine.SetInterspersed(false)
+	pflag.Parse()
+	if *version {
+		fmt.Println(AppVersion)
+		os.Exit(0)
+	}
+
+	// kvctl shell -f config.json, the options go after shell
+	args := pflag.Args()
+	shell := len(args) != 0 && args[0] == "shell"
+	script := pflag.String("script", "", "run the commands in the file instead of the input")
+	history := pflag.String("history", filepath.Join(os.Getenv("HOME"), ".kvctl_history"), "history file of the shell, empty means no history file")
+	timing := pflag.Bool("timing", true, "print the time of each command")
+	if shell {
+		pflag.CommandLine.SetInterspersed(true)
+		if err := pflag.CommandLine.Parse(args[1:]); err != nil {
+			os.Exit(2)
+		}
+	}
+
+	ctl, err := kvcfg.NewKVCtlWithFile(*config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if shell {
+		err = runShell(ctl, *script, *history, *timing)
+	} else {
+		err = ctl.Run(args)
+	}
+	ctl.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runShell(ctl *kvctl.Ctl, script string, history string, timing bool) error {
+	builder := kvctl.NewShellBuilder().WithCtl(ctl).WithTiming(timing)
+	if script == "" {
+		builder.WithHistoryFile(history)
+	}
+	shell, err := builder.Build()
+	if err != nil {
+		return err
+	}
+	defer shell.Close()
+	if script != "" {
+		return shell.Source(script)
+	}
+	return shell.Run()
+}
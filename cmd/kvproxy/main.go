@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/hatlonely/kvclient/pkg/kvcfg"
+	_ "github.com/hatlonely/kvclient/pkg/kvotel"   // OpenTelemetry tracing
+	_ "github.com/hatlonely/kvclient/pkg/kvprom"   // Prometheus metrics sink
+	_ "github.com/hatlonely/kvclient/pkg/kvserver" // RemoteCache
+	_ "github.com/hatlonely/kvclient/pkg/kvsql"    // drivers of SQLCache
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+// AppVersion version info from scripts/version.sh
+var AppVersion = "unknown"
+
+func main() {
+	version := pflag.BoolP("version", "v", false, "print current version")
+	config := pflag.StringP("filename", "f", "configs/kvproxy.json", "configuration filename")
+	pflag.String("address", ":6380", "address to listen on")
+	pflag.Parse()
+	if *version {
+		fmt.Println(AppVersion)
+		os.Exit(0)
+	}
+
+	server, err := kvcfg.NewKVProxyWithFile(*config)
+	if err != nil {
+		panic(err)
+	}
+
+	// Serve returns as soon as the listener is closed, wait for the connections to drain
+	// and the kvclient to close
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-signals
+		logrus.WithFields(logrus.Fields{"signal": sig.String(), "type": "kvproxy"}).Info("shutdown")
+		if err := server.Close(); err != nil {
+			logrus.WithFields(logrus.Fields{"error": err, "type": "kvproxy"}).Warn("close failed")
+		}
+	}()
+
+	logrus.WithFields(logrus.Fields{"address": server.Addr().String(), "type": "kvproxy"}).Info("serve")
+	if err := server.Serve(); err != nil {
+		panic(err)
+	}
+	<-done
+}
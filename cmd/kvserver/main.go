@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	_ "github.com/hatlonely/kvclient/pkg/kvotel" // OpenTelemetry tracing
+	_ "github.com/hatlonely/kvclient/pkg/kvprom" // Prometheus metrics sink
+	"github.com/hatlonely/kvclient/pkg/kvserver"
+	_ "github.com/hatlonely/kvclient/pkg/kvsql" // drivers of SQLCache
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+// AppVersion version info from scripts/version.sh
+var AppVersion = "unknown"
+
+func main() {
+	version := pflag.BoolP("version", "v", false, "print current version")
+	config := pflag.StringP("filename", "f", "configs/kvserver.json", "configuration filename")
+	pflag.String("httpAddress", ":8080", "http address to listen on")
+	pflag.String("grpcAddress", ":8081", "grpc address to listen on")
+	pflag.Parse()
+	if *version {
+		fmt.Println(AppVersion)
+		os.Exit(0)
+	}
+
+	server, err := kvserver.NewServerWithFile(*config)
+	if err != nil {
+		panic(err)
+	}
+
+	// Serve returns as soon as the listeners are closed, wait for the requests to drain
+	// and the kvclients to close
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-signals
+		logrus.WithFields(logrus.Fields{"signal": sig.String(), "type": "kvserver"}).Info("shutdown")
+		if err := server.Close(); err != nil {
+			logrus.WithFields(logrus.Fields{"error": err, "type": "kvserver"}).Warn("close failed")
+		}
+	}()
+
+	logrus.WithFields(logrus.Fields{
+		"httpAddress": fmt.Sprintf("%v", server.HTTPAddr()),
+		"grpcAddress": fmt.Sprintf("%v", server.GRPCAddr()),
+		"namespaces":  server.Namespaces(),
+		"type":        "kvserver",
+	}).Info("serve")
+	if err := server.Serve(); err != nil {
+		panic(err)
+	}
+	<-done
+}
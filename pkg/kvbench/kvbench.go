@@ -28,6 +28,7 @@ func NewKVBenchmarkerBuilder() *KVBenchmarkerBuilder {
 type KVBenchmarkerBuilder struct {
 	TimeDistributionThreshold []time.Duration
 	Schedule                  []*ScheduleItem
+	Replay                    *ReplayItem // replay a trace instead of the schedule if not nil
 	kvclient                  kvclient.KVClient
 	producer                  kvloader.KVProducer
 }
@@ -50,6 +51,12 @@ func (b *KVBenchmarkerBuilder) WithSchedule(schedule []*ScheduleItem) *KVBenchma
 	return b
 }
 
+// WithReplay option
+func (b *KVBenchmarkerBuilder) WithReplay(replay *ReplayItem) *KVBenchmarkerBuilder {
+	b.Replay = replay
+	return b
+}
+
 // WithProducer option
 func (b *KVBenchmarkerBuilder) WithProducer(producer kvloader.KVProducer) *KVBenchmarkerBuilder {
 	b.producer = producer
@@ -62,10 +69,18 @@ func (b *KVBenchmarkerBuilder) Build() *KVBenchmarker {
 		timeDistributionThreshold: b.TimeDistributionThreshold,
 		kvclient:                  b.kvclient,
 		schedule:                  b.Schedule,
+		replay:                    b.Replay,
 		producer:                  b.producer,
 	}
 }
 
+// ReplayItem replay a trace recorded by kvclient.RecordingCache
+type ReplayItem struct {
+	Filename   string
+	KeepTiming bool    // keep the intervals between operations, otherwise run as fast as possible
+	Speed      float64 // intervals are divided by speed with KeepTiming
+}
+
 // ScheduleItem run schedule
 type ScheduleItem struct {
 	ReaderNum    int
@@ -80,11 +95,16 @@ type KVBenchmarker struct {
 	timeDistributionThreshold []time.Duration
 	kvclient                  kvclient.KVClient
 	schedule                  []*ScheduleItem
+	replay                    *ReplayItem
 	producer                  kvloader.KVProducer
 }
 
 // Benchmark run benchmark
 func (b *KVBenchmarker) Benchmark() error {
+	if b.replay != nil {
+		return b.BenchmarkReplay()
+	}
+
 	mem := kvloader.NewMemKVConsumerBuilder().Build()
 
 	loader := kvloader.NewBuilder().
@@ -113,6 +133,42 @@ func (b *KVBenchmarker) Benchmark() error {
 	return nil
 }
 
+// BenchmarkReplay replay the trace against kvclient
+func (b *KVBenchmarker) BenchmarkReplay() error {
+	speed := b.replay.Speed
+	if speed == 0 {
+		speed = 1
+	}
+	replayer, err := kvclient.NewReplayerBuilder().
+		WithFilename(b.replay.Filename).
+		WithKeepTiming(b.replay.KeepTiming).
+		WithSpeed(speed).
+		WithKVClient(b.kvclient).
+		Build()
+	if err != nil {
+		return err
+	}
+	stats, err := replayer.Replay()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\t\t%v\t%v\t%v\t% 8v\t% 8v\t% 8v\n", "count", "fail", "mismatch", "totalTime", "res_time", "rec_time")
+	for _, cn := range []string{"Get", "GetBatch", "Set", "Del", "SetBatch", "SetEx", "SetNx", "SetExNx"} {
+		s, ok := stats.Operations[cn]
+		if !ok {
+			continue
+		}
+		fmt.Printf(
+			"Replay-%v\t%v\t%v\t%v\t% 8v\t% 8v\t% 8v\n",
+			cn, s.Count, s.Errors, s.Mismatches, s.Latency,
+			s.Latency/time.Duration(s.Count), s.RecordedLatency/time.Duration(s.Count),
+		)
+	}
+	fmt.Printf("replay finished in %v\n", stats.Duration)
+	return nil
+}
+
 // BenchmarkMultiThread benchmark with multi thread
 func (b *KVBenchmarker) BenchmarkMultiThread(readerNum int, writerNum int, infos []*kvloader.KVInfo) {
 	var wg sync.WaitGroup
@@ -1,6 +1,7 @@
 package kvcfg
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/hatlonely/kvclient/pkg/kvbench"
@@ -30,18 +31,25 @@ func NewKVBenchmarker(config *viper.Viper) (*kvbench.KVBenchmarker, error) {
 	if err := config.Unmarshal(builder); err != nil {
 		return nil, err
 	}
+	if builder.Replay == nil && config.Sub("producer") == nil {
+		return nil, fmt.Errorf("no producer or replay")
+	}
 
 	kvclient, err := NewKVClient(config.Sub("kvclient"))
 	if err != nil {
 		return nil, err
 	}
-	producer, err := NewKVProducer(config.Sub("producer"))
-	if err != nil {
-		return nil, err
+	builder.WithKVClient(kvclient)
+
+	// a replay runs without producer
+	if config.Sub("producer") != nil {
+		producer, err := NewKVProducer(config.Sub("producer"))
+		if err != nil {
+			kvclient.Close()
+			return nil, err
+		}
+		builder.WithProducer(producer)
 	}
 
-	return builder.
-		WithKVClient(kvclient).
-		WithProducer(producer).
-		Build(), nil
+	return builder.Build(), nil
 }
@@ -27,7 +27,29 @@ func NewKVClientWithFile(filename string) (kvclient.KVClient, error) {
 
 // NewKVClient create a new kvclient
 func NewKVClient(config *viper.Viper) (kvclient.KVClient, error) {
+	return newKVClient(config, kvClientOptions{warmup: true, dump: true})
+}
+
+// kvClientOptions sections of the config to skip, kvctl neither runs the warmup nor
+// dumps the local caches
+type kvClientOptions struct {
+	warmup bool // run the warmup section
+	dump   bool // dump the local cache to dumpFile on Close
+}
+
+func newKVClient(config *viper.Viper, options kvClientOptions) (kvclient.KVClient, error) {
+	// the caches built are closed on errors, the client is not closed so that a failed
+	// client never overwrites dumpFile
 	var caches []kvclient.Cache
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			for _, cache := range caches {
+				cache.Close()
+			}
+		}
+	}()
+	var labels []kvclient.CacheLabels
 	names := config.GetStringSlice("caches")
 	for _, name := range names {
 		cf := config.Sub(name)
@@ -40,9 +62,71 @@ func NewKVClient(config *viper.Viper) (kvclient.KVClient, error) {
 		}
 
 		caches = append(caches, cache)
+		labels = append(labels, kvclient.CacheLabels{Class: cf.GetString("class"), Name: name})
+	}
+
+	// required operations, such as ["SetEx", "SetNx"]
+	capabilities, err := kvclient.ParseCapabilities(config.GetStringSlice("capabilities"))
+	if err != nil {
+		return nil, err
+	}
+
+	builder := kvclient.NewBuilder().WithCaches(caches).WithCapabilities(capabilities)
+	if config.Sub("metrics") != nil {
+		sink, err := NewMetricsSink(config.Sub("metrics"))
+		if err != nil {
+			return nil, err
+		}
+		builder.WithMetricsSink(sink).WithCacheLabels(labels)
+	}
+
+	// registered by RegisterTracingHook, such as OpenTelemetry by pkg/kvotel
+	if config.Sub("tracing") != nil {
+		factory := registeredTracingHook()
+		if factory == nil {
+			return nil, fmt.Errorf("no tracing hook registered (forgotten import?)")
+		}
+		hook, err := factory(config.Sub("tracing"))
+		if err != nil {
+			return nil, err
+		}
+		builder.WithHooks(hook).WithCacheLabels(labels)
+	}
+
+	// {
+	//     "topK": 100,
+	//     "threshold": 1000,
+	//     "window": "1m",
+	//     "localMaxBytes": 16777216,
+	//     "localExpiration": "1s"
+	// }
+	if config.Sub("hotKeys") != nil {
+		hotKeys := kvclient.NewHotKeyDetectorBuilder()
+		if err := config.Sub("hotKeys").Unmarshal(hotKeys); err != nil {
+			return nil, err
+		}
+		detector, err := hotKeys.Build()
+		if err != nil {
+			return nil, err
+		}
+		builder.WithHotKeyDetector(detector)
 	}
 
-	client := kvclient.NewBuilder().WithCaches(caches).Build()
+	// the local cache is restored from warmupFile on startup and dumped to dumpFile on
+	// Close, usually they are the same file
+	// {
+	//     "warmupFile": "data/kvclient.dump",
+	//     "dumpFile": "data/kvclient.dump"
+	// }
+	builder.WithWarmupFile(config.GetString("warmupFile"))
+	if options.dump {
+		builder.WithDumpFile(config.GetString("dumpFile"))
+	}
+
+	client, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
 
 	if config.Sub("compressor") != nil {
 		compressor, err := NewCompressor(config.Sub("compressor"))
@@ -60,16 +144,119 @@ func NewKVClient(config *viper.Viper) (kvclient.KVClient, error) {
 		client.SetSerializer(serializer)
 	}
 
+	// fill the client before it is returned, see NewWarmer
+	if options.warmup && config.Sub("warmup") != nil {
+		warmer, err := NewWarmer(config.Sub("warmup"), client)
+		if err != nil {
+			return nil, err
+		}
+		if err := warmer.Run(); err != nil {
+			return nil, fmt.Errorf("warmup failed: %v", err)
+		}
+	}
+
+	succeeded = true
 	return client, nil
 }
 
-// NewCache create a new cache
+// NewMetricsSink create a new metrics sink, Expvar is built in, the other classes are
+// registered by RegisterMetricsSink, such as Prometheus by pkg/kvprom
+func NewMetricsSink(config *viper.Viper) (kvclient.MetricsSink, error) {
+	c := config.GetString("class")
+	if c == "Expvar" {
+		// {
+		//     "class": "Expvar"
+		// }
+		return kvclient.NewExpvarSink(), nil
+	}
+	if factory, ok := metricsSinkFactory(c); ok {
+		return factory(config)
+	}
+
+	return nil, fmt.Errorf("no metrics sink named [%v] (forgotten import?)", c)
+}
+
+// NewCache create a new cache, the classes out of kvcfg are registered by RegisterCache, such
+// as RemoteCache by pkg/kvserver
 func NewCache(config *viper.Viper) (kvclient.Cache, error) {
 	c := config.GetString("class")
-	if c == "RedisClusterString" {
+	if c == "RedisString" {
+		// {
+		//     "class": "RedisString",
+		//     "address": "127.0.0.1:6379",
+		//     "username": "kvclient",
+		//     "password": "123456",
+		//     "sentinel": {
+		//         "masterName": "mymaster",
+		//         "address": "127.0.0.1:26379,127.0.0.1:26380"
+		//     },
+		//     "tls": {
+		//         "caFile": "ca.pem",
+		//         "certFile": "client.pem",
+		//         "keyFile": "client-key.pem"
+		//     },
+		//     "poolSize": 30,
+		//     "timeout": "1s",
+		//     "retries": 3,
+		//     "expiration": "24h"
+		// }
+		builder := kvclient.NewRedisStringBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build()
+	} else if c == "RedisHash" {
+		// {
+		//     "class": "RedisHash",
+		//     "address": "127.0.0.1:6379",
+		//     "username": "kvclient",
+		//     "password": "123456",
+		//     "sentinel": {
+		//         "masterName": "mymaster",
+		//         "address": "127.0.0.1:26379,127.0.0.1:26380"
+		//     },
+		//     "tls": {
+		//         "caFile": "ca.pem"
+		//     },
+		//     "poolSize": 30,
+		//     "timeout": "1s",
+		//     "retries": 3,
+		//     "keyIdx": 8,
+		//     "keyLen": 7
+		// }
+		builder := kvclient.NewRedisHashBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build()
+	} else if c == "RedisTracking" {
+		// {
+		//     "class": "RedisTracking",
+		//     "address": "127.0.0.1:6379",
+		//     "username": "kvclient",
+		//     "password": "123456",
+		//     "poolSize": 30,
+		//     "timeout": "1s",
+		//     "retries": 3,
+		//     "expiration": "24h",
+		//     "localSize": 100000,
+		//     "localExpiration": "1m",
+		//     "reconnectInterval": "1s"
+		// }
+		builder := kvclient.NewRedisTrackingBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build()
+	} else if c == "RedisClusterString" {
 		// {
 		// 		"class": "RedisClusterString",
 		// 		"address": "127.0.0.1:7000",
+		// 		"username": "kvclient",
+		// 		"password": "123456",
+		// 		"tls": {
+		// 			"caFile": "ca.pem"
+		// 		},
 		// 		"poolSize": 30,
 		// 		"timeoutMs": 1000,
 		// 		"retries": 3,
@@ -85,6 +272,11 @@ func NewCache(config *viper.Viper) (kvclient.Cache, error) {
 		// {
 		//     "class": "RedisClusterHash",
 		//     "address": "127.0.0.1:7000",
+		//     "username": "kvclient",
+		//     "password": "123456",
+		//     "tls": {
+		//         "caFile": "ca.pem"
+		//     },
 		//     "poolSize": 30,
 		//     "timeoutMs": 1000,
 		//     "retries": 3,
@@ -111,6 +303,91 @@ func NewCache(config *viper.Viper) (kvclient.Cache, error) {
 			return nil, err
 		}
 		return builder.Build()
+	} else if c == "MapCache" {
+		// {
+		//     "class": "MapCache",
+		//     "expiration": "15m",
+		//     "maxBytes": 67108864
+		// }
+		builder := kvclient.NewMapCacheBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build(), nil
+	} else if c == "TinyLFU" {
+		// {
+		//     "class": "TinyLFU",
+		//     "maxBytes": 67108864,
+		//     "expiration": "15m",
+		//     "windowPercent": 1,
+		//     "protectedPercent": 80,
+		//     "counters": 1048576
+		// }
+		builder := kvclient.NewTinyLFUBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build()
+	} else if c == "FaultyCache" {
+		// {
+		//     "class": "FaultyCache",
+		//     "seed": 1,
+		//     "default": {
+		//         "latency": {"distribution": "normal", "mean": "1ms", "stdDev": "500us", "max": "10ms"},
+		//         "errorRate": 0.01
+		//     },
+		//     "operations": {
+		//         "get": {"timeoutRate": 0.01, "timeout": "100ms"},
+		//         "getBatch": {"partialRate": 0.1},
+		//         "set": {"dropRate": 0.05}
+		//     },
+		//     "cache": {
+		//         "class": "MapCache"
+		//     }
+		// }
+		if config.Sub("cache") == nil {
+			return nil, fmt.Errorf("no cache of FaultyCache")
+		}
+		builder := kvclient.NewFaultyCacheBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		cache, err := NewCache(config.Sub("cache"))
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := builder.WithCache(cache).Build()
+		if err != nil {
+			cache.Close()
+			return nil, err
+		}
+		return wrapped, nil
+	} else if c == "RecordingCache" {
+		// {
+		//     "class": "RecordingCache",
+		//     "filename": "trace.jsonl",
+		//     "hashValues": false,
+		//     "cache": {
+		//         "class": "MapCache"
+		//     }
+		// }
+		if config.Sub("cache") == nil {
+			return nil, fmt.Errorf("no cache of RecordingCache")
+		}
+		builder := kvclient.NewRecordingCacheBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		cache, err := NewCache(config.Sub("cache"))
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := builder.WithCache(cache).Build()
+		if err != nil {
+			cache.Close()
+			return nil, err
+		}
+		return wrapped, nil
 	} else if c == "Gcache" {
 		// {
 		//     "class": "GLocalCache",
@@ -123,11 +400,86 @@ func NewCache(config *viper.Viper) (kvclient.Cache, error) {
 		}
 		return builder.Build(), nil
 	} else if c == "LevelDB" {
+		// {
+		//     "class": "LevelDB",
+		//     "directory": "leveldb/",
+		//     "expiration": "24h",
+		//     "sweepInterval": "10m",
+		//     "sweepBatch": 1000
+		// }
 		builder := kvclient.NewLevelDBBuilder()
 		if err := config.Unmarshal(builder); err != nil {
 			return nil, err
 		}
 		return builder.Build()
+	} else if c == "BoltDB" {
+		// {
+		//     "class": "BoltDB",
+		//     "filename": "bolt.db",
+		//     "namespace": "kvclient",
+		//     "expiration": "24h",
+		//     "sweepInterval": "10m"
+		// }
+		builder := kvclient.NewBoltDBBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build()
+	} else if c == "Badger" {
+		// {
+		//     "class": "Badger",
+		//     "directory": "badger/",
+		//     "expiration": "24h",
+		//     "gcInterval": "10m",
+		//     "gcDiscardRatio": 0.5
+		// }
+		builder := kvclient.NewBadgerBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build()
+	} else if c == "Bitcask" {
+		// {
+		//     "class": "Bitcask",
+		//     "directory": "bitcask/",
+		//     "maxFileSize": 268435456,
+		//     "expiration": "24h",
+		//     "compactInterval": "10m",
+		//     "compactRatio": 0.5
+		// }
+		builder := kvclient.NewBitcaskBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build()
+	} else if c == "Snapshot" {
+		// {
+		//     "class": "Snapshot",
+		//     "directory": "data/snapshot",
+		//     "pattern": "*.snapshot",
+		//     "watchInterval": "1m"
+		// }
+		builder := kvclient.NewSnapshotBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build()
+	} else if c == "SQLCache" {
+		// {
+		//     "class": "SQLCache",
+		//     "driver": "mysql",
+		//     "dsn": "user:password@tcp(127.0.0.1:3306)/db",
+		//     "table": "kvclient",
+		//     "keyColumn": "k",
+		//     "valueColumn": "v",
+		//     "expireColumn": "expire_at",
+		//     "purgeInterval": "10m"
+		// }
+		builder := kvclient.NewSQLCacheBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build()
 	} else if c == "Memcache" {
 		builder := kvclient.NewMemcacheBuilder()
 		if err := config.Unmarshal(builder); err != nil {
@@ -148,7 +500,11 @@ func NewCache(config *viper.Viper) (kvclient.Cache, error) {
 		return builder.Build()
 	}
 
-	return nil, fmt.Errorf("no cache named [%v]", c)
+	if factory, ok := cacheFactory(c); ok {
+		return factory(config)
+	}
+
+	return nil, fmt.Errorf("no cache named [%v] (forgotten import?)", c)
 }
 
 // NewCompressor create a new compressor
@@ -174,3 +530,15 @@ func NewSerializer(config *viper.Viper) (kvclient.Serializer, error) {
 	}
 	return nil, fmt.Errorf("no serializer named %v.%v", pkg, c)
 }
+
+// NewVal create a function to create values of the class
+func NewVal(config *viper.Viper) (func() interface{}, error) {
+	c := config.GetString("class")
+	pkg := config.GetString("package")
+	if pkg == "mykv" {
+		if c == "Val" {
+			return func() interface{} { return &mykv.Val{} }, nil
+		}
+	}
+	return nil, fmt.Errorf("no val named %v.%v", pkg, c)
+}
@@ -0,0 +1,69 @@
+package kvcfg
+
+import (
+	"os"
+
+	"github.com/hatlonely/kvclient/pkg/kvctl"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// NewKVCtlWithFile create a new kvctl use a kvclient config file
+func NewKVCtlWithFile(filename string) (*kvctl.Ctl, error) {
+	config := viper.New()
+	config.SetConfigType("json")
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.ReadConfig(fp); err != nil {
+		return nil, err
+	}
+
+	config.BindPFlags(pflag.CommandLine)
+	return NewKVCtl(config)
+}
+
+// NewKVCtl create a new kvctl on a kvclient config, the local caches are still restored
+// from warmupFile, but kvctl never dumps them or runs the warmup
+func NewKVCtl(config *viper.Viper) (*kvctl.Ctl, error) {
+	// {
+	// 	"format": "json",
+	// 	"caches": ["freecache", "aerospike"],
+	// 	"serializer": {
+	// 		"package": "mykv",
+	// 		"class": "Serializer"
+	// 	},
+	// 	"val": {
+	// 		"package": "mykv",
+	// 		"class": "Val"
+	// 	},
+	// 	...
+	// }
+	builder := kvctl.NewCtlBuilder()
+	if format := config.GetString("format"); format != "" {
+		builder.WithFormat(format)
+	}
+	if config.Sub("serializer") != nil && config.Sub("val") != nil {
+		serializer, err := NewSerializer(config.Sub("serializer"))
+		if err != nil {
+			return nil, err
+		}
+		newVal, err := NewVal(config.Sub("val"))
+		if err != nil {
+			return nil, err
+		}
+		builder.WithSerializer(serializer, newVal)
+	}
+
+	kvclient, err := newKVClient(config, kvClientOptions{})
+	if err != nil {
+		return nil, err
+	}
+	ctl, err := builder.WithKVClient(kvclient).WithNames(config.GetStringSlice("caches")).Build()
+	if err != nil {
+		kvclient.Close()
+		return nil, err
+	}
+	return ctl, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/hatlonely/kvclient/pkg/kvclient"
 	"github.com/hatlonely/kvclient/pkg/kvloader"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -39,6 +40,43 @@ func NewKVLoader(config *viper.Viper) (kvloader.KVLoader, error) {
 	return kvloader.NewBuilder().WithProducer(producer).WithConsumer(consumer).Build(), nil
 }
 
+// NewWarmer create a new warmer of client, Start it to warm up in background
+func NewWarmer(config *viper.Viper, client kvclient.KVClient) (*kvloader.Warmer, error) {
+	// {
+	// 	"threadNum": 10,
+	// 	"qps": 10000,
+	// 	"timeout": "1m",
+	// 	"verbose": true,
+	// 	"val": {
+	// 		"package": "mykv",
+	// 		"class": "Val"
+	// 	},
+	// 	"producer": {
+	// 		"class": "FileKVProducer",
+	// 		"directory": "data/warmup",
+	// 		"coder": {
+	// 			"class": "MyKVCoder"
+	// 		}
+	// 	}
+	// }
+	producer, err := NewKVProducer(config.Sub("producer"))
+	if err != nil {
+		return nil, err
+	}
+	builder := kvloader.NewWarmerBuilder()
+	if err := config.Unmarshal(builder); err != nil {
+		return nil, err
+	}
+	if config.Sub("val") != nil {
+		newVal, err := NewVal(config.Sub("val"))
+		if err != nil {
+			return nil, err
+		}
+		builder.WithNewVal(newVal)
+	}
+	return builder.WithKVClient(client).WithProducer(producer).Build(), nil
+}
+
 // NewKVCoder create a new kvloader
 func NewKVCoder(config *viper.Viper) (kvloader.KVCoder, error) {
 	c := config.GetString("class")
@@ -171,6 +209,63 @@ func NewKVConsumer(config *viper.Viper) (kvloader.KVConsumer, error) {
 			return nil, err
 		}
 		return builder.WithCoder(coder).Build(), nil
+	} else if c == "BitcaskKVConsumer" {
+		// {
+		// 	"class": "BitcaskKVConsumer",
+		// 	"directory": "bitcask/",
+		// 	"threadNum": 4,
+		// 	"batch": 1000,
+		// 	"maxFileSize": 268435456,
+		// 	"compressor": {
+		// 		"package": "mykv",
+		// 		"class": "Compressor"
+		// 	},
+		// 	"serializer": {
+		// 		"package": "mykv",
+		// 		"class": "Serializer"
+		// 	}
+		// }
+		compressor, err := NewCompressor(config.Sub("compressor"))
+		if err != nil {
+			return nil, err
+		}
+		serializer, err := NewSerializer(config.Sub("serializer"))
+		if err != nil {
+			return nil, err
+		}
+		builder := kvloader.NewBitcaskKVConsumerBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.WithCompressor(compressor).WithSerializer(serializer).Build(), nil
+	} else if c == "SnapshotKVConsumer" {
+		// {
+		// 	"class": "SnapshotKVConsumer",
+		// 	"filename": "data/snapshot/20180601.snapshot",
+		// 	"threadNum": 4,
+		// 	"memBytes": 268435456,
+		// 	"compressor": {
+		// 		"package": "mykv",
+		// 		"class": "Compressor"
+		// 	},
+		// 	"serializer": {
+		// 		"package": "mykv",
+		// 		"class": "Serializer"
+		// 	}
+		// }
+		compressor, err := NewCompressor(config.Sub("compressor"))
+		if err != nil {
+			return nil, err
+		}
+		serializer, err := NewSerializer(config.Sub("serializer"))
+		if err != nil {
+			return nil, err
+		}
+		builder := kvloader.NewSnapshotKVConsumerBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.WithCompressor(compressor).WithSerializer(serializer).Build(), nil
 	} else if c == "MemKVConsumer" {
 		return kvloader.NewMemKVConsumerBuilder().Build(), nil
 	}
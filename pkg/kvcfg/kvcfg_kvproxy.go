@@ -0,0 +1,54 @@
+package kvcfg
+
+import (
+	"os"
+
+	"github.com/hatlonely/kvclient/pkg/kvproxy"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// NewKVProxyWithFile create a new kv proxy use config file
+func NewKVProxyWithFile(filename string) (*kvproxy.Server, error) {
+	config := viper.New()
+	config.SetConfigType("json")
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.ReadConfig(fp); err != nil {
+		return nil, err
+	}
+
+	config.BindPFlags(pflag.CommandLine)
+	return NewKVProxy(config)
+}
+
+// NewKVProxy create a new kv proxy, the address is listened on
+func NewKVProxy(config *viper.Viper) (*kvproxy.Server, error) {
+	// {
+	// 	"address": ":6380",
+	// 	"maxConns": 10000,
+	// 	"idleTimeout": "5m",
+	// 	"shutdownTimeout": "30s",
+	// 	"verbose": true,
+	// 	"kvclient": {
+	// 		"caches": ["freecache", "aerospike"],
+	// 		...
+	// 	}
+	// }
+	builder := kvproxy.NewServerBuilder()
+	if err := config.Unmarshal(builder); err != nil {
+		return nil, err
+	}
+	kvclient, err := NewKVClient(config.Sub("kvclient"))
+	if err != nil {
+		return nil, err
+	}
+	server, err := builder.WithKVClient(kvclient).Build()
+	if err != nil {
+		kvclient.Close()
+		return nil, err
+	}
+	return server, nil
+}
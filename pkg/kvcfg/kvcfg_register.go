@@ -0,0 +1,77 @@
+package kvcfg
+
+import (
+	"sync"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/spf13/viper"
+)
+
+// classes implemented out of kvcfg register themselves in the init of their packages, so
+// that the dependencies of them are linked only into the programs importing the packages
+
+// CacheFactory create a cache from the section of a cache in a kvclient config
+type CacheFactory func(config *viper.Viper) (kvclient.Cache, error)
+
+// MetricsSinkFactory create a metrics sink from the metrics section of a kvclient config
+type MetricsSinkFactory func(config *viper.Viper) (kvclient.MetricsSink, error)
+
+// TracingHookFactory create a hook tracing the operations from the tracing section of a kvclient config
+type TracingHookFactory func(config *viper.Viper) (kvclient.Hook, error)
+
+var (
+	registerMutex        sync.RWMutex
+	cacheFactories       = map[string]CacheFactory{}
+	metricsSinkFactories = map[string]MetricsSinkFactory{}
+	tracingHookFactory   TracingHookFactory
+)
+
+// RegisterCache register a class of cache, panic if the class is registered twice
+func RegisterCache(class string, factory CacheFactory) {
+	registerMutex.Lock()
+	defer registerMutex.Unlock()
+	if _, ok := cacheFactories[class]; ok {
+		panic("kvcfg: RegisterCache called twice for class " + class)
+	}
+	cacheFactories[class] = factory
+}
+
+func cacheFactory(class string) (CacheFactory, bool) {
+	registerMutex.RLock()
+	defer registerMutex.RUnlock()
+	factory, ok := cacheFactories[class]
+	return factory, ok
+}
+
+// RegisterMetricsSink register a class of metrics sink, panic if the class is registered twice
+func RegisterMetricsSink(class string, factory MetricsSinkFactory) {
+	registerMutex.Lock()
+	defer registerMutex.Unlock()
+	if _, ok := metricsSinkFactories[class]; ok {
+		panic("kvcfg: RegisterMetricsSink called twice for class " + class)
+	}
+	metricsSinkFactories[class] = factory
+}
+
+func metricsSinkFactory(class string) (MetricsSinkFactory, bool) {
+	registerMutex.RLock()
+	defer registerMutex.RUnlock()
+	factory, ok := metricsSinkFactories[class]
+	return factory, ok
+}
+
+// RegisterTracingHook register the hook of the tracing section, panic if it is registered twice
+func RegisterTracingHook(factory TracingHookFactory) {
+	registerMutex.Lock()
+	defer registerMutex.Unlock()
+	if tracingHookFactory != nil {
+		panic("kvcfg: RegisterTracingHook called twice")
+	}
+	tracingHookFactory = factory
+}
+
+func registeredTracingHook() TracingHookFactory {
+	registerMutex.RLock()
+	defer registerMutex.RUnlock()
+	return tracingHookFactory
+}
@@ -0,0 +1,36 @@
+//go:build cgo
+// +build cgo
+
+package kvcfg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+// the sqlite driver registered by pkg/kvsql need cgo
+func TestNewCache_SQL(t *testing.T) {
+	Convey("test new sql cache", t, func() {
+		directory, err := ioutil.TempDir("", "kvcfg")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+
+		config := viper.New()
+		config.SetConfigFile("../../configs/kvbench/sqlite_bench.json")
+		So(config.ReadInConfig(), ShouldBeNil)
+		config = config.Sub("kvclient").Sub("sqlite")
+		config.Set("dsn", "file:"+filepath.Join(directory, "kvclient.db"))
+		cache, err := NewCache(config)
+		So(err, ShouldBeNil)
+		So(cache.Set("key1", []byte("val1")), ShouldBeNil)
+		val, err := cache.Get("key1")
+		So(err, ShouldBeNil)
+		So(val, ShouldResemble, []byte("val1"))
+		So(cache.Close(), ShouldBeNil)
+	})
+}
@@ -1,8 +1,19 @@
 package kvcfg
 
 import (
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	_ "github.com/hatlonely/kvclient/pkg/kvsql"
+	"github.com/hatlonely/kvclient/pkg/mykv"
+	"github.com/spf13/viper"
+
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -13,3 +24,231 @@ func TestNewKVClient(t *testing.T) {
 		So(client, ShouldNotBeNil)
 	})
 }
+
+func TestNewKVClient_Local(t *testing.T) {
+	Convey("test new kv client with local config", t, func() {
+		client, err := NewKVClientWithFile("../../configs/kvclient/local.json")
+		So(err, ShouldBeNil)
+		So(client, ShouldNotBeNil)
+
+		So(client.Set(&mykv.Key{Message: "key1"}, &mykv.Val{Message: "val1"}), ShouldBeNil)
+		val := &mykv.Val{}
+		ok, err := client.Get(&mykv.Key{Message: "key1"}, val)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		requests := expvar.Get(kvclient.MetricCacheRequests).(*expvar.Map)
+		So(requests.Get("class=Gcache,name=gcache,op=Get,result=hit,tier=0"), ShouldNotBeNil)
+		So(requests.Get("class=MapCache,name=mapcache,op=Set,result=ok,tier=1"), ShouldNotBeNil)
+		So(client.Close(), ShouldBeNil)
+	})
+}
+
+func TestNewKVClient_Faulty(t *testing.T) {
+	Convey("test new kv client with faulty cache", t, func() {
+		config := viper.New()
+		config.SetConfigFile("../../configs/kvbench/faulty_bench.json")
+		So(config.ReadInConfig(), ShouldBeNil)
+		client, err := NewKVClient(config.Sub("kvclient"))
+		So(err, ShouldBeNil)
+		So(client.Capabilities(), ShouldEqual, kvclient.CapAll)
+		So(client.Close(), ShouldBeNil)
+	})
+}
+
+func TestNewKVClient_TinyLFU(t *testing.T) {
+	Convey("test new kv client with tinylfu", t, func() {
+		config := viper.New()
+		config.SetConfigFile("../../configs/kvbench/tinylfu_bench.json")
+		So(config.ReadInConfig(), ShouldBeNil)
+		client, err := NewKVClient(config.Sub("kvclient"))
+		So(err, ShouldBeNil)
+		So(client.Capabilities(), ShouldEqual, kvclient.CapAll)
+		So(client.Close(), ShouldBeNil)
+	})
+}
+
+func TestNewCache_Embedded(t *testing.T) {
+	Convey("test new embedded caches", t, func() {
+		directory, err := ioutil.TempDir("", "kvcfg")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+
+		for _, item := range []struct {
+			filename string
+			name     string
+			option   string
+		}{
+			{"boltdb_bench.json", "boltdb", "filename"},
+			{"badger_bench.json", "badger", "directory"},
+			{"bitcask_bench.json", "bitcask", "directory"},
+		} {
+			config := viper.New()
+			config.SetConfigFile(filepath.Join("../../configs/kvbench", item.filename))
+			So(config.ReadInConfig(), ShouldBeNil)
+			config = config.Sub("kvclient").Sub(item.name)
+			config.Set(item.option, filepath.Join(directory, item.name))
+			cache, err := NewCache(config)
+			So(err, ShouldBeNil)
+			So(cache.Capabilities(), ShouldEqual, kvclient.CapAll)
+			So(cache.Set("key1", []byte("val1")), ShouldBeNil)
+			So(cache.Close(), ShouldBeNil)
+		}
+	})
+}
+
+func TestNewKVClient_Warmup(t *testing.T) {
+	Convey("test new kvclient with warmup", t, func() {
+		directory, err := ioutil.TempDir("", "kvcfg")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+		So(ioutil.WriteFile(filepath.Join(directory, "part-0"), []byte("key1\tval1\nkey2\tval2\n"), 0644), ShouldBeNil)
+
+		config := viper.New()
+		config.SetConfigType("json")
+		So(config.ReadConfig(strings.NewReader(fmt.Sprintf(`{
+			"caches": ["local"],
+			"compressor": {"package": "mykv", "class": "Compressor"},
+			"serializer": {"package": "mykv", "class": "Serializer"},
+			"local": {"class": "MapCache"},
+			"warmup": {
+				"threadNum": 2,
+				"timeout": "10s",
+				"val": {"package": "mykv", "class": "Val"},
+				"producer": {"class": "FileKVProducer", "directory": %q, "threadNum": 1, "coder": {"class": "MyKVCoder"}}
+			}
+		}`, directory))), ShouldBeNil)
+		client, err := NewKVClient(config)
+		So(err, ShouldBeNil)
+		defer client.Close()
+
+		val := &mykv.Val{}
+		ok, err := client.Get(&mykv.Key{Message: "key2"}, val)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(val.Message, ShouldEqual, "val2")
+	})
+}
+
+func TestNewKVClient_CloseOnError(t *testing.T) {
+	Convey("test new kvclient closes the caches built on errors", t, func() {
+		directory, err := ioutil.TempDir("", "kvcfg")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+
+		newConfig := func(content string) *viper.Viper {
+			config := viper.New()
+			config.SetConfigType("json")
+			So(config.ReadConfig(strings.NewReader(content)), ShouldBeNil)
+			return config
+		}
+		leveldb := fmt.Sprintf(`"leveldb": {"class": "LevelDB", "directory": %q}`, filepath.Join(directory, "leveldb"))
+
+		// a later cache fails
+		_, err = NewKVClient(newConfig(`{"caches": ["leveldb", "unknown"], ` + leveldb + `, "unknown": {"class": "Unknown"}}`))
+		So(err, ShouldNotBeNil)
+		// the client fails
+		_, err = NewKVClient(newConfig(`{"caches": ["leveldb"], "capabilities": ["Lock"], ` + leveldb + `}`))
+		So(err, ShouldNotBeNil)
+		// the warmup fails
+		_, err = NewKVClient(newConfig(fmt.Sprintf(`{"caches": ["leveldb"], `+leveldb+`, "warmup": {
+			"producer": {"class": "FileKVProducer", "directory": %q, "threadNum": 1, "coder": {"class": "MyKVCoder"}}
+		}}`, filepath.Join(directory, "missing"))))
+		So(err, ShouldNotBeNil)
+
+		// the leveldb is not locked by the clients failed
+		client, err := NewKVClient(newConfig(`{"caches": ["leveldb"], ` + leveldb + `}`))
+		So(err, ShouldBeNil)
+		So(client.Close(), ShouldBeNil)
+	})
+}
+
+func TestNewKVBenchmarker(t *testing.T) {
+	Convey("test new kv benchmarker without producer or replay", t, func() {
+		config := viper.New()
+		config.SetConfigType("json")
+		So(config.ReadConfig(strings.NewReader(`{
+			"kvclient": {
+				"caches": ["local"],
+				"local": {"class": "MapCache"}
+			}
+		}`)), ShouldBeNil)
+		_, err := NewKVBenchmarker(config)
+		So(err, ShouldNotBeNil)
+
+		config.Set("replay", map[string]interface{}{"filename": "trace.log"})
+		benchmarker, err := NewKVBenchmarker(config)
+		So(err, ShouldBeNil)
+		So(benchmarker, ShouldNotBeNil)
+	})
+}
+
+func TestNewKVProxy(t *testing.T) {
+	Convey("test new kv proxy", t, func() {
+		config := viper.New()
+		config.SetConfigType("json")
+		So(config.ReadConfig(strings.NewReader(`{
+			"address": "127.0.0.1:0",
+			"kvclient": {
+				"caches": ["local"],
+				"local": {"class": "MapCache"}
+			}
+		}`)), ShouldBeNil)
+		server, err := NewKVProxy(config)
+		So(err, ShouldBeNil)
+		So(server.Addr().String(), ShouldStartWith, "127.0.0.1:")
+		So(server.Close(), ShouldBeNil)
+	})
+}
+
+func TestNewKVCtl(t *testing.T) {
+	Convey("test new kvctl never dumps the local caches", t, func() {
+		directory, err := ioutil.TempDir("", "kvctl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+		filename := filepath.Join(directory, "kvclient.dump")
+
+		config := viper.New()
+		config.SetConfigType("json")
+		So(config.ReadConfig(strings.NewReader(fmt.Sprintf(`{
+			"format": "hex",
+			"caches": ["local"],
+			"local": {"class": "MapCache"},
+			"dumpFile": %q
+		}`, filename))), ShouldBeNil)
+		ctl, err := NewKVCtl(config)
+		So(err, ShouldBeNil)
+		So(ctl.Run([]string{"set", "key1", "76616c31"}), ShouldBeNil)
+		So(ctl.Close(), ShouldBeNil)
+		_, err = os.Stat(filename)
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		config.Set("format", "yaml")
+		_, err = NewKVCtl(config)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("test new kvctl never runs the warmup", t, func() {
+		directory, err := ioutil.TempDir("", "kvctl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+
+		// the producer fails on the directory not exists once it is called
+		config := viper.New()
+		config.SetConfigType("json")
+		So(config.ReadConfig(strings.NewReader(fmt.Sprintf(`{
+			"caches": ["local"],
+			"local": {"class": "MapCache"},
+			"warmup": {
+				"producer": {"class": "FileKVProducer", "directory": %q, "threadNum": 1, "coder": {"class": "MyKVCoder"}}
+			}
+		}`, filepath.Join(directory, "missing")))), ShouldBeNil)
+		_, err = NewKVClient(config)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "warmup failed")
+
+		ctl, err := NewKVCtl(config)
+		So(err, ShouldBeNil)
+		So(ctl.Close(), ShouldBeNil)
+		So(config.Sub("warmup"), ShouldNotBeNil)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/aerospike/aerospike-client-go"
+	"github.com/aerospike/aerospike-client-go/types"
 )
 
 // NewAerospikeBuilder create a builder
@@ -107,16 +108,24 @@ func (b *AerospikeBuilder) Build() (*Aerospike, error) {
 // Aerospike datasource
 type Aerospike struct {
 	client    *aerospike.Client
+	closer    Closer
 	rpolicy   *aerospike.BasePolicy
 	wpolicy   *aerospike.WritePolicy
 	namespace string
 	setname   string
 }
 
+// Capabilities supported operations
+func (as *Aerospike) Capabilities() Capability {
+	return CapAll
+}
+
 // Close aerospike
 func (as *Aerospike) Close() error {
-	as.client.Close()
-	return nil
+	return as.closer.Close(func() error {
+		as.client.Close()
+		return nil
+	})
 }
 
 // Get a key
@@ -171,10 +180,7 @@ func (as *Aerospike) SetEx(key string, val []byte, expiration time.Duration) err
 		return err
 	}
 
-	wpolicy := aerospike.NewWritePolicy(0, uint32(expiration)/uint32(time.Second))
-	wpolicy.BasePolicy.Timeout = as.wpolicy.BasePolicy.Timeout
-	wpolicy.BasePolicy.MaxRetries = as.wpolicy.BasePolicy.MaxRetries
-
+	wpolicy := as.newWritePolicy(uint32(expiration/time.Second), aerospike.UPDATE)
 	if err := as.client.PutBins(wpolicy, ak, aerospike.NewBin("", val)); err != nil {
 		return err
 	}
@@ -184,12 +190,39 @@ func (as *Aerospike) SetEx(key string, val []byte, expiration time.Duration) err
 
 // SetNx set if not exists
 func (as *Aerospike) SetNx(key string, val []byte) (bool, error) {
-	return SetNx(as, key, val)
+	return as.setNx(key, val, as.wpolicy.Expiration)
 }
 
 // SetExNx set if not exists with expiration
 func (as *Aerospike) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
-	return SetExNx(as, key, val, expiration)
+	return as.setNx(key, val, uint32(expiration/time.Second))
+}
+
+// setNx create the record only if it not exists, the server rejects the write atomically
+func (as *Aerospike) setNx(key string, val []byte, expiration uint32) (bool, error) {
+	ak, err := aerospike.NewKey(as.namespace, as.setname, key)
+	if err != nil {
+		return false, err
+	}
+
+	wpolicy := as.newWritePolicy(expiration, aerospike.CREATE_ONLY)
+	if err := as.client.PutBins(wpolicy, ak, aerospike.NewBin("", val)); err != nil {
+		if aerr, ok := err.(types.AerospikeError); ok && aerr.ResultCode() == types.KEY_EXISTS_ERROR {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// newWritePolicy write policy with the builder timeout and retries
+func (as *Aerospike) newWritePolicy(expiration uint32, action aerospike.RecordExistsAction) *aerospike.WritePolicy {
+	wpolicy := aerospike.NewWritePolicy(0, expiration)
+	wpolicy.RecordExistsAction = action
+	wpolicy.BasePolicy.Timeout = as.wpolicy.BasePolicy.Timeout
+	wpolicy.BasePolicy.MaxRetries = as.wpolicy.BasePolicy.MaxRetries
+	return wpolicy
 }
 
 // SetBatch keys vals
@@ -0,0 +1,305 @@
+package kvclient
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// NewBadgerBuilder create a new BadgerBuilder
+func NewBadgerBuilder() *BadgerBuilder {
+	return &BadgerBuilder{
+		Directory:      "badger/",
+		InMemory:       false,
+		SyncWrites:     false,
+		GCInterval:     time.Duration(10) * time.Minute,
+		GCDiscardRatio: 0.5,
+	}
+}
+
+// BadgerBuilder builder
+type BadgerBuilder struct {
+	Directory      string
+	InMemory       bool // keep everything in memory, directory is ignored
+	SyncWrites     bool
+	Expiration     time.Duration
+	GCInterval     time.Duration // interval of the value log garbage collection, 0 disable it
+	GCDiscardRatio float64       // value log files with more discardable data than the ratio are rewritten
+}
+
+// WithDirectory option
+func (b *BadgerBuilder) WithDirectory(directory string) *BadgerBuilder {
+	b.Directory = directory
+	return b
+}
+
+// WithInMemory option
+func (b *BadgerBuilder) WithInMemory(inMemory bool) *BadgerBuilder {
+	b.InMemory = inMemory
+	return b
+}
+
+// WithSyncWrites option
+func (b *BadgerBuilder) WithSyncWrites(syncWrites bool) *BadgerBuilder {
+	b.SyncWrites = syncWrites
+	return b
+}
+
+// WithExpiration option, default expiration of Set, 0 means never expire
+func (b *BadgerBuilder) WithExpiration(expiration time.Duration) *BadgerBuilder {
+	b.Expiration = expiration
+	return b
+}
+
+// WithGCInterval option
+func (b *BadgerBuilder) WithGCInterval(gcInterval time.Duration) *BadgerBuilder {
+	b.GCInterval = gcInterval
+	return b
+}
+
+// WithGCDiscardRatio option
+func (b *BadgerBuilder) WithGCDiscardRatio(gcDiscardRatio float64) *BadgerBuilder {
+	b.GCDiscardRatio = gcDiscardRatio
+	return b
+}
+
+// Build a new Badger
+func (b *BadgerBuilder) Build() (*Badger, error) {
+	if b.GCDiscardRatio <= 0 || b.GCDiscardRatio >= 1 {
+		return nil, fmt.Errorf("gc discard ratio [%v] should be in (0, 1)", b.GCDiscardRatio)
+	}
+
+	options := badger.DefaultOptions(b.Directory).
+		WithInMemory(b.InMemory).
+		WithSyncWrites(b.SyncWrites).
+		WithLoggingLevel(badger.WARNING)
+	if b.InMemory {
+		options = options.WithDir("").WithValueDir("")
+	}
+	db, err := badger.Open(options)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Badger{
+		db:         db,
+		expiration: b.Expiration,
+		done:       make(chan struct{}),
+	}
+
+	if b.GCInterval > 0 && !b.InMemory {
+		d.wg.Add(1)
+		go d.gcLoop(b.GCInterval, b.GCDiscardRatio)
+	}
+
+	return d, nil
+}
+
+// Badger datasource, expiration is the native ttl of badger which has a precision
+// of one second, keys live at most one second longer than their expiration
+type Badger struct {
+	BaseCache
+
+	db         *badger.DB
+	expiration time.Duration
+	done       chan struct{}
+	wg         sync.WaitGroup
+	closer     Closer
+}
+
+// Capabilities supported operations
+func (d *Badger) Capabilities() Capability {
+	return CapAll
+}
+
+// Close badger
+func (d *Badger) Close() error {
+	return d.closer.Close(func() error {
+		close(d.done)
+		d.wg.Wait()
+		return d.db.Close()
+	})
+}
+
+// entry of key val, the ttl is rounded up to whole seconds so that
+// a key never expires before its expiration
+func (d *Badger) entry(key string, val []byte, expiration time.Duration) *badger.Entry {
+	e := badger.NewEntry([]byte(key), val)
+	if expiration > 0 {
+		e = e.WithTTL(expiration + time.Second)
+	}
+	return e
+}
+
+// get key in txn, nil if not found or expired
+func (d *Badger) get(txn *badger.Txn, key string) ([]byte, error) {
+	item, err := txn.Get([]byte(key))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+// Get key
+func (d *Badger) Get(key string) ([]byte, error) {
+	var val []byte
+	err := d.db.View(func(txn *badger.Txn) error {
+		var err error
+		val, err = d.get(txn, key)
+		return err
+	})
+	return val, err
+}
+
+// Set key value
+func (d *Badger) Set(key string, val []byte) error {
+	return d.SetEx(key, val, d.expiration)
+}
+
+// SetEx set with expiration
+func (d *Badger) SetEx(key string, val []byte, expiration time.Duration) error {
+	return d.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(d.entry(key, val, expiration))
+	})
+}
+
+// Del key
+func (d *Badger) Del(key string) error {
+	return d.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+}
+
+// SetBatch keys vals with a write batch
+func (d *Badger) SetBatch(keys []string, vals [][]byte) ([]error, error) {
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keys), len(vals))
+	}
+
+	errs := make([]error, len(keys))
+	batch := d.db.NewWriteBatch()
+	defer batch.Cancel()
+	for i := range keys {
+		if err := batch.SetEntry(d.entry(keys[i], vals[i], d.expiration)); err != nil {
+			return errs, err
+		}
+	}
+
+	return errs, batch.Flush()
+}
+
+// SetNx set if not exist
+func (d *Badger) SetNx(key string, val []byte) (bool, error) {
+	return d.SetExNx(key, val, d.expiration)
+}
+
+// SetExNx set with expiration if not exist in a transaction, the transaction
+// is retried on conflict, then the key written by the other caller is found
+func (d *Badger) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	for {
+		ok := false
+		err := d.db.Update(func(txn *badger.Txn) error {
+			gval, err := d.get(txn, key)
+			if err != nil || gval != nil {
+				return err
+			}
+			ok = true
+			return txn.SetEntry(d.entry(key, val, expiration))
+		})
+		if err == badger.ErrConflict {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return ok, nil
+	}
+}
+
+// GetBatch keys in one transaction
+func (d *Badger) GetBatch(keys []string) ([][]byte, []error, error) {
+	vals := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	var err error
+	if verr := d.db.View(func(txn *badger.Txn) error {
+		for i := range keys {
+			vals[i], errs[i] = d.get(txn, keys[i])
+			if errs[i] != nil {
+				err = errs[i]
+			}
+		}
+		return nil
+	}); verr != nil {
+		return nil, nil, verr
+	}
+	return vals, errs, err
+}
+
+// gcLoop collect the garbage of the value log every interval until Close
+func (d *Badger) gcLoop(interval time.Duration, discardRatio float64) {
+	defer d.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			// each call rewrites at most one file, run until nothing to rewrite
+			for d.db.RunValueLogGC(discardRatio) == nil {
+			}
+		}
+	}
+}
+
+// badgerTTL time to live of item, 0 means never expire
+func badgerTTL(item *badger.Item) time.Duration {
+	if item.ExpiresAt() == 0 {
+		return 0
+	}
+	return time.Until(time.Unix(int64(item.ExpiresAt()), 0))
+}
+
+// Scan keys with prefix in order
+func (d *Badger) Scan(prefix string, fn func(key string, val []byte, ttl time.Duration) bool) error {
+	return d.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			item := iter.Item()
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if !fn(string(item.KeyCopy(nil)), val, badgerTTL(item)) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// TTL of key, 0 means never expire
+func (d *Badger) TTL(key string) (time.Duration, bool, error) {
+	var ttl time.Duration
+	found := false
+	err := d.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ttl, found = badgerTTL(item), true
+		return nil
+	})
+	return ttl, found, err
+}
@@ -1,6 +1,8 @@
 package kvclient
 
 import (
+	"encoding/binary"
+	"io"
 	"time"
 
 	"github.com/allegro/bigcache"
@@ -62,44 +64,70 @@ func (b *BigcacheBuilder) Build() (*Bigcache, error) {
 	}
 
 	return &Bigcache{
-		cache: cache,
+		cache:      cache,
+		expiration: b.Expiration,
 	}, nil
 }
 
-// Bigcache cache
+// Bigcache cache. an entry is the key followed by the value, the keys read by the bigcache
+// iterator are not safe to use, Snapshot reads them from the entries instead
 type Bigcache struct {
 	BaseCache
 
-	cache *bigcache.BigCache
+	cache      *bigcache.BigCache
+	expiration time.Duration
+	locker     keyLocker
+}
+
+// newBigcacheEntry uvarint length of key, key and val
+func newBigcacheEntry(key string, val []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64+len(key)+len(val))
+	n := binary.PutUvarint(buf, uint64(len(key)))
+	n += copy(buf[n:], key)
+	n += copy(buf[n:], val)
+	return buf[:n]
+}
+
+// parseBigcacheEntry key and val of entry, false if entry is corrupted
+func parseBigcacheEntry(entry []byte) (string, []byte, bool) {
+	length, n := binary.Uvarint(entry)
+	if n <= 0 || uint64(len(entry)-n) < length {
+		return "", nil, false
+	}
+	return string(entry[n : n+int(length)]), entry[n+int(length):], true
+}
+
+// Capabilities supported operations, expiration of a single key is not supported
+func (c *Bigcache) Capabilities() Capability {
+	return CapAll &^ (CapSetEx | CapSetExNx)
 }
 
 // Get key
 func (c *Bigcache) Get(key string) ([]byte, error) {
-	val, err := c.cache.Get(key)
+	entry, err := c.cache.Get(key)
 	if err != nil {
-		switch err.(type) {
-		case *bigcache.EntryNotFoundError:
+		if err == bigcache.ErrEntryNotFound {
 			return nil, nil
 		}
 		return nil, err
 	}
 
+	// a key of the same hash overwrites the entry
+	k, val, ok := parseBigcacheEntry(entry)
+	if !ok || k != key {
+		return nil, nil
+	}
 	return val, nil
 }
 
 // Set key value
 func (c *Bigcache) Set(key string, val []byte) error {
-	return c.cache.Set(key, val)
+	return c.cache.Set(key, newBigcacheEntry(key, val))
 }
 
 // Del key
 func (c *Bigcache) Del(key string) error {
-	err := c.cache.Delete(key)
-	if err != nil {
-		switch err.(type) {
-		case *bigcache.EntryNotFoundError:
-			return nil
-		}
+	if err := c.cache.Delete(key); err != nil && err != bigcache.ErrEntryNotFound {
 		return err
 	}
 	return nil
@@ -110,8 +138,9 @@ func (c *Bigcache) SetBatch(keys []string, vals [][]byte) ([]error, error) {
 	return SetBatch(c, keys, vals)
 }
 
-// SetNx set if not exist
+// SetNx set if not exist, atomic between SetNx callers
 func (c *Bigcache) SetNx(key string, val []byte) (bool, error) {
+	defer c.locker.Lock(key).Unlock()
 	return SetNx(c, key, val)
 }
 
@@ -119,3 +148,44 @@ func (c *Bigcache) SetNx(key string, val []byte) (bool, error) {
 func (c *Bigcache) GetBatch(keys []string) ([][]byte, []error, error) {
 	return GetBatch(c, keys)
 }
+
+// Snapshot write the keys not expired, a key expires the life window after it is set,
+// implement Snapshotter
+func (c *Bigcache) Snapshot(w io.Writer) error {
+	writer, err := newDumpWriter(w)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	it := c.cache.Iterator()
+	for it.SetNext() {
+		info, err := it.Value()
+		if err != nil {
+			// the entry is evicted during the iteration
+			continue
+		}
+		at := expireAt(time.Unix(int64(info.Timestamp()), 0), c.expiration)
+		if isExpired(at, now) {
+			continue
+		}
+		key, val, ok := parseBigcacheEntry(info.Value())
+		if !ok {
+			continue
+		}
+		if err := writer.write(key, val, at); err != nil {
+			return err
+		}
+	}
+	return writer.close()
+}
+
+// Restore keys written by Snapshot. bigcache has no expiration of a single key, restored
+// keys live a whole life window again, implement Snapshotter
+func (c *Bigcache) Restore(r io.Reader) error {
+	return readDump(r, time.Now(), func(key string, val []byte, expiration time.Duration) error {
+		if buf, err := c.Get(key); err != nil || buf != nil {
+			return err
+		}
+		return c.Set(key, val)
+	})
+}
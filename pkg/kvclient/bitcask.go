@@ -0,0 +1,819 @@
+package kvclient
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewBitcaskBuilder create a new BitcaskBuilder
+func NewBitcaskBuilder() *BitcaskBuilder {
+	return &BitcaskBuilder{
+		Directory:       "bitcask/",
+		MaxFileSize:     256 * 1024 * 1024,
+		SyncWrites:      false,
+		CompactInterval: time.Duration(10) * time.Minute,
+		CompactRatio:    0.5,
+		clock:           SystemClock{},
+	}
+}
+
+// BitcaskBuilder builder
+type BitcaskBuilder struct {
+	Directory       string
+	MaxFileSize     int64 // the active data file is sealed when it grows over the size
+	SyncWrites      bool  // fsync after every write
+	Expiration      time.Duration
+	CompactInterval time.Duration // interval to check the dead ratio, 0 disable the background compaction
+	CompactRatio    float64       // compact when dead bytes / total bytes is over the ratio
+
+	clock Clock
+}
+
+// WithDirectory option
+func (b *BitcaskBuilder) WithDirectory(directory string) *BitcaskBuilder {
+	b.Directory = directory
+	return b
+}
+
+// WithMaxFileSize option
+func (b *BitcaskBuilder) WithMaxFileSize(maxFileSize int64) *BitcaskBuilder {
+	b.MaxFileSize = maxFileSize
+	return b
+}
+
+// WithSyncWrites option
+func (b *BitcaskBuilder) WithSyncWrites(syncWrites bool) *BitcaskBuilder {
+	b.SyncWrites = syncWrites
+	return b
+}
+
+// WithExpiration option, default expiration of Set, 0 means never expire
+func (b *BitcaskBuilder) WithExpiration(expiration time.Duration) *BitcaskBuilder {
+	b.Expiration = expiration
+	return b
+}
+
+// WithCompactInterval option
+func (b *BitcaskBuilder) WithCompactInterval(compactInterval time.Duration) *BitcaskBuilder {
+	b.CompactInterval = compactInterval
+	return b
+}
+
+// WithCompactRatio option
+func (b *BitcaskBuilder) WithCompactRatio(compactRatio float64) *BitcaskBuilder {
+	b.CompactRatio = compactRatio
+	return b
+}
+
+// WithClock option, the clock to decide expiration
+func (b *BitcaskBuilder) WithClock(clock Clock) *BitcaskBuilder {
+	b.clock = clock
+	return b
+}
+
+// Build a new Bitcask, the data files in the directory are loaded from their hint
+// files, or replayed if there is no hint file. a torn record at the end of the last
+// data file, left by a crash, is truncated
+func (b *BitcaskBuilder) Build() (*Bitcask, error) {
+	if b.MaxFileSize <= bitcaskHeaderLen {
+		return nil, fmt.Errorf("max file size [%v] is too small", b.MaxFileSize)
+	}
+	if err := os.MkdirAll(b.Directory, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &Bitcask{
+		directory:   b.Directory,
+		maxFileSize: b.MaxFileSize,
+		syncWrites:  b.SyncWrites,
+		expiration:  b.Expiration,
+		clock:       b.clock,
+		files:       map[uint32]*bitcaskFile{},
+		index:       map[string]bitcaskEntry{},
+		done:        make(chan struct{}),
+	}
+	if err := c.load(); err != nil {
+		c.closeFiles()
+		return nil, err
+	}
+
+	if b.CompactInterval > 0 {
+		c.wg.Add(1)
+		go c.compactLoop(b.CompactInterval, b.CompactRatio)
+	}
+
+	return c, nil
+}
+
+// record: crc32 | expireAt int64 | keyLen uint32 | valLen uint32 | key | val,
+// crc32 covers the rest of the record, valLen of a tombstone is MaxUint32
+const bitcaskHeaderLen = 20
+
+// hint: expireAt int64 | keyLen uint32 | size uint32 | offset int64 | key,
+// size 0 means a tombstone. a hint file ends with the crc32 of its content
+const bitcaskHintHeaderLen = 24
+
+const bitcaskTombstone = math.MaxUint32
+
+// bitcaskEntry position of the latest record of a key
+type bitcaskEntry struct {
+	fileID   uint32
+	offset   int64
+	size     uint32 // size of the whole record
+	expireAt int64
+}
+
+// bitcaskHint an entry of a hint file
+type bitcaskHint struct {
+	key   string
+	entry bitcaskEntry // size 0 means a tombstone
+}
+
+// bitcaskFile a data file, sealed files are read only and memory mapped
+type bitcaskFile struct {
+	id    uint32
+	file  *os.File
+	data  []byte // memory map of a sealed file
+	size  int64
+	hints []bitcaskHint // hints of the active file, written when sealed
+}
+
+// readAt read n bytes at offset into a new slice
+func (f *bitcaskFile) readAt(offset int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if f.data != nil {
+		copy(buf, f.data[offset:offset+int64(n)])
+		return buf, nil
+	}
+	_, err := f.file.ReadAt(buf, offset)
+	return buf, err
+}
+
+// Bitcask datasource, an append only log of data files with an in memory index of
+// the latest record of each key. sealed data files are read with memory maps. records
+// of overwritten, deleted and expired keys are dead until the files are compacted.
+// a directory should be opened by one Bitcask only
+type Bitcask struct {
+	BaseCache
+
+	mutex       sync.RWMutex
+	directory   string
+	maxFileSize int64
+	syncWrites  bool
+	expiration  time.Duration
+	clock       Clock
+	files       map[uint32]*bitcaskFile
+	active      *bitcaskFile
+	index       map[string]bitcaskEntry
+	totalBytes  int64
+	deadBytes   int64
+	done        chan struct{}
+	wg          sync.WaitGroup
+	closer      Closer
+}
+
+// Capabilities supported operations
+func (c *Bitcask) Capabilities() Capability {
+	return CapAll
+}
+
+// Close write the hint of the active file and close the data files
+func (c *Bitcask) Close() error {
+	return c.closer.Close(func() error {
+		close(c.done)
+		c.wg.Wait()
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		err := c.sealActive()
+		if cerr := c.closeFiles(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+}
+
+func (c *Bitcask) dataPath(id uint32) string {
+	return filepath.Join(c.directory, fmt.Sprintf("%09d.data", id))
+}
+
+func (c *Bitcask) hintPath(id uint32) string {
+	return filepath.Join(c.directory, fmt.Sprintf("%09d.hint", id))
+}
+
+// load the data files in the directory, then open a new active file
+func (c *Bitcask) load() error {
+	names, err := filepath.Glob(filepath.Join(c.directory, "*.data"))
+	if err != nil {
+		return err
+	}
+	var ids []uint32
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), ".data"), 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint32(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for i, id := range ids {
+		if err := c.loadFile(id, i == len(ids)-1); err != nil {
+			return err
+		}
+	}
+
+	next := uint32(1)
+	if len(ids) != 0 {
+		next = ids[len(ids)-1] + 1
+	}
+	return c.openActive(next)
+}
+
+// loadFile load the index of a sealed data file, from the hint file if it is valid
+func (c *Bitcask) loadFile(id uint32, last bool) error {
+	hints, err := c.readHints(id)
+	if err != nil {
+		if hints, err = c.replay(id, last); err != nil {
+			return err
+		}
+		if err := c.writeHints(id, hints); err != nil {
+			return err
+		}
+	}
+
+	fp, err := os.Open(c.dataPath(id))
+	if err != nil {
+		return err
+	}
+	info, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return err
+	}
+	f := &bitcaskFile{id: id, file: fp, size: info.Size()}
+	if f.data, err = mmapFile(fp, f.size); err != nil {
+		fp.Close()
+		return err
+	}
+	c.files[id] = f
+
+	for _, hint := range hints {
+		c.apply(hint.key, hint.entry)
+	}
+	return nil
+}
+
+// apply a record to the index and the dead bytes
+func (c *Bitcask) apply(key string, entry bitcaskEntry) {
+	size := int64(entry.size)
+	if entry.size == 0 {
+		size = int64(bitcaskHeaderLen + len(key))
+	}
+	c.totalBytes += size
+	if old, ok := c.index[key]; ok {
+		c.deadBytes += int64(old.size)
+	}
+	if entry.size == 0 {
+		delete(c.index, key)
+		c.deadBytes += size
+		return
+	}
+	c.index[key] = entry
+}
+
+// replay the records of a data file, a torn or corrupted tail of the last file is truncated
+func (c *Bitcask) replay(id uint32, last bool) ([]bitcaskHint, error) {
+	fp, err := os.OpenFile(c.dataPath(id), os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	var hints []bitcaskHint
+	reader := bufio.NewReaderSize(fp, 1024*1024)
+	header := make([]byte, bitcaskHeaderLen)
+	offset := int64(0)
+	for {
+		if _, err := io.ReadFull(reader, header); err == io.EOF {
+			return hints, nil
+		} else if err != nil {
+			return hints, c.truncate(fp, id, offset, last, err)
+		}
+		expireAt := int64(binary.BigEndian.Uint64(header[4:]))
+		keyLen := binary.BigEndian.Uint32(header[12:])
+		valLen := binary.BigEndian.Uint32(header[16:])
+		bodyLen := int64(keyLen)
+		if valLen != bitcaskTombstone {
+			bodyLen += int64(valLen)
+		}
+		if bodyLen > c.maxFileSize {
+			return hints, c.truncate(fp, id, offset, last, fmt.Errorf("record size [%v] is too large", bodyLen))
+		}
+		body := make([]byte, bodyLen)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return hints, c.truncate(fp, id, offset, last, err)
+		}
+		crc := crc32.NewIEEE()
+		crc.Write(header[4:])
+		crc.Write(body)
+		if crc.Sum32() != binary.BigEndian.Uint32(header) {
+			return hints, c.truncate(fp, id, offset, last, fmt.Errorf("crc mismatch"))
+		}
+
+		size := uint32(bitcaskHeaderLen + bodyLen)
+		if valLen == bitcaskTombstone {
+			size = 0
+		}
+		hints = append(hints, bitcaskHint{
+			key:   string(body[:keyLen]),
+			entry: bitcaskEntry{fileID: id, offset: offset, size: size, expireAt: expireAt},
+		})
+		offset += bitcaskHeaderLen + bodyLen
+	}
+}
+
+// truncate the data file at offset, only the last file may have a torn tail
+func (c *Bitcask) truncate(fp *os.File, id uint32, offset int64, last bool, cause error) error {
+	if !last {
+		return fmt.Errorf("data file [%v] is corrupted at [%v]: %v", c.dataPath(id), offset, cause)
+	}
+	return fp.Truncate(offset)
+}
+
+// readHints read a hint file, an error if it does not exist or it is corrupted
+func (c *Bitcask) readHints(id uint32) ([]bitcaskHint, error) {
+	buf, err := ioutil.ReadFile(c.hintPath(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 4 || crc32.ChecksumIEEE(buf[:len(buf)-4]) != binary.BigEndian.Uint32(buf[len(buf)-4:]) {
+		return nil, fmt.Errorf("hint file [%v] is corrupted", c.hintPath(id))
+	}
+
+	var hints []bitcaskHint
+	buf = buf[:len(buf)-4]
+	for len(buf) > 0 {
+		if len(buf) < bitcaskHintHeaderLen {
+			return nil, fmt.Errorf("hint file [%v] is corrupted", c.hintPath(id))
+		}
+		keyLen := int(binary.BigEndian.Uint32(buf[8:]))
+		if len(buf) < bitcaskHintHeaderLen+keyLen {
+			return nil, fmt.Errorf("hint file [%v] is corrupted", c.hintPath(id))
+		}
+		hints = append(hints, bitcaskHint{
+			key: string(buf[bitcaskHintHeaderLen : bitcaskHintHeaderLen+keyLen]),
+			entry: bitcaskEntry{
+				fileID:   id,
+				expireAt: int64(binary.BigEndian.Uint64(buf)),
+				size:     binary.BigEndian.Uint32(buf[12:]),
+				offset:   int64(binary.BigEndian.Uint64(buf[16:])),
+			},
+		})
+		buf = buf[bitcaskHintHeaderLen+keyLen:]
+	}
+	return hints, nil
+}
+
+// writeHints write a hint file through a temporary file, so that a hint file is always complete
+func (c *Bitcask) writeHints(id uint32, hints []bitcaskHint) error {
+	n := 4
+	for _, hint := range hints {
+		n += bitcaskHintHeaderLen + len(hint.key)
+	}
+	buf := make([]byte, 0, n)
+	header := make([]byte, bitcaskHintHeaderLen)
+	for _, hint := range hints {
+		binary.BigEndian.PutUint64(header, uint64(hint.entry.expireAt))
+		binary.BigEndian.PutUint32(header[8:], uint32(len(hint.key)))
+		binary.BigEndian.PutUint32(header[12:], hint.entry.size)
+		binary.BigEndian.PutUint64(header[16:], uint64(hint.entry.offset))
+		buf = append(buf, header...)
+		buf = append(buf, hint.key...)
+	}
+	buf = buf[:len(buf)+4]
+	binary.BigEndian.PutUint32(buf[len(buf)-4:], crc32.ChecksumIEEE(buf[:len(buf)-4]))
+
+	tmp := c.hintPath(id) + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.hintPath(id))
+}
+
+// openActive create a new active data file
+func (c *Bitcask) openActive(id uint32) error {
+	fp, err := os.OpenFile(c.dataPath(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	c.active = &bitcaskFile{id: id, file: fp}
+	c.files[id] = c.active
+	return nil
+}
+
+// sealActive sync the active file, write its hint file and map it, an empty active file is removed
+func (c *Bitcask) sealActive() error {
+	f := c.active
+	if f == nil {
+		return nil
+	}
+	c.active = nil
+	if f.size == 0 {
+		delete(c.files, f.id)
+		f.file.Close()
+		return os.Remove(c.dataPath(f.id))
+	}
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	if err := c.writeHints(f.id, f.hints); err != nil {
+		return err
+	}
+	f.hints = nil
+	data, err := mmapFile(f.file, f.size)
+	if err != nil {
+		return err
+	}
+	f.data = data
+	return nil
+}
+
+// closeFiles unmap and close all the data files
+func (c *Bitcask) closeFiles() error {
+	var err error
+	for id, f := range c.files {
+		if f.data != nil {
+			if uerr := munmapFile(f.data); err == nil {
+				err = uerr
+			}
+		}
+		if cerr := f.file.Close(); err == nil {
+			err = cerr
+		}
+		delete(c.files, id)
+	}
+	return err
+}
+
+// encode a record, val nil with tombstone true encodes a tombstone
+func encodeBitcaskRecord(key string, val []byte, expireAt int64, tombstone bool) []byte {
+	buf := make([]byte, bitcaskHeaderLen+len(key)+len(val))
+	binary.BigEndian.PutUint64(buf[4:], uint64(expireAt))
+	binary.BigEndian.PutUint32(buf[12:], uint32(len(key)))
+	if tombstone {
+		binary.BigEndian.PutUint32(buf[16:], bitcaskTombstone)
+	} else {
+		binary.BigEndian.PutUint32(buf[16:], uint32(len(val)))
+	}
+	copy(buf[bitcaskHeaderLen:], key)
+	copy(buf[bitcaskHeaderLen+len(key):], val)
+	binary.BigEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+// bitcaskWrite a record to append
+type bitcaskWrite struct {
+	key       string
+	val       []byte
+	expireAt  int64
+	tombstone bool
+}
+
+// write append records to the active file and update the index, the caller holds the lock.
+// the records are written with one write unless the active file is sealed in between
+func (c *Bitcask) write(writes []bitcaskWrite) error {
+	if c.active == nil {
+		return fmt.Errorf("no active data file in [%v]", c.directory)
+	}
+	var buf []byte
+	var hints []bitcaskHint
+	flush := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+		if _, err := c.active.file.WriteAt(buf, c.active.size); err != nil {
+			return err
+		}
+		if c.syncWrites {
+			if err := c.active.file.Sync(); err != nil {
+				return err
+			}
+		}
+		c.active.size += int64(len(buf))
+		for _, hint := range hints {
+			c.apply(hint.key, hint.entry)
+		}
+		c.active.hints = append(c.active.hints, hints...)
+		buf, hints = buf[:0], hints[:0]
+		return nil
+	}
+
+	for _, w := range writes {
+		record := encodeBitcaskRecord(w.key, w.val, w.expireAt, w.tombstone)
+		if int64(len(record)) > c.maxFileSize {
+			return fmt.Errorf("record of key [%v] is larger than max file size [%v]", w.key, c.maxFileSize)
+		}
+		if c.active.size+int64(len(buf)+len(record)) > c.maxFileSize {
+			if err := flush(); err != nil {
+				return err
+			}
+			if c.active.size != 0 {
+				id := c.active.id
+				if err := c.sealActive(); err != nil {
+					return err
+				}
+				if err := c.openActive(id + 1); err != nil {
+					return err
+				}
+			}
+		}
+		size := uint32(len(record))
+		if w.tombstone {
+			size = 0
+		}
+		hints = append(hints, bitcaskHint{key: w.key, entry: bitcaskEntry{
+			fileID: c.active.id, offset: c.active.size + int64(len(buf)), size: size, expireAt: w.expireAt,
+		}})
+		buf = append(buf, record...)
+	}
+	return flush()
+}
+
+// get the live value of key, the caller holds the lock
+func (c *Bitcask) get(key string, now time.Time) ([]byte, error) {
+	entry, ok := c.index[key]
+	if !ok || isExpired(entry.expireAt, now) {
+		return nil, nil
+	}
+	offset := entry.offset + bitcaskHeaderLen + int64(len(key))
+	return c.files[entry.fileID].readAt(offset, int(entry.size)-bitcaskHeaderLen-len(key))
+}
+
+// Get key
+func (c *Bitcask) Get(key string) ([]byte, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.get(key, c.clock.Now())
+}
+
+// GetBatch keys
+func (c *Bitcask) GetBatch(keys []string) ([][]byte, []error, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	vals := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	var err error
+	now := c.clock.Now()
+	for i := range keys {
+		vals[i], errs[i] = c.get(keys[i], now)
+		if errs[i] != nil {
+			err = errs[i]
+		}
+	}
+	return vals, errs, err
+}
+
+// Set key value
+func (c *Bitcask) Set(key string, val []byte) error {
+	return c.SetEx(key, val, c.expiration)
+}
+
+// SetEx set with expiration
+func (c *Bitcask) SetEx(key string, val []byte, expiration time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.write([]bitcaskWrite{{key: key, val: val, expireAt: expireAt(c.clock.Now(), expiration)}})
+}
+
+// Del key, a tombstone is appended if the key exists
+func (c *Bitcask) Del(key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.index[key]; !ok {
+		return nil
+	}
+	return c.write([]bitcaskWrite{{key: key, tombstone: true}})
+}
+
+// SetBatch keys vals with one append, the way to bulk import
+func (c *Bitcask) SetBatch(keys []string, vals [][]byte) ([]error, error) {
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keys), len(vals))
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	writes := make([]bitcaskWrite, len(keys))
+	at := expireAt(c.clock.Now(), c.expiration)
+	for i := range keys {
+		writes[i] = bitcaskWrite{key: keys[i], val: vals[i], expireAt: at}
+	}
+	return make([]error, len(keys)), c.write(writes)
+}
+
+// SetNx set if not exist
+func (c *Bitcask) SetNx(key string, val []byte) (bool, error) {
+	return c.SetExNx(key, val, c.expiration)
+}
+
+// SetExNx set with expiration if not exist, writes are serialized by the lock
+func (c *Bitcask) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := c.clock.Now()
+	if entry, ok := c.index[key]; ok && !isExpired(entry.expireAt, now) {
+		return false, nil
+	}
+	if err := c.write([]bitcaskWrite{{key: key, val: val, expireAt: expireAt(now, expiration)}}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Sync the active file to disk
+func (c *Bitcask) Sync() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.active == nil {
+		return fmt.Errorf("no active data file in [%v]", c.directory)
+	}
+	return c.active.file.Sync()
+}
+
+// Len number of keys in the index, expired keys included until compacted
+func (c *Bitcask) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.index)
+}
+
+// DeadRatio dead bytes / total bytes of the data files
+func (c *Bitcask) DeadRatio() float64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.totalBytes == 0 {
+		return 0
+	}
+	return float64(c.deadBytes) / float64(c.totalBytes)
+}
+
+// compactLoop compact every interval if the dead ratio is over the ratio, until Close
+func (c *Bitcask) compactLoop(interval time.Duration, ratio float64) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if c.DeadRatio() >= ratio {
+				c.Compact()
+			}
+		}
+	}
+}
+
+// Compact rewrite the live records into new data files and remove the old ones.
+// reads and writes are blocked until done. old files are removed in the order they
+// were written, so that a crash in between never brings back deleted keys
+func (c *Bitcask) Compact() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.sealActive(); err != nil {
+		return err
+	}
+	var olds []uint32
+	next := uint32(1)
+	for id := range c.files {
+		olds = append(olds, id)
+		if id >= next {
+			next = id + 1
+		}
+	}
+	sort.Slice(olds, func(i, j int) bool { return olds[i] < olds[j] })
+
+	keys := make([]string, 0, len(c.index))
+	for key := range c.index {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ei, ej := c.index[keys[i]], c.index[keys[j]]
+		return ei.fileID < ej.fileID || ei.fileID == ej.fileID && ei.offset < ej.offset
+	})
+
+	// the index is rebuilt by the writes of the live records
+	index, files := c.index, c.files
+	c.index, c.files = map[string]bitcaskEntry{}, map[uint32]*bitcaskFile{}
+	c.totalBytes, c.deadBytes = 0, 0
+	restore := func(err error) error {
+		for _, f := range c.files {
+			if f.data != nil {
+				munmapFile(f.data)
+			}
+			f.file.Close()
+			os.Remove(c.dataPath(f.id))
+			os.Remove(c.hintPath(f.id))
+		}
+		c.index, c.files, c.active = index, files, nil
+		if oerr := c.openActive(next); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+	if err := c.openActive(next); err != nil {
+		c.index, c.files = index, files
+		return err
+	}
+
+	now := c.clock.Now()
+	for _, key := range keys {
+		entry := index[key]
+		if isExpired(entry.expireAt, now) {
+			continue
+		}
+		offset := entry.offset + bitcaskHeaderLen + int64(len(key))
+		val, err := files[entry.fileID].readAt(offset, int(entry.size)-bitcaskHeaderLen-len(key))
+		if err != nil {
+			return restore(err)
+		}
+		if err := c.write([]bitcaskWrite{{key: key, val: val, expireAt: entry.expireAt}}); err != nil {
+			return restore(err)
+		}
+	}
+	id := c.active.id
+	if err := c.sealActive(); err != nil {
+		return restore(err)
+	}
+
+	for _, old := range olds {
+		f := files[old]
+		if f.data != nil {
+			munmapFile(f.data)
+		}
+		f.file.Close()
+		if err := os.Remove(c.dataPath(old)); err != nil {
+			return err
+		}
+		os.Remove(c.hintPath(old))
+	}
+
+	return c.openActive(id + 1)
+}
+
+// Scan keys with prefix in order, the values are read without holding the lock during fn
+func (c *Bitcask) Scan(prefix string, fn func(key string, val []byte, ttl time.Duration) bool) error {
+	c.mutex.RLock()
+	var keys []string
+	for key := range c.index {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	c.mutex.RUnlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		c.mutex.RLock()
+		now := c.clock.Now()
+		entry := c.index[key]
+		val, err := c.get(key, now)
+		c.mutex.RUnlock()
+		if err != nil {
+			return err
+		}
+		// deleted or expired since listed
+		if val == nil {
+			continue
+		}
+		if !fn(key, val, timeToLive(entry.expireAt, now)) {
+			break
+		}
+	}
+	return nil
+}
+
+// TTL of key, 0 means never expire
+func (c *Bitcask) TTL(key string) (time.Duration, bool, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	now := c.clock.Now()
+	entry, ok := c.index[key]
+	if !ok || isExpired(entry.expireAt, now) {
+		return 0, false, nil
+	}
+	return timeToLive(entry.expireAt, now), true, nil
+}
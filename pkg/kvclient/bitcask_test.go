@@ -0,0 +1,137 @@
+package kvclient_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBitcask(t *testing.T) {
+	directory, err := ioutil.TempDir("", "bitcask")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		subdir, err := ioutil.TempDir(directory, "")
+		if err != nil {
+			return nil, err
+		}
+		return kvclient.NewBitcaskBuilder().WithDirectory(subdir).WithMaxFileSize(4096).Build()
+	})
+
+	Convey("test bitcask", t, func() {
+		subdir, err := ioutil.TempDir(directory, "")
+		So(err, ShouldBeNil)
+		clock := kvclienttest.NewFakeClock(time.Unix(1500000000, 0))
+		builder := kvclient.NewBitcaskBuilder().WithDirectory(subdir).WithMaxFileSize(1024).WithClock(clock)
+		cache, err := builder.Build()
+		So(err, ShouldBeNil)
+
+		key := func(i int) string { return fmt.Sprintf("key%03d", i) }
+		val := func(i, n int) []byte { return []byte(fmt.Sprintf("val%03d-%v", i, n)) }
+		check := func(cache *kvclient.Bitcask, n int) {
+			for i := 0; i < 100; i++ {
+				v, err := cache.Get(key(i))
+				So(err, ShouldBeNil)
+				if i%10 == 0 {
+					So(v, ShouldBeNil)
+				} else {
+					So(v, ShouldResemble, val(i, n))
+				}
+			}
+		}
+		for n := 0; n < 3; n++ {
+			for i := 0; i < 100; i++ {
+				So(cache.Set(key(i), val(i, n)), ShouldBeNil)
+			}
+		}
+		for i := 0; i < 100; i += 10 {
+			So(cache.Del(key(i)), ShouldBeNil)
+		}
+		So(cache.SetEx("expired", []byte("val"), time.Minute), ShouldBeNil)
+		clock.Add(time.Minute)
+		check(cache, 2)
+
+		Convey("reopen from hint files", func() {
+			So(cache.Close(), ShouldBeNil)
+			hints, err := filepath.Glob(filepath.Join(subdir, "*.hint"))
+			So(err, ShouldBeNil)
+			So(len(hints), ShouldBeGreaterThan, 1)
+
+			cache, err = builder.Build()
+			So(err, ShouldBeNil)
+			defer cache.Close()
+			check(cache, 2)
+			v, err := cache.Get("expired")
+			So(err, ShouldBeNil)
+			So(v, ShouldBeNil)
+		})
+
+		Convey("recover from a crash by replaying the log", func() {
+			// copy the files as if the process crashed, with a torn record at the end
+			So(cache.Sync(), ShouldBeNil)
+			crashed, err := ioutil.TempDir(directory, "")
+			So(err, ShouldBeNil)
+			datas, err := filepath.Glob(filepath.Join(subdir, "*.data"))
+			So(err, ShouldBeNil)
+			for _, data := range datas {
+				buf, err := ioutil.ReadFile(data)
+				So(err, ShouldBeNil)
+				if data == datas[len(datas)-1] {
+					buf = append(buf, 0x01, 0x02, 0x03)
+				}
+				So(ioutil.WriteFile(filepath.Join(crashed, filepath.Base(data)), buf, 0644), ShouldBeNil)
+			}
+			So(cache.Close(), ShouldBeNil)
+
+			recovered, err := kvclient.NewBitcaskBuilder().WithDirectory(crashed).WithMaxFileSize(1024).WithClock(clock).Build()
+			So(err, ShouldBeNil)
+			check(recovered, 2)
+			So(recovered.Set(key(1), val(1, 3)), ShouldBeNil)
+			So(recovered.Close(), ShouldBeNil)
+
+			recovered, err = kvclient.NewBitcaskBuilder().WithDirectory(crashed).WithMaxFileSize(1024).WithClock(clock).Build()
+			So(err, ShouldBeNil)
+			defer recovered.Close()
+			v, err := recovered.Get(key(1))
+			So(err, ShouldBeNil)
+			So(v, ShouldResemble, val(1, 3))
+		})
+
+		Convey("compact the dead records", func() {
+			So(cache.DeadRatio(), ShouldBeGreaterThan, 0.6)
+			datas, err := filepath.Glob(filepath.Join(subdir, "*.data"))
+			So(err, ShouldBeNil)
+			So(cache.Compact(), ShouldBeNil)
+			So(cache.DeadRatio(), ShouldEqual, 0)
+			check(cache, 2)
+			compacted, err := filepath.Glob(filepath.Join(subdir, "*.data"))
+			So(err, ShouldBeNil)
+			So(len(compacted), ShouldBeLessThan, len(datas))
+
+			So(cache.Set(key(1), val(1, 3)), ShouldBeNil)
+			So(cache.Close(), ShouldBeNil)
+			cache, err = builder.Build()
+			So(err, ShouldBeNil)
+			defer cache.Close()
+			v, err := cache.Get(key(1))
+			So(err, ShouldBeNil)
+			So(v, ShouldResemble, val(1, 3))
+			v, err = cache.Get(key(2))
+			So(err, ShouldBeNil)
+			So(v, ShouldResemble, val(2, 2))
+			v, err = cache.Get(key(10))
+			So(err, ShouldBeNil)
+			So(v, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,376 @@
+package kvclient
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// NewBoltDBBuilder create a new BoltDBBuilder
+func NewBoltDBBuilder() *BoltDBBuilder {
+	return &BoltDBBuilder{
+		Filename:      "bolt.db",
+		Namespace:     "kvclient",
+		Timeout:       time.Duration(1) * time.Second,
+		NoSync:        false,
+		SweepInterval: time.Duration(10) * time.Minute,
+		SweepBatch:    1000,
+	}
+}
+
+// BoltDBBuilder builder
+type BoltDBBuilder struct {
+	Filename      string
+	Namespace     string        // bucket of the keys, caches of different namespaces can share a file
+	Timeout       time.Duration // timeout to wait for the file lock, 0 means wait forever
+	NoSync        bool          // skip fsync after commit, faster but may lose data on crash
+	Expiration    time.Duration
+	SweepInterval time.Duration
+	SweepBatch    int
+}
+
+// WithFilename option
+func (b *BoltDBBuilder) WithFilename(filename string) *BoltDBBuilder {
+	b.Filename = filename
+	return b
+}
+
+// WithNamespace option
+func (b *BoltDBBuilder) WithNamespace(namespace string) *BoltDBBuilder {
+	b.Namespace = namespace
+	return b
+}
+
+// WithTimeout option
+func (b *BoltDBBuilder) WithTimeout(timeout time.Duration) *BoltDBBuilder {
+	b.Timeout = timeout
+	return b
+}
+
+// WithNoSync option
+func (b *BoltDBBuilder) WithNoSync(noSync bool) *BoltDBBuilder {
+	b.NoSync = noSync
+	return b
+}
+
+// WithExpiration option, default expiration of Set, 0 means never expire
+func (b *BoltDBBuilder) WithExpiration(expiration time.Duration) *BoltDBBuilder {
+	b.Expiration = expiration
+	return b
+}
+
+// WithSweepInterval option, interval of the background sweeper which deletes
+// expired keys, 0 disable the sweeper
+func (b *BoltDBBuilder) WithSweepInterval(sweepInterval time.Duration) *BoltDBBuilder {
+	b.SweepInterval = sweepInterval
+	return b
+}
+
+// WithSweepBatch option, max keys deleted by the sweeper in one transaction
+func (b *BoltDBBuilder) WithSweepBatch(sweepBatch int) *BoltDBBuilder {
+	b.SweepBatch = sweepBatch
+	return b
+}
+
+// Build a new BoltDB
+func (b *BoltDBBuilder) Build() (*BoltDB, error) {
+	if b.Namespace == "" {
+		return nil, fmt.Errorf("namespace should not be empty")
+	}
+	if b.SweepBatch <= 0 {
+		return nil, fmt.Errorf("sweep batch should be positive, got [%v]", b.SweepBatch)
+	}
+
+	db, err := bolt.Open(b.Filename, 0644, &bolt.Options{Timeout: b.Timeout, NoSync: b.NoSync})
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := []byte(b.Namespace)
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	d := &BoltDB{
+		db:         db,
+		bucket:     bucket,
+		expiration: b.Expiration,
+		sweepBatch: b.SweepBatch,
+		done:       make(chan struct{}),
+	}
+
+	if b.SweepInterval > 0 {
+		d.wg.Add(1)
+		go d.sweepLoop(b.SweepInterval)
+	}
+
+	return d, nil
+}
+
+// BoltDB datasource, keys of a namespace are stored in one bucket. values are stored
+// with the expire header of LevelDB, expired keys are taken as not found and deleted
+// by the background sweeper
+type BoltDB struct {
+	BaseCache
+
+	db         *bolt.DB
+	bucket     []byte
+	expiration time.Duration
+	sweepBatch int
+	done       chan struct{}
+	wg         sync.WaitGroup
+	closer     Closer
+}
+
+// Capabilities supported operations
+func (d *BoltDB) Capabilities() Capability {
+	return CapAll
+}
+
+// Close boltdb
+func (d *BoltDB) Close() error {
+	return d.closer.Close(func() error {
+		close(d.done)
+		d.wg.Wait()
+		return d.db.Close()
+	})
+}
+
+// get key in tx, the value is copied out of the memory map
+func (d *BoltDB) get(tx *bolt.Tx, key string, now time.Time) []byte {
+	buf := tx.Bucket(d.bucket).Get([]byte(key))
+	if buf == nil {
+		return nil
+	}
+	val, expireAt := decodeExpire(buf)
+	if isExpired(expireAt, now) {
+		return nil
+	}
+	return append([]byte{}, val...)
+}
+
+// Get key
+func (d *BoltDB) Get(key string) ([]byte, error) {
+	var val []byte
+	err := d.db.View(func(tx *bolt.Tx) error {
+		val = d.get(tx, key, time.Now())
+		return nil
+	})
+	return val, err
+}
+
+// Set key value
+func (d *BoltDB) Set(key string, val []byte) error {
+	return d.SetEx(key, val, d.expiration)
+}
+
+// SetEx set with expiration
+func (d *BoltDB) SetEx(key string, val []byte, expiration time.Duration) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(d.bucket).Put([]byte(key), encodeExpire(val, expireAt(time.Now(), expiration)))
+	})
+}
+
+// Del key
+func (d *BoltDB) Del(key string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(d.bucket).Delete([]byte(key))
+	})
+}
+
+// SetBatch keys vals in one transaction
+func (d *BoltDB) SetBatch(keys []string, vals [][]byte) ([]error, error) {
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keys), len(vals))
+	}
+
+	errs := make([]error, len(keys))
+	at := expireAt(time.Now(), d.expiration)
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(d.bucket)
+		for i := range keys {
+			if err := bucket.Put([]byte(keys[i]), encodeExpire(vals[i], at)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return errs, err
+}
+
+// SetNx set if not exist, write transactions of bolt are serialized
+func (d *BoltDB) SetNx(key string, val []byte) (bool, error) {
+	return d.SetExNx(key, val, d.expiration)
+}
+
+// SetExNx set with expiration if not exist, write transactions of bolt are serialized
+func (d *BoltDB) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	ok := false
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		now := time.Now()
+		if d.get(tx, key, now) != nil {
+			return nil
+		}
+		ok = true
+		return tx.Bucket(d.bucket).Put([]byte(key), encodeExpire(val, expireAt(now, expiration)))
+	})
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// GetBatch keys in one transaction
+func (d *BoltDB) GetBatch(keys []string) ([][]byte, []error, error) {
+	vals := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	err := d.db.View(func(tx *bolt.Tx) error {
+		now := time.Now()
+		for i := range keys {
+			vals[i] = d.get(tx, keys[i], now)
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return vals, errs, err
+}
+
+// sweepLoop run Sweep every interval until Close
+func (d *BoltDB) sweepLoop(interval time.Duration) {
+	defer d.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.Sweep()
+		}
+	}
+}
+
+// Sweep delete expired keys, return the number of deleted keys
+func (d *BoltDB) Sweep() (int, error) {
+	total := 0
+	var start []byte
+	for {
+		keys, next, err := d.expiredKeys(start)
+		if err != nil {
+			return total, err
+		}
+		n, err := d.deleteExpired(keys)
+		total += n
+		if err != nil || next == nil {
+			return total, err
+		}
+		start = next
+	}
+}
+
+// expiredKeys scan from start in a read transaction, collect at most sweepBatch
+// expired keys, next is the key to continue with, nil if the scan is done
+func (d *BoltDB) expiredKeys(start []byte) ([][]byte, []byte, error) {
+	var keys [][]byte
+	var next []byte
+	err := d.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(d.bucket).Cursor()
+		now := time.Now()
+		k, v := cursor.First()
+		if start != nil {
+			k, v = cursor.Seek(start)
+		}
+		for ; k != nil; k, v = cursor.Next() {
+			if len(keys) >= d.sweepBatch {
+				next = append([]byte{}, k...)
+				return nil
+			}
+			if _, expireAt := decodeExpire(v); isExpired(expireAt, now) {
+				keys = append(keys, append([]byte{}, k...))
+			}
+		}
+		return nil
+	})
+	return keys, next, err
+}
+
+// deleteExpired delete keys which are still expired in a write transaction,
+// so that a key set again after the scan is kept
+func (d *BoltDB) deleteExpired(keys [][]byte) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	n := 0
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(d.bucket)
+		now := time.Now()
+		for _, key := range keys {
+			buf := bucket.Get(key)
+			if buf == nil {
+				continue
+			}
+			if _, expireAt := decodeExpire(buf); !isExpired(expireAt, now) {
+				continue
+			}
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// Scan keys with prefix in order, fn is called in a read transaction
+func (d *BoltDB) Scan(prefix string, fn func(key string, val []byte, ttl time.Duration) bool) error {
+	return d.db.View(func(tx *bolt.Tx) error {
+		now := time.Now()
+		cursor := tx.Bucket(d.bucket).Cursor()
+		for k, v := cursor.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = cursor.Next() {
+			val, expireAt := decodeExpire(v)
+			if isExpired(expireAt, now) {
+				continue
+			}
+			if !fn(string(k), append([]byte{}, val...), timeToLive(expireAt, now)) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// TTL of key, 0 means never expire
+func (d *BoltDB) TTL(key string) (time.Duration, bool, error) {
+	var ttl time.Duration
+	found := false
+	err := d.db.View(func(tx *bolt.Tx) error {
+		buf := tx.Bucket(d.bucket).Get([]byte(key))
+		if buf == nil {
+			return nil
+		}
+		now := time.Now()
+		if _, expireAt := decodeExpire(buf); !isExpired(expireAt, now) {
+			ttl, found = timeToLive(expireAt, now), true
+		}
+		return nil
+	})
+	return ttl, found, err
+}
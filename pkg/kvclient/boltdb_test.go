@@ -0,0 +1,72 @@
+package kvclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltDB(t *testing.T) {
+	Convey("test boltdb", t, func() {
+		directory, err := ioutil.TempDir("", "boltdb")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+		filename := filepath.Join(directory, "bolt.db")
+
+		Convey("namespaces of a file are separated", func() {
+			users, err := NewBoltDBBuilder().WithFilename(filename).WithNamespace("users").Build()
+			So(err, ShouldBeNil)
+			So(users.Set("key1", []byte("user1")), ShouldBeNil)
+			So(users.Close(), ShouldBeNil)
+
+			items, err := NewBoltDBBuilder().WithFilename(filename).WithNamespace("items").Build()
+			So(err, ShouldBeNil)
+			val, err := items.Get("key1")
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+			So(items.Set("key1", []byte("item1")), ShouldBeNil)
+			So(items.Close(), ShouldBeNil)
+
+			users, err = NewBoltDBBuilder().WithFilename(filename).WithNamespace("users").Build()
+			So(err, ShouldBeNil)
+			defer users.Close()
+			val, err = users.Get("key1")
+			So(err, ShouldBeNil)
+			So(val, ShouldResemble, []byte("user1"))
+		})
+
+		Convey("sweep batch should be positive", func() {
+			_, err := NewBoltDBBuilder().WithFilename(filename).WithSweepBatch(0).Build()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("expired keys are deleted by the sweeper", func() {
+			boltDB, err := NewBoltDBBuilder().
+				WithFilename(filename).
+				WithSweepInterval(time.Duration(20) * time.Millisecond).
+				WithSweepBatch(1).
+				Build()
+			So(err, ShouldBeNil)
+			defer boltDB.Close()
+
+			So(boltDB.SetEx("key1", []byte("val1"), time.Duration(10)*time.Millisecond), ShouldBeNil)
+			So(boltDB.SetEx("key2", []byte("val2"), time.Duration(10)*time.Millisecond), ShouldBeNil)
+			So(boltDB.Set("key3", []byte("val3")), ShouldBeNil)
+
+			time.Sleep(time.Duration(100) * time.Millisecond)
+			var keys []string
+			So(boltDB.db.View(func(tx *bolt.Tx) error {
+				return tx.Bucket(boltDB.bucket).ForEach(func(k, v []byte) error {
+					keys = append(keys, string(k))
+					return nil
+				})
+			}), ShouldBeNil)
+			So(keys, ShouldResemble, []string{"key3"})
+		})
+	})
+}
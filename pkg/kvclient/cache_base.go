@@ -2,10 +2,13 @@ package kvclient
 
 import (
 	"fmt"
+	"hash/fnv"
+	"sync"
 	"time"
 )
 
-// BaseCache cache base not implememt
+// BaseCache cache base, every operation returns ErrNotSupported
+// embed it and override the operations the cache supports
 type BaseCache struct{}
 
 // Close cache
@@ -15,37 +18,42 @@ func (c *BaseCache) Close() error {
 
 // Get key
 func (c *BaseCache) Get(key string) ([]byte, error) {
-	panic("not implememt")
+	return nil, &ErrNotSupported{Capability: CapGet}
 }
 
 // Set key value
 func (c *BaseCache) Set(key string, val []byte) error {
-	panic("not implement")
+	return &ErrNotSupported{Capability: CapSet}
 }
 
 // Del key
 func (c *BaseCache) Del(key string) error {
-	panic("not implement")
+	return &ErrNotSupported{Capability: CapDel}
+}
+
+// GetBatch keys
+func (c *BaseCache) GetBatch(keys []string) ([][]byte, []error, error) {
+	return nil, nil, &ErrNotSupported{Capability: CapGetBatch}
 }
 
 // SetBatch keys values
 func (c *BaseCache) SetBatch(keys []string, vals [][]byte) ([]error, error) {
-	panic("not implememt")
+	return nil, &ErrNotSupported{Capability: CapSetBatch}
 }
 
 // SetEx set key with expiration
 func (c *BaseCache) SetEx(key string, val []byte, expiration time.Duration) error {
-	panic("not implememt")
+	return &ErrNotSupported{Capability: CapSetEx}
 }
 
 // SetNx set if not exist
 func (c *BaseCache) SetNx(key string, val []byte) (bool, error) {
-	panic("not implememt")
+	return false, &ErrNotSupported{Capability: CapSetNx}
 }
 
 // SetExNx set with expiration if not exist
 func (c *BaseCache) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
-	panic("not implememt")
+	return false, &ErrNotSupported{Capability: CapSetExNx}
 }
 
 // GetBatch get keys
@@ -108,3 +116,32 @@ func SetExNx(c Cache, key string, val []byte, expiration time.Duration) (bool, e
 
 	return true, c.SetEx(key, val, expiration)
 }
+
+// keyLocker striped mutexes, serialize check-and-set operations on the same key
+// for caches that have no native atomic set if not exists
+type keyLocker struct {
+	mutexes [256]sync.Mutex
+}
+
+// Lock the stripe of the key, return the locked mutex
+func (l *keyLocker) Lock(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	m := &l.mutexes[h.Sum32()%uint32(len(l.mutexes))]
+	m.Lock()
+	return m
+}
+
+// Closer make Close idempotent, later calls return the result of the first call
+type Closer struct {
+	once sync.Once
+	err  error
+}
+
+// Close call fn only once
+func (c *Closer) Close(fn func() error) error {
+	c.once.Do(func() {
+		c.err = fn()
+	})
+	return c.err
+}
@@ -2,75 +2,103 @@ package kvclient
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+// liveBackends tests of redis, aerospike and memcache need live servers,
+// set KVCLIENT_TEST_LIVE to run them
+func liveBackends() bool {
+	return os.Getenv("KVCLIENT_TEST_LIVE") != ""
+}
+
 func TestCache_All(t *testing.T) {
 	Convey("test cache all", t, func() {
 		var caches1 []Cache
 		var caches2 []Cache
 
-		rch, err := NewRedisClusterHashBuilder().
-			WithAddress("127.0.0.1:7002").
-			WithRetries(3).
-			WithTimeout(time.Duration(240)*time.Millisecond).
-			WithPoolSize(15).
-			WithKeyIdxLen(8, 7).
-			Build()
-		So(err, ShouldBeNil)
-		defer rch.Close()
-		caches1 = append(caches1, rch)
-
-		rcs, err := NewRedisClusterStringBuilder().
-			WithAddress("127.0.0.1:7002").
-			WithRetries(3).
-			WithTimeout(time.Duration(240) * time.Millisecond).
-			WithExpiration(time.Duration(1) * time.Second).
-			WithPoolSize(15).
-			Build()
-		So(err, ShouldBeNil)
-		defer rcs.Close()
-		caches1 = append(caches1, rcs)
-		caches2 = append(caches2, rcs)
-
-		rs, err := NewRedisStringBuilder().
-			WithAddress("127.0.0.1:6379").
-			WithRetries(3).
-			WithTimeout(time.Duration(240) * time.Millisecond).
-			WithExpiration(time.Duration(1) * time.Second).
-			WithPoolSize(15).
-			Build()
-		So(err, ShouldBeNil)
-		defer rs.Close()
-		caches1 = append(caches1, rs)
-		caches2 = append(caches2, rs)
-
-		rh, err := NewRedisHashBuilder().
-			WithAddress("127.0.0.1:6379").
-			WithRetries(3).
-			WithTimeout(time.Duration(240)*time.Millisecond).
-			WithPoolSize(15).
-			WithKeyIdxLen(8, 7).
-			Build()
-		So(err, ShouldBeNil)
-		defer rh.Close()
-		caches1 = append(caches1, rh)
-
-		aerospike, err := NewAerospikeBuilder().
-			WithAddress("127.0.0.1:3000").
-			WithNamespace("dmp").
-			WithSetName("dsp").
-			WithTimeout(time.Duration(200) * time.Millisecond).
-			WithRetries(4).
-			WithExpiration(time.Duration(200) * time.Second).
-			Build()
+		if liveBackends() {
+			rch, err := NewRedisClusterHashBuilder().
+				WithAddress("127.0.0.1:7002").
+				WithRetries(3).
+				WithTimeout(time.Duration(240)*time.Millisecond).
+				WithPoolSize(15).
+				WithKeyIdxLen(8, 7).
+				Build()
+			So(err, ShouldBeNil)
+			defer rch.Close()
+			caches1 = append(caches1, rch)
+
+			rcs, err := NewRedisClusterStringBuilder().
+				WithAddress("127.0.0.1:7002").
+				WithRetries(3).
+				WithTimeout(time.Duration(240) * time.Millisecond).
+				WithExpiration(time.Duration(1) * time.Second).
+				WithPoolSize(15).
+				Build()
+			So(err, ShouldBeNil)
+			defer rcs.Close()
+			caches1 = append(caches1, rcs)
+			caches2 = append(caches2, rcs)
+
+			rs, err := NewRedisStringBuilder().
+				WithAddress("127.0.0.1:6379").
+				WithRetries(3).
+				WithTimeout(time.Duration(240) * time.Millisecond).
+				WithExpiration(time.Duration(1) * time.Second).
+				WithPoolSize(15).
+				Build()
+			So(err, ShouldBeNil)
+			defer rs.Close()
+			caches1 = append(caches1, rs)
+			caches2 = append(caches2, rs)
+
+			rh, err := NewRedisHashBuilder().
+				WithAddress("127.0.0.1:6379").
+				WithRetries(3).
+				WithTimeout(time.Duration(240)*time.Millisecond).
+				WithPoolSize(15).
+				WithKeyIdxLen(8, 7).
+				Build()
+			So(err, ShouldBeNil)
+			defer rh.Close()
+			caches1 = append(caches1, rh)
+
+			aerospike, err := NewAerospikeBuilder().
+				WithAddress("127.0.0.1:3000").
+				WithNamespace("dmp").
+				WithSetName("dsp").
+				WithTimeout(time.Duration(200) * time.Millisecond).
+				WithRetries(4).
+				WithExpiration(time.Duration(200) * time.Second).
+				Build()
+			So(err, ShouldBeNil)
+			defer aerospike.Close()
+			caches1 = append(caches1, aerospike)
+			caches2 = append(caches2, aerospike)
+
+			memcache := NewMemcacheBuilder().Build()
+			defer memcache.Close()
+			caches1 = append(caches1, memcache)
+			caches2 = append(caches2, memcache)
+		}
+
+		mapCache := NewMapCacheBuilder().Build()
+		defer mapCache.Close()
+		caches1 = append(caches1, mapCache)
+		caches2 = append(caches2, mapCache)
+
+		tinyLFU, err := NewTinyLFUBuilder().Build()
 		So(err, ShouldBeNil)
-		defer aerospike.Close()
-		caches1 = append(caches1, aerospike)
-		caches2 = append(caches2, aerospike)
+		defer tinyLFU.Close()
+		caches1 = append(caches1, tinyLFU)
+		caches2 = append(caches2, tinyLFU)
 
 		gcache := NewGcacheBuilder().Build()
 		defer gcache.Close()
@@ -82,11 +110,6 @@ func TestCache_All(t *testing.T) {
 		defer levelDB.Close()
 		caches1 = append(caches1, levelDB)
 
-		memcache := NewMemcacheBuilder().Build()
-		defer memcache.Close()
-		caches1 = append(caches1, memcache)
-		caches2 = append(caches2, memcache)
-
 		freecache := NewFreecacheBuilder().Build()
 		defer freecache.Close()
 		caches1 = append(caches1, freecache)
@@ -101,7 +124,7 @@ func TestCache_All(t *testing.T) {
 			Convey(fmt.Sprintf("loop-%v: get a key that not exists", i), func() {
 				val, err := cache.Get("name")
 				So(err, ShouldEqual, nil)
-				So(val, ShouldEqual, nil)
+				So(val, ShouldBeNil)
 			})
 
 			Convey(fmt.Sprintf("loop-%v: set a key", i), func() {
@@ -121,7 +144,7 @@ func TestCache_All(t *testing.T) {
 					Convey(fmt.Sprintf("loop-%v: get the key again，it's not exists", i), func() {
 						val, err := cache.Get("name")
 						So(err, ShouldEqual, nil)
-						So(val, ShouldEqual, nil)
+						So(val, ShouldBeNil)
 					})
 				})
 			})
@@ -157,6 +180,17 @@ func TestCache_All(t *testing.T) {
 				})
 			})
 
+			Convey(fmt.Sprintf("loop-%v: get batch with a missing key", i), func() {
+				So(cache.Set("key5", []byte("val5")), ShouldBeNil)
+				So(cache.Set("key7", []byte("val7")), ShouldBeNil)
+				So(cache.Del("key6"), ShouldBeNil)
+
+				vals, errs, err := cache.GetBatch([]string{"key7", "key6", "key5"})
+				So(err, ShouldBeNil)
+				So(errs, ShouldResemble, []error{nil, nil, nil})
+				So(vals, ShouldResemble, [][]byte{[]byte("val7"), nil, []byte("val5")})
+			})
+
 			Convey(fmt.Sprintf("loop-%v: set if not exists", i), func() {
 				So(cache.Del("key4"), ShouldBeNil)
 
@@ -185,3 +219,56 @@ func TestCache_All(t *testing.T) {
 		}
 	})
 }
+
+func TestCache_SetNxConcurrent(t *testing.T) {
+	Convey("test set if not exists concurrently", t, func() {
+		directory, err := ioutil.TempDir("", "leveldb")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+
+		levelDB, err := NewLevelDBBuilder().WithDirectory(directory).Build()
+		So(err, ShouldBeNil)
+		defer levelDB.Close()
+
+		bigcache, err := NewBigcacheBuilder().Build()
+		So(err, ShouldBeNil)
+		defer bigcache.Close()
+
+		tinyLFU, err := NewTinyLFUBuilder().Build()
+		So(err, ShouldBeNil)
+
+		caches := []Cache{
+			NewMapCacheBuilder().Build(),
+			tinyLFU,
+			NewGcacheBuilder().Build(),
+			NewFreecacheBuilder().WithMemBytes(1024 * 1024).Build(),
+			bigcache,
+			levelDB,
+		}
+
+		for i, cache := range caches {
+			Convey(fmt.Sprintf("loop-%v: only one caller wins", i), func() {
+				So(cache.Del("lock"), ShouldBeNil)
+
+				var wg sync.WaitGroup
+				var wins int64
+				start := make(chan struct{})
+				for j := 0; j < 256; j++ {
+					wg.Add(1)
+					go func(j int) {
+						defer wg.Done()
+						<-start
+						ok, err := cache.SetNx("lock", []byte(fmt.Sprintf("owner-%v", j)))
+						if err == nil && ok {
+							atomic.AddInt64(&wins, 1)
+						}
+					}(j)
+				}
+				close(start)
+				wg.Wait()
+
+				So(wins, ShouldEqual, 1)
+			})
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package kvclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capability operations supported by a cache, combined as bit flags
+type Capability uint32
+
+// capabilities of Cache operations
+const (
+	CapGet Capability = 1 << iota
+	CapGetBatch
+	CapSet
+	CapDel
+	CapSetBatch
+	CapSetEx
+	CapSetNx
+	CapSetExNx
+
+	// CapAll all operations of Cache
+	CapAll = CapGet | CapGetBatch | CapSet | CapDel | CapSetBatch | CapSetEx | CapSetNx | CapSetExNx
+)
+
+var capabilityNames = []struct {
+	capability Capability
+	name       string
+}{
+	{CapGet, "Get"},
+	{CapGetBatch, "GetBatch"},
+	{CapSet, "Set"},
+	{CapDel, "Del"},
+	{CapSetBatch, "SetBatch"},
+	{CapSetEx, "SetEx"},
+	{CapSetNx, "SetNx"},
+	{CapSetExNx, "SetExNx"},
+}
+
+// Has return true if c contains all of capabilities
+func (c Capability) Has(capabilities Capability) bool {
+	return c&capabilities == capabilities
+}
+
+// String names joined by "|"
+func (c Capability) String() string {
+	var names []string
+	for _, cn := range capabilityNames {
+		if c.Has(cn.capability) {
+			names = append(names, cn.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// ParseCapabilities parse operation names such as ["Get", "SetEx"]
+func ParseCapabilities(names []string) (Capability, error) {
+	var c Capability
+	for _, name := range names {
+		found := false
+		for _, cn := range capabilityNames {
+			if strings.EqualFold(cn.name, name) {
+				c |= cn.capability
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("no capability named [%v]", name)
+		}
+	}
+	return c, nil
+}
+
+// ErrNotSupported returned by a cache for an operation it does not support
+type ErrNotSupported struct {
+	Capability Capability
+}
+
+// Error message
+func (e *ErrNotSupported) Error() string {
+	return fmt.Sprintf("operation [%v] not supported", e.Capability)
+}
+
+// IsNotSupported return true if err is an ErrNotSupported
+func IsNotSupported(err error) bool {
+	_, ok := err.(*ErrNotSupported)
+	return ok
+}
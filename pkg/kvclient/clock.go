@@ -0,0 +1,16 @@
+package kvclient
+
+import "time"
+
+// Clock source of the current time, inject a fake clock to control expiration in tests
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock the real clock
+type SystemClock struct{}
+
+// Now current time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,31 @@
+package kvclient
+
+import (
+	"fmt"
+)
+
+// BytesCompressor keys are strings used as they are, such as the keys of kvproxy and kvserver
+type BytesCompressor struct{}
+
+// Compress key
+func (BytesCompressor) Compress(key interface{}) string {
+	return key.(string)
+}
+
+// BytesSerializer values are []byte stored as they are, Unmarshal into a *[]byte
+type BytesSerializer struct{}
+
+// Marshal val
+func (BytesSerializer) Marshal(val interface{}) ([]byte, error) {
+	return val.([]byte), nil
+}
+
+// Unmarshal val
+func (BytesSerializer) Unmarshal(buf []byte, val interface{}) error {
+	pv, ok := val.(*[]byte)
+	if !ok {
+		return fmt.Errorf("val [%v] is not a type of *[]byte", val)
+	}
+	*pv = append((*pv)[:0], buf...)
+	return nil
+}
@@ -0,0 +1,102 @@
+package kvclient_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+)
+
+func TestConformance_Local(t *testing.T) {
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewMapCacheBuilder().Build(), nil
+	})
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewGcacheBuilder().Build(), nil
+	})
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewFreecacheBuilder().WithMemBytes(1024 * 1024).Build(), nil
+	})
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewBigcacheBuilder().Build()
+	})
+
+	directory, err := ioutil.TempDir("", "leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		// a leveldb directory can only be opened once, each check gets its own
+		subdir, err := ioutil.TempDir(directory, "")
+		if err != nil {
+			return nil, err
+		}
+		return kvclient.NewLevelDBBuilder().WithDirectory(subdir).Build()
+	})
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		subdir, err := ioutil.TempDir(directory, "")
+		if err != nil {
+			return nil, err
+		}
+		return kvclient.NewBadgerBuilder().WithDirectory(subdir).Build()
+	})
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewBadgerBuilder().WithInMemory(true).Build()
+	})
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		subdir, err := ioutil.TempDir(directory, "")
+		if err != nil {
+			return nil, err
+		}
+		return kvclient.NewBoltDBBuilder().WithFilename(filepath.Join(subdir, "bolt.db")).Build()
+	})
+}
+
+func TestConformance_Redis(t *testing.T) {
+	server, err := kvclienttest.NewRedisServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	timeout := time.Duration(1) * time.Second
+
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewRedisStringBuilder().WithAddress(server.Addr()).WithTimeout(timeout).Build()
+	})
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewRedisHashBuilder().WithAddress(server.Addr()).WithTimeout(timeout).Build()
+	})
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewRedisClusterStringBuilder().WithAddress(server.Addr()).WithTimeout(timeout).Build()
+	})
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewRedisClusterHashBuilder().WithAddress(server.Addr()).WithTimeout(timeout).Build()
+	})
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewRedisTrackingBuilder().WithAddress(server.Addr()).WithTimeout(timeout).Build()
+	})
+	// RedisHash with field ttl runs lua scripts, which the stand-in server does not support,
+	// and miniredis does not run them atomically, see redis_hash_ttl_test.go instead
+}
+
+func TestConformance_Aerospike(t *testing.T) {
+	// needs a live aerospike, the same as the other tests of live backends
+	if os.Getenv("KVCLIENT_TEST_LIVE") == "" {
+		t.Skip("set KVCLIENT_TEST_LIVE to run it")
+	}
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewAerospikeBuilder().
+			WithAddress("127.0.0.1:3000").
+			WithNamespace("dmp").
+			WithSetName("dsp").
+			WithTimeout(time.Duration(200) * time.Millisecond).
+			WithRetries(4).
+			WithExpiration(time.Duration(200) * time.Second).
+			Build()
+	})
+}
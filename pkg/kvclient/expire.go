@@ -0,0 +1,52 @@
+package kvclient
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// expireMagic marks a value which carries an expire header. values without the
+// header are legacy values written before the header existed, they never expire
+var expireMagic = []byte{0xff, 'k', 'v', 0x01}
+
+// expireHeaderLen magic + expire time in unix milliseconds (big endian uint64)
+const expireHeaderLen = 12
+
+// encodeExpire prepend the expire header to val, expireAt 0 means never expire
+func encodeExpire(val []byte, expireAt int64) []byte {
+	buf := make([]byte, expireHeaderLen+len(val))
+	copy(buf, expireMagic)
+	binary.BigEndian.PutUint64(buf[len(expireMagic):], uint64(expireAt))
+	copy(buf[expireHeaderLen:], val)
+	return buf
+}
+
+// decodeExpire split buf into val and expire time, legacy values return expireAt 0
+func decodeExpire(buf []byte) ([]byte, int64) {
+	if len(buf) < expireHeaderLen || !bytes.Equal(buf[:len(expireMagic)], expireMagic) {
+		return buf, 0
+	}
+	return buf[expireHeaderLen:], int64(binary.BigEndian.Uint64(buf[len(expireMagic):]))
+}
+
+// expireAt expire time in unix milliseconds, 0 if expiration is not positive
+func expireAt(now time.Time, expiration time.Duration) int64 {
+	if expiration <= 0 {
+		return 0
+	}
+	return now.Add(expiration).UnixNano() / int64(time.Millisecond)
+}
+
+// isExpired check expireAt which come from expireAt/decodeExpire
+func isExpired(expireAt int64, now time.Time) bool {
+	return expireAt != 0 && expireAt <= now.UnixNano()/int64(time.Millisecond)
+}
+
+// timeToLive time left of expireAt, 0 if never expire
+func timeToLive(expireAt int64, now time.Time) time.Duration {
+	if expireAt == 0 {
+		return 0
+	}
+	return time.Duration(expireAt-now.UnixNano()/int64(time.Millisecond)) * time.Millisecond
+}
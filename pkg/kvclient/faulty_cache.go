@@ -0,0 +1,417 @@
+package kvclient
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewFaultyCacheBuilder create a new FaultyCache builder
+func NewFaultyCacheBuilder() *FaultyCacheBuilder {
+	return &FaultyCacheBuilder{
+		Seed: 1,
+	}
+}
+
+// FaultyCacheBuilder builder
+type FaultyCacheBuilder struct {
+	Seed       int64
+	Default    Fault            // faults of operations not in Operations
+	Operations map[string]Fault // faults by operation name, such as "Get", "SetBatch", case insensitive
+
+	cache Cache
+}
+
+// Fault faults injected into an operation, rates are probabilities in [0, 1]
+type Fault struct {
+	Latency     Latency       // extra latency before calling the cache
+	ErrorRate   float64       // fail without calling the cache
+	TimeoutRate float64       // call the cache, sleep Timeout, then fail. writes may be applied as a real timeout
+	Timeout     time.Duration // latency before a timeout
+	DropRate    float64       // writes only, succeed without calling the cache
+	PartialRate float64       // batch operations only, each key fails alone
+}
+
+// Latency distribution of the extra latency
+type Latency struct {
+	Distribution string        // one of "fixed", "uniform", "normal", "exponential", empty means no latency
+	Min          time.Duration // uniform lower bound
+	Max          time.Duration // uniform upper bound, cap of normal and exponential if not 0
+	Mean         time.Duration // fixed latency, mean of normal and exponential
+	StdDev       time.Duration // standard deviation of normal
+}
+
+// WithSeed option, runs with the same seed and the same sequence of calls inject the same faults
+func (b *FaultyCacheBuilder) WithSeed(seed int64) *FaultyCacheBuilder {
+	b.Seed = seed
+	return b
+}
+
+// WithDefault option
+func (b *FaultyCacheBuilder) WithDefault(fault Fault) *FaultyCacheBuilder {
+	b.Default = fault
+	return b
+}
+
+// WithOperation option, faults of the operation, such as "Get"
+func (b *FaultyCacheBuilder) WithOperation(name string, fault Fault) *FaultyCacheBuilder {
+	if b.Operations == nil {
+		b.Operations = map[string]Fault{}
+	}
+	b.Operations[name] = fault
+	return b
+}
+
+// WithCache option, the cache to inject faults into
+func (b *FaultyCacheBuilder) WithCache(cache Cache) *FaultyCacheBuilder {
+	b.cache = cache
+	return b
+}
+
+// Build a new FaultyCache
+func (b *FaultyCacheBuilder) Build() (*FaultyCache, error) {
+	if b.cache == nil {
+		return nil, fmt.Errorf("no cache to inject faults into")
+	}
+
+	faults := map[Capability]*Fault{}
+	for _, cn := range capabilityNames {
+		fault := b.Default
+		faults[cn.capability] = &fault
+	}
+	for name, fault := range b.Operations {
+		capability, err := ParseCapabilities([]string{name})
+		if err != nil {
+			return nil, err
+		}
+		fault := fault
+		faults[capability] = &fault
+	}
+	for capability, fault := range faults {
+		switch fault.Latency.Distribution {
+		case "", "fixed", "uniform", "normal", "exponential":
+		default:
+			return nil, fmt.Errorf("unknown latency distribution [%v] of operation [%v]", fault.Latency.Distribution, capability)
+		}
+		if fault.TimeoutRate > 0 && fault.Timeout <= 0 {
+			return nil, fmt.Errorf("timeout of operation [%v] should be positive with timeout rate [%v]", capability, fault.TimeoutRate)
+		}
+	}
+
+	return &FaultyCache{
+		cache:  b.cache,
+		faults: faults,
+		rand:   rand.New(rand.NewSource(b.Seed)),
+	}, nil
+}
+
+// FaultyCache inject faults into a cache for resilience testing, all faults are
+// driven by a seeded random number generator so runs are reproducible
+type FaultyCache struct {
+	cache  Cache
+	faults map[Capability]*Fault
+
+	mutex sync.Mutex // rand is not safe for concurrent use
+	rand  *rand.Rand
+
+	errors   int64
+	timeouts int64
+	drops    int64
+	partials int64
+}
+
+// FaultStats numbers of faults injected
+type FaultStats struct {
+	Errors   int64
+	Timeouts int64
+	Drops    int64
+	Partials int64
+}
+
+// ErrFaultInjected returned by FaultyCache for an injected failure
+type ErrFaultInjected struct {
+	Capability Capability
+	Timeout    time.Duration // not 0 for a timeout
+}
+
+// Error message
+func (e *ErrFaultInjected) Error() string {
+	if e.Timeout != 0 {
+		return fmt.Sprintf("operation [%v] timeout after %v (injected)", e.Capability, e.Timeout)
+	}
+	return fmt.Sprintf("operation [%v] failed (injected)", e.Capability)
+}
+
+// IsFaultInjected return true if err is an ErrFaultInjected
+func IsFaultInjected(err error) bool {
+	_, ok := err.(*ErrFaultInjected)
+	return ok
+}
+
+// faultDecision faults decided for one call
+type faultDecision struct {
+	capability Capability
+	latency    time.Duration
+	fail       bool
+	timeout    time.Duration
+	drop       bool
+}
+
+// Stats numbers of faults injected
+func (c *FaultyCache) Stats() FaultStats {
+	return FaultStats{
+		Errors:   atomic.LoadInt64(&c.errors),
+		Timeouts: atomic.LoadInt64(&c.timeouts),
+		Drops:    atomic.LoadInt64(&c.drops),
+		Partials: atomic.LoadInt64(&c.partials),
+	}
+}
+
+// Capabilities of the cache
+func (c *FaultyCache) Capabilities() Capability {
+	return c.cache.Capabilities()
+}
+
+// Close the cache
+func (c *FaultyCache) Close() error {
+	return c.cache.Close()
+}
+
+// Get get a key
+func (c *FaultyCache) Get(key string) ([]byte, error) {
+	d := c.decide(CapGet, false)
+	if err := c.before(d); err != nil {
+		return nil, err
+	}
+	val, err := c.cache.Get(key)
+	if err := c.after(d); err != nil {
+		return nil, err
+	}
+	return val, err
+}
+
+// Set set a key
+func (c *FaultyCache) Set(key string, val []byte) error {
+	d := c.decide(CapSet, true)
+	if err := c.before(d); err != nil || d.drop {
+		return err
+	}
+	err := c.cache.Set(key, val)
+	if err := c.after(d); err != nil {
+		return err
+	}
+	return err
+}
+
+// Del delete a key
+func (c *FaultyCache) Del(key string) error {
+	d := c.decide(CapDel, true)
+	if err := c.before(d); err != nil || d.drop {
+		return err
+	}
+	err := c.cache.Del(key)
+	if err := c.after(d); err != nil {
+		return err
+	}
+	return err
+}
+
+// SetEx set with expiration
+func (c *FaultyCache) SetEx(key string, val []byte, expiration time.Duration) error {
+	d := c.decide(CapSetEx, true)
+	if err := c.before(d); err != nil || d.drop {
+		return err
+	}
+	err := c.cache.SetEx(key, val, expiration)
+	if err := c.after(d); err != nil {
+		return err
+	}
+	return err
+}
+
+// SetNx set if not exists, a dropped write reports success
+func (c *FaultyCache) SetNx(key string, val []byte) (bool, error) {
+	d := c.decide(CapSetNx, true)
+	if err := c.before(d); err != nil {
+		return false, err
+	}
+	if d.drop {
+		return true, nil
+	}
+	ok, err := c.cache.SetNx(key, val)
+	if err := c.after(d); err != nil {
+		return false, err
+	}
+	return ok, err
+}
+
+// SetExNx set if not exists with expiration, a dropped write reports success
+func (c *FaultyCache) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	d := c.decide(CapSetExNx, true)
+	if err := c.before(d); err != nil {
+		return false, err
+	}
+	if d.drop {
+		return true, nil
+	}
+	ok, err := c.cache.SetExNx(key, val, expiration)
+	if err := c.after(d); err != nil {
+		return false, err
+	}
+	return ok, err
+}
+
+// GetBatch get keys, each key may fail alone with PartialRate
+func (c *FaultyCache) GetBatch(keys []string) ([][]byte, []error, error) {
+	d := c.decide(CapGetBatch, false)
+	if err := c.before(d); err != nil {
+		return nil, nil, err
+	}
+	vals, errs, err := c.cache.GetBatch(keys)
+	if err := c.after(d); err != nil {
+		return nil, nil, err
+	}
+	if err != nil {
+		return vals, errs, err
+	}
+
+	for i, fail := range c.partial(CapGetBatch, len(keys)) {
+		if fail {
+			vals[i] = nil
+			errs[i] = &ErrFaultInjected{Capability: CapGetBatch}
+		}
+	}
+	return vals, errs, nil
+}
+
+// SetBatch set keys, each key may fail alone with PartialRate and is not written
+func (c *FaultyCache) SetBatch(keys []string, vals [][]byte) ([]error, error) {
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keys), len(vals))
+	}
+
+	d := c.decide(CapSetBatch, true)
+	if err := c.before(d); err != nil {
+		return nil, err
+	}
+	if d.drop {
+		return make([]error, len(keys)), nil
+	}
+
+	errs := make([]error, len(keys))
+	var idxs []int
+	var subKeys []string
+	var subVals [][]byte
+	for i, fail := range c.partial(CapSetBatch, len(keys)) {
+		if fail {
+			errs[i] = &ErrFaultInjected{Capability: CapSetBatch}
+			continue
+		}
+		idxs = append(idxs, i)
+		subKeys = append(subKeys, keys[i])
+		subVals = append(subVals, vals[i])
+	}
+
+	subErrs, err := c.cache.SetBatch(subKeys, subVals)
+	if err := c.after(d); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return subErrs, err
+	}
+	for j, i := range idxs {
+		errs[i] = subErrs[j]
+	}
+	return errs, nil
+}
+
+// decide the faults of a call
+func (c *FaultyCache) decide(capability Capability, write bool) *faultDecision {
+	fault := c.faults[capability]
+	d := &faultDecision{capability: capability}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	d.latency = c.latency(&fault.Latency)
+	if c.rand.Float64() < fault.ErrorRate {
+		d.fail = true
+	} else if c.rand.Float64() < fault.TimeoutRate {
+		d.timeout = fault.Timeout
+	} else if write && c.rand.Float64() < fault.DropRate {
+		d.drop = true
+	}
+	return d
+}
+
+// partial decide which keys of a batch fail
+func (c *FaultyCache) partial(capability Capability, n int) []bool {
+	rate := c.faults[capability].PartialRate
+	fails := make([]bool, n)
+	if rate <= 0 {
+		return fails
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i := range fails {
+		if c.rand.Float64() < rate {
+			fails[i] = true
+			atomic.AddInt64(&c.partials, 1)
+		}
+	}
+	return fails
+}
+
+// latency sample the distribution with c.mutex held
+func (c *FaultyCache) latency(l *Latency) time.Duration {
+	var d time.Duration
+	switch l.Distribution {
+	case "fixed":
+		return l.Mean
+	case "uniform":
+		if l.Max <= l.Min {
+			return l.Min
+		}
+		return l.Min + time.Duration(c.rand.Int63n(int64(l.Max-l.Min)))
+	case "normal":
+		d = l.Mean + time.Duration(c.rand.NormFloat64()*float64(l.StdDev))
+	case "exponential":
+		d = time.Duration(c.rand.ExpFloat64() * float64(l.Mean))
+	default:
+		return 0
+	}
+	if d < 0 {
+		d = 0
+	}
+	if l.Max > 0 && d > l.Max {
+		d = l.Max
+	}
+	return d
+}
+
+// before calling the cache, sleep the latency, return the error if decided to fail
+func (c *FaultyCache) before(d *faultDecision) error {
+	if d.latency > 0 {
+		time.Sleep(d.latency)
+	}
+	if d.fail {
+		atomic.AddInt64(&c.errors, 1)
+		return &ErrFaultInjected{Capability: d.capability}
+	}
+	if d.drop {
+		atomic.AddInt64(&c.drops, 1)
+	}
+	return nil
+}
+
+// after calling the cache, sleep then return the error if decided to timeout
+func (c *FaultyCache) after(d *faultDecision) error {
+	if d.timeout <= 0 {
+		return nil
+	}
+	time.Sleep(d.timeout)
+	atomic.AddInt64(&c.timeouts, 1)
+	return &ErrFaultInjected{Capability: d.capability, Timeout: d.timeout}
+}
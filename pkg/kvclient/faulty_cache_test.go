@@ -0,0 +1,106 @@
+package kvclient_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFaultyCache(t *testing.T) {
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewFaultyCacheBuilder().WithCache(kvclient.NewMapCacheBuilder().Build()).Build()
+	})
+
+	Convey("test faulty cache", t, func() {
+		build := func(seed int64, op string, fault kvclient.Fault) *kvclient.FaultyCache {
+			fc, err := kvclient.NewFaultyCacheBuilder().
+				WithSeed(seed).
+				WithOperation(op, fault).
+				WithCache(kvclient.NewMapCacheBuilder().Build()).
+				Build()
+			So(err, ShouldBeNil)
+			return fc
+		}
+
+		Convey("errors are reproducible with the same seed", func() {
+			pattern := func(seed int64) []bool {
+				fc := build(seed, "get", kvclient.Fault{ErrorRate: 0.3})
+				fails := make([]bool, 1000)
+				for i := range fails {
+					_, err := fc.Get("key")
+					fails[i] = err != nil
+					if err != nil {
+						So(kvclient.IsFaultInjected(err), ShouldBeTrue)
+					}
+				}
+				So(fc.Stats().Errors, ShouldBeBetween, 200, 400)
+				return fails
+			}
+			So(pattern(7), ShouldResemble, pattern(7))
+			So(pattern(7), ShouldNotResemble, pattern(8))
+		})
+
+		Convey("dropped writes succeed without writing", func() {
+			fc := build(1, "Set", kvclient.Fault{DropRate: 1})
+			So(fc.Set("key", []byte("val")), ShouldBeNil)
+			val, err := fc.Get("key")
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+			So(fc.Stats().Drops, ShouldEqual, 1)
+		})
+
+		Convey("slow then timeout", func() {
+			fc := build(1, "Set", kvclient.Fault{TimeoutRate: 1, Timeout: time.Duration(20) * time.Millisecond})
+			ts := time.Now()
+			err := fc.Set("key", []byte("val"))
+			So(time.Since(ts), ShouldBeGreaterThanOrEqualTo, time.Duration(20)*time.Millisecond)
+			So(kvclient.IsFaultInjected(err), ShouldBeTrue)
+			So(err.Error(), ShouldEqual, "operation [Set] timeout after 20ms (injected)")
+			val, _ := fc.Get("key")
+			So(val, ShouldResemble, []byte("val"))
+		})
+
+		Convey("keys of a batch fail alone", func() {
+			fc := build(1, "GetBatch", kvclient.Fault{PartialRate: 0.5})
+			keys := make([]string, 100)
+			for i := range keys {
+				keys[i] = string(rune('a' + i%26))
+				So(fc.Set(keys[i], []byte("val")), ShouldBeNil)
+			}
+			vals, errs, err := fc.GetBatch(keys)
+			So(err, ShouldBeNil)
+			fails := 0
+			for i := range keys {
+				if errs[i] != nil {
+					fails++
+					So(vals[i], ShouldBeNil)
+				} else {
+					So(vals[i], ShouldResemble, []byte("val"))
+				}
+			}
+			So(fails, ShouldBeBetween, 20, 80)
+			So(fc.Stats().Partials, ShouldEqual, fails)
+		})
+
+		Convey("latency", func() {
+			fc := build(1, "Get", kvclient.Fault{Latency: kvclient.Latency{
+				Distribution: "uniform", Min: time.Duration(5) * time.Millisecond, Max: time.Duration(10) * time.Millisecond,
+			}})
+			ts := time.Now()
+			fc.Get("key")
+			So(time.Since(ts), ShouldBeGreaterThanOrEqualTo, time.Duration(5)*time.Millisecond)
+		})
+
+		Convey("invalid config", func() {
+			_, err := kvclient.NewFaultyCacheBuilder().WithOperation("Incr", kvclient.Fault{}).WithCache(kvclient.NewMapCacheBuilder().Build()).Build()
+			So(err, ShouldNotBeNil)
+			_, err = kvclient.NewFaultyCacheBuilder().WithDefault(kvclient.Fault{Latency: kvclient.Latency{Distribution: "pareto"}}).WithCache(kvclient.NewMapCacheBuilder().Build()).Build()
+			So(err, ShouldNotBeNil)
+			_, err = kvclient.NewFaultyCacheBuilder().Build()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
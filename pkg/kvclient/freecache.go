@@ -1,6 +1,7 @@
 package kvclient
 
 import (
+	"io"
 	"time"
 
 	"github.com/coocood/freecache"
@@ -47,6 +48,12 @@ type Freecache struct {
 
 	cache      *freecache.Cache
 	expiration time.Duration
+	locker     keyLocker
+}
+
+// Capabilities supported operations
+func (c *Freecache) Capabilities() Capability {
+	return CapAll
 }
 
 // Get key
@@ -83,13 +90,15 @@ func (c *Freecache) SetEx(key string, val []byte, expiration time.Duration) erro
 	return c.cache.Set([]byte(key), val, int(expiration/time.Second))
 }
 
-// SetNx set if not exist
+// SetNx set if not exist, atomic between SetNx/SetExNx callers
 func (c *Freecache) SetNx(key string, val []byte) (bool, error) {
+	defer c.locker.Lock(key).Unlock()
 	return SetNx(c, key, val)
 }
 
-// SetExNx set with expiration if not exists
+// SetExNx set with expiration if not exists, atomic between SetNx/SetExNx callers
 func (c *Freecache) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	defer c.locker.Lock(key).Unlock()
 	return SetExNx(c, key, val, expiration)
 }
 
@@ -97,3 +106,42 @@ func (c *Freecache) SetExNx(key string, val []byte, expiration time.Duration) (b
 func (c *Freecache) GetBatch(keys []string) ([][]byte, []error, error) {
 	return GetBatch(c, keys)
 }
+
+// Snapshot write the keys not expired, implement Snapshotter
+func (c *Freecache) Snapshot(w io.Writer) error {
+	writer, err := newDumpWriter(w)
+	if err != nil {
+		return err
+	}
+	it := c.cache.NewIterator()
+	for entry := it.Next(); entry != nil; entry = it.Next() {
+		// ttl is in seconds and 0 means never expire
+		ttl, err := c.cache.TTL(entry.Key)
+		if err == freecache.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var at int64
+		if ttl > 0 {
+			at = expireAt(time.Now(), time.Duration(ttl)*time.Second)
+		}
+		if err := writer.write(string(entry.Key), entry.Value, at); err != nil {
+			return err
+		}
+	}
+	return writer.close()
+}
+
+// Restore keys written by Snapshot, implement Snapshotter
+func (c *Freecache) Restore(r io.Reader) error {
+	return readDump(r, time.Now(), func(key string, val []byte, expiration time.Duration) error {
+		if _, err := c.cache.Get([]byte(key)); err != freecache.ErrNotFound {
+			return nil
+		}
+		// freecache expires in seconds where 0 means never expire, round up the time left
+		seconds := int((expiration + time.Second - 1) / time.Second)
+		return c.cache.Set([]byte(key), val, seconds)
+	})
+}
@@ -1,6 +1,7 @@
 package kvclient
 
 import (
+	"io"
 	"time"
 
 	"github.com/bluele/gcache"
@@ -23,7 +24,8 @@ type GcacheBuilder struct {
 // Build build a new local cache
 func (b *GcacheBuilder) Build() *Gcache {
 	return &Gcache{
-		cache: gcache.New(b.Size).LRU().Expiration(b.Expiration).Build(),
+		cache:      gcache.New(b.Size).LRU().Expiration(b.Expiration).Build(),
+		expiration: b.Expiration,
 	}
 }
 
@@ -43,12 +45,25 @@ func (b *GcacheBuilder) WithExpiration(expiration time.Duration) *GcacheBuilder
 type Gcache struct {
 	BaseCache
 
-	cache gcache.Cache
+	cache      gcache.Cache
+	expiration time.Duration
+	locker     keyLocker
+}
+
+// gcacheItem value with its expire time, gcache does not expose the expire time of a key
+type gcacheItem struct {
+	val      []byte
+	expireAt time.Time
+}
+
+// Capabilities supported operations
+func (lc *Gcache) Capabilities() Capability {
+	return CapAll
 }
 
 // Set set a key
 func (lc *Gcache) Set(key string, val []byte) error {
-	return lc.cache.Set(key, val)
+	return lc.SetEx(key, val, lc.expiration)
 }
 
 // Get get a key
@@ -62,7 +77,7 @@ func (lc *Gcache) Get(key string) ([]byte, error) {
 		return nil, err
 	}
 
-	return val.([]byte), nil
+	return val.(*gcacheItem).val, nil
 }
 
 // Del delete a key
@@ -73,16 +88,18 @@ func (lc *Gcache) Del(key string) error {
 
 // SetEx set with expiration
 func (lc *Gcache) SetEx(key string, val []byte, expiration time.Duration) error {
-	return lc.cache.SetWithExpire(key, val, expiration)
+	return lc.cache.SetWithExpire(key, &gcacheItem{val: val, expireAt: time.Now().Add(expiration)}, expiration)
 }
 
-// SetNx set if not exists
+// SetNx set if not exists, atomic between SetNx/SetExNx callers
 func (lc *Gcache) SetNx(key string, val []byte) (bool, error) {
+	defer lc.locker.Lock(key).Unlock()
 	return SetNx(lc, key, val)
 }
 
-// SetExNx set if not exists with expiration
+// SetExNx set if not exists with expiration, atomic between SetNx/SetExNx callers
 func (lc *Gcache) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	defer lc.locker.Lock(key).Unlock()
 	return SetExNx(lc, key, val, expiration)
 }
 
@@ -95,3 +112,32 @@ func (lc *Gcache) SetBatch(keys []string, vals [][]byte) ([]error, error) {
 func (lc *Gcache) GetBatch(keys []string) ([][]byte, []error, error) {
 	return GetBatch(lc, keys)
 }
+
+// Snapshot write the keys not expired, implement Snapshotter
+func (lc *Gcache) Snapshot(w io.Writer) error {
+	writer, err := newDumpWriter(w)
+	if err != nil {
+		return err
+	}
+	for key, val := range lc.cache.GetALL(true) {
+		item := val.(*gcacheItem)
+		if err := writer.write(key.(string), item.val, unixMilli(item.expireAt)); err != nil {
+			return err
+		}
+	}
+	return writer.close()
+}
+
+// Restore keys written by Snapshot, keys never expire in the snapshot are restored
+// with the default expiration, implement Snapshotter
+func (lc *Gcache) Restore(r io.Reader) error {
+	return readDump(r, time.Now(), func(key string, val []byte, expiration time.Duration) error {
+		if lc.cache.Has(key) {
+			return nil
+		}
+		if expiration == 0 {
+			expiration = lc.expiration
+		}
+		return lc.SetEx(key, val, expiration)
+	})
+}
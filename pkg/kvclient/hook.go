@@ -0,0 +1,86 @@
+package kvclient
+
+import (
+	"context"
+	"time"
+)
+
+// Hook observe the operations of a KVClient. each operation of the client is an event
+// with Tier -1, the calls to the caches made by it are child events with the tier index
+type Hook interface {
+	// Before called when an event starts, the returned context is passed to After and
+	// to Before of the child events
+	Before(ctx context.Context, event *HookEvent) context.Context
+	// After called when an event ends, with OK, Err and Latency set
+	After(ctx context.Context, event *HookEvent)
+}
+
+// HookEvent an operation of the client, or a call to a cache tier
+type HookEvent struct {
+	Operation Capability
+	Keys      []string    // compressed keys
+	Tier      int         // index of the cache, -1 for the operation of the client
+	Cache     CacheLabels // labels of the cache, empty for the operation of the client
+	Backfill  bool        // a Set to backfill the key found in a later tier by Get
+	Start     time.Time
+	Latency   time.Duration
+	OK        bool // Get found the key, SetNx/SetExNx set the key, other operations succeeded
+	Err       error
+}
+
+// hookRun an event observed by hooks, methods do nothing on nil
+type hookRun struct {
+	hooks []Hook
+	ctxs  []context.Context
+	event *HookEvent
+}
+
+func startHooks(hooks []Hook, parents []context.Context, event *HookEvent) *hookRun {
+	r := &hookRun{hooks: hooks, ctxs: make([]context.Context, len(hooks)), event: event}
+	event.Start = time.Now()
+	for i, hook := range hooks {
+		ctx := context.Background()
+		if parents != nil {
+			ctx = parents[i]
+		}
+		r.ctxs[i] = hook.Before(ctx, event)
+	}
+	return r
+}
+
+// before start an operation of the client
+func (c *kvClient) before(operation Capability, keys ...string) *hookRun {
+	if len(c.hooks) == 0 {
+		return nil
+	}
+	return startHooks(c.hooks, nil, &HookEvent{Operation: operation, Keys: keys, Tier: -1})
+}
+
+// tier start a call to the i-th cache
+func (r *hookRun) tier(i int, labels CacheLabels, operation Capability, keys ...string) *hookRun {
+	if r == nil {
+		return nil
+	}
+	return startHooks(r.hooks, r.ctxs, &HookEvent{Operation: operation, Keys: keys, Tier: i, Cache: labels})
+}
+
+// backfill start a backfill Set to the i-th cache
+func (r *hookRun) backfill(i int, labels CacheLabels, key string) *hookRun {
+	if r == nil {
+		return nil
+	}
+	return startHooks(r.hooks, r.ctxs, &HookEvent{Operation: CapSet, Keys: []string{key}, Tier: i, Cache: labels, Backfill: true})
+}
+
+// after end the event, hooks are called in reverse order
+func (r *hookRun) after(ok bool, err error) {
+	if r == nil {
+		return
+	}
+	r.event.Latency = time.Since(r.event.Start)
+	r.event.OK = ok && err == nil
+	r.event.Err = err
+	for i := len(r.hooks) - 1; i >= 0; i-- {
+		r.hooks[i].After(r.ctxs[i], r.event)
+	}
+}
@@ -0,0 +1,308 @@
+package kvclient
+
+import (
+	"container/heap"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewHotKeyDetectorBuilder create a new HotKeyDetector builder
+func NewHotKeyDetectorBuilder() *HotKeyDetectorBuilder {
+	return &HotKeyDetectorBuilder{
+		TopK:            100,
+		Threshold:       1000,
+		Window:          time.Minute,
+		Width:           16384,
+		Depth:           4,
+		LocalMaxBytes:   16 * 1024 * 1024,
+		LocalExpiration: time.Second,
+		clock:           SystemClock{},
+	}
+}
+
+// HotKeyDetectorBuilder builder
+type HotKeyDetectorBuilder struct {
+	TopK            int           // number of the top keys reported by HotKeys
+	Threshold       uint64        // keys read more than threshold in a window are promoted
+	Window          time.Duration // read counts are halved every window
+	Width           int           // width of the count-min sketch
+	Depth           int           // depth of the count-min sketch
+	LocalMaxBytes   int           // memory limit of the local cache of promoted keys
+	LocalExpiration time.Duration // expiration of promoted keys, writes of other clients are not seen until expired
+
+	clock Clock
+}
+
+// WithTopK option
+func (b *HotKeyDetectorBuilder) WithTopK(topK int) *HotKeyDetectorBuilder {
+	b.TopK = topK
+	return b
+}
+
+// WithThreshold option
+func (b *HotKeyDetectorBuilder) WithThreshold(threshold uint64) *HotKeyDetectorBuilder {
+	b.Threshold = threshold
+	return b
+}
+
+// WithWindow option
+func (b *HotKeyDetectorBuilder) WithWindow(window time.Duration) *HotKeyDetectorBuilder {
+	b.Window = window
+	return b
+}
+
+// WithWidth option
+func (b *HotKeyDetectorBuilder) WithWidth(width int) *HotKeyDetectorBuilder {
+	b.Width = width
+	return b
+}
+
+// WithDepth option
+func (b *HotKeyDetectorBuilder) WithDepth(depth int) *HotKeyDetectorBuilder {
+	b.Depth = depth
+	return b
+}
+
+// WithLocalMaxBytes option
+func (b *HotKeyDetectorBuilder) WithLocalMaxBytes(localMaxBytes int) *HotKeyDetectorBuilder {
+	b.LocalMaxBytes = localMaxBytes
+	return b
+}
+
+// WithLocalExpiration option
+func (b *HotKeyDetectorBuilder) WithLocalExpiration(localExpiration time.Duration) *HotKeyDetectorBuilder {
+	b.LocalExpiration = localExpiration
+	return b
+}
+
+// WithClock option, the clock of windows and expiration
+func (b *HotKeyDetectorBuilder) WithClock(clock Clock) *HotKeyDetectorBuilder {
+	b.clock = clock
+	return b
+}
+
+// Build a new HotKeyDetector
+func (b *HotKeyDetectorBuilder) Build() (*HotKeyDetector, error) {
+	if b.Width <= 0 || b.Depth <= 0 {
+		return nil, fmt.Errorf("width [%v] and depth [%v] of sketch should be positive", b.Width, b.Depth)
+	}
+	if b.TopK <= 0 || b.Threshold == 0 {
+		return nil, fmt.Errorf("topK [%v] and threshold [%v] should be positive", b.TopK, b.Threshold)
+	}
+	if b.Window <= 0 || b.LocalExpiration <= 0 {
+		return nil, fmt.Errorf("window [%v] and local expiration [%v] should be positive", b.Window, b.LocalExpiration)
+	}
+
+	return &HotKeyDetector{
+		counters:  make([]uint32, b.Width*b.Depth),
+		width:     uint32(b.Width),
+		depth:     uint32(b.Depth),
+		threshold: b.Threshold,
+		window:    b.Window,
+		clock:     b.clock,
+		lastDecay: b.clock.Now().UnixNano(),
+		topK:      b.TopK,
+		topKeys:   &hotKeyHeap{index: map[string]int{}},
+		local:     NewMapCacheBuilder().WithExpiration(b.LocalExpiration).WithMaxBytes(b.LocalMaxBytes).WithClock(b.clock).Build(),
+	}, nil
+}
+
+// HotKeyDetector count reads of keys with a count-min sketch, keep the top keys, and
+// promote the keys above the threshold into a small local cache with a short expiration.
+// a detector belongs to one client, the client deletes promoted keys it writes
+type HotKeyDetector struct {
+	counters  []uint32 // depth rows of width counters, updated atomically
+	width     uint32
+	depth     uint32
+	threshold uint64
+	window    time.Duration
+	clock     Clock
+	lastDecay int64 // unix nanoseconds
+
+	mutex   sync.Mutex
+	topK    int
+	topKeys *hotKeyHeap
+	minTop  uint64 // smallest count of topKeys when full, read atomically to skip the mutex
+
+	// invalidations hold the write lock, so a value read from the caches is promoted
+	// only if the key is not written by the client since the read, see RedisTracking
+	versionMutex sync.RWMutex
+	stripes      [256]uint64
+	local        *MapCache
+}
+
+// HotKey a key in the report
+type HotKey struct {
+	Key      string
+	Count    uint64 // estimated reads, halved every window
+	Promoted bool   // in the local cache now
+}
+
+// HotKeys the top keys by estimated reads, in descending order
+func (d *HotKeyDetector) HotKeys() []HotKey {
+	d.mutex.Lock()
+	keys := make([]HotKey, len(d.topKeys.items))
+	for i, item := range d.topKeys.items {
+		keys[i] = HotKey{Key: item.key, Count: item.count}
+	}
+	d.mutex.Unlock()
+
+	for i := range keys {
+		val, _ := d.local.Get(keys[i].Key)
+		keys[i].Promoted = val != nil
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Count != keys[j].Count {
+			return keys[i].Count > keys[j].Count
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
+
+// touch count a read of key, return true if the key is hot
+func (d *HotKeyDetector) touch(key string) bool {
+	d.decay()
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)|1
+	count := uint64(^uint32(0))
+	for i := uint32(0); i < d.depth; i++ {
+		idx := i*d.width + (h1+i*h2)%d.width
+		if c := uint64(atomic.AddUint32(&d.counters[idx], 1)); c < count {
+			count = c
+		}
+	}
+
+	if count > atomic.LoadUint64(&d.minTop) {
+		d.mutex.Lock()
+		d.topKeys.update(key, count, d.topK)
+		if len(d.topKeys.items) >= d.topK {
+			atomic.StoreUint64(&d.minTop, d.topKeys.items[0].count)
+		}
+		d.mutex.Unlock()
+	}
+
+	return count >= d.threshold
+}
+
+// decay halve the counts if a window passed
+func (d *HotKeyDetector) decay() {
+	now := d.clock.Now().UnixNano()
+	last := atomic.LoadInt64(&d.lastDecay)
+	if now-last < int64(d.window) || !atomic.CompareAndSwapInt64(&d.lastDecay, last, now) {
+		return
+	}
+
+	for i := range d.counters {
+		for {
+			c := atomic.LoadUint32(&d.counters[i])
+			if atomic.CompareAndSwapUint32(&d.counters[i], c, c/2) {
+				break
+			}
+		}
+	}
+	d.mutex.Lock()
+	d.topKeys.halve()
+	if len(d.topKeys.items) >= d.topK {
+		atomic.StoreUint64(&d.minTop, d.topKeys.items[0].count)
+	}
+	d.mutex.Unlock()
+}
+
+// get a promoted key, nil if not promoted
+func (d *HotKeyDetector) get(key string) []byte {
+	val, _ := d.local.Get(key)
+	return val
+}
+
+// version of key, taken before reading it from the caches and passed to promote
+func (d *HotKeyDetector) version(key string) uint64 {
+	d.versionMutex.RLock()
+	defer d.versionMutex.RUnlock()
+	return *d.stripe(key)
+}
+
+func (d *HotKeyDetector) stripe(key string) *uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &d.stripes[h.Sum32()%uint32(len(d.stripes))]
+}
+
+// promote a hot key with the value read from the caches, only if the key is not invalidated
+// since version. values over the memory limit are not promoted
+func (d *HotKeyDetector) promote(key string, val []byte, version uint64) {
+	d.versionMutex.RLock()
+	defer d.versionMutex.RUnlock()
+	if *d.stripe(key) == version {
+		d.local.Set(key, val)
+	}
+}
+
+// invalidate keys written by the client
+func (d *HotKeyDetector) invalidate(keys ...string) {
+	d.versionMutex.Lock()
+	defer d.versionMutex.Unlock()
+	for _, key := range keys {
+		*d.stripe(key)++
+		d.local.Del(key)
+	}
+}
+
+// hotKeyHeap min heap of the top keys by count
+type hotKeyHeap struct {
+	items []*hotKeyItem
+	index map[string]int
+}
+
+type hotKeyItem struct {
+	key   string
+	count uint64
+}
+
+func (h *hotKeyHeap) Len() int           { return len(h.items) }
+func (h *hotKeyHeap) Less(i, j int) bool { return h.items[i].count < h.items[j].count }
+func (h *hotKeyHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.index[h.items[i].key] = i
+	h.index[h.items[j].key] = j
+}
+func (h *hotKeyHeap) Push(x interface{}) {
+	item := x.(*hotKeyItem)
+	h.index[item.key] = len(h.items)
+	h.items = append(h.items, item)
+}
+func (h *hotKeyHeap) Pop() interface{} {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	delete(h.index, item.key)
+	return item
+}
+
+// update the count of key, replace the smallest key if full
+func (h *hotKeyHeap) update(key string, count uint64, k int) {
+	if i, ok := h.index[key]; ok {
+		h.items[i].count = count
+		heap.Fix(h, i)
+	} else if len(h.items) < k {
+		heap.Push(h, &hotKeyItem{key: key, count: count})
+	} else if count > h.items[0].count {
+		delete(h.index, h.items[0].key)
+		h.items[0] = &hotKeyItem{key: key, count: count}
+		h.index[key] = 0
+		heap.Fix(h, 0)
+	}
+}
+
+// halve all the counts, the order is kept
+func (h *hotKeyHeap) halve() {
+	for _, item := range h.items {
+		item.count /= 2
+	}
+}
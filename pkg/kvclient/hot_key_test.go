@@ -0,0 +1,129 @@
+package kvclient_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKVClient_HotKeys(t *testing.T) {
+	Convey("test hot keys", t, func() {
+		clock := kvclienttest.NewFakeClock(time.Unix(1500000000, 0))
+		detector, err := kvclient.NewHotKeyDetectorBuilder().
+			WithTopK(3).
+			WithThreshold(3).
+			WithWindow(time.Minute).
+			WithLocalExpiration(time.Second).
+			WithClock(clock).
+			Build()
+		So(err, ShouldBeNil)
+		remote := &hookCache{Cache: kvclient.NewMapCacheBuilder().Build()}
+		client, err := kvclient.NewBuilder().
+			WithCaches([]kvclient.Cache{remote}).
+			WithCompressor(testCompressor{}).
+			WithSerializer(testSerializer{}).
+			WithHotKeyDetector(detector).
+			Build()
+		So(err, ShouldBeNil)
+		So(remote.Set("key1", []byte("val1")), ShouldBeNil)
+
+		get := func(key string) string {
+			var val string
+			ok, err := client.Get(key, &val)
+			So(err, ShouldBeNil)
+			if !ok {
+				return ""
+			}
+			return val
+		}
+
+		Convey("keys above the threshold are promoted until expired", func() {
+			So(get("key1"), ShouldEqual, "val1")
+			So(get("key1"), ShouldEqual, "val1")
+			So(remote.Set("key1", []byte("val2")), ShouldBeNil)
+			So(get("key1"), ShouldEqual, "val2")
+
+			// promoted, writes of others are not seen until expired
+			So(remote.Set("key1", []byte("val3")), ShouldBeNil)
+			So(get("key1"), ShouldEqual, "val2")
+			clock.Add(time.Second)
+			So(get("key1"), ShouldEqual, "val3")
+		})
+
+		Convey("writes of the client delete promoted keys", func() {
+			for i := 0; i < 3; i++ {
+				get("key1")
+			}
+			So(client.Set("key1", "val2"), ShouldBeNil)
+			So(get("key1"), ShouldEqual, "val2")
+
+			vals := []interface{}{new(string), new(string)}
+			oks, errs, err := client.GetBatch([]interface{}{"key1", "key2"}, vals)
+			So(err, ShouldBeNil)
+			So(errs, ShouldResemble, []error{nil, nil})
+			So(oks, ShouldResemble, []bool{true, false})
+			So(*(vals[0].(*string)), ShouldEqual, "val2")
+		})
+
+		Convey("writes of the client during a read are not overwritten by the promotion", func() {
+			get("key1")
+			get("key1")
+			remote.afterGet = func() {
+				remote.afterGet = nil
+				So(client.Set("key1", "val2"), ShouldBeNil)
+			}
+			So(get("key1"), ShouldEqual, "val1")
+			So(get("key1"), ShouldEqual, "val2")
+		})
+
+		Convey("misses are promoted", func() {
+			for i := 0; i < 3; i++ {
+				So(get("key2"), ShouldEqual, "")
+			}
+			So(remote.Set("key2", []byte("val2")), ShouldBeNil)
+			So(get("key2"), ShouldEqual, "")
+			oks, _, err := client.GetBatch([]interface{}{"key2"}, []interface{}{new(string)})
+			So(err, ShouldBeNil)
+			So(oks, ShouldResemble, []bool{false})
+		})
+
+		Convey("report the top keys", func() {
+			for i := 0; i < 5; i++ {
+				for j := 0; j <= i; j++ {
+					get(fmt.Sprintf("key%v", i))
+				}
+			}
+			So(client.HotKeys(), ShouldResemble, []kvclient.HotKey{
+				{Key: "key4", Count: 5, Promoted: true},
+				{Key: "key3", Count: 4, Promoted: true},
+				{Key: "key2", Count: 3, Promoted: true},
+			})
+
+			clock.Add(time.Minute)
+			get("key0")
+			So(client.HotKeys(), ShouldResemble, []kvclient.HotKey{
+				{Key: "key3", Count: 2, Promoted: false},
+				{Key: "key4", Count: 2, Promoted: false},
+				{Key: "key2", Count: 1, Promoted: false},
+			})
+		})
+	})
+}
+
+// hookCache calls afterGet after reading the cache
+type hookCache struct {
+	kvclient.Cache
+	afterGet func()
+}
+
+func (c *hookCache) Get(key string) ([]byte, error) {
+	buf, err := c.Cache.Get(key)
+	if c.afterGet != nil {
+		c.afterGet()
+	}
+	return buf, err
+}
@@ -34,6 +34,12 @@ type KVClient interface {
 	SetExNx(key interface{}, val interface{}, expiration time.Duration) (bool, error)
 	Close() error
 	CacheHitRate() []float64
+	// top keys by reads, nil if no HotKeyDetector
+	HotKeys() []HotKey
+	// operations supported by all the caches
+	Capabilities() Capability
+	// the tiers from the upper to the lower, for inspecting such as kvctl
+	Caches() []Cache
 }
 
 // Cache interface
@@ -50,4 +56,6 @@ type Cache interface {
 	SetNx(key string, val []byte) (bool, error)                             // set if not exists, return false if already exists
 	SetExNx(key string, val []byte, expiration time.Duration) (bool, error) // set if not exists with expiration
 	Close() error
+	// operations supported, others return ErrNotSupported
+	Capabilities() Capability
 }
@@ -3,6 +3,7 @@ package kvclient
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"sync/atomic"
 	"time"
 )
@@ -14,9 +15,16 @@ func NewBuilder() *Builder {
 
 // Builder kvclient builder
 type Builder struct {
-	caches     []Cache
-	compressor Compressor
-	serializer Serializer
+	caches       []Cache
+	compressor   Compressor
+	serializer   Serializer
+	capabilities Capability
+	metricsSink  MetricsSink
+	cacheLabels  []CacheLabels
+	hooks        []Hook
+	hotKeys      *HotKeyDetector
+	warmupFile   string
+	dumpFile     string
 }
 
 // WithCaches option
@@ -37,31 +45,151 @@ func (b *Builder) WithSerializer(serializer Serializer) *Builder {
 	return b
 }
 
-// Build a KVClient
-func (b *Builder) Build() KVClient {
-	return &kvClient{
-		caches:     b.caches,
-		getTimes:   make([]int64, len(b.caches)),
-		hitTimes:   make([]int64, len(b.caches)),
-		compressor: b.compressor,
-		serializer: b.serializer,
-		nilValBuf:  []byte{},
+// WithCapabilities option, operations the client is required to support
+func (b *Builder) WithCapabilities(capabilities Capability) *Builder {
+	b.capabilities = capabilities
+	return b
+}
+
+// WithMetricsSink option, record the metrics of each cache tier into sink
+func (b *Builder) WithMetricsSink(sink MetricsSink) *Builder {
+	b.metricsSink = sink
+	return b
+}
+
+// WithCacheLabels option, labels of the caches in metrics and hooks, in the same order as caches
+func (b *Builder) WithCacheLabels(labels []CacheLabels) *Builder {
+	b.cacheLabels = labels
+	return b
+}
+
+// WithHooks option, hooks are called in order before an event and in reverse order after it
+func (b *Builder) WithHooks(hooks ...Hook) *Builder {
+	b.hooks = append(b.hooks, hooks...)
+	return b
+}
+
+// WithHotKeyDetector option, keys read frequently are served from a local cache of the detector
+func (b *Builder) WithHotKeyDetector(detector *HotKeyDetector) *Builder {
+	b.hotKeys = detector
+	return b
+}
+
+// WithWarmupFile option, restore the first cache which is a Snapshotter from the file
+// on Build, a missing file is ignored so that the first start works
+func (b *Builder) WithWarmupFile(filename string) *Builder {
+	b.warmupFile = filename
+	return b
+}
+
+// WithDumpFile option, snapshot the first cache which is a Snapshotter into the file on Close
+func (b *Builder) WithDumpFile(filename string) *Builder {
+	b.dumpFile = filename
+	return b
+}
+
+// Build a KVClient, fail if the caches can not support the required capabilities
+func (b *Builder) Build() (KVClient, error) {
+	if len(b.caches) == 0 {
+		return nil, fmt.Errorf("no caches")
 	}
+
+	// all tiers are read by Get, the tiers before the last are backfilled by Set
+	capabilities := CapAll
+	for i, cache := range b.caches {
+		c := cache.Capabilities()
+		if !c.Has(CapGet) {
+			return nil, fmt.Errorf("cache[%v] %T not support [%v]", i, cache, CapGet)
+		}
+		if i < len(b.caches)-1 && !c.Has(CapSet) {
+			return nil, fmt.Errorf("cache[%v] %T not support [%v] which is required to backfill", i, cache, CapSet)
+		}
+		if !c.Has(b.capabilities) {
+			return nil, fmt.Errorf("cache[%v] %T not support [%v]", i, cache, b.capabilities&^c)
+		}
+		capabilities &= c
+	}
+	// GetBatch only reads the last tier
+	capabilities &^= CapGetBatch
+	capabilities |= b.caches[len(b.caches)-1].Capabilities() & CapGetBatch
+
+	if b.cacheLabels != nil && len(b.cacheLabels) != len(b.caches) {
+		return nil, fmt.Errorf("assert len(cacheLabels)[%v] == len(caches)[%v] failed", len(b.cacheLabels), len(b.caches))
+	}
+	labels := make([]CacheLabels, len(b.caches))
+	for i, cache := range b.caches {
+		labels[i] = defaultCacheLabels(i, cache)
+		if b.cacheLabels != nil {
+			labels[i] = b.cacheLabels[i]
+		}
+	}
+
+	var snapshotter Snapshotter
+	if b.warmupFile != "" || b.dumpFile != "" {
+		for _, cache := range b.caches {
+			if s, ok := cache.(Snapshotter); ok {
+				snapshotter = s
+				break
+			}
+		}
+		if snapshotter == nil {
+			return nil, fmt.Errorf("no cache is a Snapshotter to warmup or dump")
+		}
+	}
+	if b.warmupFile != "" {
+		if err := RestoreFile(snapshotter, b.warmupFile); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("warmup from [%v] failed: %v", b.warmupFile, err)
+		}
+	}
+
+	caches := b.caches
+	if b.metricsSink != nil {
+		caches = make([]Cache, len(b.caches))
+		for i, cache := range b.caches {
+			caches[i] = newMetricsCache(i, cache, labels[i], b.metricsSink)
+		}
+	}
+
+	return &kvClient{
+		caches:       caches,
+		labels:       labels,
+		hooks:        b.hooks,
+		hotKeys:      b.hotKeys,
+		getTimes:     make([]int64, len(b.caches)),
+		hitTimes:     make([]int64, len(b.caches)),
+		compressor:   b.compressor,
+		serializer:   b.serializer,
+		nilValBuf:    []byte{},
+		capabilities: capabilities,
+		snapshotter:  snapshotter,
+		dumpFile:     b.dumpFile,
+	}, nil
 }
 
 // kvClient dmp client
 type kvClient struct {
-	caches     []Cache
-	getTimes   []int64
-	hitTimes   []int64
-	compressor Compressor
-	serializer Serializer
-	nilValBuf  []byte
+	caches       []Cache
+	labels       []CacheLabels
+	hooks        []Hook
+	hotKeys      *HotKeyDetector
+	getTimes     []int64
+	hitTimes     []int64
+	compressor   Compressor
+	serializer   Serializer
+	nilValBuf    []byte
+	capabilities Capability
+	snapshotter  Snapshotter
+	dumpFile     string
 }
 
-// Close caches
+// Close caches, the snapshot is dumped before the caches drop their keys
 func (c *kvClient) Close() error {
 	var err error
+	if c.dumpFile != "" {
+		if derr := SnapshotFile(c.snapshotter, c.dumpFile); derr != nil {
+			err = fmt.Errorf("dump to [%v] failed: %v", c.dumpFile, derr)
+		}
+	}
 	for _, cache := range c.caches {
 		if cerr := cache.Close(); cerr != nil {
 			err = cerr
@@ -86,19 +214,79 @@ func (c *kvClient) SetNilValBuf(buf []byte) {
 	c.nilValBuf = buf
 }
 
-// CacheHitRate cache hit rate
+// CacheHitRate cache hit rate since the client created, 0 for a tier never read.
+// use a MetricsSink for the hit rate over time
 func (c *kvClient) CacheHitRate() []float64 {
 	var rate []float64
 	for i := range c.caches {
-		rate = append(rate, float64(c.hitTimes[i])/float64(c.getTimes[i]))
+		getTimes := atomic.LoadInt64(&c.getTimes[i])
+		if getTimes == 0 {
+			rate = append(rate, 0)
+			continue
+		}
+		rate = append(rate, float64(atomic.LoadInt64(&c.hitTimes[i]))/float64(getTimes))
 	}
 
 	return rate
 }
 
+// Capabilities operations supported by all the caches
+func (c *kvClient) Capabilities() Capability {
+	return c.capabilities
+}
+
+// Caches the tiers from the upper to the lower, as they are built, without metrics
+func (c *kvClient) Caches() []Cache {
+	caches := make([]Cache, len(c.caches))
+	for i, cache := range c.caches {
+		if mc, ok := cache.(*metricsCache); ok {
+			cache = mc.cache
+		}
+		caches[i] = cache
+	}
+	return caches
+}
+
+// HotKeys top keys by reads
+func (c *kvClient) HotKeys() []HotKey {
+	if c.hotKeys == nil {
+		return nil
+	}
+	return c.hotKeys.HotKeys()
+}
+
+// invalidateHotKeys delete promoted keys written by the client
+func (c *kvClient) invalidateHotKeys(keybufs ...string) {
+	if c.hotKeys != nil {
+		c.hotKeys.invalidate(keybufs...)
+	}
+}
+
 // Get key
 func (c *kvClient) Get(key interface{}, val interface{}) (bool, error) {
 	keybuf := c.compressor.Compress(key)
+	h := c.before(CapGet, keybuf)
+	ok, err := c.get(h, keybuf, val)
+	h.after(ok, err)
+	return ok, err
+}
+
+func (c *kvClient) get(h *hookRun, keybuf string, val interface{}) (bool, error) {
+	hot := false
+	var version uint64
+	if c.hotKeys != nil {
+		hot = c.hotKeys.touch(keybuf)
+		if buf := c.hotKeys.get(keybuf); buf != nil {
+			if bytes.Equal(buf, c.nilValBuf) {
+				return false, nil
+			}
+			if err := c.serializer.Unmarshal(buf, val); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+		version = c.hotKeys.version(keybuf)
+	}
 
 	var ok bool
 	var err error
@@ -106,7 +294,9 @@ func (c *kvClient) Get(key interface{}, val interface{}) (bool, error) {
 	var idx int
 	for i, cache := range c.caches {
 		idx = i
+		t := h.tier(i, c.labels[i], CapGet, keybuf)
 		buf, err = cache.Get(keybuf)
+		t.after(buf != nil, err)
 		atomic.AddInt64(&(c.getTimes[i]), 1)
 		if err != nil {
 			return false, err
@@ -126,30 +316,50 @@ func (c *kvClient) Get(key interface{}, val interface{}) (bool, error) {
 		}
 	}
 
-	if ok {
-		for i := 0; i < idx; i++ {
-			c.caches[i].Set(keybuf, buf)
-		}
-	} else {
-		for i := 0; i < idx; i++ {
-			c.caches[i].Set(keybuf, c.nilValBuf)
+	backfill := buf
+	if !ok {
+		backfill = c.nilValBuf
+	}
+	for i := 0; i < idx; i++ {
+		t := h.backfill(i, c.labels[i], keybuf)
+		t.after(true, c.caches[i].Set(keybuf, backfill))
+		if mc, ok := c.caches[i].(*metricsCache); ok {
+			mc.backfill()
 		}
 	}
+	if hot {
+		c.hotKeys.promote(keybuf, backfill, version)
+	}
 
 	return ok, nil
 }
 
 // Set key
 func (c *kvClient) Set(key interface{}, val interface{}) error {
+	if !c.capabilities.Has(CapSet) {
+		return &ErrNotSupported{Capability: CapSet}
+	}
+
 	keybuf := c.compressor.Compress(key)
+	h := c.before(CapSet, keybuf)
+	err := c.set(h, keybuf, val)
+	c.invalidateHotKeys(keybuf)
+	h.after(true, err)
+	return err
+}
+
+func (c *kvClient) set(h *hookRun, keybuf string, val interface{}) error {
 	valbuf, err := c.serializer.Marshal(val)
 
 	if err != nil {
 		return err
 	}
 
-	for _, cache := range c.caches {
-		if err := cache.Set(keybuf, valbuf); err != nil {
+	for i, cache := range c.caches {
+		t := h.tier(i, c.labels[i], CapSet, keybuf)
+		err := cache.Set(keybuf, valbuf)
+		t.after(true, err)
+		if err != nil {
 			return err
 		}
 	}
@@ -159,10 +369,24 @@ func (c *kvClient) Set(key interface{}, val interface{}) error {
 
 // Del key
 func (c *kvClient) Del(key interface{}) error {
+	if !c.capabilities.Has(CapDel) {
+		return &ErrNotSupported{Capability: CapDel}
+	}
+
 	keybuf := c.compressor.Compress(key)
+	h := c.before(CapDel, keybuf)
+	err := c.del(h, keybuf)
+	c.invalidateHotKeys(keybuf)
+	h.after(true, err)
+	return err
+}
 
-	for _, cache := range c.caches {
-		if err := cache.Del(keybuf); err != nil {
+func (c *kvClient) del(h *hookRun, keybuf string) error {
+	for i, cache := range c.caches {
+		t := h.tier(i, c.labels[i], CapDel, keybuf)
+		err := cache.Del(keybuf)
+		t.after(true, err)
+		if err != nil {
 			return err
 		}
 	}
@@ -172,15 +396,30 @@ func (c *kvClient) Del(key interface{}) error {
 
 // SetEx set with expiration
 func (c *kvClient) SetEx(key interface{}, val interface{}, expiration time.Duration) error {
+	if !c.capabilities.Has(CapSetEx) {
+		return &ErrNotSupported{Capability: CapSetEx}
+	}
+
 	keybuf := c.compressor.Compress(key)
+	h := c.before(CapSetEx, keybuf)
+	err := c.setEx(h, keybuf, val, expiration)
+	c.invalidateHotKeys(keybuf)
+	h.after(true, err)
+	return err
+}
+
+func (c *kvClient) setEx(h *hookRun, keybuf string, val interface{}, expiration time.Duration) error {
 	valbuf, err := c.serializer.Marshal(val)
 
 	if err != nil {
 		return err
 	}
 
-	for _, cache := range c.caches {
-		if err := cache.SetEx(keybuf, valbuf, expiration); err != nil {
+	for i, cache := range c.caches {
+		t := h.tier(i, c.labels[i], CapSetEx, keybuf)
+		err := cache.SetEx(keybuf, valbuf, expiration)
+		t.after(true, err)
+		if err != nil {
 			return err
 		}
 	}
@@ -190,85 +429,185 @@ func (c *kvClient) SetEx(key interface{}, val interface{}, expiration time.Durat
 
 // SetNx set if not exist
 func (c *kvClient) SetNx(key interface{}, val interface{}) (bool, error) {
+	if !c.capabilities.Has(CapSetNx) {
+		return false, &ErrNotSupported{Capability: CapSetNx}
+	}
+
 	keybuf := c.compressor.Compress(key)
+	h := c.before(CapSetNx, keybuf)
+	ok, err := c.setNx(h, keybuf, val)
+	c.invalidateHotKeys(keybuf)
+	h.after(ok, err)
+	return ok, err
+}
+
+func (c *kvClient) setNx(h *hookRun, keybuf string, val interface{}) (bool, error) {
 	valbuf, err := c.serializer.Marshal(val)
 
 	if err != nil {
 		return false, err
 	}
 
-	for i := 0; i < len(c.caches)-1; i++ {
-		if _, err := c.caches[i].SetNx(keybuf, valbuf); err != nil {
+	var ok bool
+	for i, cache := range c.caches {
+		t := h.tier(i, c.labels[i], CapSetNx, keybuf)
+		ok, err = cache.SetNx(keybuf, valbuf)
+		t.after(ok, err)
+		if err != nil {
 			return false, err
 		}
 	}
 
-	return c.caches[len(c.caches)-1].SetNx(keybuf, valbuf)
+	return ok, nil
 }
 
 // SetExNx set with expiration if not exist
 func (c *kvClient) SetExNx(key interface{}, val interface{}, expiration time.Duration) (bool, error) {
+	if !c.capabilities.Has(CapSetExNx) {
+		return false, &ErrNotSupported{Capability: CapSetExNx}
+	}
+
 	keybuf := c.compressor.Compress(key)
+	h := c.before(CapSetExNx, keybuf)
+	ok, err := c.setExNx(h, keybuf, val, expiration)
+	c.invalidateHotKeys(keybuf)
+	h.after(ok, err)
+	return ok, err
+}
+
+func (c *kvClient) setExNx(h *hookRun, keybuf string, val interface{}, expiration time.Duration) (bool, error) {
 	valbuf, err := c.serializer.Marshal(val)
 
 	if err != nil {
 		return false, err
 	}
 
-	for i := 0; i < len(c.caches)-1; i++ {
-		if _, err := c.caches[i].SetExNx(keybuf, valbuf, expiration); err != nil {
+	var ok bool
+	for i, cache := range c.caches {
+		t := h.tier(i, c.labels[i], CapSetExNx, keybuf)
+		ok, err = cache.SetExNx(keybuf, valbuf, expiration)
+		t.after(ok, err)
+		if err != nil {
 			return false, err
 		}
 	}
 
-	return c.caches[len(c.caches)-1].SetExNx(keybuf, valbuf, expiration)
+	return ok, nil
 }
 
 // SetBatch set batch
 func (c *kvClient) SetBatch(keys []interface{}, vals []interface{}) ([]error, error) {
-	if len(keys) != len(vals) {
-		return nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keys), len(vals))
+	if !c.capabilities.Has(CapSetBatch) {
+		return nil, &ErrNotSupported{Capability: CapSetBatch}
 	}
 
-	var err error
 	keybufs := make([]string, len(keys))
-	valbufs := make([][]byte, len(keys))
 	for i := range keys {
 		keybufs[i] = c.compressor.Compress(keys[i])
+	}
+	h := c.before(CapSetBatch, keybufs...)
+	errs, err := c.setBatch(h, keybufs, vals)
+	c.invalidateHotKeys(keybufs...)
+	h.after(true, err)
+	return errs, err
+}
+
+func (c *kvClient) setBatch(h *hookRun, keybufs []string, vals []interface{}) ([]error, error) {
+	if len(keybufs) != len(vals) {
+		return nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keybufs), len(vals))
+	}
+
+	var err error
+	valbufs := make([][]byte, len(vals))
+	for i := range vals {
 		valbufs[i], err = c.serializer.Marshal(vals[i])
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	for i := 0; i < len(c.caches)-1; i++ {
-		if errs, err := c.caches[i].SetBatch(keybufs, valbufs); err != nil {
+	var errs []error
+	for i, cache := range c.caches {
+		t := h.tier(i, c.labels[i], CapSetBatch, keybufs...)
+		errs, err = cache.SetBatch(keybufs, valbufs)
+		t.after(true, err)
+		if err != nil {
 			return errs, err
 		}
 	}
 
-	return c.caches[len(c.caches)-1].SetBatch(keybufs, valbufs)
+	return errs, nil
 }
 
 // GetBatch get batch
 func (c *kvClient) GetBatch(keys []interface{}, vals []interface{}) ([]bool, []error, error) {
-	if len(keys) != len(vals) {
-		return nil, nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keys), len(vals))
+	if !c.capabilities.Has(CapGetBatch) {
+		return nil, nil, &ErrNotSupported{Capability: CapGetBatch}
 	}
 
-	var err error
 	keybufs := make([]string, len(keys))
 	for i := range keys {
 		keybufs[i] = c.compressor.Compress(keys[i])
 	}
+	h := c.before(CapGetBatch, keybufs...)
+	oks, errs, err := c.getBatch(h, keybufs, vals)
+	h.after(true, err)
+	return oks, errs, err
+}
+
+func (c *kvClient) getBatch(h *hookRun, keybufs []string, vals []interface{}) ([]bool, []error, error) {
+	if len(keybufs) != len(vals) {
+		return nil, nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keybufs), len(vals))
+	}
+
+	// promoted keys are served by the hot key detector, others are read from the last tier
+	idxs := make([]int, 0, len(keybufs))
+	hots := make([]bool, len(keybufs))
+	versions := make([]uint64, len(keybufs))
+	valbufs := make([][]byte, len(keybufs))
+	for i, keybuf := range keybufs {
+		if c.hotKeys != nil {
+			hots[i] = c.hotKeys.touch(keybuf)
+			if buf := c.hotKeys.get(keybuf); buf != nil {
+				// a promoted miss is nilValBuf
+				if !bytes.Equal(buf, c.nilValBuf) {
+					valbufs[i] = buf
+				}
+				continue
+			}
+			versions[i] = c.hotKeys.version(keybuf)
+		}
+		idxs = append(idxs, i)
+	}
+	reads := keybufs
+	if len(idxs) != len(keybufs) {
+		reads = make([]string, len(idxs))
+		for j, i := range idxs {
+			reads[j] = keybufs[i]
+		}
+	}
 
-	valbufs, errs, err := c.caches[len(c.caches)-1].GetBatch(keybufs)
+	last := len(c.caches) - 1
+	t := h.tier(last, c.labels[last], CapGetBatch, reads...)
+	bufs, readErrs, err := c.caches[last].GetBatch(reads)
+	t.after(true, err)
 	if err != nil {
 		return nil, nil, err
 	}
+	errs := make([]error, len(keybufs))
+	for j, i := range idxs {
+		valbufs[i], errs[i] = bufs[j], readErrs[j]
+		if hots[i] && errs[i] == nil {
+			if valbufs[i] == nil {
+				c.hotKeys.promote(keybufs[i], c.nilValBuf, versions[i])
+			} else {
+				c.hotKeys.promote(keybufs[i], valbufs[i], versions[i])
+			}
+		}
+	}
 
-	oks := make([]bool, len(keys))
-	for i := range keys {
+	oks := make([]bool, len(keybufs))
+	for i := range keybufs {
 		oks[i] = false
 		if errs[i] != nil {
 			continue
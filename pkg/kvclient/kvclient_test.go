@@ -2,6 +2,7 @@ package kvclient
 
 import (
 	"testing"
+	"time"
 
 	"github.com/hatlonely/kvclient/pkg/mykv"
 	. "github.com/smartystreets/goconvey/convey"
@@ -10,14 +11,19 @@ import (
 func TestKVClient_All(t *testing.T) {
 	Convey("kvclient test", t, func() {
 		freecache := NewFreecacheBuilder().Build()
-		// redis, err := NewRedisClusterStringBuilder().WithExpiration(time.Duration(120) * time.Second).Build()
-		redis, err := NewRedisClusterHashBuilder().Build()
-		So(err, ShouldBeNil)
-		client := NewBuilder().
-			WithCaches([]Cache{freecache, redis}).
+		var backend Cache = NewMapCacheBuilder().Build()
+		if liveBackends() {
+			// redis, err := NewRedisClusterStringBuilder().WithExpiration(time.Duration(120) * time.Second).Build()
+			redis, err := NewRedisClusterHashBuilder().Build()
+			So(err, ShouldBeNil)
+			backend = redis
+		}
+		client, err := NewBuilder().
+			WithCaches([]Cache{freecache, backend}).
 			WithCompressor(&mykv.Compressor{}).
 			WithSerializer(&mykv.Serializer{}).
 			Build()
+		So(err, ShouldBeNil)
 
 		err = client.Set(&mykv.Key{Message: "key1"}, &mykv.Val{Message: "val1"})
 		err = client.Set(&mykv.Key{Message: "key3"}, &mykv.Val{Message: "val3"})
@@ -38,3 +44,44 @@ func TestKVClient_All(t *testing.T) {
 		So(errs, ShouldResemble, []error{nil, nil, nil})
 	})
 }
+
+func TestKVClient_Capabilities(t *testing.T) {
+	Convey("kvclient capabilities test", t, func() {
+		freecache := NewFreecacheBuilder().WithMemBytes(1024 * 1024).Build()
+		bigcache, err := NewBigcacheBuilder().Build()
+		So(err, ShouldBeNil)
+
+		Convey("unsupported operation of a cache returns ErrNotSupported", func() {
+			err := bigcache.SetEx("key", []byte("val"), time.Second)
+			So(IsNotSupported(err), ShouldBeTrue)
+			So(err.Error(), ShouldEqual, "operation [SetEx] not supported")
+		})
+
+		Convey("capabilities of the client are supported by all caches", func() {
+			client, err := NewBuilder().WithCaches([]Cache{freecache, bigcache}).Build()
+			So(err, ShouldBeNil)
+			So(client.Capabilities(), ShouldEqual, CapAll&^(CapSetEx|CapSetExNx))
+
+			_, err = client.SetExNx(&mykv.Key{Message: "key"}, &mykv.Val{Message: "val"}, time.Second)
+			So(IsNotSupported(err), ShouldBeTrue)
+		})
+
+		Convey("build fails if a required capability is not supported", func() {
+			_, err := NewBuilder().WithCaches([]Cache{freecache, bigcache}).WithCapabilities(CapSet | CapSetEx).Build()
+			So(err, ShouldNotBeNil)
+
+			_, err = NewBuilder().WithCaches([]Cache{freecache}).WithCapabilities(CapSet | CapSetEx).Build()
+			So(err, ShouldBeNil)
+		})
+
+		Convey("parse capabilities", func() {
+			capabilities, err := ParseCapabilities([]string{"SetEx", "setnx"})
+			So(err, ShouldBeNil)
+			So(capabilities, ShouldEqual, CapSetEx|CapSetNx)
+			So(capabilities.String(), ShouldEqual, "SetEx|SetNx")
+
+			_, err = ParseCapabilities([]string{"Incr"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
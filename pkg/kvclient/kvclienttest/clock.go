@@ -0,0 +1,31 @@
+package kvclienttest
+
+import (
+	"sync"
+	"time"
+)
+
+// NewFakeClock create a clock stopped at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// FakeClock a clock which moves only when Add is called
+type FakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// Now current time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Add move the clock forward by d
+func (c *FakeClock) Add(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,255 @@
+package kvclienttest
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// CacheFactory create a new cache, called once for each check. caches created by
+// the same factory may share data, such as redis caches of the same server
+type CacheFactory func() (kvclient.Cache, error)
+
+// ConformanceOptions differences of a cache allowed by RunCacheConformanceWithOptions
+type ConformanceOptions struct {
+	// an empty value reads as not found, such as a cache in front of a KVClient
+	EmptyValueNotFound bool
+}
+
+// RunCacheConformance check the caches created by factory follow the contract of
+// kvclient.Cache. operations not in Capabilities must return kvclient.ErrNotSupported,
+// the other checks are skipped for them. expiration is checked with a ttl of 1 second
+func RunCacheConformance(t *testing.T, factory CacheFactory) {
+	RunCacheConformanceWithOptions(t, factory, ConformanceOptions{})
+}
+
+// RunCacheConformanceWithOptions RunCacheConformance with the differences in options
+func RunCacheConformanceWithOptions(t *testing.T, factory CacheFactory, options ConformanceOptions) {
+	Convey("cache conformance", t, func() {
+		cache, err := factory()
+		So(err, ShouldBeNil)
+		So(cache, ShouldNotBeNil)
+		defer cache.Close()
+
+		capabilities := cache.Capabilities()
+		// keys are unique to each check, caches of a factory may share data
+		prefix := fmt.Sprintf("kvclienttest-%v-", time.Now().UnixNano())
+		key := func(name string) string {
+			return prefix + name
+		}
+		get := func(key string) []byte {
+			val, err := cache.Get(key)
+			So(err, ShouldBeNil)
+			return val
+		}
+
+		Convey("unsupported operations return ErrNotSupported", func() {
+			ops := map[kvclient.Capability]func() error{
+				kvclient.CapGet: func() error {
+					_, err := cache.Get(key("key"))
+					return err
+				},
+				kvclient.CapGetBatch: func() error {
+					_, _, err := cache.GetBatch([]string{key("key")})
+					return err
+				},
+				kvclient.CapSet: func() error {
+					return cache.Set(key("key"), []byte("val"))
+				},
+				kvclient.CapDel: func() error {
+					return cache.Del(key("key"))
+				},
+				kvclient.CapSetBatch: func() error {
+					_, err := cache.SetBatch([]string{key("key")}, [][]byte{[]byte("val")})
+					return err
+				},
+				kvclient.CapSetEx: func() error {
+					return cache.SetEx(key("key"), []byte("val"), time.Minute)
+				},
+				kvclient.CapSetNx: func() error {
+					_, err := cache.SetNx(key("key"), []byte("val"))
+					return err
+				},
+				kvclient.CapSetExNx: func() error {
+					_, err := cache.SetExNx(key("key"), []byte("val"), time.Minute)
+					return err
+				},
+			}
+			for capability, op := range ops {
+				if !capabilities.Has(capability) {
+					So(kvclient.IsNotSupported(op()), ShouldBeTrue)
+				}
+			}
+		})
+
+		if capabilities.Has(kvclient.CapGet) {
+			Convey("get a missing key returns nil", func() {
+				So(get(key("missing")), ShouldBeNil)
+			})
+		}
+
+		if capabilities.Has(kvclient.CapDel) {
+			Convey("del a missing key succeeds", func() {
+				So(cache.Del(key("missing")), ShouldBeNil)
+				So(cache.Del(key("missing")), ShouldBeNil)
+			})
+		}
+
+		if capabilities.Has(kvclient.CapGet | kvclient.CapSet | kvclient.CapDel) {
+			Convey("set, get and del a key", func() {
+				So(cache.Set(key("key1"), []byte("val1")), ShouldBeNil)
+				So(get(key("key1")), ShouldResemble, []byte("val1"))
+				So(cache.Set(key("key1"), []byte("val2")), ShouldBeNil)
+				So(get(key("key1")), ShouldResemble, []byte("val2"))
+				So(cache.Del(key("key1")), ShouldBeNil)
+				So(get(key("key1")), ShouldBeNil)
+			})
+		}
+
+		if capabilities.Has(kvclient.CapGet | kvclient.CapSet) {
+			Convey("empty and binary values", func() {
+				So(cache.Set(key("empty"), []byte{}), ShouldBeNil)
+				val := get(key("empty"))
+				if options.EmptyValueNotFound {
+					So(val, ShouldBeNil)
+				} else {
+					So(val, ShouldNotBeNil)
+					So(len(val), ShouldEqual, 0)
+				}
+
+				binary := make([]byte, 256)
+				for i := range binary {
+					binary[i] = byte(i)
+				}
+				So(cache.Set(key("binary"), binary), ShouldBeNil)
+				So(get(key("binary")), ShouldResemble, binary)
+			})
+		}
+
+		if capabilities.Has(kvclient.CapGet | kvclient.CapSetNx) {
+			Convey("set if not exists", func() {
+				ok, err := cache.SetNx(key("nx"), []byte("val1"))
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+				ok, err = cache.SetNx(key("nx"), []byte("val2"))
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeFalse)
+				So(get(key("nx")), ShouldResemble, []byte("val1"))
+			})
+		}
+
+		if capabilities.Has(kvclient.CapSetNx) {
+			Convey("set if not exists is atomic", func() {
+				So(countWins(func(i int) (bool, error) {
+					return cache.SetNx(key("lock"), []byte(fmt.Sprintf("owner-%v", i)))
+				}), ShouldEqual, 1)
+			})
+		}
+
+		if capabilities.Has(kvclient.CapSetExNx) {
+			Convey("set if not exists with expiration is atomic", func() {
+				So(countWins(func(i int) (bool, error) {
+					return cache.SetExNx(key("lock"), []byte(fmt.Sprintf("owner-%v", i)), time.Minute)
+				}), ShouldEqual, 1)
+			})
+		}
+
+		if capabilities.Has(kvclient.CapGet | kvclient.CapSetEx) {
+			Convey("keys expire", func() {
+				So(cache.SetEx(key("ex1"), []byte("val1"), time.Second), ShouldBeNil)
+				So(cache.SetEx(key("ex2"), []byte("val2"), time.Hour), ShouldBeNil)
+				So(get(key("ex1")), ShouldResemble, []byte("val1"))
+				So(eventually(func() bool {
+					return get(key("ex1")) == nil
+				}), ShouldBeTrue)
+				So(get(key("ex2")), ShouldResemble, []byte("val2"))
+			})
+		}
+
+		if capabilities.Has(kvclient.CapSetExNx) {
+			Convey("set if not exists succeeds after expiration", func() {
+				ok, err := cache.SetExNx(key("exnx"), []byte("val1"), time.Second)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+				ok, err = cache.SetExNx(key("exnx"), []byte("val2"), time.Second)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeFalse)
+				So(eventually(func() bool {
+					ok, err := cache.SetExNx(key("exnx"), []byte("val3"), time.Minute)
+					So(err, ShouldBeNil)
+					return ok
+				}), ShouldBeTrue)
+			})
+		}
+
+		if capabilities.Has(kvclient.CapSet | kvclient.CapGetBatch) {
+			Convey("get batch keeps the order of keys with misses", func() {
+				So(cache.Set(key("batch1"), []byte("val1")), ShouldBeNil)
+				So(cache.Set(key("batch3"), []byte("val3")), ShouldBeNil)
+				vals, errs, err := cache.GetBatch([]string{key("batch3"), key("batch2"), key("batch1"), key("batch4")})
+				So(err, ShouldBeNil)
+				So(errs, ShouldResemble, []error{nil, nil, nil, nil})
+				So(vals, ShouldResemble, [][]byte{[]byte("val3"), nil, []byte("val1"), nil})
+
+				vals, errs, err = cache.GetBatch(nil)
+				So(err, ShouldBeNil)
+				So(len(vals), ShouldEqual, 0)
+				So(len(errs), ShouldEqual, 0)
+			})
+		}
+
+		if capabilities.Has(kvclient.CapGet | kvclient.CapSetBatch) {
+			Convey("set batch", func() {
+				_, err := cache.SetBatch([]string{key("batch1"), key("batch2")}, [][]byte{[]byte("val1")})
+				So(err, ShouldNotBeNil)
+
+				errs, err := cache.SetBatch([]string{key("batch1"), key("batch2")}, [][]byte{[]byte("val1"), []byte("val2")})
+				So(err, ShouldBeNil)
+				So(errs, ShouldResemble, []error{nil, nil})
+				So(get(key("batch1")), ShouldResemble, []byte("val1"))
+				So(get(key("batch2")), ShouldResemble, []byte("val2"))
+			})
+		}
+
+		Convey("close is idempotent", func() {
+			So(cache.Close(), ShouldBeNil)
+			So(cache.Close(), ShouldBeNil)
+		})
+	})
+}
+
+// countWins call fn concurrently, return the number of calls returned true
+func countWins(fn func(i int) (bool, error)) int64 {
+	var wg sync.WaitGroup
+	var wins int64
+	start := make(chan struct{})
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			if ok, err := fn(i); err == nil && ok {
+				atomic.AddInt64(&wins, 1)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return wins
+}
+
+// eventually wait until fn returns true, at most 3 seconds
+func eventually(fn func() bool) bool {
+	for deadline := time.Now().Add(time.Duration(3) * time.Second); time.Now().Before(deadline); {
+		if fn() {
+			return true
+		}
+		time.Sleep(time.Duration(50) * time.Millisecond)
+	}
+	return fn()
+}
@@ -0,0 +1,673 @@
+package kvclienttest
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvresp"
+)
+
+// invalidateChannel channel of client side caching invalidation messages
+const invalidateChannel = "__redis__:invalidate"
+
+// NewRedisServer start a stand-in redis server on a random local port
+func NewRedisServer() (*RedisServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &RedisServer{
+		listener: listener,
+		data:     map[string]*redisEntry{},
+		clients:  map[int64]*redisConn{},
+		tracking: map[string]map[int64]bool{},
+		calls:    map[string]int{},
+		done:     make(chan struct{}),
+	}
+
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		s.serve()
+	}()
+	go func() {
+		defer s.wg.Done()
+		s.expireLoop()
+	}()
+
+	return s, nil
+}
+
+// RedisServer a stand-in redis server for tests. it speaks RESP2 and supports
+// the string and hash commands used by kvclient, `CLUSTER SLOTS` as a cluster of
+// one node, and client side caching with `CLIENT TRACKING on REDIRECT <id>`
+// and `SUBSCRIBE __redis__:invalidate`
+type RedisServer struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mutex    sync.Mutex
+	data     map[string]*redisEntry
+	clients  map[int64]*redisConn
+	tracking map[string]map[int64]bool // key -> ids of the clients to send invalidation to
+	calls    map[string]int
+	nextID   int64
+	closed   bool
+	done     chan struct{}
+}
+
+type redisEntry struct {
+	val      []byte
+	hash     map[string][]byte // not nil for hash keys
+	expireAt time.Time
+}
+
+type redisConn struct {
+	id         int64
+	conn       net.Conn
+	writer     *kvresp.Writer
+	mutex      sync.Mutex // guard writer, invalidation messages are written by other clients
+	redirect   int64
+	subscribed map[string]bool
+}
+
+// Addr address of the server, such as "127.0.0.1:6379"
+func (s *RedisServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close the server and all client connections
+func (s *RedisServer) Close() error {
+	s.mutex.Lock()
+	s.closed = true
+	s.mutex.Unlock()
+	close(s.done)
+	err := s.listener.Close()
+	s.CloseClients()
+	s.wg.Wait()
+	return err
+}
+
+// CloseClients close all client connections, to test reconnection
+func (s *RedisServer) CloseClients() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, c := range s.clients {
+		c.conn.Close()
+	}
+}
+
+// Get value of key, as another client
+func (s *RedisServer) Get(key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e := s.lookup(key)
+	if e == nil {
+		return nil, false
+	}
+	return e.val, true
+}
+
+// Set key to val, as another client, tracking clients are invalidated
+func (s *RedisServer) Set(key string, val []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data[key] = &redisEntry{val: val}
+	s.invalidate(key)
+}
+
+// Del key, as another client, tracking clients are invalidated
+func (s *RedisServer) Del(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.data, key)
+	s.invalidate(key)
+}
+
+// TTL of key, 0 if key has no expiration or not exists
+func (s *RedisServer) TTL(key string) time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e := s.lookup(key)
+	if e == nil || e.expireAt.IsZero() {
+		return 0
+	}
+	return time.Until(e.expireAt)
+}
+
+// Tracked return true if any client is tracking key
+func (s *RedisServer) Tracked(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.tracking[key]) != 0
+}
+
+// Calls number of times cmd, such as "get", was called
+func (s *RedisServer) Calls(cmd string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.calls[strings.ToLower(cmd)]
+}
+
+// expireLoop delete expired keys actively like redis, so tracking clients are
+// invalidated even if the keys are not accessed
+func (s *RedisServer) expireLoop() {
+	ticker := time.NewTicker(time.Duration(20) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		s.mutex.Lock()
+		for key := range s.data {
+			s.lookup(key)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+func (s *RedisServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		s.nextID++
+		c := &redisConn{
+			id:         s.nextID,
+			conn:       conn,
+			writer:     kvresp.NewWriter(conn),
+			subscribed: map[string]bool{},
+		}
+		s.clients[c.id] = c
+		s.mutex.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(c)
+		}()
+	}
+}
+
+func (s *RedisServer) handle(c *redisConn) {
+	defer func() {
+		s.mutex.Lock()
+		delete(s.clients, c.id)
+		s.mutex.Unlock()
+		c.conn.Close()
+	}()
+
+	reader := kvresp.NewReader(c.conn)
+	for {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		s.mutex.Lock()
+		reply := s.exec(c, args)
+		s.mutex.Unlock()
+
+		c.mutex.Lock()
+		if replies, ok := reply.(multiReply); ok {
+			for _, r := range replies {
+				c.writer.WriteValue(r)
+			}
+		} else {
+			c.writer.WriteValue(reply)
+		}
+		if reader.Buffered() == 0 {
+			err = c.writer.Flush()
+		}
+		c.mutex.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+var (
+	replyOK       = kvresp.SimpleString("OK")
+	errNotInteger = kvresp.Error("ERR value is not an integer or out of range")
+	errWrongType  = kvresp.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+)
+
+// multiReply several replies of one command, such as SUBSCRIBE with several channels
+type multiReply []interface{}
+
+func errorf(format string, args ...interface{}) kvresp.Error {
+	return kvresp.Error(fmt.Sprintf(format, args...))
+}
+
+func errWrongArgs(cmd string) kvresp.Error {
+	return errorf("ERR wrong number of arguments for '%s' command", cmd)
+}
+
+// commandInfos reply of COMMAND, cluster clients route commands by the key positions
+var commandInfos = []struct {
+	name     string
+	arity    int64
+	readonly bool
+	firstKey int64
+	lastKey  int64
+}{
+	{"ping", -1, true, 0, 0},
+	{"get", 2, true, 1, 1},
+	{"mget", -2, true, 1, -1},
+	{"set", -3, false, 1, 1},
+	{"setnx", 3, false, 1, 1},
+	{"del", -2, false, 1, -1},
+	{"exists", -2, true, 1, -1},
+	{"expire", 3, false, 1, 1},
+	{"pexpire", 3, false, 1, 1},
+	{"ttl", 2, true, 1, 1},
+	{"pttl", 2, true, 1, 1},
+	{"hget", 3, true, 1, 1},
+	{"hset", -4, false, 1, 1},
+	{"hsetnx", 4, false, 1, 1},
+	{"hdel", -3, false, 1, 1},
+	{"hlen", 2, true, 1, 1},
+	{"hgetall", 2, true, 1, 1},
+}
+
+// exec a command with s.mutex held
+func (s *RedisServer) exec(c *redisConn, args [][]byte) interface{} {
+	cmd := strings.ToLower(string(args[0]))
+	s.calls[cmd]++
+	switch cmd {
+	case "ping":
+		if len(args) > 1 {
+			return args[1]
+		}
+		return kvresp.SimpleString("PONG")
+	case "echo":
+		if len(args) != 2 {
+			return errWrongArgs(cmd)
+		}
+		return args[1]
+	case "auth", "select", "quit":
+		return replyOK
+	case "client":
+		return s.execClient(c, args)
+	case "subscribe":
+		var replies multiReply
+		for _, channel := range args[1:] {
+			c.subscribed[string(channel)] = true
+			replies = append(replies, []interface{}{"subscribe", channel, int64(len(c.subscribed))})
+		}
+		return replies
+	case "get":
+		if len(args) != 2 {
+			return errWrongArgs(cmd)
+		}
+		key := string(args[1])
+		s.track(c, key)
+		e := s.lookup(key)
+		if e == nil {
+			return nil
+		}
+		if e.hash != nil {
+			return errWrongType
+		}
+		return e.val
+	case "mget":
+		vals := make([]interface{}, len(args)-1)
+		for i, arg := range args[1:] {
+			key := string(arg)
+			s.track(c, key)
+			if e := s.lookup(key); e != nil && e.hash == nil {
+				vals[i] = e.val
+			}
+		}
+		return vals
+	case "hget", "hset", "hsetnx", "hdel", "hlen", "hgetall":
+		return s.execHash(c, cmd, args)
+	case "set":
+		return s.execSet(args)
+	case "setnx":
+		if len(args) != 3 {
+			return errWrongArgs(cmd)
+		}
+		if s.lookup(string(args[1])) != nil {
+			return int64(0)
+		}
+		s.data[string(args[1])] = &redisEntry{val: args[2]}
+		s.invalidate(string(args[1]))
+		return int64(1)
+	case "del":
+		n := int64(0)
+		for _, arg := range args[1:] {
+			key := string(arg)
+			if s.lookup(key) != nil {
+				delete(s.data, key)
+				s.invalidate(key)
+				n++
+			}
+		}
+		return n
+	case "exists":
+		n := int64(0)
+		for _, arg := range args[1:] {
+			if s.lookup(string(arg)) != nil {
+				n++
+			}
+		}
+		return n
+	case "expire", "pexpire":
+		if len(args) != 3 {
+			return errWrongArgs(cmd)
+		}
+		n, err := strconv.ParseInt(string(args[2]), 10, 64)
+		if err != nil {
+			return errNotInteger
+		}
+		e := s.lookup(string(args[1]))
+		if e == nil {
+			return int64(0)
+		}
+		unit := time.Second
+		if cmd == "pexpire" {
+			unit = time.Millisecond
+		}
+		e.expireAt = time.Now().Add(time.Duration(n) * unit)
+		return int64(1)
+	case "ttl", "pttl":
+		if len(args) != 2 {
+			return errWrongArgs(cmd)
+		}
+		e := s.lookup(string(args[1]))
+		if e == nil {
+			return int64(-2)
+		}
+		if e.expireAt.IsZero() {
+			return int64(-1)
+		}
+		if cmd == "pttl" {
+			return int64(time.Until(e.expireAt) / time.Millisecond)
+		}
+		return int64(time.Until(e.expireAt) / time.Second)
+	case "cluster":
+		return s.execCluster(args)
+	case "command":
+		var infos []interface{}
+		for _, info := range commandInfos {
+			flags := []interface{}{kvresp.SimpleString("write")}
+			if info.readonly {
+				flags = []interface{}{kvresp.SimpleString("readonly")}
+			}
+			infos = append(infos, []interface{}{info.name, info.arity, flags, info.firstKey, info.lastKey, int64(1)})
+		}
+		return infos
+	case "flushall", "flushdb":
+		s.data = map[string]*redisEntry{}
+		s.flush()
+		return replyOK
+	}
+
+	return errorf("ERR unknown command '%s'", cmd)
+}
+
+func (s *RedisServer) execClient(c *redisConn, args [][]byte) interface{} {
+	if len(args) < 2 {
+		return errWrongArgs("client")
+	}
+
+	switch strings.ToLower(string(args[1])) {
+	case "id":
+		return c.id
+	case "setname":
+		return replyOK
+	case "tracking":
+		if len(args) < 3 {
+			return errWrongArgs("client|tracking")
+		}
+		if strings.EqualFold(string(args[2]), "off") {
+			c.redirect = 0
+			return replyOK
+		}
+		redirect := int64(0)
+		for i := 3; i < len(args); i++ {
+			if strings.EqualFold(string(args[i]), "redirect") && i+1 < len(args) {
+				id, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+				if err != nil {
+					return errNotInteger
+				}
+				redirect = id
+				i++
+			}
+		}
+		if redirect == 0 {
+			return errorf("ERR this stand-in server only supports tracking with REDIRECT")
+		}
+		if _, ok := s.clients[redirect]; !ok {
+			return errorf("ERR The client ID you want redirect to does not exist")
+		}
+		c.redirect = redirect
+		return replyOK
+	}
+
+	return errorf("ERR unknown subcommand '%s'", args[1])
+}
+
+func (s *RedisServer) execHash(c *redisConn, cmd string, args [][]byte) interface{} {
+	if len(args) < 2 {
+		return errWrongArgs(cmd)
+	}
+	key := string(args[1])
+	e := s.lookup(key)
+	if e != nil && e.hash == nil {
+		return errWrongType
+	}
+
+	switch cmd {
+	case "hget":
+		if len(args) != 3 {
+			return errWrongArgs(cmd)
+		}
+		s.track(c, key)
+		if e == nil {
+			return nil
+		}
+		return e.hash[string(args[2])]
+	case "hlen":
+		s.track(c, key)
+		if e == nil {
+			return int64(0)
+		}
+		return int64(len(e.hash))
+	case "hgetall":
+		s.track(c, key)
+		var vals [][]byte
+		if e != nil {
+			for field, val := range e.hash {
+				vals = append(vals, []byte(field), val)
+			}
+		}
+		return vals
+	case "hset", "hsetnx":
+		if len(args) < 4 || len(args)%2 != 0 || (cmd == "hsetnx" && len(args) != 4) {
+			return errWrongArgs(cmd)
+		}
+		if e == nil {
+			e = &redisEntry{hash: map[string][]byte{}}
+			s.data[key] = e
+		}
+		n := int64(0)
+		for i := 2; i < len(args); i += 2 {
+			field := string(args[i])
+			if _, ok := e.hash[field]; ok {
+				if cmd == "hsetnx" {
+					return int64(0)
+				}
+			} else {
+				n++
+			}
+			e.hash[field] = args[i+1]
+		}
+		s.invalidate(key)
+		return n
+	case "hdel":
+		n := int64(0)
+		if e != nil {
+			for _, field := range args[2:] {
+				if _, ok := e.hash[string(field)]; ok {
+					delete(e.hash, string(field))
+					n++
+				}
+			}
+			if len(e.hash) == 0 {
+				delete(s.data, key)
+			}
+		}
+		if n != 0 {
+			s.invalidate(key)
+		}
+		return n
+	}
+
+	return errorf("ERR unknown command '%s'", cmd)
+}
+
+// execCluster the server acts as a cluster of one node owning all slots
+func (s *RedisServer) execCluster(args [][]byte) interface{} {
+	if len(args) < 2 {
+		return errWrongArgs("cluster")
+	}
+
+	switch strings.ToLower(string(args[1])) {
+	case "slots":
+		host, port, _ := net.SplitHostPort(s.Addr())
+		p, _ := strconv.ParseInt(port, 10, 64)
+		return []interface{}{
+			[]interface{}{int64(0), int64(16383), []interface{}{host, p, "kvclienttest"}},
+		}
+	case "info":
+		return []byte("cluster_state:ok\r\ncluster_slots_assigned:16384\r\ncluster_known_nodes:1\r\n")
+	}
+
+	return errorf("ERR unknown subcommand '%s'", args[1])
+}
+
+func (s *RedisServer) execSet(args [][]byte) interface{} {
+	if len(args) < 3 {
+		return errWrongArgs("set")
+	}
+	key := string(args[1])
+	e := &redisEntry{val: args[2]}
+	nx, xx := false, false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ex", "px":
+			if i+1 >= len(args) {
+				return errorf("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || n <= 0 {
+				return errorf("ERR invalid expire time in set")
+			}
+			unit := time.Second
+			if strings.EqualFold(string(args[i]), "px") {
+				unit = time.Millisecond
+			}
+			e.expireAt = time.Now().Add(time.Duration(n) * unit)
+			i++
+		default:
+			return errorf("ERR syntax error")
+		}
+	}
+
+	exists := s.lookup(key) != nil
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+	s.data[key] = e
+	s.invalidate(key)
+	return replyOK
+}
+
+// lookup key, expired keys are deleted
+func (s *RedisServer) lookup(key string) *redisEntry {
+	e, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !time.Now().Before(e.expireAt) {
+		delete(s.data, key)
+		s.invalidate(key)
+		return nil
+	}
+	return e
+}
+
+// track key for c if c enabled tracking
+func (s *RedisServer) track(c *redisConn, key string) {
+	if c.redirect == 0 {
+		return
+	}
+	ids, ok := s.tracking[key]
+	if !ok {
+		ids = map[int64]bool{}
+		s.tracking[key] = ids
+	}
+	ids[c.redirect] = true
+}
+
+// invalidate key, send an invalidation message to each tracking client
+func (s *RedisServer) invalidate(key string) {
+	ids := s.tracking[key]
+	delete(s.tracking, key)
+	for id := range ids {
+		s.publish(id, [][]byte{[]byte(key)})
+	}
+}
+
+// flush send a null invalidation message to all tracking clients
+func (s *RedisServer) flush() {
+	ids := map[int64]bool{}
+	for _, m := range s.tracking {
+		for id := range m {
+			ids[id] = true
+		}
+	}
+	s.tracking = map[string]map[int64]bool{}
+	for id := range ids {
+		s.publish(id, nil)
+	}
+}
+
+func (s *RedisServer) publish(id int64, keys [][]byte) {
+	c, ok := s.clients[id]
+	if !ok || !c.subscribed[invalidateChannel] {
+		return
+	}
+	var payload interface{}
+	if keys != nil {
+		payload = keys
+	}
+	c.mutex.Lock()
+	c.writer.WriteValue([]interface{}{"message", invalidateChannel, payload})
+	c.writer.Flush()
+	c.mutex.Unlock()
+}
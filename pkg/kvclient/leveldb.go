@@ -2,9 +2,12 @@ package kvclient
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 // NewLevelDBBuilder create a new LevelDBBuilder
@@ -15,6 +18,8 @@ func NewLevelDBBuilder() *LevelDBBuilder {
 		Strict:        0,
 		NoWriteMerge:  false,
 		Sync:          false,
+		SweepInterval: time.Duration(10) * time.Minute,
+		SweepBatch:    1000,
 	}
 }
 
@@ -25,6 +30,9 @@ type LevelDBBuilder struct {
 	Strict        int
 	NoWriteMerge  bool
 	Sync          bool
+	Expiration    time.Duration
+	SweepInterval time.Duration
+	SweepBatch    int
 }
 
 // WithDirectory option
@@ -57,8 +65,31 @@ func (b *LevelDBBuilder) WithSync(sync bool) *LevelDBBuilder {
 	return b
 }
 
+// WithExpiration option, default expiration of Set, 0 means never expire
+func (b *LevelDBBuilder) WithExpiration(expiration time.Duration) *LevelDBBuilder {
+	b.Expiration = expiration
+	return b
+}
+
+// WithSweepInterval option, interval of the background sweeper which deletes
+// expired keys, 0 disable the sweeper
+func (b *LevelDBBuilder) WithSweepInterval(sweepInterval time.Duration) *LevelDBBuilder {
+	b.SweepInterval = sweepInterval
+	return b
+}
+
+// WithSweepBatch option, max keys deleted by the sweeper in one transaction
+func (b *LevelDBBuilder) WithSweepBatch(sweepBatch int) *LevelDBBuilder {
+	b.SweepBatch = sweepBatch
+	return b
+}
+
 // Build a new LevelDB
 func (b *LevelDBBuilder) Build() (*LevelDB, error) {
+	if b.SweepBatch <= 0 {
+		return nil, fmt.Errorf("sweep batch should be positive, got [%v]", b.SweepBatch)
+	}
+
 	db, err := leveldb.OpenFile(b.Directory, nil)
 	if err != nil {
 		return nil, err
@@ -74,42 +105,77 @@ func (b *LevelDBBuilder) Build() (*LevelDB, error) {
 		Sync:         b.Sync,
 	}
 
-	return &LevelDB{
-		db:       db,
-		roptions: roptions,
-		woptions: woptions,
-	}, nil
+	l := &LevelDB{
+		db:         db,
+		roptions:   roptions,
+		woptions:   woptions,
+		expiration: b.Expiration,
+		sweepBatch: b.SweepBatch,
+		done:       make(chan struct{}),
+	}
+
+	if b.SweepInterval > 0 {
+		l.wg.Add(1)
+		go l.sweepLoop(b.SweepInterval)
+	}
+
+	return l, nil
 }
 
-// LevelDB datasource
+// LevelDB datasource, values are stored with an expire header,
+// expired keys are taken as not found and deleted by the background sweeper
 type LevelDB struct {
 	BaseCache
 
-	db       *leveldb.DB
-	roptions *opt.ReadOptions
-	woptions *opt.WriteOptions
+	db         *leveldb.DB
+	roptions   *opt.ReadOptions
+	woptions   *opt.WriteOptions
+	locker     keyLocker
+	expiration time.Duration
+	sweepBatch int
+	done       chan struct{}
+	wg         sync.WaitGroup
+	closer     Closer
+}
+
+// Capabilities supported operations
+func (l *LevelDB) Capabilities() Capability {
+	return CapAll
 }
 
 // Close leveldb
 func (l *LevelDB) Close() error {
-	return l.db.Close()
+	return l.closer.Close(func() error {
+		close(l.done)
+		l.wg.Wait()
+		return l.db.Close()
+	})
 }
 
 // Get key
 func (l *LevelDB) Get(key string) ([]byte, error) {
-	val, err := l.db.Get([]byte(key), l.roptions)
+	buf, err := l.db.Get([]byte(key), l.roptions)
 	if err == leveldb.ErrNotFound {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
+	val, expireAt := decodeExpire(buf)
+	if isExpired(expireAt, time.Now()) {
+		return nil, nil
+	}
 	return val, nil
 }
 
 // Set key value
 func (l *LevelDB) Set(key string, val []byte) error {
-	return l.db.Put([]byte(key), val, l.woptions)
+	return l.SetEx(key, val, l.expiration)
+}
+
+// SetEx set with expiration
+func (l *LevelDB) SetEx(key string, val []byte, expiration time.Duration) error {
+	return l.db.Put([]byte(key), encodeExpire(val, expireAt(time.Now(), expiration)), l.woptions)
 }
 
 // Del key
@@ -125,8 +191,9 @@ func (l *LevelDB) SetBatch(keys []string, vals [][]byte) ([]error, error) {
 
 	var errs []error
 	batch := &leveldb.Batch{}
+	at := expireAt(time.Now(), l.expiration)
 	for i := range keys {
-		batch.Put([]byte(keys[i]), vals[i])
+		batch.Put([]byte(keys[i]), encodeExpire(vals[i], at))
 		errs = append(errs, nil)
 	}
 	err := l.db.Write(batch, l.woptions)
@@ -134,12 +201,149 @@ func (l *LevelDB) SetBatch(keys []string, vals [][]byte) ([]error, error) {
 	return errs, err
 }
 
-// SetNx set if not exist.
+// SetNx set if not exist, atomic between SetNx/SetExNx callers
 func (l *LevelDB) SetNx(key string, val []byte) (bool, error) {
+	defer l.locker.Lock(key).Unlock()
 	return SetNx(l, key, val)
 }
 
+// SetExNx set with expiration if not exist, atomic between SetNx/SetExNx callers
+func (l *LevelDB) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	defer l.locker.Lock(key).Unlock()
+	return SetExNx(l, key, val, expiration)
+}
+
 // GetBatch keys
 func (l *LevelDB) GetBatch(keys []string) ([][]byte, []error, error) {
 	return GetBatch(l, keys)
 }
+
+// sweepLoop run Sweep every interval until Close
+func (l *LevelDB) sweepLoop(interval time.Duration) {
+	defer l.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.Sweep()
+		}
+	}
+}
+
+// Sweep delete expired keys, return the number of deleted keys
+func (l *LevelDB) Sweep() (int, error) {
+	total := 0
+	var start []byte
+	for {
+		keys, next, err := l.expiredKeys(start)
+		if err != nil {
+			return total, err
+		}
+		n, err := l.deleteExpired(keys)
+		total += n
+		if err != nil || next == nil {
+			return total, err
+		}
+		start = next
+	}
+}
+
+// expiredKeys scan from start, collect at most sweepBatch expired keys,
+// next is the key to continue with, nil if the scan is done
+func (l *LevelDB) expiredKeys(start []byte) ([][]byte, []byte, error) {
+	iter := l.db.NewIterator(nil, &opt.ReadOptions{DontFillCache: true})
+	defer iter.Release()
+
+	var keys [][]byte
+	now := time.Now()
+	ok := iter.First()
+	if start != nil {
+		ok = iter.Seek(start)
+	}
+	for ; ok; ok = iter.Next() {
+		if len(keys) >= l.sweepBatch {
+			return keys, append([]byte{}, iter.Key()...), iter.Error()
+		}
+		if _, expireAt := decodeExpire(iter.Value()); isExpired(expireAt, now) {
+			keys = append(keys, append([]byte{}, iter.Key()...))
+		}
+	}
+
+	return keys, nil, iter.Error()
+}
+
+// deleteExpired delete keys which are still expired in a transaction,
+// so that a key set again after the scan is kept
+func (l *LevelDB) deleteExpired(keys [][]byte) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	tr, err := l.db.OpenTransaction()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	now := time.Now()
+	for _, key := range keys {
+		buf, err := tr.Get(key, nil)
+		if err == leveldb.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			tr.Discard()
+			return 0, err
+		}
+		if _, expireAt := decodeExpire(buf); !isExpired(expireAt, now) {
+			continue
+		}
+		if err := tr.Delete(key, l.woptions); err != nil {
+			tr.Discard()
+			return 0, err
+		}
+		n++
+	}
+
+	if err := tr.Commit(); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// Scan keys with prefix in order
+func (l *LevelDB) Scan(prefix string, fn func(key string, val []byte, ttl time.Duration) bool) error {
+	iter := l.db.NewIterator(util.BytesPrefix([]byte(prefix)), &opt.ReadOptions{DontFillCache: true})
+	defer iter.Release()
+	now := time.Now()
+	for iter.Next() {
+		val, expireAt := decodeExpire(iter.Value())
+		if isExpired(expireAt, now) {
+			continue
+		}
+		if !fn(string(iter.Key()), append([]byte{}, val...), timeToLive(expireAt, now)) {
+			break
+		}
+	}
+	return iter.Error()
+}
+
+// TTL of key, 0 means never expire
+func (l *LevelDB) TTL(key string) (time.Duration, bool, error) {
+	buf, err := l.db.Get([]byte(key), l.roptions)
+	if err == leveldb.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	now := time.Now()
+	if _, expireAt := decodeExpire(buf); !isExpired(expireAt, now) {
+		return timeToLive(expireAt, now), true, nil
+	}
+	return 0, false, nil
+}
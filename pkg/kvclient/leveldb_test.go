@@ -0,0 +1,77 @@
+package kvclient
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLevelDB_Expiration(t *testing.T) {
+	Convey("test leveldb expiration", t, func() {
+		directory, err := ioutil.TempDir("", "leveldb")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+
+		levelDB, err := NewLevelDBBuilder().
+			WithDirectory(directory).
+			WithSweepInterval(time.Duration(20) * time.Millisecond).
+			Build()
+		So(err, ShouldBeNil)
+		defer levelDB.Close()
+
+		Convey("set with expiration, the key is not found after expired", func() {
+			So(levelDB.SetEx("key1", []byte("val1"), time.Duration(50)*time.Millisecond), ShouldBeNil)
+			val, err := levelDB.Get("key1")
+			So(err, ShouldBeNil)
+			So(val, ShouldResemble, []byte("val1"))
+
+			time.Sleep(time.Duration(60) * time.Millisecond)
+			val, err = levelDB.Get("key1")
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+
+			ok, err := levelDB.SetExNx("key1", []byte("val2"), time.Duration(10)*time.Second)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("expired keys are deleted by the sweeper", func() {
+			So(levelDB.SetEx("key2", []byte("val2"), time.Duration(10)*time.Millisecond), ShouldBeNil)
+			So(levelDB.Set("key3", []byte("val3")), ShouldBeNil)
+
+			time.Sleep(time.Duration(100) * time.Millisecond)
+			has, err := levelDB.db.Has([]byte("key2"), nil)
+			So(err, ShouldBeNil)
+			So(has, ShouldBeFalse)
+			has, err = levelDB.db.Has([]byte("key3"), nil)
+			So(err, ShouldBeNil)
+			So(has, ShouldBeTrue)
+		})
+
+		Convey("legacy values without header are still readable", func() {
+			So(levelDB.db.Put([]byte("key4"), []byte("val4"), nil), ShouldBeNil)
+			val, err := levelDB.Get("key4")
+			So(err, ShouldBeNil)
+			So(val, ShouldResemble, []byte("val4"))
+
+			vals, errs, err := levelDB.GetBatch([]string{"key4", "key5"})
+			So(err, ShouldBeNil)
+			So(errs, ShouldResemble, []error{nil, nil})
+			So(vals, ShouldResemble, [][]byte{[]byte("val4"), nil})
+		})
+	})
+}
+
+func TestLevelDBBuilder_SweepBatch(t *testing.T) {
+	Convey("test leveldb sweep batch should be positive", t, func() {
+		directory, err := ioutil.TempDir("", "leveldb")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+
+		_, err = NewLevelDBBuilder().WithDirectory(directory).WithSweepBatch(0).Build()
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,269 @@
+package kvclient
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// NewMapCacheBuilder create a new MapCache builder
+func NewMapCacheBuilder() *MapCacheBuilder {
+	return &MapCacheBuilder{
+		clock: SystemClock{},
+	}
+}
+
+// MapCacheBuilder builder
+type MapCacheBuilder struct {
+	Expiration time.Duration // expire time of Set, 0 means never expire
+	MaxBytes   int           // memory limit of keys and values, 0 means no limit
+
+	clock Clock
+}
+
+// WithExpiration option
+func (b *MapCacheBuilder) WithExpiration(expiration time.Duration) *MapCacheBuilder {
+	b.Expiration = expiration
+	return b
+}
+
+// WithMaxBytes option, the least recently used keys are evicted if exceeded
+func (b *MapCacheBuilder) WithMaxBytes(maxBytes int) *MapCacheBuilder {
+	b.MaxBytes = maxBytes
+	return b
+}
+
+// WithClock option, the clock to decide expiration
+func (b *MapCacheBuilder) WithClock(clock Clock) *MapCacheBuilder {
+	b.clock = clock
+	return b
+}
+
+// Build a new MapCache
+func (b *MapCacheBuilder) Build() *MapCache {
+	clock := b.clock
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	return &MapCache{
+		items:      map[string]*list.Element{},
+		lru:        list.New(),
+		maxBytes:   b.MaxBytes,
+		expiration: b.Expiration,
+		clock:      clock,
+	}
+}
+
+// MapCache pure in memory cache with full semantics of Cache, the reference
+// model for tests and local development. values are copied in and out
+type MapCache struct {
+	BaseCache
+
+	mutex      sync.Mutex
+	items      map[string]*list.Element
+	lru        *list.List // front is the most recently used
+	bytes      int
+	maxBytes   int
+	expiration time.Duration
+	clock      Clock
+}
+
+type mapCacheItem struct {
+	key      string
+	val      []byte
+	expireAt time.Time
+}
+
+func (i *mapCacheItem) size() int {
+	return len(i.key) + len(i.val)
+}
+
+// Capabilities supported operations
+func (c *MapCache) Capabilities() Capability {
+	return CapAll
+}
+
+// Close drop all keys
+func (c *MapCache) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.items = map[string]*list.Element{}
+	c.lru.Init()
+	c.bytes = 0
+	return nil
+}
+
+// Len number of keys, including expired keys not removed yet
+func (c *MapCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.items)
+}
+
+// Bytes memory used by keys and values
+func (c *MapCache) Bytes() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.bytes
+}
+
+// Get get a key
+func (c *MapCache) Get(key string) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.get(key), nil
+}
+
+// Set set a key
+func (c *MapCache) Set(key string, val []byte) error {
+	return c.SetEx(key, val, c.expiration)
+}
+
+// Del delete a key
+func (c *MapCache) Del(key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+	return nil
+}
+
+// SetEx set with expiration, 0 means never expire
+func (c *MapCache) SetEx(key string, val []byte, expiration time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.set(key, val, expiration)
+}
+
+// SetNx set if not exists
+func (c *MapCache) SetNx(key string, val []byte) (bool, error) {
+	return c.SetExNx(key, val, c.expiration)
+}
+
+// SetExNx set if not exists with expiration
+func (c *MapCache) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.get(key) != nil {
+		return false, nil
+	}
+	if err := c.set(key, val, expiration); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetBatch get keys
+func (c *MapCache) GetBatch(keys []string) ([][]byte, []error, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	vals := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		vals[i] = c.get(key)
+	}
+	return vals, errs, nil
+}
+
+// SetBatch set keys
+func (c *MapCache) SetBatch(keys []string, vals [][]byte) ([]error, error) {
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keys), len(vals))
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	errs := make([]error, len(keys))
+	for i := range keys {
+		errs[i] = c.set(keys[i], vals[i], c.expiration)
+	}
+	return errs, nil
+}
+
+// get a copy of the value, nil if not exists or expired
+func (c *MapCache) get(key string) []byte {
+	elem, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+	item := elem.Value.(*mapCacheItem)
+	if !item.expireAt.IsZero() && !c.clock.Now().Before(item.expireAt) {
+		c.remove(elem)
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return append([]byte{}, item.val...)
+}
+
+func (c *MapCache) set(key string, val []byte, expiration time.Duration) error {
+	item := &mapCacheItem{key: key, val: append([]byte{}, val...)}
+	if expiration > 0 {
+		item.expireAt = c.clock.Now().Add(expiration)
+	}
+	if c.maxBytes > 0 && item.size() > c.maxBytes {
+		return fmt.Errorf("size of key [%v] is [%v], larger than max bytes [%v]", key, item.size(), c.maxBytes)
+	}
+
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+	c.items[key] = c.lru.PushFront(item)
+	c.bytes += item.size()
+
+	for c.maxBytes > 0 && c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+	return nil
+}
+
+func (c *MapCache) remove(elem *list.Element) {
+	item := c.lru.Remove(elem).(*mapCacheItem)
+	delete(c.items, item.key)
+	c.bytes -= item.size()
+}
+
+// Snapshot write the keys from the most recently used, implement Snapshotter
+func (c *MapCache) Snapshot(w io.Writer) error {
+	writer, err := newDumpWriter(w)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := c.clock.Now()
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		item := elem.Value.(*mapCacheItem)
+		if !item.expireAt.IsZero() && !now.Before(item.expireAt) {
+			continue
+		}
+		if err := writer.write(item.key, item.val, unixMilli(item.expireAt)); err != nil {
+			return err
+		}
+	}
+	return writer.close()
+}
+
+// Restore keys written by Snapshot behind the keys in the cache, keys that do not fit
+// in max bytes are dropped, implement Snapshotter
+func (c *MapCache) Restore(r io.Reader) error {
+	return readDump(r, c.clock.Now(), func(key string, val []byte, expiration time.Duration) error {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if _, ok := c.items[key]; ok {
+			return nil
+		}
+		item := &mapCacheItem{key: key, val: val}
+		if expiration > 0 {
+			item.expireAt = c.clock.Now().Add(expiration)
+		}
+		if c.maxBytes > 0 && c.bytes+item.size() > c.maxBytes {
+			return nil
+		}
+		c.items[key] = c.lru.PushBack(item)
+		c.bytes += item.size()
+		return nil
+	})
+}
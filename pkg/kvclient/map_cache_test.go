@@ -0,0 +1,71 @@
+package kvclient_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMapCache(t *testing.T) {
+	Convey("test map cache", t, func() {
+		clock := kvclienttest.NewFakeClock(time.Unix(1500000000, 0))
+
+		Convey("keys expire with the clock", func() {
+			mc := kvclient.NewMapCacheBuilder().WithClock(clock).WithExpiration(time.Minute).Build()
+			So(mc.Set("key1", []byte("val1")), ShouldBeNil)
+			So(mc.SetEx("key2", []byte("val2"), time.Hour), ShouldBeNil)
+			So(mc.SetEx("key3", []byte("val3"), 0), ShouldBeNil)
+
+			clock.Add(time.Minute)
+			vals, errs, err := mc.GetBatch([]string{"key1", "key2", "key3"})
+			So(err, ShouldBeNil)
+			So(errs, ShouldResemble, []error{nil, nil, nil})
+			So(vals, ShouldResemble, [][]byte{nil, []byte("val2"), []byte("val3")})
+
+			ok, err := mc.SetExNx("key2", []byte("val4"), time.Hour)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			clock.Add(time.Hour)
+			ok, err = mc.SetExNx("key2", []byte("val4"), time.Hour)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("values are copied", func() {
+			mc := kvclient.NewMapCacheBuilder().Build()
+			val := []byte("val1")
+			So(mc.Set("key1", val), ShouldBeNil)
+			val[0] = 'x'
+			got, _ := mc.Get("key1")
+			So(got, ShouldResemble, []byte("val1"))
+			got[0] = 'y'
+			got, _ = mc.Get("key1")
+			So(got, ShouldResemble, []byte("val1"))
+
+			So(mc.Set("empty", []byte{}), ShouldBeNil)
+			got, _ = mc.Get("empty")
+			So(got, ShouldNotBeNil)
+			So(len(got), ShouldEqual, 0)
+		})
+
+		Convey("the least recently used keys are evicted over max bytes", func() {
+			mc := kvclient.NewMapCacheBuilder().WithMaxBytes(24).Build()
+			So(mc.Set("key1", []byte("val1")), ShouldBeNil)
+			So(mc.Set("key2", []byte("val2")), ShouldBeNil)
+			So(mc.Set("key3", []byte("val3")), ShouldBeNil)
+			So(mc.Bytes(), ShouldEqual, 24)
+
+			mc.Get("key1")
+			So(mc.Set("key4", []byte("val4")), ShouldBeNil)
+			So(mc.Len(), ShouldEqual, 3)
+			vals, _, _ := mc.GetBatch([]string{"key1", "key2", "key3", "key4"})
+			So(vals, ShouldResemble, [][]byte{[]byte("val1"), nil, []byte("val3"), []byte("val4")})
+
+			So(mc.Set("key5", make([]byte, 24)), ShouldNotBeNil)
+			So(mc.Len(), ShouldEqual, 3)
+		})
+	})
+}
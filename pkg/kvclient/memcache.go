@@ -1,7 +1,9 @@
 package kvclient
 
 import (
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
@@ -48,12 +50,15 @@ func (b *MemcacheBuilder) WithTimeout(timeout time.Duration) *MemcacheBuilder {
 
 // Build a MemcacheBuilder
 func (b *MemcacheBuilder) Build() *Memcache {
-	client := memcache.New(strings.Split(b.Address, ",")...)
+	servers := &memcache.ServerList{}
+	servers.SetServers(strings.Split(b.Address, ",")...)
+	client := memcache.NewFromSelector(servers)
 	client.MaxIdleConns = b.PoolSize
 	client.Timeout = b.Timeout
 
 	return &Memcache{
 		client:     client,
+		servers:    servers,
 		expiration: b.Expiration,
 	}
 }
@@ -63,9 +68,15 @@ type Memcache struct {
 	BaseCache
 
 	client     *memcache.Client
+	servers    *memcache.ServerList
 	expiration time.Duration
 }
 
+// Capabilities supported operations
+func (m *Memcache) Capabilities() Capability {
+	return CapAll
+}
+
 // Get key
 func (m *Memcache) Get(key string) (val []byte, err error) {
 	item, err := m.client.Get(key)
@@ -92,9 +103,43 @@ func (m *Memcache) Del(key string) error {
 	return err
 }
 
-// SetBatch set keys values
+// SetBatch set keys values, keys on different servers are set in parallel
 func (m *Memcache) SetBatch(keys []string, vals [][]byte) ([]error, error) {
-	return SetBatch(m, keys, vals)
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keys), len(vals))
+	}
+
+	errs := make([]error, len(keys))
+	groups := map[string][]int{}
+	for i := range keys {
+		addr, err := m.servers.PickServer(keys[i])
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		groups[addr.String()] = append(groups[addr.String()], i)
+	}
+
+	var wg sync.WaitGroup
+	for _, idxs := range groups {
+		wg.Add(1)
+		go func(idxs []int) {
+			for _, i := range idxs {
+				errs[i] = m.Set(keys[i], vals[i])
+			}
+			wg.Done()
+		}(idxs)
+	}
+	wg.Wait()
+
+	var err error
+	for i := range errs {
+		if errs[i] != nil {
+			err = errs[i]
+		}
+	}
+
+	return errs, err
 }
 
 // SetEx set with expiration
@@ -104,15 +149,76 @@ func (m *Memcache) SetEx(key string, val []byte, expiration time.Duration) error
 
 // SetNx set if not exist
 func (m *Memcache) SetNx(key string, val []byte) (bool, error) {
-	return SetNx(m, key, val)
+	return m.SetExNx(key, val, m.expiration)
 }
 
 // SetExNx set if not exists with expiration
 func (m *Memcache) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
-	return SetExNx(m, key, val, expiration)
+	err := m.client.Add(&memcache.Item{Key: key, Value: val, Expiration: int32(expiration / time.Second)})
+	if err == memcache.ErrNotStored {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-// GetBatch keys
+// Touch update the expiration of a key, return false if key not found
+func (m *Memcache) Touch(key string, expiration time.Duration) (bool, error) {
+	err := m.client.Touch(key, int32(expiration/time.Second))
+	if err == memcache.ErrCacheMiss {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetBatch keys with one multi get per server in parallel, vals are in the same order
+// as keys. a failed server only fails its own keys
 func (m *Memcache) GetBatch(keys []string) ([][]byte, []error, error) {
-	return GetBatch(m, keys)
+	vals := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	groups := map[string][]int{}
+	for i := range keys {
+		addr, err := m.servers.PickServer(keys[i])
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		groups[addr.String()] = append(groups[addr.String()], i)
+	}
+
+	var wg sync.WaitGroup
+	for _, idxs := range groups {
+		wg.Add(1)
+		go func(idxs []int) {
+			defer wg.Done()
+			ks := make([]string, len(idxs))
+			for j, i := range idxs {
+				ks[j] = keys[i]
+			}
+			// items read before the error are still returned
+			items, err := m.client.GetMulti(ks)
+			for _, i := range idxs {
+				if item, ok := items[keys[i]]; ok {
+					vals[i] = item.Value
+				} else if err != nil {
+					errs[i] = err
+				}
+			}
+		}(idxs)
+	}
+	wg.Wait()
+
+	var err error
+	for i := range errs {
+		if errs[i] != nil {
+			err = errs[i]
+		}
+	}
+
+	return vals, errs, err
 }
@@ -0,0 +1,186 @@
+package kvclient_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeMemcached an in-memory memcached of the commands used by Memcache: get, gets,
+// set, add, delete and touch
+type fakeMemcached struct {
+	mutex sync.Mutex
+	items map[string]fakeMemcachedItem
+}
+
+type fakeMemcachedItem struct {
+	val      []byte
+	expireAt time.Time
+}
+
+func newFakeMemcached() *fakeMemcached {
+	return &fakeMemcached{items: map[string]fakeMemcachedItem{}}
+}
+
+// set key val without expiration
+func (m *fakeMemcached) set(key string, val []byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.items[key] = fakeMemcachedItem{val: val}
+}
+
+// get key, false if not exists or expired, m.mutex is held
+func (m *fakeMemcached) get(key string) ([]byte, bool) {
+	item, ok := m.items[key]
+	if !ok || (!item.expireAt.IsZero() && !time.Now().Before(item.expireAt)) {
+		delete(m.items, key)
+		return nil, false
+	}
+	return item.val, true
+}
+
+// expireAt of exptime, seconds from now up to 30 days, a unix timestamp beyond
+func (m *fakeMemcached) expireAt(exptime string) time.Time {
+	seconds, _ := strconv.ParseInt(exptime, 10, 64)
+	if seconds == 0 {
+		return time.Time{}
+	}
+	if seconds > 30*24*3600 {
+		return time.Unix(seconds, 0)
+	}
+	return time.Now().Add(time.Duration(seconds) * time.Second)
+}
+
+func (m *fakeMemcached) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				fields := strings.Fields(line)
+				if len(fields) == 0 {
+					fmt.Fprint(conn, "ERROR\r\n")
+					continue
+				}
+				switch {
+				case fields[0] == "get" || fields[0] == "gets":
+					m.mutex.Lock()
+					for _, key := range fields[1:] {
+						if val, ok := m.get(key); ok {
+							fmt.Fprintf(conn, "VALUE %v 0 %v 1\r\n%s\r\n", key, len(val), val)
+						}
+					}
+					m.mutex.Unlock()
+					fmt.Fprint(conn, "END\r\n")
+				case (fields[0] == "set" || fields[0] == "add") && len(fields) >= 5:
+					size, _ := strconv.Atoi(fields[4])
+					buf := make([]byte, size+2)
+					if _, err := io.ReadFull(r, buf); err != nil {
+						return
+					}
+					m.mutex.Lock()
+					_, exists := m.get(fields[1])
+					if fields[0] == "add" && exists {
+						m.mutex.Unlock()
+						fmt.Fprint(conn, "NOT_STORED\r\n")
+						continue
+					}
+					m.items[fields[1]] = fakeMemcachedItem{val: buf[:size], expireAt: m.expireAt(fields[3])}
+					m.mutex.Unlock()
+					fmt.Fprint(conn, "STORED\r\n")
+				case fields[0] == "delete" && len(fields) >= 2:
+					m.mutex.Lock()
+					_, exists := m.get(fields[1])
+					delete(m.items, fields[1])
+					m.mutex.Unlock()
+					if exists {
+						fmt.Fprint(conn, "DELETED\r\n")
+					} else {
+						fmt.Fprint(conn, "NOT_FOUND\r\n")
+					}
+				case fields[0] == "touch" && len(fields) >= 3:
+					m.mutex.Lock()
+					val, exists := m.get(fields[1])
+					if exists {
+						m.items[fields[1]] = fakeMemcachedItem{val: val, expireAt: m.expireAt(fields[2])}
+					}
+					m.mutex.Unlock()
+					if exists {
+						fmt.Fprint(conn, "TOUCHED\r\n")
+					} else {
+						fmt.Fprint(conn, "NOT_FOUND\r\n")
+					}
+				default:
+					fmt.Fprint(conn, "ERROR\r\n")
+				}
+			}
+		}(conn)
+	}
+}
+
+func TestMemcache_GetBatch(t *testing.T) {
+	Convey("test memcache get batch with a failed server", t, func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer listener.Close()
+		fake := newFakeMemcached()
+		go fake.serve(listener)
+		down, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		down.Close()
+
+		c := kvclient.NewMemcacheBuilder().WithAddress(listener.Addr().String() + "," + down.Addr().String()).Build()
+		defer c.Close()
+		var keys []string
+		for i := 0; i < 20; i++ {
+			keys = append(keys, fmt.Sprintf("key%v", i))
+			fake.set(keys[i], []byte("val-"+keys[i]))
+		}
+		vals, errs, err := c.GetBatch(keys)
+		So(err, ShouldNotBeNil)
+		So(len(vals), ShouldEqual, len(keys))
+		found, failed := 0, 0
+		for i := range keys {
+			if errs[i] != nil {
+				So(vals[i], ShouldBeNil)
+				failed++
+			} else {
+				So(string(vals[i]), ShouldEqual, "val-"+keys[i])
+				found++
+			}
+		}
+		So(found, ShouldBeGreaterThan, 0)
+		So(failed, ShouldBeGreaterThan, 0)
+	})
+}
+
+func TestMemcache_Conformance(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go newFakeMemcached().serve(listener)
+
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewMemcacheBuilder().WithAddress(listener.Addr().String()).Build(), nil
+	})
+}
@@ -0,0 +1,228 @@
+package kvclient
+
+import (
+	"expvar"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metrics recorded by kvclient, the labels of a metric are always the same
+const (
+	// requests of each cache, labels: tier, class, name, op, result
+	MetricCacheRequests = "kvclient_cache_requests_total"
+	// latency of each cache in seconds, labels: tier, class, name, op
+	MetricCacheDuration = "kvclient_cache_request_duration_seconds"
+	// sizes of values read and written, labels: tier, class, name, op
+	MetricCacheValueSize = "kvclient_cache_value_size_bytes"
+	// keys set into a tier after found in a later tier by Get, labels: tier, class, name
+	MetricBackfills = "kvclient_backfills_total"
+)
+
+// results of MetricCacheRequests
+const (
+	MetricResultHit    = "hit"    // Get found the key
+	MetricResultMiss   = "miss"   // Get found no key
+	MetricResultOK     = "ok"     // other operations succeeded
+	MetricResultExists = "exists" // SetNx/SetExNx did not set as the key exists
+	MetricResultError  = "error"
+)
+
+// MetricsSink receive metrics of kvclient
+type MetricsSink interface {
+	// Count add delta to a counter
+	Count(name string, labels map[string]string, delta float64)
+	// Observe add an observation to a histogram
+	Observe(name string, labels map[string]string, value float64)
+}
+
+// CacheLabels labels of a cache tier in metrics
+type CacheLabels struct {
+	Class string // class in kvcfg, such as "RedisString"
+	Name  string // name in kvcfg
+}
+
+// defaultCacheLabels labels of a cache without labels configured
+func defaultCacheLabels(i int, cache Cache) CacheLabels {
+	t := reflect.TypeOf(cache)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return CacheLabels{Class: t.Name(), Name: fmt.Sprintf("cache%v", i)}
+}
+
+// metricsCache record the metrics of a cache tier
+type metricsCache struct {
+	cache  Cache
+	sink   MetricsSink
+	tier   string
+	labels CacheLabels
+}
+
+func newMetricsCache(i int, cache Cache, labels CacheLabels, sink MetricsSink) *metricsCache {
+	return &metricsCache{
+		cache:  cache,
+		sink:   sink,
+		tier:   strconv.Itoa(i),
+		labels: labels,
+	}
+}
+
+func (c *metricsCache) cacheLabels() map[string]string {
+	return map[string]string{"tier": c.tier, "class": c.labels.Class, "name": c.labels.Name}
+}
+
+func (c *metricsCache) observe(ts time.Time, capability Capability, result string, vals ...[]byte) {
+	labels := c.cacheLabels()
+	labels["op"] = capability.String()
+	c.sink.Observe(MetricCacheDuration, labels, time.Since(ts).Seconds())
+	for _, val := range vals {
+		if val != nil {
+			c.sink.Observe(MetricCacheValueSize, labels, float64(len(val)))
+		}
+	}
+	labels["result"] = result
+	c.sink.Count(MetricCacheRequests, labels, 1)
+}
+
+func (c *metricsCache) backfill() {
+	c.sink.Count(MetricBackfills, c.cacheLabels(), 1)
+}
+
+func metricResult(err error) string {
+	if err != nil {
+		return MetricResultError
+	}
+	return MetricResultOK
+}
+
+func metricNxResult(ok bool, err error) string {
+	if err == nil && !ok {
+		return MetricResultExists
+	}
+	return metricResult(err)
+}
+
+func (c *metricsCache) Capabilities() Capability {
+	return c.cache.Capabilities()
+}
+
+func (c *metricsCache) Close() error {
+	return c.cache.Close()
+}
+
+func (c *metricsCache) Get(key string) ([]byte, error) {
+	ts := time.Now()
+	val, err := c.cache.Get(key)
+	result := metricResult(err)
+	if err == nil && val != nil {
+		result = MetricResultHit
+	} else if err == nil {
+		result = MetricResultMiss
+	}
+	c.observe(ts, CapGet, result, val)
+	return val, err
+}
+
+func (c *metricsCache) GetBatch(keys []string) ([][]byte, []error, error) {
+	ts := time.Now()
+	vals, errs, err := c.cache.GetBatch(keys)
+	c.observe(ts, CapGetBatch, metricResult(err), vals...)
+	return vals, errs, err
+}
+
+func (c *metricsCache) Set(key string, val []byte) error {
+	ts := time.Now()
+	err := c.cache.Set(key, val)
+	c.observe(ts, CapSet, metricResult(err), val)
+	return err
+}
+
+func (c *metricsCache) Del(key string) error {
+	ts := time.Now()
+	err := c.cache.Del(key)
+	c.observe(ts, CapDel, metricResult(err))
+	return err
+}
+
+func (c *metricsCache) SetBatch(keys []string, vals [][]byte) ([]error, error) {
+	ts := time.Now()
+	errs, err := c.cache.SetBatch(keys, vals)
+	c.observe(ts, CapSetBatch, metricResult(err), vals...)
+	return errs, err
+}
+
+func (c *metricsCache) SetEx(key string, val []byte, expiration time.Duration) error {
+	ts := time.Now()
+	err := c.cache.SetEx(key, val, expiration)
+	c.observe(ts, CapSetEx, metricResult(err), val)
+	return err
+}
+
+func (c *metricsCache) SetNx(key string, val []byte) (bool, error) {
+	ts := time.Now()
+	ok, err := c.cache.SetNx(key, val)
+	c.observe(ts, CapSetNx, metricNxResult(ok, err), val)
+	return ok, err
+}
+
+func (c *metricsCache) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	ts := time.Now()
+	ok, err := c.cache.SetExNx(key, val, expiration)
+	c.observe(ts, CapSetExNx, metricNxResult(ok, err), val)
+	return ok, err
+}
+
+// NewExpvarSink create a new ExpvarSink
+func NewExpvarSink() *ExpvarSink {
+	return &ExpvarSink{maps: map[string]*expvar.Map{}}
+}
+
+// ExpvarSink publish metrics with expvar, for processes without prometheus. each metric
+// is an expvar.Map keyed by its labels, such as `op=Get,result=hit`. a histogram only
+// keeps the count and the sum of observations, as `<labels>:count` and `<labels>:sum`
+type ExpvarSink struct {
+	mutex sync.Mutex
+	maps  map[string]*expvar.Map
+}
+
+// Count add delta to a counter
+func (s *ExpvarSink) Count(name string, labels map[string]string, delta float64) {
+	s.get(name).AddFloat(expvarKey(labels), delta)
+}
+
+// Observe add an observation to a histogram
+func (s *ExpvarSink) Observe(name string, labels map[string]string, value float64) {
+	m := s.get(name)
+	key := expvarKey(labels)
+	m.AddFloat(key+":count", 1)
+	m.AddFloat(key+":sum", value)
+}
+
+// get the map of a metric, published maps are shared as expvar names are global
+func (s *ExpvarSink) get(name string) *expvar.Map {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if m, ok := s.maps[name]; ok {
+		return m
+	}
+	m, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		m = expvar.NewMap(name)
+	}
+	s.maps[name] = m
+	return m
+}
+
+func expvarKey(labels map[string]string) string {
+	kvs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
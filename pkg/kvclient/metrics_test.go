@@ -0,0 +1,110 @@
+package kvclient_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testSink keep counters by name and sorted labels
+type testSink struct {
+	mutex    sync.Mutex
+	counters map[string]float64
+	observes map[string]int
+}
+
+func newTestSink() *testSink {
+	return &testSink{counters: map[string]float64{}, observes: map[string]int{}}
+}
+
+func (s *testSink) key(name string, labels map[string]string) string {
+	var kvs []string
+	for k, v := range labels {
+		kvs = append(kvs, fmt.Sprintf("%v=%v", k, v))
+	}
+	sort.Strings(kvs)
+	return name + "{" + strings.Join(kvs, ",") + "}"
+}
+
+func (s *testSink) Count(name string, labels map[string]string, delta float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.counters[s.key(name, labels)] += delta
+}
+
+func (s *testSink) Observe(name string, labels map[string]string, value float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.observes[s.key(name, labels)]++
+}
+
+type testCompressor struct{}
+
+func (testCompressor) Compress(key interface{}) string {
+	return key.(string)
+}
+
+type testSerializer struct{}
+
+func (testSerializer) Marshal(val interface{}) ([]byte, error) {
+	return []byte(val.(string)), nil
+}
+
+func (testSerializer) Unmarshal(buf []byte, val interface{}) error {
+	*(val.(*string)) = string(buf)
+	return nil
+}
+
+func TestKVClient_Metrics(t *testing.T) {
+	Convey("test kvclient metrics", t, func() {
+		sink := newTestSink()
+		local := kvclient.NewMapCacheBuilder().Build()
+		remote := kvclient.NewMapCacheBuilder().Build()
+		client, err := kvclient.NewBuilder().
+			WithCaches([]kvclient.Cache{local, remote}).
+			WithCompressor(testCompressor{}).
+			WithSerializer(testSerializer{}).
+			WithMetricsSink(sink).
+			WithCacheLabels([]kvclient.CacheLabels{{Class: "MapCache", Name: "local"}, {Class: "MapCache", Name: "remote"}}).
+			Build()
+		So(err, ShouldBeNil)
+		So(client.CacheHitRate(), ShouldResemble, []float64{0, 0})
+		// the tiers are not wrapped by the metrics, kvctl inspects them by their types
+		So(client.Caches()[0], ShouldEqual, local)
+		So(client.Caches()[1], ShouldEqual, remote)
+
+		So(remote.Set("key1", []byte("val1")), ShouldBeNil)
+		var val string
+		ok, err := client.Get("key1", &val)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		ok, err = client.Get("key1", &val)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(client.CacheHitRate(), ShouldResemble, []float64{0.5, 1})
+
+		So(sink.counters, ShouldResemble, map[string]float64{
+			"kvclient_cache_requests_total{class=MapCache,name=local,op=Get,result=miss,tier=0}": 1,
+			"kvclient_cache_requests_total{class=MapCache,name=local,op=Get,result=hit,tier=0}":  1,
+			"kvclient_cache_requests_total{class=MapCache,name=remote,op=Get,result=hit,tier=1}": 1,
+			"kvclient_cache_requests_total{class=MapCache,name=local,op=Set,result=ok,tier=0}":   1,
+			"kvclient_backfills_total{class=MapCache,name=local,tier=0}":                         1,
+		})
+		So(sink.observes["kvclient_cache_value_size_bytes{class=MapCache,name=local,op=Get,tier=0}"], ShouldEqual, 1)
+		So(sink.observes["kvclient_cache_request_duration_seconds{class=MapCache,name=local,op=Get,tier=0}"], ShouldEqual, 2)
+
+		Convey("labels are checked", func() {
+			_, err := kvclient.NewBuilder().
+				WithCaches([]kvclient.Cache{local, remote}).
+				WithMetricsSink(sink).
+				WithCacheLabels([]kvclient.CacheLabels{{Class: "MapCache", Name: "local"}}).
+				Build()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package kvclient
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile map size bytes of a file read only, nil for an empty file
+func mmapFile(fp *os.File, size int64) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	return syscall.Mmap(int(fp.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmapFile unmap data returned by mmapFile
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,26 @@
+//go:build windows
+// +build windows
+
+package kvclient
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile read size bytes of a file into memory, there is no mmap in syscall on windows
+func mmapFile(fp *os.File, size int64) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(fp, 0, size), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// munmapFile release data returned by mmapFile
+func munmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,310 @@
+package kvclient
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// results of a TraceRecord
+const (
+	TraceResultOK     = "ok"
+	TraceResultMiss   = "miss"   // Get found no key
+	TraceResultExists = "exists" // SetNx/SetExNx did not set as the key exists
+	TraceResultError  = "error"
+)
+
+// TraceRecord one operation of a trace, written as a line of json
+type TraceRecord struct {
+	Time    int64    `json:"time"`             // start time, unix nanoseconds
+	Op      string   `json:"op"`               // operation, such as "Get", "SetBatch"
+	Keys    []string `json:"keys"`             // one key except batch operations
+	Base64  bool     `json:"base64,omitempty"` // keys are base64 encoded, as some are not valid utf8
+	Sizes   []int    `json:"sizes,omitempty"`  // sizes of values written or read, -1 for keys not found
+	Hashes  []string `json:"hashes,omitempty"` // fnv64a of the values, if enabled
+	TTL     int64    `json:"ttl,omitempty"`    // expiration of SetEx/SetExNx, nanoseconds
+	Latency int64    `json:"latency"`          // nanoseconds
+	Result  string   `json:"result"`           // one of "ok", "miss", "exists", "error"
+	Error   string   `json:"error,omitempty"`  // error message if result is "error"
+}
+
+// DecodeKeys keys of the record
+func (r *TraceRecord) DecodeKeys() ([]string, error) {
+	if !r.Base64 {
+		return r.Keys, nil
+	}
+	keys := make([]string, len(r.Keys))
+	for i, k := range r.Keys {
+		buf, err := base64.StdEncoding.DecodeString(k)
+		if err != nil {
+			return nil, fmt.Errorf("decode key [%v] failed: %v", k, err)
+		}
+		keys[i] = string(buf)
+	}
+	return keys, nil
+}
+
+// NewRecordingCacheBuilder create a new RecordingCache builder
+func NewRecordingCacheBuilder() *RecordingCacheBuilder {
+	return &RecordingCacheBuilder{
+		Filename: "trace.jsonl",
+	}
+}
+
+// RecordingCacheBuilder builder
+type RecordingCacheBuilder struct {
+	Filename   string // trace file, appended if exists
+	HashValues bool   // record fnv64a of values besides sizes
+
+	cache  Cache
+	writer io.Writer
+}
+
+// WithFilename option
+func (b *RecordingCacheBuilder) WithFilename(filename string) *RecordingCacheBuilder {
+	b.Filename = filename
+	return b
+}
+
+// WithHashValues option
+func (b *RecordingCacheBuilder) WithHashValues(hashValues bool) *RecordingCacheBuilder {
+	b.HashValues = hashValues
+	return b
+}
+
+// WithWriter option, write the trace to writer instead of Filename
+func (b *RecordingCacheBuilder) WithWriter(writer io.Writer) *RecordingCacheBuilder {
+	b.writer = writer
+	return b
+}
+
+// WithCache option, the cache to record
+func (b *RecordingCacheBuilder) WithCache(cache Cache) *RecordingCacheBuilder {
+	b.cache = cache
+	return b
+}
+
+// Build a new RecordingCache
+func (b *RecordingCacheBuilder) Build() (*RecordingCache, error) {
+	if b.cache == nil {
+		return nil, fmt.Errorf("no cache to record")
+	}
+
+	c := &RecordingCache{
+		cache:      b.cache,
+		hashValues: b.HashValues,
+	}
+	if b.writer != nil {
+		c.writer = bufio.NewWriter(b.writer)
+	} else {
+		fp, err := os.OpenFile(b.Filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		c.file = fp
+		c.writer = bufio.NewWriter(fp)
+	}
+	c.encoder = json.NewEncoder(c.writer)
+
+	return c, nil
+}
+
+// RecordingCache record every operation of a cache into a trace, which can be
+// replayed by Replayer against other caches. values are not recorded, only sizes
+type RecordingCache struct {
+	cache      Cache
+	hashValues bool
+
+	mutex   sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	err     error // first write error, returned by Flush and Close
+	closer  Closer
+}
+
+// Capabilities of the cache
+func (c *RecordingCache) Capabilities() Capability {
+	return c.cache.Capabilities()
+}
+
+// Flush buffered records
+func (c *RecordingCache) Flush() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.writer.Flush(); err != nil && c.err == nil {
+		c.err = err
+	}
+	return c.err
+}
+
+// Close flush the trace and close the cache
+func (c *RecordingCache) Close() error {
+	return c.closer.Close(func() error {
+		err := c.Flush()
+		if c.file != nil {
+			if ferr := c.file.Close(); ferr != nil && err == nil {
+				err = ferr
+			}
+		}
+		if cerr := c.cache.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		return err
+	})
+}
+
+// Get get a key
+func (c *RecordingCache) Get(key string) ([]byte, error) {
+	ts := time.Now()
+	val, err := c.cache.Get(key)
+	r := c.record(ts, CapGet, []string{key}, err)
+	if err == nil {
+		if val == nil {
+			r.Result = TraceResultMiss
+		}
+		c.values(r, [][]byte{val})
+	}
+	c.write(r)
+	return val, err
+}
+
+// Set set a key
+func (c *RecordingCache) Set(key string, val []byte) error {
+	ts := time.Now()
+	err := c.cache.Set(key, val)
+	r := c.record(ts, CapSet, []string{key}, err)
+	c.values(r, [][]byte{val})
+	c.write(r)
+	return err
+}
+
+// Del delete a key
+func (c *RecordingCache) Del(key string) error {
+	ts := time.Now()
+	err := c.cache.Del(key)
+	c.write(c.record(ts, CapDel, []string{key}, err))
+	return err
+}
+
+// SetEx set with expiration
+func (c *RecordingCache) SetEx(key string, val []byte, expiration time.Duration) error {
+	ts := time.Now()
+	err := c.cache.SetEx(key, val, expiration)
+	r := c.record(ts, CapSetEx, []string{key}, err)
+	r.TTL = int64(expiration)
+	c.values(r, [][]byte{val})
+	c.write(r)
+	return err
+}
+
+// SetNx set if not exists
+func (c *RecordingCache) SetNx(key string, val []byte) (bool, error) {
+	ts := time.Now()
+	ok, err := c.cache.SetNx(key, val)
+	r := c.record(ts, CapSetNx, []string{key}, err)
+	if err == nil && !ok {
+		r.Result = TraceResultExists
+	}
+	c.values(r, [][]byte{val})
+	c.write(r)
+	return ok, err
+}
+
+// SetExNx set if not exists with expiration
+func (c *RecordingCache) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	ts := time.Now()
+	ok, err := c.cache.SetExNx(key, val, expiration)
+	r := c.record(ts, CapSetExNx, []string{key}, err)
+	r.TTL = int64(expiration)
+	if err == nil && !ok {
+		r.Result = TraceResultExists
+	}
+	c.values(r, [][]byte{val})
+	c.write(r)
+	return ok, err
+}
+
+// GetBatch get keys, keys failed alone are recorded as not found
+func (c *RecordingCache) GetBatch(keys []string) ([][]byte, []error, error) {
+	ts := time.Now()
+	vals, errs, err := c.cache.GetBatch(keys)
+	r := c.record(ts, CapGetBatch, keys, err)
+	if err == nil {
+		c.values(r, vals)
+	}
+	c.write(r)
+	return vals, errs, err
+}
+
+// SetBatch set keys
+func (c *RecordingCache) SetBatch(keys []string, vals [][]byte) ([]error, error) {
+	ts := time.Now()
+	errs, err := c.cache.SetBatch(keys, vals)
+	r := c.record(ts, CapSetBatch, keys, err)
+	c.values(r, vals)
+	c.write(r)
+	return errs, err
+}
+
+func (c *RecordingCache) record(ts time.Time, capability Capability, keys []string, err error) *TraceRecord {
+	r := &TraceRecord{
+		Time:    ts.UnixNano(),
+		Op:      capability.String(),
+		Keys:    keys,
+		Latency: int64(time.Since(ts)),
+		Result:  TraceResultOK,
+	}
+	for _, key := range keys {
+		if !utf8.ValidString(key) {
+			r.Base64 = true
+			break
+		}
+	}
+	if r.Base64 {
+		r.Keys = make([]string, len(keys))
+		for i, key := range keys {
+			r.Keys[i] = base64.StdEncoding.EncodeToString([]byte(key))
+		}
+	}
+	if err != nil {
+		r.Result = TraceResultError
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// values record sizes and hashes of vals, nil values are recorded as -1
+func (c *RecordingCache) values(r *TraceRecord, vals [][]byte) {
+	r.Sizes = make([]int, len(vals))
+	if c.hashValues {
+		r.Hashes = make([]string, len(vals))
+	}
+	for i, val := range vals {
+		if val == nil {
+			r.Sizes[i] = -1
+			continue
+		}
+		r.Sizes[i] = len(val)
+		if c.hashValues {
+			h := fnv.New64a()
+			h.Write(val)
+			r.Hashes[i] = fmt.Sprintf("%016x", h.Sum64())
+		}
+	}
+}
+
+func (c *RecordingCache) write(r *TraceRecord) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.encoder.Encode(r); err != nil && c.err == nil {
+		c.err = err
+	}
+}
@@ -0,0 +1,125 @@
+package kvclient_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecordingCache(t *testing.T) {
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewRecordingCacheBuilder().WithWriter(&bytes.Buffer{}).WithCache(kvclient.NewMapCacheBuilder().Build()).Build()
+	})
+
+	Convey("test recording cache", t, func() {
+		buf := &bytes.Buffer{}
+		rc, err := kvclient.NewRecordingCacheBuilder().
+			WithWriter(buf).
+			WithHashValues(true).
+			WithCache(kvclient.NewMapCacheBuilder().Build()).
+			Build()
+		So(err, ShouldBeNil)
+
+		So(rc.Set("key1", []byte("val1")), ShouldBeNil)
+		So(rc.SetEx("key2", []byte("val22"), time.Minute), ShouldBeNil)
+		rc.Get("key1")
+		rc.Get("key3")
+		ok, _ := rc.SetNx("key1", []byte("val"))
+		So(ok, ShouldBeFalse)
+		rc.GetBatch([]string{"key2", "key3"})
+		So(rc.Del("key1"), ShouldBeNil)
+		rc.Get("\xff\xfe")
+		So(rc.Flush(), ShouldBeNil)
+		trace := buf.String()
+
+		Convey("every operation is recorded", func() {
+			var records []*kvclient.TraceRecord
+			for _, line := range strings.Split(strings.TrimSpace(trace), "\n") {
+				record := &kvclient.TraceRecord{}
+				So(json.Unmarshal([]byte(line), record), ShouldBeNil)
+				records = append(records, record)
+			}
+			So(len(records), ShouldEqual, 8)
+
+			So(records[0].Op, ShouldEqual, "Set")
+			So(records[0].Keys, ShouldResemble, []string{"key1"})
+			So(records[0].Sizes, ShouldResemble, []int{4})
+			So(len(records[0].Hashes[0]), ShouldEqual, 16)
+			So(records[1].TTL, ShouldEqual, int64(time.Minute))
+			So(records[2].Result, ShouldEqual, kvclient.TraceResultOK)
+			So(records[3].Result, ShouldEqual, kvclient.TraceResultMiss)
+			So(records[3].Sizes, ShouldResemble, []int{-1})
+			So(records[4].Result, ShouldEqual, kvclient.TraceResultExists)
+			So(records[5].Sizes, ShouldResemble, []int{5, -1})
+			So(records[6].Op, ShouldEqual, "Del")
+
+			So(records[7].Base64, ShouldBeTrue)
+			keys, err := records[7].DecodeKeys()
+			So(err, ShouldBeNil)
+			So(keys, ShouldResemble, []string{"\xff\xfe"})
+		})
+
+		Convey("replay against a cache", func() {
+			mc := kvclient.NewMapCacheBuilder().Build()
+			replayer, err := kvclient.NewReplayerBuilder().WithReader(strings.NewReader(trace)).WithCache(mc).Build()
+			So(err, ShouldBeNil)
+			stats, err := replayer.Replay()
+			So(err, ShouldBeNil)
+			So(stats.Operations["Get"].Count, ShouldEqual, 3)
+			So(stats.Operations["Set"].Count, ShouldEqual, 1)
+			for _, s := range stats.Operations {
+				So(s.Errors, ShouldEqual, 0)
+				So(s.Mismatches, ShouldEqual, 0)
+			}
+			val, _ := mc.Get("key2")
+			So(len(val), ShouldEqual, 5)
+		})
+
+		Convey("replay against a kvclient", func() {
+			client, err := kvclient.NewBuilder().
+				WithCaches([]kvclient.Cache{kvclient.NewMapCacheBuilder().Build()}).
+				WithCompressor(testCompressor{}).
+				WithSerializer(testSerializer{}).
+				Build()
+			So(err, ShouldBeNil)
+			replayer, err := kvclient.NewReplayerBuilder().WithReader(strings.NewReader(trace)).WithKVClient(client).Build()
+			So(err, ShouldBeNil)
+			stats, err := replayer.Replay()
+			So(err, ShouldBeNil)
+			for _, s := range stats.Operations {
+				So(s.Errors, ShouldEqual, 0)
+				So(s.Mismatches, ShouldEqual, 0)
+			}
+
+			// the codecs of the client are kept
+			So(client.Set("key9", "val9"), ShouldBeNil)
+			var val string
+			ok, err := client.Get("key9", &val)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(val, ShouldEqual, "val9")
+		})
+
+		Convey("replay keeps the timing", func() {
+			trace := `{"time":0,"op":"Set","keys":["key1"],"sizes":[1],"latency":0,"result":"ok"}
+{"time":200000000,"op":"Get","keys":["key1"],"sizes":[1],"latency":0,"result":"ok"}`
+			replayer, err := kvclient.NewReplayerBuilder().
+				WithReader(strings.NewReader(trace)).
+				WithKeepTiming(true).
+				WithSpeed(2).
+				WithCache(kvclient.NewMapCacheBuilder().Build()).
+				Build()
+			So(err, ShouldBeNil)
+			stats, err := replayer.Replay()
+			So(err, ShouldBeNil)
+			So(stats.Duration, ShouldBeGreaterThanOrEqualTo, time.Duration(100)*time.Millisecond)
+			So(stats.Duration, ShouldBeLessThan, time.Duration(200)*time.Millisecond)
+		})
+	})
+}
@@ -23,11 +23,19 @@ func NewRedisClusterHashBuilder() *RedisClusterHashBuilder {
 // RedisClusterHashBuilder redis cluster builder
 type RedisClusterHashBuilder struct {
 	Address  []string
+	Username string
+	Password string
+	TLS      RedisTLSOptions
 	Timeout  time.Duration
 	Retries  int
 	PoolSize int
 	KeyIdx   int
 	KeyLen   int
+	// emulate expiration of fields with a value header, the format of values
+	// changes, so enable it only on the buckets written by this client
+	FieldTTL   bool
+	Expiration time.Duration
+	LazySweep  bool
 }
 
 // WithAddress option
@@ -36,6 +44,24 @@ func (b *RedisClusterHashBuilder) WithAddress(address string) *RedisClusterHashB
 	return b
 }
 
+// WithPassword set password
+func (b *RedisClusterHashBuilder) WithPassword(password string) *RedisClusterHashBuilder {
+	b.Password = password
+	return b
+}
+
+// WithUsername set username of redis 6 acl
+func (b *RedisClusterHashBuilder) WithUsername(username string) *RedisClusterHashBuilder {
+	b.Username = username
+	return b
+}
+
+// WithTLS set tls options
+func (b *RedisClusterHashBuilder) WithTLS(tlsOptions RedisTLSOptions) *RedisClusterHashBuilder {
+	b.TLS = tlsOptions
+	return b
+}
+
 // WithRetries option
 func (b *RedisClusterHashBuilder) WithRetries(retries int) *RedisClusterHashBuilder {
 	b.Retries = retries
@@ -61,25 +87,45 @@ func (b *RedisClusterHashBuilder) WithKeyIdxLen(keyIdx int, keyLen int) *RedisCl
 	return b
 }
 
+// WithFieldTTL option, enable expiration of fields
+func (b *RedisClusterHashBuilder) WithFieldTTL(fieldTTL bool) *RedisClusterHashBuilder {
+	b.FieldTTL = fieldTTL
+	return b
+}
+
+// WithExpiration option, default expiration of fields when FieldTTL enabled
+func (b *RedisClusterHashBuilder) WithExpiration(expiration time.Duration) *RedisClusterHashBuilder {
+	b.Expiration = expiration
+	return b
+}
+
+// WithLazySweep option, delete the expired fields found on reading
+func (b *RedisClusterHashBuilder) WithLazySweep(lazySweep bool) *RedisClusterHashBuilder {
+	b.LazySweep = lazySweep
+	return b
+}
+
 // Build build a new redis cluster client
 func (b *RedisClusterHashBuilder) Build() (*RedisClusterHash, error) {
-	client := redis.NewClusterClient(&redis.ClusterOptions{
-		Addrs:        b.Address,
-		DialTimeout:  b.Timeout,
-		ReadTimeout:  b.Timeout,
-		WriteTimeout: b.Timeout,
-		MaxRetries:   b.Retries,
-		PoolSize:     b.PoolSize,
-	})
-	if err := client.Ping().Err(); err != nil {
+	client, err := newRedisClusterClient(b.Address, b.Username, b.Password, b.TLS, b.Timeout, b.Retries, b.PoolSize)
+	if err != nil {
 		return nil, err
 	}
 
-	return &RedisClusterHash{
+	rc := &RedisClusterHash{
 		client: client,
 		keyIdx: b.KeyIdx,
 		keyLen: b.KeyLen,
-	}, nil
+	}
+	if b.FieldTTL {
+		rc.ttl = &redisFieldTTL{
+			client:     client,
+			expiration: b.Expiration,
+			lazySweep:  b.LazySweep,
+		}
+	}
+
+	return rc, nil
 }
 
 // RedisClusterHash redis cluster client
@@ -87,13 +133,23 @@ type RedisClusterHash struct {
 	BaseCache
 
 	client *redis.ClusterClient
+	closer Closer
 	keyIdx int
 	keyLen int
+	ttl    *redisFieldTTL
+}
+
+// Capabilities supported operations, expiration is supported only when FieldTTL enabled
+func (rc *RedisClusterHash) Capabilities() Capability {
+	if rc.ttl != nil {
+		return CapAll
+	}
+	return CapAll &^ (CapSetEx | CapSetExNx)
 }
 
 // Close redis client
 func (rc *RedisClusterHash) Close() error {
-	return rc.client.Close()
+	return rc.closer.Close(rc.client.Close)
 }
 
 // Get get a key
@@ -106,15 +162,32 @@ func (rc *RedisClusterHash) Get(key string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if rc.ttl != nil {
+		return rc.ttl.decode(k, f, []byte(val)), nil
+	}
 	return []byte(val), nil
 }
 
 // Set set a key
 func (rc *RedisClusterHash) Set(key string, val []byte) error {
 	k, f := rc.parseKey(key)
+	if rc.ttl != nil {
+		_, err := rc.ttl.set(k, f, val, rc.ttl.expiration, false)
+		return err
+	}
 	return rc.client.HSet(k, f, val).Err()
 }
 
+// SetEx set with expiration, FieldTTL is required
+func (rc *RedisClusterHash) SetEx(key string, val []byte, expiration time.Duration) error {
+	if rc.ttl == nil {
+		return &ErrNotSupported{Capability: CapSetEx}
+	}
+	k, f := rc.parseKey(key)
+	_, err := rc.ttl.set(k, f, val, expiration, false)
+	return err
+}
+
 // Del delete a key
 func (rc *RedisClusterHash) Del(key string) error {
 	k, f := rc.parseKey(key)
@@ -124,9 +197,21 @@ func (rc *RedisClusterHash) Del(key string) error {
 // SetNx set if not exists
 func (rc *RedisClusterHash) SetNx(key string, val []byte) (bool, error) {
 	k, f := rc.parseKey(key)
+	if rc.ttl != nil {
+		return rc.ttl.set(k, f, val, rc.ttl.expiration, true)
+	}
 	return rc.client.HSetNX(k, f, val).Result()
 }
 
+// SetExNx set if not exists with expiration, FieldTTL is required
+func (rc *RedisClusterHash) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	if rc.ttl == nil {
+		return false, &ErrNotSupported{Capability: CapSetExNx}
+	}
+	k, f := rc.parseKey(key)
+	return rc.ttl.set(k, f, val, expiration, true)
+}
+
 // SetBatch set batch
 func (rc *RedisClusterHash) SetBatch(keys []string, vals [][]byte) ([]error, error) {
 	if len(keys) != len(vals) {
@@ -135,11 +220,15 @@ func (rc *RedisClusterHash) SetBatch(keys []string, vals [][]byte) ([]error, err
 
 	pipe := rc.client.Pipeline()
 	defer pipe.Close()
-	cmds := make([]*redis.BoolCmd, len(keys))
+	cmds := make([]redis.Cmder, len(keys))
 
 	for i := range keys {
 		k, f := rc.parseKey(keys[i])
-		cmds[i] = pipe.HSet(k, f, vals[i])
+		if rc.ttl != nil {
+			cmds[i] = rc.ttl.pipeSet(pipe, k, f, vals[i])
+		} else {
+			cmds[i] = pipe.HSet(k, f, vals[i])
+		}
 	}
 
 	if _, err := pipe.Exec(); err != nil {
@@ -169,9 +258,11 @@ func (rc *RedisClusterHash) GetBatch(keys []string) ([][]byte, []error, error) {
 	pipe := rc.client.Pipeline()
 	defer pipe.Close()
 	cmds := make([]*redis.StringCmd, len(keys))
+	fields := make([][2]string, len(keys))
 
 	for i := range keys {
 		k, f := rc.parseKey(keys[i])
+		fields[i] = [2]string{k, f}
 		cmds[i] = pipe.HGet(k, f)
 	}
 
@@ -189,6 +280,9 @@ func (rc *RedisClusterHash) GetBatch(keys []string) ([][]byte, []error, error) {
 		} else if err != nil {
 			vals[i] = nil
 			errs[i] = err
+		} else if rc.ttl != nil {
+			vals[i] = rc.ttl.decode(fields[i][0], fields[i][1], []byte(cmd.Val()))
+			errs[i] = nil
 		} else {
 			vals[i] = []byte(cmd.Val())
 			errs[i] = err
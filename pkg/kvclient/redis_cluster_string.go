@@ -22,6 +22,9 @@ func NewRedisClusterStringBuilder() *RedisClusterStringBuilder {
 // RedisClusterStringBuilder redis cluster builder
 type RedisClusterStringBuilder struct {
 	Address    []string
+	Username   string
+	Password   string
+	TLS        RedisTLSOptions
 	Timeout    time.Duration
 	Retries    int
 	PoolSize   int
@@ -34,6 +37,24 @@ func (b *RedisClusterStringBuilder) WithAddress(address string) *RedisClusterStr
 	return b
 }
 
+// WithPassword set password
+func (b *RedisClusterStringBuilder) WithPassword(password string) *RedisClusterStringBuilder {
+	b.Password = password
+	return b
+}
+
+// WithUsername set username of redis 6 acl
+func (b *RedisClusterStringBuilder) WithUsername(username string) *RedisClusterStringBuilder {
+	b.Username = username
+	return b
+}
+
+// WithTLS set tls options
+func (b *RedisClusterStringBuilder) WithTLS(tlsOptions RedisTLSOptions) *RedisClusterStringBuilder {
+	b.TLS = tlsOptions
+	return b
+}
+
 // WithRetries set retry times
 func (b *RedisClusterStringBuilder) WithRetries(retries int) *RedisClusterStringBuilder {
 	b.Retries = retries
@@ -60,21 +81,15 @@ func (b *RedisClusterStringBuilder) WithExpiration(expiration time.Duration) *Re
 
 // Build build a new redis cluster client
 func (b *RedisClusterStringBuilder) Build() (*RedisClusterString, error) {
-	redisCluster := &RedisClusterString{}
-	redisCluster.client = redis.NewClusterClient(&redis.ClusterOptions{
-		Addrs:        b.Address,
-		DialTimeout:  b.Timeout,
-		ReadTimeout:  b.Timeout,
-		WriteTimeout: b.Timeout,
-		MaxRetries:   b.Retries,
-		PoolSize:     b.PoolSize,
-	})
-	redisCluster.expiration = b.Expiration
-	if err := redisCluster.client.Ping().Err(); err != nil {
+	client, err := newRedisClusterClient(b.Address, b.Username, b.Password, b.TLS, b.Timeout, b.Retries, b.PoolSize)
+	if err != nil {
 		return nil, err
 	}
 
-	return redisCluster, nil
+	return &RedisClusterString{
+		client:     client,
+		expiration: b.Expiration,
+	}, nil
 }
 
 // RedisClusterString redis cluster client
@@ -82,12 +97,18 @@ type RedisClusterString struct {
 	BaseCache
 
 	client     *redis.ClusterClient
+	closer     Closer
 	expiration time.Duration
 }
 
+// Capabilities supported operations
+func (rc *RedisClusterString) Capabilities() Capability {
+	return CapAll
+}
+
 // Close redis client
 func (rc *RedisClusterString) Close() error {
-	return rc.client.Close()
+	return rc.closer.Close(rc.client.Close)
 }
 
 // Get get a key
@@ -22,12 +22,20 @@ func NewRedisHashBuilder() *RedisHashBuilder {
 // RedisHashBuilder redis cluster builder
 type RedisHashBuilder struct {
 	Address  string
+	Username string
 	Password string
+	Sentinel RedisSentinelOptions
+	TLS      RedisTLSOptions
 	Timeout  time.Duration
 	Retries  int
 	PoolSize int
 	KeyIdx   int
 	KeyLen   int
+	// emulate expiration of fields with a value header, the format of values
+	// changes, so enable it only on the buckets written by this client
+	FieldTTL   bool
+	Expiration time.Duration
+	LazySweep  bool
 }
 
 // WithAddress option
@@ -42,6 +50,24 @@ func (b *RedisHashBuilder) WithPassword(password string) *RedisHashBuilder {
 	return b
 }
 
+// WithUsername set username of redis 6 acl
+func (b *RedisHashBuilder) WithUsername(username string) *RedisHashBuilder {
+	b.Username = username
+	return b
+}
+
+// WithSentinel connect to the master named masterName through sentinels of address
+func (b *RedisHashBuilder) WithSentinel(masterName string, address string) *RedisHashBuilder {
+	b.Sentinel = RedisSentinelOptions{MasterName: masterName, Address: address}
+	return b
+}
+
+// WithTLS set tls options
+func (b *RedisHashBuilder) WithTLS(tlsOptions RedisTLSOptions) *RedisHashBuilder {
+	b.TLS = tlsOptions
+	return b
+}
+
 // WithRetries option
 func (b *RedisHashBuilder) WithRetries(retries int) *RedisHashBuilder {
 	b.Retries = retries
@@ -67,26 +93,45 @@ func (b *RedisHashBuilder) WithKeyIdxLen(keyIdx int, keyLen int) *RedisHashBuild
 	return b
 }
 
+// WithFieldTTL option, enable expiration of fields
+func (b *RedisHashBuilder) WithFieldTTL(fieldTTL bool) *RedisHashBuilder {
+	b.FieldTTL = fieldTTL
+	return b
+}
+
+// WithExpiration option, default expiration of fields when FieldTTL enabled
+func (b *RedisHashBuilder) WithExpiration(expiration time.Duration) *RedisHashBuilder {
+	b.Expiration = expiration
+	return b
+}
+
+// WithLazySweep option, delete the expired fields found on reading
+func (b *RedisHashBuilder) WithLazySweep(lazySweep bool) *RedisHashBuilder {
+	b.LazySweep = lazySweep
+	return b
+}
+
 // Build build a new redis cluster client
 func (b *RedisHashBuilder) Build() (*RedisHash, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:         b.Address,
-		DialTimeout:  b.Timeout,
-		ReadTimeout:  b.Timeout,
-		WriteTimeout: b.Timeout,
-		MaxRetries:   b.Retries,
-		PoolSize:     b.PoolSize,
-		Password:     b.Password,
-	})
-	if err := client.Ping().Err(); err != nil {
+	client, err := newRedisClient(b.Address, b.Username, b.Password, b.Sentinel, b.TLS, b.Timeout, b.Retries, b.PoolSize)
+	if err != nil {
 		return nil, err
 	}
 
-	return &RedisHash{
+	rc := &RedisHash{
 		client: client,
 		keyIdx: b.KeyIdx,
 		keyLen: b.KeyLen,
-	}, nil
+	}
+	if b.FieldTTL {
+		rc.ttl = &redisFieldTTL{
+			client:     client,
+			expiration: b.Expiration,
+			lazySweep:  b.LazySweep,
+		}
+	}
+
+	return rc, nil
 }
 
 // RedisHash redis cluster client
@@ -94,13 +139,23 @@ type RedisHash struct {
 	BaseCache
 
 	client *redis.Client
+	closer Closer
 	keyIdx int
 	keyLen int
+	ttl    *redisFieldTTL
+}
+
+// Capabilities supported operations, expiration is supported only when FieldTTL enabled
+func (rc *RedisHash) Capabilities() Capability {
+	if rc.ttl != nil {
+		return CapAll
+	}
+	return CapAll &^ (CapSetEx | CapSetExNx)
 }
 
 // Close redis client
 func (rc *RedisHash) Close() error {
-	return rc.client.Close()
+	return rc.closer.Close(rc.client.Close)
 }
 
 // Get get a key
@@ -113,15 +168,32 @@ func (rc *RedisHash) Get(key string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if rc.ttl != nil {
+		return rc.ttl.decode(k, f, []byte(val)), nil
+	}
 	return []byte(val), nil
 }
 
 // Set set a key
 func (rc *RedisHash) Set(key string, val []byte) error {
 	k, f := rc.parseKey(key)
+	if rc.ttl != nil {
+		_, err := rc.ttl.set(k, f, val, rc.ttl.expiration, false)
+		return err
+	}
 	return rc.client.HSet(k, f, val).Err()
 }
 
+// SetEx set with expiration, FieldTTL is required
+func (rc *RedisHash) SetEx(key string, val []byte, expiration time.Duration) error {
+	if rc.ttl == nil {
+		return &ErrNotSupported{Capability: CapSetEx}
+	}
+	k, f := rc.parseKey(key)
+	_, err := rc.ttl.set(k, f, val, expiration, false)
+	return err
+}
+
 // Del delete a key
 func (rc *RedisHash) Del(key string) error {
 	k, f := rc.parseKey(key)
@@ -131,9 +203,21 @@ func (rc *RedisHash) Del(key string) error {
 // SetNx set if not exists
 func (rc *RedisHash) SetNx(key string, val []byte) (bool, error) {
 	k, f := rc.parseKey(key)
+	if rc.ttl != nil {
+		return rc.ttl.set(k, f, val, rc.ttl.expiration, true)
+	}
 	return rc.client.HSetNX(k, f, val).Result()
 }
 
+// SetExNx set if not exists with expiration, FieldTTL is required
+func (rc *RedisHash) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	if rc.ttl == nil {
+		return false, &ErrNotSupported{Capability: CapSetExNx}
+	}
+	k, f := rc.parseKey(key)
+	return rc.ttl.set(k, f, val, expiration, true)
+}
+
 // SetBatch set batch
 func (rc *RedisHash) SetBatch(keys []string, vals [][]byte) ([]error, error) {
 	if len(keys) != len(vals) {
@@ -142,11 +226,15 @@ func (rc *RedisHash) SetBatch(keys []string, vals [][]byte) ([]error, error) {
 
 	pipe := rc.client.Pipeline()
 	defer pipe.Close()
-	cmds := make([]*redis.BoolCmd, len(keys))
+	cmds := make([]redis.Cmder, len(keys))
 
 	for i := range keys {
 		k, f := rc.parseKey(keys[i])
-		cmds[i] = pipe.HSet(k, f, vals[i])
+		if rc.ttl != nil {
+			cmds[i] = rc.ttl.pipeSet(pipe, k, f, vals[i])
+		} else {
+			cmds[i] = pipe.HSet(k, f, vals[i])
+		}
 	}
 
 	if _, err := pipe.Exec(); err != nil {
@@ -176,9 +264,11 @@ func (rc *RedisHash) GetBatch(keys []string) ([][]byte, []error, error) {
 	pipe := rc.client.Pipeline()
 	defer pipe.Close()
 	cmds := make([]*redis.StringCmd, len(keys))
+	fields := make([][2]string, len(keys))
 
 	for i := range keys {
 		k, f := rc.parseKey(keys[i])
+		fields[i] = [2]string{k, f}
 		cmds[i] = pipe.HGet(k, f)
 	}
 
@@ -196,6 +286,9 @@ func (rc *RedisHash) GetBatch(keys []string) ([][]byte, []error, error) {
 		} else if err != nil {
 			vals[i] = nil
 			errs[i] = err
+		} else if rc.ttl != nil {
+			vals[i] = rc.ttl.decode(fields[i][0], fields[i][1], []byte(cmd.Val()))
+			errs[i] = nil
 		} else {
 			vals[i] = []byte(cmd.Val())
 			errs[i] = err
@@ -0,0 +1,102 @@
+package kvclient
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// luaExpired check the expire header of a field value, see expire.go
+const luaExpired = `
+local function expired(v, now)
+	if string.len(v) < 12 or string.sub(v, 1, 4) ~= "\255kv\1" then
+		return false
+	end
+	local t = 0
+	for i = 5, 12 do
+		t = t * 256 + string.byte(v, i)
+	end
+	return t > 0 and t <= now
+end
+`
+
+// hashSetScript set a field with its expire header, the bucket expires with the
+// max ttl of its fields, a field without ttl makes the bucket persistent
+// KEYS[1] bucket, ARGV[1] field, ARGV[2] value, ARGV[3] ttl ms, ARGV[4] nx, ARGV[5] now ms
+var hashSetScript = redis.NewScript(luaExpired + `
+local pttl = redis.call("PTTL", KEYS[1])
+if ARGV[4] == "1" then
+	local old = redis.call("HGET", KEYS[1], ARGV[1])
+	if old and not expired(old, tonumber(ARGV[5])) then
+		return 0
+	end
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+local ttl = tonumber(ARGV[3])
+if ttl <= 0 then
+	redis.call("PERSIST", KEYS[1])
+elseif pttl == -2 or (pttl >= 0 and pttl < ttl) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+end
+return 1
+`)
+
+// hashSweepScript delete a field only if it is still expired
+// KEYS[1] bucket, ARGV[1] field, ARGV[2] now ms
+var hashSweepScript = redis.NewScript(luaExpired + `
+local v = redis.call("HGET", KEYS[1], ARGV[1])
+if v and expired(v, tonumber(ARGV[2])) then
+	return redis.call("HDEL", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// redisFieldTTL emulate expiration of hash fields, which redis does not support.
+// values are stored with the expire header, expired fields are taken as not found
+type redisFieldTTL struct {
+	client     redis.Cmdable
+	expiration time.Duration
+	lazySweep  bool
+}
+
+// set field with expiration, only if the field not exists or expired when nx
+func (t *redisFieldTTL) set(key string, field string, val []byte, expiration time.Duration, nx bool) (bool, error) {
+	now := time.Now()
+	res, err := hashSetScript.Run(t.client, []string{key}, t.args(field, val, expiration, nx, now)...).Result()
+	if err != nil {
+		return false, err
+	}
+	return res.(int64) == 1, nil
+}
+
+// pipeSet queue a set with default expiration into pipe
+func (t *redisFieldTTL) pipeSet(pipe redis.Pipeliner, key string, field string, val []byte) *redis.Cmd {
+	return hashSetScript.Eval(pipe, []string{key}, t.args(field, val, t.expiration, false, time.Now())...)
+}
+
+func (t *redisFieldTTL) args(field string, val []byte, expiration time.Duration, nx bool, now time.Time) []interface{} {
+	flag := "0"
+	if nx {
+		flag = "1"
+	}
+	return []interface{}{
+		field,
+		encodeExpire(val, expireAt(now, expiration)),
+		int64(expiration / time.Millisecond),
+		flag,
+		now.UnixNano() / int64(time.Millisecond),
+	}
+}
+
+// decode a field value, return nil if expired and delete it when lazy sweep enabled
+func (t *redisFieldTTL) decode(key string, field string, buf []byte) []byte {
+	val, expireAt := decodeExpire(buf)
+	now := time.Now()
+	if !isExpired(expireAt, now) {
+		return val
+	}
+	if t.lazySweep {
+		hashSweepScript.Run(t.client, []string{key}, field, now.UnixNano()/int64(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package kvclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedisHash_FieldTTL(t *testing.T) {
+	Convey("test redis hash field ttl", t, func() {
+		server, err := miniredis.Run()
+		So(err, ShouldBeNil)
+		defer server.Close()
+
+		rh, err := NewRedisHashBuilder().
+			WithAddress(server.Addr()).
+			WithKeyIdxLen(0, 4).
+			WithFieldTTL(true).
+			WithLazySweep(true).
+			Build()
+		So(err, ShouldBeNil)
+		defer rh.Close()
+		So(rh.Capabilities(), ShouldEqual, CapAll)
+
+		Convey("expired fields are not found and swept lazily", func() {
+			So(rh.SetEx("buck-key1", []byte("val1"), time.Duration(50)*time.Millisecond), ShouldBeNil)
+			val, err := rh.Get("buck-key1")
+			So(err, ShouldBeNil)
+			So(val, ShouldResemble, []byte("val1"))
+
+			time.Sleep(time.Duration(60) * time.Millisecond)
+			So(server.Exists("buck"), ShouldBeTrue)
+			val, err = rh.Get("buck-key1")
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+			So(server.HGet("buck", "-key1"), ShouldEqual, "")
+
+			ok, err := rh.SetExNx("buck-key1", []byte("val2"), time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			ok, err = rh.SetExNx("buck-key1", []byte("val3"), time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("bucket expires with the max ttl of its fields", func() {
+			So(rh.SetEx("buck-key1", []byte("val1"), time.Minute), ShouldBeNil)
+			So(server.TTL("buck"), ShouldEqual, time.Minute)
+			So(rh.SetEx("buck-key2", []byte("val2"), time.Hour), ShouldBeNil)
+			So(server.TTL("buck"), ShouldEqual, time.Hour)
+			So(rh.SetEx("buck-key3", []byte("val3"), time.Second), ShouldBeNil)
+			So(server.TTL("buck"), ShouldEqual, time.Hour)
+
+			So(rh.Set("buck-key4", []byte("val4")), ShouldBeNil)
+			So(server.TTL("buck"), ShouldEqual, time.Duration(0))
+			So(rh.SetEx("buck-key5", []byte("val5"), time.Minute), ShouldBeNil)
+			So(server.TTL("buck"), ShouldEqual, time.Duration(0))
+		})
+
+		Convey("batch operations", func() {
+			errs, err := rh.SetBatch([]string{"buck-key1", "buck-key2"}, [][]byte{[]byte("val1"), []byte("val2")})
+			So(err, ShouldBeNil)
+			So(errs, ShouldResemble, []error{nil, nil})
+			So(rh.SetEx("buck-key3", []byte("val3"), time.Millisecond), ShouldBeNil)
+			time.Sleep(time.Duration(5) * time.Millisecond)
+
+			vals, errs, err := rh.GetBatch([]string{"buck-key1", "buck-key3", "buck-key2"})
+			So(err, ShouldBeNil)
+			So(errs, ShouldResemble, []error{nil, nil, nil})
+			So(vals, ShouldResemble, [][]byte{[]byte("val1"), nil, []byte("val2")})
+		})
+
+		Convey("legacy fields without header never expire", func() {
+			server.HSet("buck", "-key6", "val6")
+			val, err := rh.Get("buck-key6")
+			So(err, ShouldBeNil)
+			So(val, ShouldResemble, []byte("val6"))
+		})
+	})
+}
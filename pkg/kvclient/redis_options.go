@@ -0,0 +1,160 @@
+package kvclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// RedisSentinelOptions connect to the master through sentinels, enabled if MasterName is set
+type RedisSentinelOptions struct {
+	MasterName string
+	Address    string // sentinel addresses, separated by ","
+}
+
+// RedisTLSOptions tls options, enabled if Enable is true or any file is set
+type RedisTLSOptions struct {
+	Enable             bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Config create the tls config, nil if tls is not enabled
+func (o *RedisTLSOptions) Config() (*tls.Config, error) {
+	if !o.Enable && o.CAFile == "" && o.CertFile == "" && o.KeyFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+
+	if o.CAFile != "" {
+		buf, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file [%v] failed: %v", o.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("no certificate found in ca file [%v]", o.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load cert file [%v] key file [%v] failed: %v", o.CertFile, o.KeyFile, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// redisAuth options of the go-redis client for auth. go-redis only sends
+// `AUTH password`, redis 6 acl users need `AUTH username password` on connect
+func redisAuth(username string, password string) (string, func(*redis.Conn) error) {
+	if username == "" {
+		return password, nil
+	}
+	return "", func(conn *redis.Conn) error {
+		cmd := redis.NewStatusCmd("auth", username, password)
+		conn.Process(cmd)
+		return cmd.Err()
+	}
+}
+
+// newRedisClient create a client of a single redis or a sentinel failover master, then ping it
+func newRedisClient(
+	address string, username string, password string, sentinel RedisSentinelOptions, tlsOptions RedisTLSOptions,
+	timeout time.Duration, retries int, poolSize int,
+) (*redis.Client, error) {
+	tlsConfig, err := tlsOptions.Config()
+	if err != nil {
+		return nil, err
+	}
+	password, onConnect := redisAuth(username, password)
+
+	if sentinel.MasterName != "" {
+		client := redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    sentinel.MasterName,
+			SentinelAddrs: strings.Split(sentinel.Address, ","),
+			OnConnect:     onConnect,
+			Password:      password,
+			DialTimeout:   timeout,
+			ReadTimeout:   timeout,
+			WriteTimeout:  timeout,
+			MaxRetries:    retries,
+			PoolSize:      poolSize,
+			TLSConfig:     tlsConfig,
+		})
+		if err := client.Ping().Err(); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("redis master [%v] from sentinel [%v] ping failed: %v", sentinel.MasterName, sentinel.Address, err)
+		}
+		return client, nil
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:         address,
+		OnConnect:    onConnect,
+		Password:     password,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+		MaxRetries:   retries,
+		PoolSize:     poolSize,
+		TLSConfig:    tlsConfig,
+	})
+	if err := client.Ping().Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis [%v] ping failed: %v", address, err)
+	}
+
+	return client, nil
+}
+
+// newRedisClusterClient create a redis cluster client, then ping every node
+func newRedisClusterClient(
+	address []string, username string, password string, tlsOptions RedisTLSOptions,
+	timeout time.Duration, retries int, poolSize int,
+) (*redis.ClusterClient, error) {
+	tlsConfig, err := tlsOptions.Config()
+	if err != nil {
+		return nil, err
+	}
+	password, onConnect := redisAuth(username, password)
+
+	client := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:        address,
+		OnConnect:    onConnect,
+		Password:     password,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+		MaxRetries:   retries,
+		PoolSize:     poolSize,
+		TLSConfig:    tlsConfig,
+	})
+	if err := client.ForEachNode(func(node *redis.Client) error {
+		if err := node.Ping().Err(); err != nil {
+			return fmt.Errorf("node [%v] ping failed: %v", node.Options().Addr, err)
+		}
+		return nil
+	}); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis cluster [%v] ping failed: %v", strings.Join(address, ","), err)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,56 @@
+package kvclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedisOptions(t *testing.T) {
+	Convey("test redis options", t, func() {
+		server, err := miniredis.Run()
+		So(err, ShouldBeNil)
+		defer server.Close()
+		server.RequireAuth("123456")
+
+		Convey("auth with password", func() {
+			rs, err := NewRedisStringBuilder().WithAddress(server.Addr()).WithPassword("123456").Build()
+			So(err, ShouldBeNil)
+			defer rs.Close()
+			So(rs.Set("key", []byte("val")), ShouldBeNil)
+		})
+
+		Convey("connection errors tell the failed node", func() {
+			_, err := NewRedisStringBuilder().WithAddress(server.Addr()).WithPassword("654321").Build()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, server.Addr())
+
+			_, err = NewRedisClusterHashBuilder().
+				WithAddress("127.0.0.1:1").
+				WithTimeout(time.Duration(100) * time.Millisecond).
+				WithRetries(0).
+				Build()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "127.0.0.1:1")
+		})
+
+		Convey("tls config", func() {
+			config, err := (&RedisTLSOptions{}).Config()
+			So(err, ShouldBeNil)
+			So(config, ShouldBeNil)
+
+			config, err = (&RedisTLSOptions{Enable: true, ServerName: "redis"}).Config()
+			So(err, ShouldBeNil)
+			So(config.ServerName, ShouldEqual, "redis")
+
+			_, err = NewRedisHashBuilder().
+				WithAddress(server.Addr()).
+				WithTLS(RedisTLSOptions{CAFile: "notexists.pem"}).
+				Build()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "notexists.pem")
+		})
+	})
+}
@@ -2,6 +2,7 @@ package kvclient
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -21,7 +22,10 @@ func NewRedisStringBuilder() *RedisStringBuilder {
 // RedisStringBuilder redis cluster builder
 type RedisStringBuilder struct {
 	Address    string
+	Username   string
 	Password   string
+	Sentinel   RedisSentinelOptions
+	TLS        RedisTLSOptions
 	Timeout    time.Duration
 	Retries    int
 	PoolSize   int
@@ -40,6 +44,24 @@ func (b *RedisStringBuilder) WithPassword(password string) *RedisStringBuilder {
 	return b
 }
 
+// WithUsername set username of redis 6 acl
+func (b *RedisStringBuilder) WithUsername(username string) *RedisStringBuilder {
+	b.Username = username
+	return b
+}
+
+// WithSentinel connect to the master named masterName through sentinels of address
+func (b *RedisStringBuilder) WithSentinel(masterName string, address string) *RedisStringBuilder {
+	b.Sentinel = RedisSentinelOptions{MasterName: masterName, Address: address}
+	return b
+}
+
+// WithTLS set tls options
+func (b *RedisStringBuilder) WithTLS(tlsOptions RedisTLSOptions) *RedisStringBuilder {
+	b.TLS = tlsOptions
+	return b
+}
+
 // WithRetries set retry times
 func (b *RedisStringBuilder) WithRetries(retries int) *RedisStringBuilder {
 	b.Retries = retries
@@ -66,22 +88,15 @@ func (b *RedisStringBuilder) WithExpiration(expiration time.Duration) *RedisStri
 
 // Build build a new redis cluster client
 func (b *RedisStringBuilder) Build() (*RedisString, error) {
-	rs := &RedisString{}
-	rs.client = redis.NewClient(&redis.Options{
-		Addr:         b.Address,
-		DialTimeout:  b.Timeout,
-		ReadTimeout:  b.Timeout,
-		WriteTimeout: b.Timeout,
-		MaxRetries:   b.Retries,
-		PoolSize:     b.PoolSize,
-		Password:     b.Password,
-	})
-	rs.expiration = b.Expiration
-	if err := rs.client.Ping().Err(); err != nil {
+	client, err := newRedisClient(b.Address, b.Username, b.Password, b.Sentinel, b.TLS, b.Timeout, b.Retries, b.PoolSize)
+	if err != nil {
 		return nil, err
 	}
 
-	return rs, nil
+	return &RedisString{
+		client:     client,
+		expiration: b.Expiration,
+	}, nil
 }
 
 // RedisString redis cluster client
@@ -89,12 +104,18 @@ type RedisString struct {
 	BaseCache
 
 	client     *redis.Client
+	closer     Closer
 	expiration time.Duration
 }
 
+// Capabilities supported operations
+func (rc *RedisString) Capabilities() Capability {
+	return CapAll
+}
+
 // Close redis client
 func (rc *RedisString) Close() error {
-	return rc.client.Close()
+	return rc.closer.Close(rc.client.Close)
 }
 
 // Get get a key
@@ -192,3 +213,56 @@ func (rc *RedisString) GetBatch(keys []string) ([][]byte, []error, error) {
 
 	return vals, errs, nil
 }
+
+// redisGlobEscaper escape the special characters of glob patterns
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// Scan keys with prefix by SCAN, keys are not in order and may be returned more than
+// once if the keyspace changes during the scan
+func (rc *RedisString) Scan(prefix string, fn func(key string, val []byte, ttl time.Duration) bool) error {
+	match := redisGlobEscaper.Replace(prefix) + "*"
+	var cursor uint64
+	for {
+		keys, next, err := rc.client.Scan(cursor, match, 1000).Result()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			val, err := rc.Get(key)
+			if err != nil {
+				return err
+			}
+			ttl, ok, err := rc.TTL(key)
+			if err != nil {
+				return err
+			}
+			// deleted since scanned
+			if val == nil || !ok {
+				continue
+			}
+			if !fn(key, val, ttl) {
+				return nil
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// TTL of key by PTTL, 0 means never expire
+func (rc *RedisString) TTL(key string) (time.Duration, bool, error) {
+	ttl, err := rc.client.PTTL(key).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	// -2 if not found, -1 if never expire
+	if ttl == -2*time.Millisecond {
+		return 0, false, nil
+	}
+	if ttl < 0 {
+		return 0, true, nil
+	}
+	return ttl, true, nil
+}
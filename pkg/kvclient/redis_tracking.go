@@ -0,0 +1,600 @@
+package kvclient
+
+import (
+	"crypto/tls"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/go-redis/redis"
+	"github.com/hatlonely/kvclient/pkg/kvresp"
+)
+
+// redisInvalidateChannel channel of client side caching invalidation messages
+const redisInvalidateChannel = "__redis__:invalidate"
+
+// NewRedisTrackingBuilder create a new redis tracking builder
+func NewRedisTrackingBuilder() *RedisTrackingBuilder {
+	return &RedisTrackingBuilder{
+		Address:           "127.0.0.1:6379",
+		Timeout:           time.Duration(1000) * time.Millisecond,
+		Retries:           3,
+		PoolSize:          20,
+		Expiration:        time.Duration(24) * time.Hour,
+		LocalSize:         100000,
+		LocalExpiration:   time.Duration(1) * time.Minute,
+		ReconnectInterval: time.Duration(1) * time.Second,
+	}
+}
+
+// RedisTrackingBuilder redis tracking builder
+type RedisTrackingBuilder struct {
+	Address           string
+	Username          string
+	Password          string
+	TLS               RedisTLSOptions
+	Timeout           time.Duration
+	Retries           int
+	PoolSize          int
+	Expiration        time.Duration
+	LocalSize         int
+	LocalExpiration   time.Duration
+	ReconnectInterval time.Duration
+}
+
+// WithAddress set address
+func (b *RedisTrackingBuilder) WithAddress(address string) *RedisTrackingBuilder {
+	b.Address = address
+	return b
+}
+
+// WithPassword set password
+func (b *RedisTrackingBuilder) WithPassword(password string) *RedisTrackingBuilder {
+	b.Password = password
+	return b
+}
+
+// WithUsername set username of redis 6 acl
+func (b *RedisTrackingBuilder) WithUsername(username string) *RedisTrackingBuilder {
+	b.Username = username
+	return b
+}
+
+// WithTLS set tls options
+func (b *RedisTrackingBuilder) WithTLS(tlsOptions RedisTLSOptions) *RedisTrackingBuilder {
+	b.TLS = tlsOptions
+	return b
+}
+
+// WithRetries set retry times
+func (b *RedisTrackingBuilder) WithRetries(retries int) *RedisTrackingBuilder {
+	b.Retries = retries
+	return b
+}
+
+// WithTimeout set timeout
+func (b *RedisTrackingBuilder) WithTimeout(timeout time.Duration) *RedisTrackingBuilder {
+	b.Timeout = timeout
+	return b
+}
+
+// WithPoolSize set connection pool size
+func (b *RedisTrackingBuilder) WithPoolSize(poolsize int) *RedisTrackingBuilder {
+	b.PoolSize = poolsize
+	return b
+}
+
+// WithExpiration set expire time in redis
+func (b *RedisTrackingBuilder) WithExpiration(expiration time.Duration) *RedisTrackingBuilder {
+	b.Expiration = expiration
+	return b
+}
+
+// WithLocalSize set max number of keys kept in process
+func (b *RedisTrackingBuilder) WithLocalSize(size int) *RedisTrackingBuilder {
+	b.LocalSize = size
+	return b
+}
+
+// WithLocalExpiration set expire time of the in process copy, bound the staleness
+// if an invalidation message is lost
+func (b *RedisTrackingBuilder) WithLocalExpiration(expiration time.Duration) *RedisTrackingBuilder {
+	b.LocalExpiration = expiration
+	return b
+}
+
+// WithReconnectInterval set interval between reconnections of the invalidation connection
+func (b *RedisTrackingBuilder) WithReconnectInterval(interval time.Duration) *RedisTrackingBuilder {
+	b.ReconnectInterval = interval
+	return b
+}
+
+// Build build a new redis tracking cache
+func (b *RedisTrackingBuilder) Build() (*RedisTracking, error) {
+	tlsConfig, err := b.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	builder := *b
+	t := &RedisTracking{
+		builder:   &builder,
+		tlsConfig: tlsConfig,
+		local:     gcache.New(b.LocalSize).LRU().Expiration(b.LocalExpiration).Build(),
+		done:      make(chan struct{}),
+	}
+
+	conn, reader, client, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+	t.conn = conn
+	t.client = &redisTrackingClient{Client: client}
+	t.tracking = true
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.listen(conn, reader)
+	}()
+
+	return t, nil
+}
+
+// RedisTracking redis string cache with client side caching. values read are
+// kept in process, redis tracks the keys and sends invalidation messages to a
+// dedicated connection when they are changed by any client.
+// the in process copy is not used while the invalidation connection is broken
+type RedisTracking struct {
+	BaseCache
+
+	builder   *RedisTrackingBuilder
+	tlsConfig *tls.Config
+	local     gcache.Cache
+
+	// mutex guard the fields below, invalidations hold the write lock, so a
+	// read from redis is kept in process only if no invalidation happened since
+	mutex    sync.RWMutex
+	client   *redisTrackingClient
+	conn     net.Conn
+	tracking bool
+	epoch    uint64
+	stripes  [256]uint64
+
+	done   chan struct{}
+	wg     sync.WaitGroup
+	closer Closer
+}
+
+// redisTrackingClient a redis client and the operations in flight on it. a client
+// replaced by reconnect is closed after the operations started on it are done
+type redisTrackingClient struct {
+	*redis.Client
+	inflight sync.RWMutex
+}
+
+// release the client when the operation is done
+func (c *redisTrackingClient) release() {
+	c.inflight.RUnlock()
+}
+
+// retire close the client after the operations in flight are done
+func (c *redisTrackingClient) retire() error {
+	c.inflight.Lock()
+	defer c.inflight.Unlock()
+	return c.Close()
+}
+
+// redisTrackingVersion the state of a key before reading it from redis
+type redisTrackingVersion struct {
+	epoch  uint64
+	stripe uint64
+}
+
+// Capabilities supported operations
+func (t *RedisTracking) Capabilities() Capability {
+	return CapAll
+}
+
+// Close the invalidation connection and redis client
+func (t *RedisTracking) Close() error {
+	return t.closer.Close(func() error {
+		close(t.done)
+		t.mutex.Lock()
+		t.tracking = false
+		t.conn.Close()
+		client := t.client
+		t.mutex.Unlock()
+		t.wg.Wait()
+		t.local.Purge()
+		return client.retire()
+	})
+}
+
+// Get get a key, from the in process copy if it is valid
+func (t *RedisTracking) Get(key string) ([]byte, error) {
+	client, versions, tracking := t.snapshot(key)
+	defer client.release()
+	if tracking {
+		if val, err := t.local.Get(key); err == nil {
+			return val.([]byte), nil
+		}
+	}
+
+	val, err := client.Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tracking {
+		t.store(key, val, versions[0])
+	}
+
+	return val, nil
+}
+
+// GetBatch get keys, keys not kept in process are read from redis in a pipeline
+func (t *RedisTracking) GetBatch(keys []string) ([][]byte, []error, error) {
+	vals := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+
+	client, versions, tracking := t.snapshot(keys...)
+	defer client.release()
+	pipe := client.Pipeline()
+	defer pipe.Close()
+	cmds := make([]*redis.StringCmd, len(keys))
+	n := 0
+	for i, key := range keys {
+		if tracking {
+			if val, err := t.local.Get(key); err == nil {
+				vals[i] = val.([]byte)
+				continue
+			}
+		}
+		cmds[i] = pipe.Get(key)
+		n++
+	}
+	if n == 0 {
+		return vals, errs, nil
+	}
+
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		return nil, nil, err
+	}
+
+	for i, cmd := range cmds {
+		if cmd == nil {
+			continue
+		}
+		val, err := cmd.Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		vals[i] = val
+		if tracking {
+			t.store(keys[i], val, versions[i])
+		}
+	}
+
+	return vals, errs, nil
+}
+
+// Set set a key
+func (t *RedisTracking) Set(key string, val []byte) error {
+	return t.SetEx(key, val, t.builder.Expiration)
+}
+
+// SetEx set with expiration
+func (t *RedisTracking) SetEx(key string, val []byte, expiration time.Duration) error {
+	defer t.invalidate(key)
+	client := t.acquire()
+	defer client.release()
+	return client.Set(key, val, expiration).Err()
+}
+
+// SetNx set if not exists
+func (t *RedisTracking) SetNx(key string, val []byte) (bool, error) {
+	return t.SetExNx(key, val, t.builder.Expiration)
+}
+
+// SetExNx set if not exists with expiration
+func (t *RedisTracking) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	defer t.invalidate(key)
+	client := t.acquire()
+	defer client.release()
+	return client.SetNX(key, val, expiration).Result()
+}
+
+// Del delete a key
+func (t *RedisTracking) Del(key string) error {
+	defer t.invalidate(key)
+	client := t.acquire()
+	defer client.release()
+	return client.Del(key).Err()
+}
+
+// SetBatch set batch
+func (t *RedisTracking) SetBatch(keys []string, vals [][]byte) ([]error, error) {
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keys), len(vals))
+	}
+	defer t.invalidate(keys...)
+
+	client := t.acquire()
+	defer client.release()
+	pipe := client.Pipeline()
+	defer pipe.Close()
+	cmds := make([]*redis.StatusCmd, len(keys))
+
+	for i := range keys {
+		cmds[i] = pipe.Set(keys[i], vals[i], t.builder.Expiration)
+	}
+
+	if _, err := pipe.Exec(); err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(keys))
+	for i, cmd := range cmds {
+		errs[i] = cmd.Err()
+	}
+
+	return errs, nil
+}
+
+func (t *RedisTracking) stripe(key string) *uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &t.stripes[h.Sum32()%uint32(len(t.stripes))]
+}
+
+// acquire the current client, release it when the operation is done
+func (t *RedisTracking) acquire() *redisTrackingClient {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	t.client.inflight.RLock()
+	return t.client
+}
+
+// snapshot acquire the client and the versions of keys before reading them from redis
+func (t *RedisTracking) snapshot(keys ...string) (*redisTrackingClient, []redisTrackingVersion, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	versions := make([]redisTrackingVersion, len(keys))
+	for i, key := range keys {
+		versions[i] = redisTrackingVersion{epoch: t.epoch, stripe: *t.stripe(key)}
+	}
+	t.client.inflight.RLock()
+	return t.client, versions, t.tracking
+}
+
+// store val read from redis, only if key is not invalidated since the snapshot
+func (t *RedisTracking) store(key string, val []byte, version redisTrackingVersion) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if t.tracking && t.epoch == version.epoch && *t.stripe(key) == version.stripe {
+		t.local.Set(key, val)
+	}
+}
+
+// invalidate keys, called on invalidation messages and after writes
+func (t *RedisTracking) invalidate(keys ...string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, key := range keys {
+		*t.stripe(key)++
+		t.local.Remove(key)
+	}
+}
+
+// flush all keys kept in process
+func (t *RedisTracking) flush() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.epoch++
+	t.local.Purge()
+}
+
+// connect the invalidation connection, then a redis client whose connections
+// redirect invalidation messages to it
+func (t *RedisTracking) connect() (net.Conn, *kvresp.Reader, *redis.Client, error) {
+	b := t.builder
+	dialer := &net.Dialer{Timeout: b.Timeout}
+	var conn net.Conn
+	var err error
+	if t.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", b.Address, t.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", b.Address)
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("redis [%v] connect failed: %v", b.Address, err)
+	}
+
+	reader := kvresp.NewReader(conn)
+	writer := kvresp.NewWriter(conn)
+	call := func(args ...string) (interface{}, error) {
+		conn.SetDeadline(time.Now().Add(b.Timeout))
+		writer.WriteCommand(args...)
+		if err := writer.Flush(); err != nil {
+			return nil, err
+		}
+		val, err := reader.ReadValue()
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := val.(kvresp.Error); ok {
+			return nil, e
+		}
+		return val, nil
+	}
+
+	id, err := func() (int64, error) {
+		if b.Username != "" {
+			if _, err := call("AUTH", b.Username, b.Password); err != nil {
+				return 0, err
+			}
+		} else if b.Password != "" {
+			if _, err := call("AUTH", b.Password); err != nil {
+				return 0, err
+			}
+		}
+		val, err := call("CLIENT", "ID")
+		if err != nil {
+			return 0, err
+		}
+		id, ok := val.(int64)
+		if !ok {
+			return 0, fmt.Errorf("unexpected client id [%v]", val)
+		}
+		if _, err := call("SUBSCRIBE", redisInvalidateChannel); err != nil {
+			return 0, err
+		}
+		return id, nil
+	}()
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("redis [%v] subscribe invalidation failed: %v", b.Address, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	password, auth := redisAuth(b.Username, b.Password)
+	client := redis.NewClient(&redis.Options{
+		Addr: b.Address,
+		OnConnect: func(c *redis.Conn) error {
+			if auth != nil {
+				if err := auth(c); err != nil {
+					return err
+				}
+			}
+			cmd := redis.NewStatusCmd("client", "tracking", "on", "redirect", id)
+			c.Process(cmd)
+			return cmd.Err()
+		},
+		Password:     password,
+		DialTimeout:  b.Timeout,
+		ReadTimeout:  b.Timeout,
+		WriteTimeout: b.Timeout,
+		MaxRetries:   b.Retries,
+		PoolSize:     b.PoolSize,
+		TLSConfig:    t.tlsConfig,
+	})
+	if err := client.Ping().Err(); err != nil {
+		client.Close()
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("redis [%v] ping failed: %v", b.Address, err)
+	}
+
+	return conn, reader, client, nil
+}
+
+// listen invalidation messages, reconnect if the connection is broken
+func (t *RedisTracking) listen(conn net.Conn, reader *kvresp.Reader) {
+	for {
+		t.receive(reader)
+		conn.Close()
+		select {
+		case <-t.done:
+			return
+		default:
+		}
+
+		// keys changed while disconnected are unknown, stop using the in process copy
+		t.mutex.Lock()
+		t.tracking = false
+		t.epoch++
+		t.local.Purge()
+		t.mutex.Unlock()
+
+		var ok bool
+		if conn, reader, ok = t.reconnect(); !ok {
+			return
+		}
+	}
+}
+
+// reconnect until success or closed, then replace the redis client,
+// whose connections redirect to the broken connection
+func (t *RedisTracking) reconnect() (net.Conn, *kvresp.Reader, bool) {
+	for {
+		select {
+		case <-t.done:
+			return nil, nil, false
+		case <-time.After(t.builder.ReconnectInterval):
+		}
+
+		conn, reader, client, err := t.connect()
+		if err != nil {
+			continue
+		}
+
+		t.mutex.Lock()
+		select {
+		case <-t.done:
+			t.mutex.Unlock()
+			conn.Close()
+			client.Close()
+			return nil, nil, false
+		default:
+		}
+		old := t.client
+		t.client = &redisTrackingClient{Client: client}
+		t.conn = conn
+		t.tracking = true
+		t.epoch++
+		t.local.Purge()
+		t.mutex.Unlock()
+		// reads started before are still using the old client
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			old.retire()
+		}()
+
+		return conn, reader, true
+	}
+}
+
+// receive invalidation messages until the connection is broken
+func (t *RedisTracking) receive(reader *kvresp.Reader) {
+	for {
+		val, err := reader.ReadValue()
+		if err != nil {
+			return
+		}
+		msg, ok := val.([]interface{})
+		if !ok || len(msg) != 3 {
+			continue
+		}
+		if kind, _ := msg[0].([]byte); string(kind) != "message" {
+			continue
+		}
+		if channel, _ := msg[1].([]byte); string(channel) != redisInvalidateChannel {
+			continue
+		}
+
+		switch payload := msg[2].(type) {
+		case nil:
+			t.flush()
+		case []interface{}:
+			keys := make([]string, 0, len(payload))
+			for _, k := range payload {
+				if buf, ok := k.([]byte); ok {
+					keys = append(keys, string(buf))
+				}
+			}
+			t.invalidate(keys...)
+		case []byte:
+			t.invalidate(string(payload))
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package kvclient_test
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// eventually wait invalidation messages, which are delivered asynchronously
+func eventually(fn func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if fn() {
+			return true
+		}
+		time.Sleep(time.Duration(10) * time.Millisecond)
+	}
+	return false
+}
+
+func TestRedisTracking(t *testing.T) {
+	Convey("test redis tracking", t, func() {
+		server, err := kvclienttest.NewRedisServer()
+		So(err, ShouldBeNil)
+		defer server.Close()
+
+		rt, err := kvclient.NewRedisTrackingBuilder().
+			WithAddress(server.Addr()).
+			WithReconnectInterval(time.Duration(10) * time.Millisecond).
+			Build()
+		So(err, ShouldBeNil)
+		defer rt.Close()
+
+		get := func(key string) string {
+			val, err := rt.Get(key)
+			So(err, ShouldBeNil)
+			return string(val)
+		}
+
+		Convey("values read are kept in process until changed by another client", func() {
+			server.Set("key1", []byte("val1"))
+			So(get("key1"), ShouldEqual, "val1")
+			So(server.Tracked("key1"), ShouldBeTrue)
+			So(get("key1"), ShouldEqual, "val1")
+			So(server.Calls("get"), ShouldEqual, 1)
+
+			server.Set("key1", []byte("val2"))
+			So(eventually(func() bool { return get("key1") == "val2" }), ShouldBeTrue)
+
+			server.Del("key1")
+			So(eventually(func() bool { return get("key1") == "" }), ShouldBeTrue)
+		})
+
+		Convey("own writes are visible immediately", func() {
+			So(rt.Set("key1", []byte("val1")), ShouldBeNil)
+			So(get("key1"), ShouldEqual, "val1")
+			So(rt.Set("key1", []byte("val2")), ShouldBeNil)
+			So(get("key1"), ShouldEqual, "val2")
+			ok, err := rt.SetNx("key1", []byte("val3"))
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			So(rt.Del("key1"), ShouldBeNil)
+			So(get("key1"), ShouldEqual, "")
+			So(rt.SetEx("key2", []byte("val2"), time.Minute), ShouldBeNil)
+			So(server.TTL("key2"), ShouldBeGreaterThan, time.Duration(59)*time.Second)
+		})
+
+		Convey("batch operations", func() {
+			errs, err := rt.SetBatch([]string{"key1", "key2"}, [][]byte{[]byte("val1"), []byte("val2")})
+			So(err, ShouldBeNil)
+			So(errs, ShouldResemble, []error{nil, nil})
+			So(get("key1"), ShouldEqual, "val1")
+
+			vals, errs, err := rt.GetBatch([]string{"key1", "key3", "key2"})
+			So(err, ShouldBeNil)
+			So(errs, ShouldResemble, []error{nil, nil, nil})
+			So(vals, ShouldResemble, [][]byte{[]byte("val1"), nil, []byte("val2")})
+
+			server.Set("key2", []byte("val4"))
+			So(eventually(func() bool {
+				vals, _, _ := rt.GetBatch([]string{"key1", "key2"})
+				return string(vals[1]) == "val4"
+			}), ShouldBeTrue)
+		})
+
+		Convey("reconnect and drop the in process copy", func() {
+			server.Set("key1", []byte("val1"))
+			So(get("key1"), ShouldEqual, "val1")
+
+			server.CloseClients()
+			server.Set("key1", []byte("val2"))
+			So(eventually(func() bool {
+				val, err := rt.Get("key1")
+				return err == nil && string(val) == "val2"
+			}), ShouldBeTrue)
+
+			So(eventually(func() bool { return server.Tracked("key1") }), ShouldBeTrue)
+			server.Set("key1", []byte("val3"))
+			So(eventually(func() bool { return get("key1") == "val3" }), ShouldBeTrue)
+		})
+
+		Convey("reads in flight are not broken by the replaced client", func() {
+			So(rt.Set("key1", []byte("val1")), ShouldBeNil)
+			var wg sync.WaitGroup
+			var closed int64
+			done := make(chan struct{})
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-done:
+							return
+						default:
+						}
+						// reads may fail with the connections closed by the server, but never
+						// with a client closed by reconnect
+						if _, err := rt.Get("key1"); err != nil && strings.Contains(err.Error(), "client is closed") {
+							atomic.AddInt64(&closed, 1)
+						}
+					}
+				}()
+			}
+			for i := 0; i < 5; i++ {
+				server.CloseClients()
+				time.Sleep(time.Duration(30) * time.Millisecond)
+			}
+			close(done)
+			wg.Wait()
+			So(atomic.LoadInt64(&closed), ShouldEqual, 0)
+		})
+
+		Convey("close twice", func() {
+			So(rt.Close(), ShouldBeNil)
+			So(rt.Close(), ShouldBeNil)
+		})
+	})
+}
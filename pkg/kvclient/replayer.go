@@ -0,0 +1,390 @@
+package kvclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// NewReplayerBuilder create a new Replayer builder
+func NewReplayerBuilder() *ReplayerBuilder {
+	return &ReplayerBuilder{
+		Filename: "trace.jsonl",
+		Speed:    1,
+	}
+}
+
+// ReplayerBuilder builder
+type ReplayerBuilder struct {
+	Filename   string  // trace recorded by RecordingCache
+	KeepTiming bool    // keep the intervals between operations, otherwise run as fast as possible
+	Speed      float64 // intervals are divided by speed with KeepTiming, 2 means twice as fast
+
+	reader io.Reader
+	cache  Cache
+	client KVClient
+}
+
+// WithFilename option
+func (b *ReplayerBuilder) WithFilename(filename string) *ReplayerBuilder {
+	b.Filename = filename
+	return b
+}
+
+// WithKeepTiming option
+func (b *ReplayerBuilder) WithKeepTiming(keepTiming bool) *ReplayerBuilder {
+	b.KeepTiming = keepTiming
+	return b
+}
+
+// WithSpeed option
+func (b *ReplayerBuilder) WithSpeed(speed float64) *ReplayerBuilder {
+	b.Speed = speed
+	return b
+}
+
+// WithReader option, read the trace from reader instead of Filename, which can be replayed only once
+func (b *ReplayerBuilder) WithReader(reader io.Reader) *ReplayerBuilder {
+	b.reader = reader
+	return b
+}
+
+// WithCache option, the cache to replay against
+func (b *ReplayerBuilder) WithCache(cache Cache) *ReplayerBuilder {
+	b.cache = cache
+	return b
+}
+
+// WithKVClient option, the client to replay against. keys and values of the trace are
+// passed to the caches as they are through a view of client, the client is not changed
+func (b *ReplayerBuilder) WithKVClient(client KVClient) *ReplayerBuilder {
+	b.client = client
+	return b
+}
+
+// Build a new Replayer
+func (b *ReplayerBuilder) Build() (*Replayer, error) {
+	cache := b.cache
+	if b.client != nil {
+		view, err := rawView(b.client)
+		if err != nil {
+			return nil, err
+		}
+		cache = &clientCache{client: view}
+	}
+	if cache == nil {
+		return nil, fmt.Errorf("no cache to replay against")
+	}
+	if b.KeepTiming && b.Speed <= 0 {
+		return nil, fmt.Errorf("speed should be positive, got [%v]", b.Speed)
+	}
+
+	return &Replayer{
+		filename:   b.Filename,
+		keepTiming: b.KeepTiming,
+		speed:      b.Speed,
+		reader:     b.reader,
+		cache:      cache,
+	}, nil
+}
+
+// Replayer drive a trace recorded by RecordingCache against a cache. values are
+// not recorded, they are generated with the recorded sizes
+type Replayer struct {
+	filename   string
+	keepTiming bool
+	speed      float64
+	reader     io.Reader
+	cache      Cache
+}
+
+// ReplayStats stats of a replay
+type ReplayStats struct {
+	Duration   time.Duration
+	Operations map[string]*ReplayOperationStats // by operation name, such as "Get"
+}
+
+// ReplayOperationStats stats of an operation
+type ReplayOperationStats struct {
+	Count           int
+	Errors          int           // operations failed in the replay
+	Mismatches      int           // results differ from the trace, such as a hit recorded but a miss replayed
+	Latency         time.Duration // total latency of the replay
+	RecordedLatency time.Duration // total latency of the trace
+}
+
+// Replay run the operations of the trace one by one in the recorded order
+func (r *Replayer) Replay() (*ReplayStats, error) {
+	reader := r.reader
+	if reader == nil {
+		fp, err := os.Open(r.filename)
+		if err != nil {
+			return nil, err
+		}
+		defer fp.Close()
+		reader = fp
+	}
+
+	stats := &ReplayStats{Operations: map[string]*ReplayOperationStats{}}
+	decoder := json.NewDecoder(reader)
+	start := time.Now()
+	var first int64
+	for i := 0; ; i++ {
+		record := &TraceRecord{}
+		if err := decoder.Decode(record); err == io.EOF {
+			break
+		} else if err != nil {
+			return stats, fmt.Errorf("decode record [%v] failed: %v", i, err)
+		}
+		keys, err := record.DecodeKeys()
+		if err != nil {
+			return stats, fmt.Errorf("decode record [%v] failed: %v", i, err)
+		}
+
+		if i == 0 {
+			first = record.Time
+		}
+		if r.keepTiming {
+			offset := time.Duration(float64(record.Time-first) / r.speed)
+			if d := offset - time.Since(start); d > 0 {
+				time.Sleep(d)
+			}
+		}
+
+		ts := time.Now()
+		result, err := r.replay(record, keys)
+		if err != nil {
+			return stats, fmt.Errorf("replay record [%v] failed: %v", i, err)
+		}
+		latency := time.Since(ts)
+
+		s, ok := stats.Operations[record.Op]
+		if !ok {
+			s = &ReplayOperationStats{}
+			stats.Operations[record.Op] = s
+		}
+		s.Count++
+		s.Latency += latency
+		s.RecordedLatency += time.Duration(record.Latency)
+		if result.err != nil {
+			s.Errors++
+		}
+		if result.result != record.Result || !sameHits(result.sizes, record.Sizes) {
+			s.Mismatches++
+		}
+	}
+	stats.Duration = time.Since(start)
+
+	return stats, nil
+}
+
+// replayResult result of an operation replayed, compared with the trace
+type replayResult struct {
+	result string
+	sizes  []int // sizes read by Get and GetBatch
+	err    error
+}
+
+// replay an operation, return an error only if the record is invalid
+func (r *Replayer) replay(record *TraceRecord, keys []string) (*replayResult, error) {
+	capability, err := ParseCapabilities([]string{record.Op})
+	if err != nil {
+		return nil, err
+	}
+	if capability != CapGetBatch && capability != CapSetBatch && len(keys) != 1 {
+		return nil, fmt.Errorf("operation [%v] expects 1 key, got [%v]", record.Op, len(keys))
+	}
+
+	res := &replayResult{result: TraceResultOK}
+	ok := true
+	switch capability {
+	case CapGet:
+		var val []byte
+		val, res.err = r.cache.Get(keys[0])
+		res.sizes = sizes([][]byte{val})
+		ok = val != nil
+	case CapGetBatch:
+		var vals [][]byte
+		vals, _, res.err = r.cache.GetBatch(keys)
+		res.sizes = sizes(vals)
+	case CapSet:
+		res.err = r.cache.Set(keys[0], replayValue(record, 0))
+	case CapDel:
+		res.err = r.cache.Del(keys[0])
+	case CapSetBatch:
+		vals := make([][]byte, len(keys))
+		for i := range vals {
+			vals[i] = replayValue(record, i)
+		}
+		_, res.err = r.cache.SetBatch(keys, vals)
+	case CapSetEx:
+		res.err = r.cache.SetEx(keys[0], replayValue(record, 0), time.Duration(record.TTL))
+	case CapSetNx:
+		ok, res.err = r.cache.SetNx(keys[0], replayValue(record, 0))
+	case CapSetExNx:
+		ok, res.err = r.cache.SetExNx(keys[0], replayValue(record, 0), time.Duration(record.TTL))
+	default:
+		return nil, fmt.Errorf("unknown operation [%v]", record.Op)
+	}
+
+	if res.err != nil {
+		res.result = TraceResultError
+	} else if !ok && capability == CapGet {
+		res.result = TraceResultMiss
+	} else if !ok {
+		res.result = TraceResultExists
+	}
+	return res, nil
+}
+
+// replayValue a value of the recorded size of the i-th key, filled with a fixed pattern
+func replayValue(record *TraceRecord, i int) []byte {
+	size := 0
+	if i < len(record.Sizes) && record.Sizes[i] > 0 {
+		size = record.Sizes[i]
+	}
+	val := make([]byte, size)
+	for j := range val {
+		val[j] = byte('a' + j%26)
+	}
+	return val
+}
+
+func sizes(vals [][]byte) []int {
+	s := make([]int, len(vals))
+	for i, val := range vals {
+		if val == nil {
+			s[i] = -1
+		} else {
+			s[i] = len(val)
+		}
+	}
+	return s
+}
+
+// sameHits return true if the keys found in replayed are the same as recorded, reads only
+func sameHits(replayed []int, recorded []int) bool {
+	if replayed == nil {
+		return true
+	}
+	if len(replayed) != len(recorded) {
+		return len(recorded) == 0
+	}
+	for i := range replayed {
+		if (replayed[i] < 0) != (recorded[i] < 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// rawCompressor keys of a trace are already compressed
+type rawCompressor struct{}
+
+func (rawCompressor) Compress(key interface{}) string {
+	return key.(string)
+}
+
+// rawSerializer values of a trace are already serialized
+type rawSerializer struct{}
+
+func (rawSerializer) Marshal(val interface{}) ([]byte, error) {
+	return val.([]byte), nil
+}
+
+func (rawSerializer) Unmarshal(buf []byte, val interface{}) error {
+	*(val.(*[]byte)) = buf
+	return nil
+}
+
+// rawView a view of the client whose keys and values are passed to the caches as they
+// are. the view shares the caches, hooks and stats with the client, which is not changed
+func rawView(client KVClient) (KVClient, error) {
+	c, ok := client.(*kvClient)
+	if !ok {
+		return nil, fmt.Errorf("can not replay against [%T], only clients built by Builder are supported", client)
+	}
+	view := *c
+	view.compressor = rawCompressor{}
+	view.serializer = rawSerializer{}
+	// the view never dumps, the caches are owned by the client
+	view.dumpFile = ""
+	return &view, nil
+}
+
+// clientCache replay against a KVClient as a Cache
+type clientCache struct {
+	client KVClient
+}
+
+func (c *clientCache) Capabilities() Capability {
+	return c.client.Capabilities()
+}
+
+// Close nothing, the client is closed by its owner
+func (c *clientCache) Close() error {
+	return nil
+}
+
+func (c *clientCache) Get(key string) ([]byte, error) {
+	var val []byte
+	ok, err := c.client.Get(key, &val)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return val, nil
+}
+
+func (c *clientCache) GetBatch(keys []string) ([][]byte, []error, error) {
+	ks := make([]interface{}, len(keys))
+	bufs := make([][]byte, len(keys))
+	vs := make([]interface{}, len(keys))
+	for i := range keys {
+		ks[i] = keys[i]
+		vs[i] = &bufs[i]
+	}
+	oks, errs, err := c.client.GetBatch(ks, vs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, ok := range oks {
+		if !ok {
+			bufs[i] = nil
+		}
+	}
+	return bufs, errs, nil
+}
+
+func (c *clientCache) Set(key string, val []byte) error {
+	return c.client.Set(key, val)
+}
+
+func (c *clientCache) Del(key string) error {
+	return c.client.Del(key)
+}
+
+func (c *clientCache) SetBatch(keys []string, vals [][]byte) ([]error, error) {
+	ks := make([]interface{}, len(keys))
+	vs := make([]interface{}, len(vals))
+	for i := range keys {
+		ks[i] = keys[i]
+	}
+	for i := range vals {
+		vs[i] = vals[i]
+	}
+	return c.client.SetBatch(ks, vs)
+}
+
+func (c *clientCache) SetEx(key string, val []byte, expiration time.Duration) error {
+	return c.client.SetEx(key, val, expiration)
+}
+
+func (c *clientCache) SetNx(key string, val []byte) (bool, error) {
+	return c.client.SetNx(key, val)
+}
+
+func (c *clientCache) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	return c.client.SetExNx(key, val, expiration)
+}
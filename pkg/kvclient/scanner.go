@@ -0,0 +1,70 @@
+package kvclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scanner a cache which iterates its keys, for inspecting tools such as kvctl
+type Scanner interface {
+	// Scan call fn with the keys not expired which start with prefix, their values and
+	// the time to live (0 means never expire) until fn returns false
+	Scan(prefix string, fn func(key string, val []byte, ttl time.Duration) bool) error
+}
+
+// TTLer a cache which tells the time to live of a key
+type TTLer interface {
+	// TTL time to live of key, 0 means never expire, return false if key not found
+	TTL(key string) (time.Duration, bool, error)
+}
+
+var errStopScan = errors.New("stop scan")
+
+// Scan keys of c which start with prefix by Scanner, or by Snapshotter for the local
+// caches, which snapshot all the keys into memory first
+func Scan(c Cache, prefix string, fn func(key string, val []byte, ttl time.Duration) bool) error {
+	if s, ok := c.(Scanner); ok {
+		return s.Scan(prefix, fn)
+	}
+	s, ok := c.(Snapshotter)
+	if !ok {
+		return fmt.Errorf("cache [%T] can not scan", c)
+	}
+	var buf bytes.Buffer
+	if err := s.Snapshot(&buf); err != nil {
+		return err
+	}
+	err := readDump(&buf, time.Now(), func(key string, val []byte, ttl time.Duration) error {
+		if !strings.HasPrefix(key, prefix) || fn(key, val, ttl) {
+			return nil
+		}
+		return errStopScan
+	})
+	if err == errStopScan {
+		return nil
+	}
+	return err
+}
+
+// TTL of key in c by TTLer, or by scanning a Snapshotter
+func TTL(c Cache, key string) (time.Duration, bool, error) {
+	if t, ok := c.(TTLer); ok {
+		return t.TTL(key)
+	}
+	if _, ok := c.(Snapshotter); !ok {
+		return 0, false, fmt.Errorf("cache [%T] can not tell ttl", c)
+	}
+	var ttl time.Duration
+	found := false
+	err := Scan(c, key, func(k string, val []byte, t time.Duration) bool {
+		if k != key {
+			return true
+		}
+		ttl, found = t, true
+		return false
+	})
+	return ttl, found, err
+}
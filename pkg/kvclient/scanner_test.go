@@ -0,0 +1,106 @@
+package kvclient_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func checkScan(c kvclient.Cache) {
+	So(c.SetEx("user:1", []byte("val1"), time.Hour), ShouldBeNil)
+	So(c.SetEx("user:2", []byte("val2"), 0), ShouldBeNil)
+	So(c.SetEx("user:3", []byte("val3"), time.Hour), ShouldBeNil)
+	So(c.SetEx("item:1", []byte("val4"), time.Hour), ShouldBeNil)
+
+	var keys []string
+	vals := map[string]string{}
+	So(kvclient.Scan(c, "user:", func(key string, val []byte, ttl time.Duration) bool {
+		keys = append(keys, key)
+		vals[key] = string(val)
+		return true
+	}), ShouldBeNil)
+	sort.Strings(keys)
+	So(keys, ShouldResemble, []string{"user:1", "user:2", "user:3"})
+	So(vals["user:2"], ShouldEqual, "val2")
+
+	n := 0
+	So(kvclient.Scan(c, "", func(key string, val []byte, ttl time.Duration) bool {
+		n++
+		return n < 2
+	}), ShouldBeNil)
+	So(n, ShouldEqual, 2)
+
+	ttl, ok, err := kvclient.TTL(c, "user:1")
+	So(err, ShouldBeNil)
+	So(ok, ShouldBeTrue)
+	So(ttl, ShouldBeBetweenOrEqual, 59*time.Minute, time.Hour+time.Second)
+	ttl, ok, err = kvclient.TTL(c, "user:2")
+	So(err, ShouldBeNil)
+	So(ok, ShouldBeTrue)
+	So(ttl, ShouldEqual, 0)
+	_, ok, err = kvclient.TTL(c, "user:4")
+	So(err, ShouldBeNil)
+	So(ok, ShouldBeFalse)
+}
+
+func TestScan(t *testing.T) {
+	Convey("test scan and ttl", t, func() {
+		directory, err := ioutil.TempDir("", "scan")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+
+		Convey("snapshotter", func() {
+			checkScan(kvclient.NewMapCacheBuilder().Build())
+		})
+
+		Convey("leveldb", func() {
+			c, err := kvclient.NewLevelDBBuilder().WithDirectory(directory).Build()
+			So(err, ShouldBeNil)
+			defer c.Close()
+			checkScan(c)
+		})
+
+		Convey("boltdb", func() {
+			c, err := kvclient.NewBoltDBBuilder().WithFilename(filepath.Join(directory, "bolt.db")).Build()
+			So(err, ShouldBeNil)
+			defer c.Close()
+			checkScan(c)
+		})
+
+		Convey("badger", func() {
+			c, err := kvclient.NewBadgerBuilder().WithInMemory(true).Build()
+			So(err, ShouldBeNil)
+			defer c.Close()
+			checkScan(c)
+		})
+
+		Convey("bitcask", func() {
+			c, err := kvclient.NewBitcaskBuilder().WithDirectory(directory).Build()
+			So(err, ShouldBeNil)
+			defer c.Close()
+			checkScan(c)
+		})
+
+		Convey("redis", func() {
+			server, err := miniredis.Run()
+			So(err, ShouldBeNil)
+			defer server.Close()
+			c, err := kvclient.NewRedisStringBuilder().WithAddress(server.Addr()).Build()
+			So(err, ShouldBeNil)
+			defer c.Close()
+			checkScan(c)
+		})
+
+		Convey("others can not scan", func() {
+			_, _, err := kvclient.TTL(kvclient.NewMemcacheBuilder().Build(), "key1")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,420 @@
+package kvclient
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// snapshot file: records | sparse index | bloom filter | footer
+//
+//	record: keyLen uvarint | key | valLen uvarint | val, sorted by key
+//	index: (keyLen uvarint | key | offset uvarint) of every interval records
+//	bloom: k uint32 | bits
+//	footer: indexOffset uint64 | bloomOffset uint64 | count uint64 | crc32 of index and bloom | magic
+const snapshotFooterLen = 36
+
+var snapshotMagic = []byte("KVSNAP01")
+
+// NewSnapshotBuilder create a new SnapshotBuilder
+func NewSnapshotBuilder() *SnapshotBuilder {
+	return &SnapshotBuilder{
+		Pattern:       "*.snapshot",
+		WatchInterval: time.Duration(1) * time.Minute,
+	}
+}
+
+// SnapshotBuilder builder
+type SnapshotBuilder struct {
+	Filename      string        // the snapshot file, or
+	Directory     string        // the directory of snapshot files, the last one by name is served
+	Pattern       string        // pattern of the snapshot files in directory
+	WatchInterval time.Duration // interval to look for a newer file in directory, 0 disable it
+}
+
+// WithFilename option
+func (b *SnapshotBuilder) WithFilename(filename string) *SnapshotBuilder {
+	b.Filename = filename
+	return b
+}
+
+// WithDirectory option
+func (b *SnapshotBuilder) WithDirectory(directory string) *SnapshotBuilder {
+	b.Directory = directory
+	return b
+}
+
+// WithPattern option
+func (b *SnapshotBuilder) WithPattern(pattern string) *SnapshotBuilder {
+	b.Pattern = pattern
+	return b
+}
+
+// WithWatchInterval option
+func (b *SnapshotBuilder) WithWatchInterval(watchInterval time.Duration) *SnapshotBuilder {
+	b.WatchInterval = watchInterval
+	return b
+}
+
+// Build a new Snapshot
+func (b *SnapshotBuilder) Build() (*Snapshot, error) {
+	s := &Snapshot{
+		directory: b.Directory,
+		pattern:   b.Pattern,
+		done:      make(chan struct{}),
+	}
+
+	if b.Directory == "" {
+		if err := s.Swap(b.Filename); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	if b.WatchInterval > 0 {
+		s.wg.Add(1)
+		go s.watchLoop(b.WatchInterval)
+	}
+	return s, nil
+}
+
+// Snapshot read only datasource of an immutable sorted file written by SnapshotWriter.
+// the file is memory mapped, a get checks the bloom filter, finds the block in the sparse
+// index, then scans the block. Swap replaces the file atomically, gets in flight finish
+// on the old file before it is unmapped
+type Snapshot struct {
+	BaseCache
+
+	mutex     sync.RWMutex
+	file      *snapshotFile
+	directory string
+	pattern   string
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closer    Closer
+}
+
+// Capabilities supported operations
+func (s *Snapshot) Capabilities() Capability {
+	return CapGet | CapGetBatch
+}
+
+// Close the snapshot
+func (s *Snapshot) Close() error {
+	return s.closer.Close(func() error {
+		close(s.done)
+		s.wg.Wait()
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.file == nil {
+			return nil
+		}
+		err := s.file.close()
+		s.file = nil
+		return err
+	})
+}
+
+// Filename the file being served
+func (s *Snapshot) Filename() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.file == nil {
+		return ""
+	}
+	return s.file.filename
+}
+
+// Count number of keys in the file being served
+func (s *Snapshot) Count() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.file == nil {
+		return 0
+	}
+	return int(s.file.count)
+}
+
+// Swap serve a new file, the old file is closed after the gets in flight
+func (s *Snapshot) Swap(filename string) error {
+	file, err := openSnapshotFile(filename)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	old := s.file
+	s.file = file
+	s.mutex.Unlock()
+	if old != nil {
+		return old.close()
+	}
+	return nil
+}
+
+// Reload swap to the last file in directory by name if it is not being served,
+// return true if swapped
+func (s *Snapshot) Reload() (bool, error) {
+	names, err := filepath.Glob(filepath.Join(s.directory, s.pattern))
+	if err != nil {
+		return false, err
+	}
+	if len(names) == 0 {
+		return false, fmt.Errorf("no snapshot file matches [%v]", filepath.Join(s.directory, s.pattern))
+	}
+	sort.Strings(names)
+	last := names[len(names)-1]
+	if last == s.Filename() {
+		return false, nil
+	}
+	return true, s.Swap(last)
+}
+
+// watchLoop run Reload every interval until Close
+func (s *Snapshot) watchLoop(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.Reload()
+		}
+	}
+}
+
+// Get key
+func (s *Snapshot) Get(key string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.file == nil {
+		return nil, fmt.Errorf("snapshot is closed")
+	}
+	return s.file.get(key)
+}
+
+// GetBatch keys
+func (s *Snapshot) GetBatch(keys []string) ([][]byte, []error, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.file == nil {
+		return nil, nil, fmt.Errorf("snapshot is closed")
+	}
+	vals := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	var err error
+	for i := range keys {
+		vals[i], errs[i] = s.file.get(keys[i])
+		if errs[i] != nil {
+			err = errs[i]
+		}
+	}
+	return vals, errs, err
+}
+
+// snapshotFile an opened snapshot file
+type snapshotFile struct {
+	filename string
+	fp       *os.File
+	data     []byte // memory map of the whole file
+	records  []byte // the record section of data
+	keys     [][]byte
+	offsets  []uint64
+	bloom    *snapshotBloom
+	count    uint64
+}
+
+func openSnapshotFile(filename string) (*snapshotFile, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return nil, err
+	}
+	if info.Size() < snapshotFooterLen {
+		fp.Close()
+		return nil, fmt.Errorf("snapshot file [%v] is too small", filename)
+	}
+	data, err := mmapFile(fp, info.Size())
+	if err != nil {
+		fp.Close()
+		return nil, err
+	}
+	f := &snapshotFile{filename: filename, fp: fp, data: data}
+	if err := f.parse(); err != nil {
+		f.close()
+		return nil, fmt.Errorf("snapshot file [%v] is corrupted: %v", filename, err)
+	}
+	return f, nil
+}
+
+// parse the footer, the sparse index and the bloom filter
+func (f *snapshotFile) parse() error {
+	footer := f.data[len(f.data)-snapshotFooterLen:]
+	if !bytes.Equal(footer[28:], snapshotMagic) {
+		return fmt.Errorf("bad magic")
+	}
+	indexOffset := binary.BigEndian.Uint64(footer)
+	bloomOffset := binary.BigEndian.Uint64(footer[8:])
+	f.count = binary.BigEndian.Uint64(footer[16:])
+	metaEnd := uint64(len(f.data) - snapshotFooterLen)
+	if indexOffset > bloomOffset || bloomOffset > metaEnd {
+		return fmt.Errorf("bad offsets")
+	}
+	if crc32.ChecksumIEEE(f.data[indexOffset:metaEnd]) != binary.BigEndian.Uint32(footer[24:]) {
+		return fmt.Errorf("crc mismatch")
+	}
+	f.records = f.data[:indexOffset]
+
+	index := f.data[indexOffset:bloomOffset]
+	for len(index) > 0 {
+		key, n := readUvarintBytes(index)
+		if n <= 0 {
+			return fmt.Errorf("bad index")
+		}
+		offset, m := binary.Uvarint(index[n:])
+		if m <= 0 || offset > indexOffset {
+			return fmt.Errorf("bad index")
+		}
+		f.keys = append(f.keys, key)
+		f.offsets = append(f.offsets, offset)
+		index = index[n+m:]
+	}
+
+	bloom, err := decodeSnapshotBloom(f.data[bloomOffset:metaEnd])
+	if err != nil {
+		return err
+	}
+	f.bloom = bloom
+	return nil
+}
+
+// readUvarintBytes read a length prefixed byte slice, n <= 0 if buf is too short
+func readUvarintBytes(buf []byte) ([]byte, int) {
+	l, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < l {
+		return nil, 0
+	}
+	return buf[n : n+int(l)], n + int(l)
+}
+
+// get key, the value is copied out of the memory map
+func (f *snapshotFile) get(key string) ([]byte, error) {
+	if !f.bloom.has(key) {
+		return nil, nil
+	}
+	target := []byte(key)
+	// the last block whose first key <= key
+	i := sort.Search(len(f.keys), func(i int) bool { return bytes.Compare(f.keys[i], target) > 0 }) - 1
+	if i < 0 {
+		return nil, nil
+	}
+	end := uint64(len(f.records))
+	if i+1 < len(f.offsets) {
+		end = f.offsets[i+1]
+	}
+	block := f.records[f.offsets[i]:end]
+	for len(block) > 0 {
+		k, n := readUvarintBytes(block)
+		if n <= 0 {
+			return nil, fmt.Errorf("snapshot file [%v] is corrupted", f.filename)
+		}
+		v, m := readUvarintBytes(block[n:])
+		if m <= 0 {
+			return nil, fmt.Errorf("snapshot file [%v] is corrupted", f.filename)
+		}
+		switch c := bytes.Compare(k, target); {
+		case c == 0:
+			return append([]byte{}, v...), nil
+		case c > 0:
+			return nil, nil
+		}
+		block = block[n+m:]
+	}
+	return nil, nil
+}
+
+func (f *snapshotFile) close() error {
+	err := munmapFile(f.data)
+	if cerr := f.fp.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// snapshotBloom bloom filter with double hashing of fnv64a
+type snapshotBloom struct {
+	k    uint32
+	bits []byte
+}
+
+func newSnapshotBloom(n int, bitsPerKey int) *snapshotBloom {
+	m := n * bitsPerKey
+	if m < 64 {
+		m = 64
+	}
+	k := uint32(math.Round(float64(bitsPerKey) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	if k > 30 {
+		k = 30
+	}
+	return &snapshotBloom{k: k, bits: make([]byte, (m+7)/8)}
+}
+
+func decodeSnapshotBloom(buf []byte) (*snapshotBloom, error) {
+	if len(buf) < 5 {
+		return nil, fmt.Errorf("bad bloom filter")
+	}
+	return &snapshotBloom{k: binary.BigEndian.Uint32(buf), bits: buf[4:]}, nil
+}
+
+func (b *snapshotBloom) encode() []byte {
+	buf := make([]byte, 4+len(b.bits))
+	binary.BigEndian.PutUint32(buf, b.k)
+	copy(buf[4:], b.bits)
+	return buf
+}
+
+func (b *snapshotBloom) positions(key string, fn func(bit uint64) bool) bool {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum, sum>>32|1
+	m := uint64(len(b.bits)) * 8
+	for i := uint64(0); i < uint64(b.k); i++ {
+		if !fn((h1 + i*h2) % m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *snapshotBloom) add(key string) {
+	b.positions(key, func(bit uint64) bool {
+		b.bits[bit/8] |= 1 << (bit % 8)
+		return true
+	})
+}
+
+func (b *snapshotBloom) has(key string) bool {
+	return b.positions(key, func(bit uint64) bool {
+		return b.bits[bit/8]&(1<<(bit%8)) != 0
+	})
+}
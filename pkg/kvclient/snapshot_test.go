@@ -0,0 +1,134 @@
+package kvclient_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func writeSnapshot(filename string, n int, day string) error {
+	writer, err := kvclient.NewSnapshotWriterBuilder().
+		WithFilename(filename).
+		WithMemBytes(4096).
+		WithIndexInterval(16).
+		Build()
+	if err != nil {
+		return err
+	}
+	// keys in reverse order, odd keys are added twice and the second one wins
+	for i := n - 1; i >= 0; i-- {
+		if i%2 == 1 {
+			if err := writer.Add(fmt.Sprintf("key%05d", i), []byte("stale")); err != nil {
+				return err
+			}
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		if err := writer.Add(fmt.Sprintf("key%05d", i), []byte(fmt.Sprintf("%v-val%05d", day, i))); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func TestSnapshot(t *testing.T) {
+	directory, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	filename := filepath.Join(directory, "20180601.snapshot")
+	if err := writeSnapshot(filename, 1000, "20180601"); err != nil {
+		t.Fatal(err)
+	}
+
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewSnapshotBuilder().WithFilename(filename).Build()
+	})
+
+	Convey("test snapshot", t, func() {
+		snapshot, err := kvclient.NewSnapshotBuilder().WithDirectory(directory).WithWatchInterval(0).Build()
+		So(err, ShouldBeNil)
+		defer snapshot.Close()
+		So(snapshot.Count(), ShouldEqual, 1000)
+		So(snapshot.Filename(), ShouldEqual, filename)
+
+		Convey("get every key and misses", func() {
+			for i := 0; i < 1000; i++ {
+				val, err := snapshot.Get(fmt.Sprintf("key%05d", i))
+				So(err, ShouldBeNil)
+				So(string(val), ShouldEqual, fmt.Sprintf("20180601-val%05d", i))
+			}
+			for _, key := range []string{"", "key", "key00000a", "key01000", "zzz"} {
+				val, err := snapshot.Get(key)
+				So(err, ShouldBeNil)
+				So(val, ShouldBeNil)
+			}
+			vals, errs, err := snapshot.GetBatch([]string{"key00999", "key01000", "key00000"})
+			So(err, ShouldBeNil)
+			So(errs, ShouldResemble, []error{nil, nil, nil})
+			So(vals, ShouldResemble, [][]byte{[]byte("20180601-val00999"), nil, []byte("20180601-val00000")})
+		})
+
+		Convey("swap to the new day while reading", func() {
+			var wg sync.WaitGroup
+			done := make(chan struct{})
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-done:
+							return
+						default:
+						}
+						val, err := snapshot.Get("key00001")
+						if err != nil || (string(val) != "20180601-val00001" && string(val) != "20180602-val00001") {
+							panic(fmt.Sprintf("unexpected [%s] [%v]", val, err))
+						}
+					}
+				}()
+			}
+
+			So(writeSnapshot(filepath.Join(directory, "20180602.snapshot"), 500, "20180602"), ShouldBeNil)
+			swapped, err := snapshot.Reload()
+			So(err, ShouldBeNil)
+			So(swapped, ShouldBeTrue)
+			time.Sleep(time.Duration(10) * time.Millisecond)
+			close(done)
+			wg.Wait()
+
+			So(snapshot.Count(), ShouldEqual, 500)
+			val, err := snapshot.Get("key00001")
+			So(err, ShouldBeNil)
+			So(string(val), ShouldEqual, "20180602-val00001")
+			val, err = snapshot.Get("key00600")
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+			swapped, err = snapshot.Reload()
+			So(err, ShouldBeNil)
+			So(swapped, ShouldBeFalse)
+			So(os.Remove(filepath.Join(directory, "20180602.snapshot")), ShouldBeNil)
+		})
+
+		Convey("corrupted files are rejected", func() {
+			corrupted := filepath.Join(directory, "corrupted")
+			buf, err := ioutil.ReadFile(filename)
+			So(err, ShouldBeNil)
+			buf[len(buf)-40] ^= 0xff
+			So(ioutil.WriteFile(corrupted, buf, 0644), ShouldBeNil)
+			defer os.Remove(corrupted)
+			So(snapshot.Swap(corrupted), ShouldNotBeNil)
+			So(snapshot.Filename(), ShouldEqual, filename)
+		})
+	})
+}
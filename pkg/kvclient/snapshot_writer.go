@@ -0,0 +1,369 @@
+package kvclient
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// NewSnapshotWriterBuilder create a new SnapshotWriterBuilder
+func NewSnapshotWriterBuilder() *SnapshotWriterBuilder {
+	return &SnapshotWriterBuilder{
+		Filename:        "kvclient.snapshot",
+		MemBytes:        256 * 1024 * 1024,
+		IndexInterval:   64,
+		BloomBitsPerKey: 10,
+	}
+}
+
+// SnapshotWriterBuilder builder
+type SnapshotWriterBuilder struct {
+	Filename        string
+	TempDirectory   string // directory of the sorted runs, default the directory of filename
+	MemBytes        int    // keys and values are sorted in memory up to the size, then spilled to a run
+	IndexInterval   int    // one sparse index entry every interval records
+	BloomBitsPerKey int    // 10 bits per key has a false positive rate of about 1%
+}
+
+// WithFilename option
+func (b *SnapshotWriterBuilder) WithFilename(filename string) *SnapshotWriterBuilder {
+	b.Filename = filename
+	return b
+}
+
+// WithTempDirectory option
+func (b *SnapshotWriterBuilder) WithTempDirectory(tempDirectory string) *SnapshotWriterBuilder {
+	b.TempDirectory = tempDirectory
+	return b
+}
+
+// WithMemBytes option
+func (b *SnapshotWriterBuilder) WithMemBytes(memBytes int) *SnapshotWriterBuilder {
+	b.MemBytes = memBytes
+	return b
+}
+
+// WithIndexInterval option
+func (b *SnapshotWriterBuilder) WithIndexInterval(indexInterval int) *SnapshotWriterBuilder {
+	b.IndexInterval = indexInterval
+	return b
+}
+
+// WithBloomBitsPerKey option
+func (b *SnapshotWriterBuilder) WithBloomBitsPerKey(bloomBitsPerKey int) *SnapshotWriterBuilder {
+	b.BloomBitsPerKey = bloomBitsPerKey
+	return b
+}
+
+// Build a new SnapshotWriter
+func (b *SnapshotWriterBuilder) Build() (*SnapshotWriter, error) {
+	if b.IndexInterval <= 0 || b.BloomBitsPerKey <= 0 {
+		return nil, fmt.Errorf("index interval [%v] and bloom bits per key [%v] should be positive", b.IndexInterval, b.BloomBitsPerKey)
+	}
+	directory := b.TempDirectory
+	if directory == "" {
+		directory = filepath.Dir(b.Filename)
+	}
+	tmp, err := ioutil.TempDir(directory, filepath.Base(b.Filename)+".runs")
+	if err != nil {
+		return nil, err
+	}
+
+	return &SnapshotWriter{
+		filename:        b.Filename,
+		runDirectory:    tmp,
+		memBytes:        b.MemBytes,
+		indexInterval:   b.IndexInterval,
+		bloomBitsPerKey: b.BloomBitsPerKey,
+	}, nil
+}
+
+// SnapshotWriter write a snapshot file from keys in any order. keys are sorted in memory
+// and spilled to sorted runs, Close merges the runs and writes the file in one pass.
+// if a key is added more than once, the last one wins. safe for concurrent use
+type SnapshotWriter struct {
+	mutex           sync.Mutex
+	filename        string
+	runDirectory    string
+	memBytes        int
+	indexInterval   int
+	bloomBitsPerKey int
+
+	records []snapshotRecord
+	bytes   int
+	seq     uint64
+	runs    []string
+	total   int // records added, an upper bound of the keys to size the bloom filter
+	closer  Closer
+}
+
+// snapshotRecord seq orders the records of the same key, the larger one is added later
+type snapshotRecord struct {
+	key string
+	val []byte
+	seq uint64
+}
+
+// Add a key value
+func (w *SnapshotWriter) Add(key string, val []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.records = append(w.records, snapshotRecord{key: key, val: append([]byte{}, val...), seq: w.seq})
+	w.seq++
+	w.total++
+	w.bytes += len(key) + len(val)
+	if w.bytes >= w.memBytes {
+		return w.spill()
+	}
+	return nil
+}
+
+// sortRecords by key, then by seq descending so that the latest record of a key is the first
+func sortRecords(records []snapshotRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].key != records[j].key {
+			return records[i].key < records[j].key
+		}
+		return records[i].seq > records[j].seq
+	})
+}
+
+// spill the records in memory to a sorted run
+func (w *SnapshotWriter) spill() error {
+	sortRecords(w.records)
+	fp, err := ioutil.TempFile(w.runDirectory, "run")
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	writer := bufio.NewWriterSize(fp, 1024*1024)
+	for _, r := range w.records {
+		if err := writeSnapshotRun(writer, r); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	w.runs = append(w.runs, fp.Name())
+	w.records = w.records[:0]
+	w.bytes = 0
+	return nil
+}
+
+// run record: seq uvarint | keyLen uvarint | valLen uvarint | key | val
+func writeSnapshotRun(writer *bufio.Writer, r snapshotRecord) error {
+	var buf [3 * binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], r.seq)
+	n += binary.PutUvarint(buf[n:], uint64(len(r.key)))
+	n += binary.PutUvarint(buf[n:], uint64(len(r.val)))
+	writer.Write(buf[:n])
+	writer.WriteString(r.key)
+	_, err := writer.Write(r.val)
+	return err
+}
+
+func readSnapshotRun(reader *bufio.Reader) (snapshotRecord, error) {
+	var r snapshotRecord
+	seq, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return r, err
+	}
+	keyLen, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return r, err
+	}
+	valLen, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return r, err
+	}
+	buf := make([]byte, keyLen+valLen)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return r, err
+	}
+	return snapshotRecord{key: string(buf[:keyLen]), val: buf[keyLen:], seq: seq}, nil
+}
+
+// Abort remove the runs without writing the file
+func (w *SnapshotWriter) Abort() error {
+	return w.closer.Close(func() error {
+		return os.RemoveAll(w.runDirectory)
+	})
+}
+
+// Close merge the runs and the records in memory, write the file through a temporary
+// file and rename it, so that readers never see a partial file
+func (w *SnapshotWriter) Close() error {
+	return w.closer.Close(func() error {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		defer os.RemoveAll(w.runDirectory)
+		sortRecords(w.records)
+
+		merger := &snapshotMerger{}
+		for i, run := range w.runs {
+			fp, err := os.Open(run)
+			if err != nil {
+				return err
+			}
+			defer fp.Close()
+			reader := bufio.NewReaderSize(fp, 256*1024)
+			next := func() (snapshotRecord, error) { return readSnapshotRun(reader) }
+			if err := merger.add(i, next); err != nil {
+				return err
+			}
+		}
+		records := w.records
+		if err := merger.add(len(w.runs), func() (snapshotRecord, error) {
+			if len(records) == 0 {
+				return snapshotRecord{}, io.EOF
+			}
+			r := records[0]
+			records = records[1:]
+			return r, nil
+		}); err != nil {
+			return err
+		}
+
+		tmp := w.filename + ".tmp"
+		if err := w.write(tmp, merger); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return os.Rename(tmp, w.filename)
+	})
+}
+
+// write the merged records, the sparse index, the bloom filter and the footer
+func (w *SnapshotWriter) write(filename string, merger *snapshotMerger) error {
+	fp, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	writer := bufio.NewWriterSize(fp, 1024*1024)
+
+	bloom := newSnapshotBloom(w.total, w.bloomBitsPerKey)
+	var index []byte
+	var buf [binary.MaxVarintLen64]byte
+	offset := uint64(0)
+	count := uint64(0)
+	last, first := "", true
+	for {
+		r, err := merger.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// the latest record of a key comes first
+		if !first && r.key == last {
+			continue
+		}
+		first, last = false, r.key
+
+		if count%uint64(w.indexInterval) == 0 {
+			index = appendUvarintBytes(index, []byte(r.key))
+			index = binary.AppendUvarint(index, offset)
+		}
+		bloom.add(r.key)
+		n := binary.PutUvarint(buf[:], uint64(len(r.key)))
+		writer.Write(buf[:n])
+		writer.WriteString(r.key)
+		m := binary.PutUvarint(buf[:], uint64(len(r.val)))
+		writer.Write(buf[:m])
+		if _, err := writer.Write(r.val); err != nil {
+			return err
+		}
+		offset += uint64(n + len(r.key) + m + len(r.val))
+		count++
+	}
+
+	meta := append(index, bloom.encode()...)
+	footer := make([]byte, snapshotFooterLen)
+	binary.BigEndian.PutUint64(footer, offset)
+	binary.BigEndian.PutUint64(footer[8:], offset+uint64(len(index)))
+	binary.BigEndian.PutUint64(footer[16:], count)
+	binary.BigEndian.PutUint32(footer[24:], crc32.ChecksumIEEE(meta))
+	copy(footer[28:], snapshotMagic)
+	writer.Write(meta)
+	if _, err := writer.Write(footer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return fp.Sync()
+}
+
+func appendUvarintBytes(buf []byte, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// snapshotMerger merge sorted runs with a heap, records of the same key are ordered by
+// seq descending. seq of a record is unique, so runs are added in any order
+type snapshotMerger struct {
+	items []*snapshotMergeItem
+}
+
+type snapshotMergeItem struct {
+	record snapshotRecord
+	next   func() (snapshotRecord, error)
+}
+
+func (m *snapshotMerger) Len() int { return len(m.items) }
+func (m *snapshotMerger) Less(i, j int) bool {
+	ri, rj := m.items[i].record, m.items[j].record
+	if ri.key != rj.key {
+		return ri.key < rj.key
+	}
+	return ri.seq > rj.seq
+}
+func (m *snapshotMerger) Swap(i, j int)      { m.items[i], m.items[j] = m.items[j], m.items[i] }
+func (m *snapshotMerger) Push(x interface{}) { m.items = append(m.items, x.(*snapshotMergeItem)) }
+func (m *snapshotMerger) Pop() interface{} {
+	item := m.items[len(m.items)-1]
+	m.items = m.items[:len(m.items)-1]
+	return item
+}
+
+func (m *snapshotMerger) add(run int, next func() (snapshotRecord, error)) error {
+	r, err := next()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read run [%v] failed: %v", run, err)
+	}
+	heap.Push(m, &snapshotMergeItem{record: r, next: next})
+	return nil
+}
+
+func (m *snapshotMerger) next() (snapshotRecord, error) {
+	if len(m.items) == 0 {
+		return snapshotRecord{}, io.EOF
+	}
+	item := m.items[0]
+	r := item.record
+	next, err := item.next()
+	if err == io.EOF {
+		heap.Pop(m)
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+	item.record = next
+	heap.Fix(m, 0)
+	return r, nil
+}
@@ -0,0 +1,159 @@
+package kvclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Snapshotter a local cache which can dump its keys and restore them, so that a process
+// restarts with a warm cache instead of sending all the reads to the remote tiers
+type Snapshotter interface {
+	// Snapshot write the keys not expired with their expire time
+	Snapshot(w io.Writer) error
+	// Restore the keys written by Snapshot, keys expired since the snapshot are skipped
+	// and keys already in the cache are kept
+	Restore(r io.Reader) error
+}
+
+// dump stream: magic | entries | 0
+//
+//	entry: keyLen+1 uvarint | key | valLen uvarint | val | expireAt uvarint
+//
+// expireAt is in unix milliseconds and 0 means never expire, so the time a process is
+// down counts against the ttl. the terminating 0 tells a complete stream from a truncated one
+var dumpMagic = []byte("KVDUMP01")
+
+// dumpWriter write a dump stream
+type dumpWriter struct {
+	writer *bufio.Writer
+	buf    [binary.MaxVarintLen64]byte
+}
+
+func newDumpWriter(w io.Writer) (*dumpWriter, error) {
+	writer := bufio.NewWriterSize(w, 256*1024)
+	if _, err := writer.Write(dumpMagic); err != nil {
+		return nil, err
+	}
+	return &dumpWriter{writer: writer}, nil
+}
+
+// uvarint write v, errors of bufio.Writer are sticky so the last write returns the first error
+func (w *dumpWriter) uvarint(v uint64) error {
+	n := binary.PutUvarint(w.buf[:], v)
+	_, err := w.writer.Write(w.buf[:n])
+	return err
+}
+
+// write an entry, expireAt comes from expireAt
+func (w *dumpWriter) write(key string, val []byte, expireAt int64) error {
+	w.uvarint(uint64(len(key)) + 1)
+	w.writer.WriteString(key)
+	w.uvarint(uint64(len(val)))
+	w.writer.Write(val)
+	return w.uvarint(uint64(expireAt))
+}
+
+// close write the terminator and flush
+func (w *dumpWriter) close() error {
+	w.uvarint(0)
+	return w.writer.Flush()
+}
+
+// readDump call fn with the entries not expired at now, expiration is the time left,
+// 0 means never expire
+func readDump(r io.Reader, now time.Time, fn func(key string, val []byte, expiration time.Duration) error) error {
+	reader := bufio.NewReaderSize(r, 256*1024)
+	magic := make([]byte, len(dumpMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return fmt.Errorf("read dump magic failed: %v", err)
+	}
+	if !bytes.Equal(magic, dumpMagic) {
+		return fmt.Errorf("bad dump magic [%q]", magic)
+	}
+
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	for {
+		keyLen, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return fmt.Errorf("dump is truncated: %v", err)
+		}
+		if keyLen == 0 {
+			return nil
+		}
+		key := make([]byte, keyLen-1)
+		if _, err := io.ReadFull(reader, key); err != nil {
+			return fmt.Errorf("dump is truncated: %v", err)
+		}
+		valLen, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return fmt.Errorf("dump is truncated: %v", err)
+		}
+		val := make([]byte, valLen)
+		if _, err := io.ReadFull(reader, val); err != nil {
+			return fmt.Errorf("dump is truncated: %v", err)
+		}
+		at, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return fmt.Errorf("dump is truncated: %v", err)
+		}
+
+		if isExpired(int64(at), now) {
+			continue
+		}
+		var expiration time.Duration
+		if at != 0 {
+			expiration = time.Duration(int64(at)-nowMs) * time.Millisecond
+		}
+		if err := fn(string(key), val, expiration); err != nil {
+			return err
+		}
+	}
+}
+
+// SnapshotFile dump s into filename through a temporary file, so that a crash never
+// leaves a partial file behind
+func SnapshotFile(s Snapshotter, filename string) error {
+	tmp := filename + ".tmp"
+	fp, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := s.Snapshot(fp); err != nil {
+		fp.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := fp.Sync(); err != nil {
+		fp.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := fp.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// RestoreFile restore s from a file written by SnapshotFile
+func RestoreFile(s Snapshotter, filename string) error {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return s.Restore(fp)
+}
+
+// unixMilli expire time of a dump entry, 0 if t is zero which means never expire
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,179 @@
+package kvclient_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSnapshotter(t *testing.T) {
+	Convey("test snapshotter", t, func() {
+		clock := kvclienttest.NewFakeClock(time.Unix(1500000000, 0))
+
+		Convey("time left is preserved across the downtime", func() {
+			mc := kvclient.NewMapCacheBuilder().WithClock(clock).Build()
+			So(mc.SetEx("key1", []byte("val1"), time.Hour), ShouldBeNil)
+			So(mc.SetEx("key2", []byte("val2"), time.Minute), ShouldBeNil)
+			So(mc.SetEx("key3", []byte("val3"), 0), ShouldBeNil)
+			var buf bytes.Buffer
+			So(mc.Snapshot(&buf), ShouldBeNil)
+
+			clock.Add(30 * time.Minute)
+			restored := kvclient.NewMapCacheBuilder().WithClock(clock).Build()
+			So(restored.Set("key3", []byte("val4")), ShouldBeNil)
+			So(restored.Restore(&buf), ShouldBeNil)
+			vals, _, err := restored.GetBatch([]string{"key1", "key2", "key3"})
+			So(err, ShouldBeNil)
+			So(vals, ShouldResemble, [][]byte{[]byte("val1"), nil, []byte("val4")})
+
+			clock.Add(30 * time.Minute)
+			val, err := restored.Get("key1")
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+		})
+
+		Convey("the hottest keys are kept if the cache is smaller", func() {
+			mc := kvclient.NewMapCacheBuilder().WithClock(clock).Build()
+			for i := 0; i < 10; i++ {
+				So(mc.Set(fmt.Sprintf("key%v", i), []byte("val")), ShouldBeNil)
+			}
+			var buf bytes.Buffer
+			So(mc.Snapshot(&buf), ShouldBeNil)
+
+			restored := kvclient.NewMapCacheBuilder().WithClock(clock).WithMaxBytes(3 * len("key0val")).Build()
+			So(restored.Restore(&buf), ShouldBeNil)
+			So(restored.Len(), ShouldEqual, 3)
+			val, _ := restored.Get("key9")
+			So(val, ShouldResemble, []byte("val"))
+			val, _ = restored.Get("key6")
+			So(val, ShouldBeNil)
+		})
+
+		Convey("tinylfu restores more keys than its window", func() {
+			lfu, err := kvclient.NewTinyLFUBuilder().WithClock(clock).WithMaxBytes(100 * len("key00val")).Build()
+			So(err, ShouldBeNil)
+			for i := 0; i < 50; i++ {
+				So(lfu.SetEx(fmt.Sprintf("key%02v", i), []byte("val"), time.Hour), ShouldBeNil)
+				lfu.Get(fmt.Sprintf("key%02v", i))
+			}
+			var buf bytes.Buffer
+			So(lfu.Snapshot(&buf), ShouldBeNil)
+
+			restored, err := kvclient.NewTinyLFUBuilder().WithClock(clock).WithMaxBytes(100 * len("key00val")).Build()
+			So(err, ShouldBeNil)
+			So(restored.Restore(&buf), ShouldBeNil)
+			So(restored.Len(), ShouldEqual, lfu.Len())
+			val, _ := restored.Get("key49")
+			So(val, ShouldResemble, []byte("val"))
+		})
+
+		Convey("library backed caches", func() {
+			bigcache, err := kvclient.NewBigcacheBuilder().WithExpiration(time.Hour).WithShards(16).WithSize(100).Build()
+			So(err, ShouldBeNil)
+			restoredBigcache, err := kvclient.NewBigcacheBuilder().WithExpiration(time.Hour).WithShards(16).WithSize(100).Build()
+			So(err, ShouldBeNil)
+
+			for _, item := range []struct {
+				cache interface {
+					kvclient.Cache
+					kvclient.Snapshotter
+				}
+				restored interface {
+					kvclient.Cache
+					kvclient.Snapshotter
+				}
+			}{
+				{kvclient.NewGcacheBuilder().WithExpiration(time.Hour).Build(), kvclient.NewGcacheBuilder().WithExpiration(time.Hour).Build()},
+				{kvclient.NewFreecacheBuilder().WithMemBytes(1024 * 1024).Build(), kvclient.NewFreecacheBuilder().WithMemBytes(1024 * 1024).Build()},
+				{bigcache, restoredBigcache},
+			} {
+				So(item.cache.Set("key1", []byte("val1")), ShouldBeNil)
+				So(item.cache.Set("key2", []byte("val2")), ShouldBeNil)
+				var buf bytes.Buffer
+				So(item.cache.Snapshot(&buf), ShouldBeNil)
+				So(item.restored.Restore(&buf), ShouldBeNil)
+				vals, _, err := item.restored.GetBatch([]string{"key1", "key2", "key3"})
+				So(err, ShouldBeNil)
+				So(vals, ShouldResemble, [][]byte{[]byte("val1"), []byte("val2"), nil})
+			}
+		})
+
+		Convey("bigcache snapshots the keys of every shard", func() {
+			bigcache, err := kvclient.NewBigcacheBuilder().WithExpiration(time.Hour).WithShards(16).Build()
+			So(err, ShouldBeNil)
+			for i := 0; i < 1000; i++ {
+				So(bigcache.Set(fmt.Sprintf("key%v", i), []byte(fmt.Sprintf("val%v", i))), ShouldBeNil)
+			}
+			var buf bytes.Buffer
+			So(bigcache.Snapshot(&buf), ShouldBeNil)
+
+			restored, err := kvclient.NewBigcacheBuilder().WithExpiration(time.Hour).WithShards(16).Build()
+			So(err, ShouldBeNil)
+			So(restored.Restore(&buf), ShouldBeNil)
+			for i := 0; i < 1000; i++ {
+				val, err := restored.Get(fmt.Sprintf("key%v", i))
+				So(err, ShouldBeNil)
+				So(string(val), ShouldEqual, fmt.Sprintf("val%v", i))
+			}
+		})
+
+		Convey("truncated dump is an error", func() {
+			mc := kvclient.NewMapCacheBuilder().Build()
+			So(mc.Set("key1", []byte("val1")), ShouldBeNil)
+			var buf bytes.Buffer
+			So(mc.Snapshot(&buf), ShouldBeNil)
+			So(kvclient.NewMapCacheBuilder().Build().Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-1])), ShouldNotBeNil)
+			So(kvclient.NewMapCacheBuilder().Build().Restore(bytes.NewReader([]byte("garbage"))), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestKVClient_DumpAndWarmup(t *testing.T) {
+	Convey("test kvclient dump and warmup", t, func() {
+		dir, err := ioutil.TempDir("", "dump")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		filename := filepath.Join(dir, "kvclient.dump")
+
+		newClient := func() (kvclient.KVClient, *kvclient.MapCache, error) {
+			local := kvclient.NewMapCacheBuilder().Build()
+			remote := kvclient.NewMapCacheBuilder().Build()
+			client, err := kvclient.NewBuilder().
+				WithCaches([]kvclient.Cache{local, remote}).
+				WithCompressor(testCompressor{}).
+				WithSerializer(testSerializer{}).
+				WithWarmupFile(filename).
+				WithDumpFile(filename).
+				Build()
+			return client, local, err
+		}
+
+		// no file on the first start
+		client, _, err := newClient()
+		So(err, ShouldBeNil)
+		So(client.Set("key1", "val1"), ShouldBeNil)
+		So(client.Close(), ShouldBeNil)
+
+		_, local, err := newClient()
+		So(err, ShouldBeNil)
+		val, err := local.Get("key1")
+		So(err, ShouldBeNil)
+		So(val, ShouldResemble, []byte("val1"))
+
+		Convey("a Snapshotter is required", func() {
+			leveldb, err := kvclient.NewLevelDBBuilder().WithDirectory(filepath.Join(dir, "leveldb")).Build()
+			So(err, ShouldBeNil)
+			defer leveldb.Close()
+			_, err = kvclient.NewBuilder().WithCaches([]kvclient.Cache{leveldb}).WithDumpFile(filename).Build()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,476 @@
+package kvclient
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewSQLCacheBuilder create a new SQLCacheBuilder
+func NewSQLCacheBuilder() *SQLCacheBuilder {
+	return &SQLCacheBuilder{
+		Driver:        "mysql",
+		Table:         "kvclient",
+		KeyColumn:     "k",
+		ValueColumn:   "v",
+		ExpireColumn:  "expire_at",
+		BatchSize:     500,
+		PurgeInterval: time.Duration(10) * time.Minute,
+		clock:         SystemClock{},
+	}
+}
+
+// SQLCacheBuilder builder
+type SQLCacheBuilder struct {
+	Driver        string // driver name of database/sql, the driver should be imported by the caller
+	DSN           string
+	Dialect       string // mysql, postgres or sqlite3, default by the driver
+	Table         string
+	KeyColumn     string
+	ValueColumn   string
+	ExpireColumn  string // expire time in unix milliseconds, 0 means never expire
+	CreateTable   bool   // create the table if not exists
+	MaxOpenConns  int    // 0 means no limit
+	MaxIdleConns  int
+	Expiration    time.Duration
+	BatchSize     int           // max keys of an IN (...) query of GetBatch
+	PurgeInterval time.Duration // interval of the background purge of expired rows, 0 disable it
+
+	db    *sql.DB
+	clock Clock
+}
+
+// WithDriver option
+func (b *SQLCacheBuilder) WithDriver(driver string) *SQLCacheBuilder {
+	b.Driver = driver
+	return b
+}
+
+// WithDSN option
+func (b *SQLCacheBuilder) WithDSN(dsn string) *SQLCacheBuilder {
+	b.DSN = dsn
+	return b
+}
+
+// WithDialect option
+func (b *SQLCacheBuilder) WithDialect(dialect string) *SQLCacheBuilder {
+	b.Dialect = dialect
+	return b
+}
+
+// WithTable option
+func (b *SQLCacheBuilder) WithTable(table string) *SQLCacheBuilder {
+	b.Table = table
+	return b
+}
+
+// WithColumns option, names of the key, value and expire columns
+func (b *SQLCacheBuilder) WithColumns(keyColumn, valueColumn, expireColumn string) *SQLCacheBuilder {
+	b.KeyColumn = keyColumn
+	b.ValueColumn = valueColumn
+	b.ExpireColumn = expireColumn
+	return b
+}
+
+// WithCreateTable option
+func (b *SQLCacheBuilder) WithCreateTable(createTable bool) *SQLCacheBuilder {
+	b.CreateTable = createTable
+	return b
+}
+
+// WithMaxOpenConns option
+func (b *SQLCacheBuilder) WithMaxOpenConns(maxOpenConns int) *SQLCacheBuilder {
+	b.MaxOpenConns = maxOpenConns
+	return b
+}
+
+// WithMaxIdleConns option
+func (b *SQLCacheBuilder) WithMaxIdleConns(maxIdleConns int) *SQLCacheBuilder {
+	b.MaxIdleConns = maxIdleConns
+	return b
+}
+
+// WithExpiration option, default expiration of Set, 0 means never expire
+func (b *SQLCacheBuilder) WithExpiration(expiration time.Duration) *SQLCacheBuilder {
+	b.Expiration = expiration
+	return b
+}
+
+// WithBatchSize option
+func (b *SQLCacheBuilder) WithBatchSize(batchSize int) *SQLCacheBuilder {
+	b.BatchSize = batchSize
+	return b
+}
+
+// WithPurgeInterval option
+func (b *SQLCacheBuilder) WithPurgeInterval(purgeInterval time.Duration) *SQLCacheBuilder {
+	b.PurgeInterval = purgeInterval
+	return b
+}
+
+// WithDB option, use an opened db instead of driver and dsn, the db is not closed by the cache
+func (b *SQLCacheBuilder) WithDB(db *sql.DB) *SQLCacheBuilder {
+	b.db = db
+	return b
+}
+
+// WithClock option, the clock to decide expiration
+func (b *SQLCacheBuilder) WithClock(clock Clock) *SQLCacheBuilder {
+	b.clock = clock
+	return b
+}
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Build a new SQLCache
+func (b *SQLCacheBuilder) Build() (*SQLCache, error) {
+	for _, name := range []string{b.Table, b.KeyColumn, b.ValueColumn, b.ExpireColumn} {
+		if !sqlIdentifier.MatchString(name) {
+			return nil, fmt.Errorf("invalid table or column name [%v]", name)
+		}
+	}
+	if b.BatchSize <= 0 {
+		return nil, fmt.Errorf("batch size [%v] should be positive", b.BatchSize)
+	}
+	dialect := b.Dialect
+	if dialect == "" {
+		dialect = b.Driver
+	}
+	d, ok := sqlDialects[dialect]
+	if !ok {
+		return nil, fmt.Errorf("no sql dialect named [%v]", dialect)
+	}
+
+	db, owned := b.db, false
+	if db == nil {
+		var err error
+		if db, err = sql.Open(b.Driver, b.DSN); err != nil {
+			return nil, err
+		}
+		owned = true
+		db.SetMaxOpenConns(b.MaxOpenConns)
+		db.SetMaxIdleConns(b.MaxIdleConns)
+	}
+
+	c := &SQLCache{
+		db:         db,
+		owned:      owned,
+		queries:    d.queries(b.Table, b.KeyColumn, b.ValueColumn, b.ExpireColumn),
+		dialect:    d,
+		expiration: b.Expiration,
+		batchSize:  b.BatchSize,
+		clock:      b.clock,
+		done:       make(chan struct{}),
+	}
+
+	if b.CreateTable {
+		if _, err := db.Exec(c.queries.create); err != nil {
+			c.closeDB()
+			return nil, err
+		}
+	}
+
+	if b.PurgeInterval > 0 {
+		c.wg.Add(1)
+		go c.purgeLoop(b.PurgeInterval)
+	}
+
+	return c, nil
+}
+
+// sqlDialect differences of the sql databases
+type sqlDialect struct {
+	name      string
+	keyType   string
+	valueType string
+	upsert    string // format with table, key, value, expire columns
+	insertNx  string // format with table, key, value, expire columns
+}
+
+var sqlDialects = map[string]*sqlDialect{
+	"mysql": {
+		name:      "mysql",
+		keyType:   "VARBINARY(255)",
+		valueType: "LONGBLOB",
+		upsert:    "INSERT INTO %[1]v (%[2]v, %[3]v, %[4]v) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE %[3]v = VALUES(%[3]v), %[4]v = VALUES(%[4]v)",
+		insertNx:  "INSERT IGNORE INTO %[1]v (%[2]v, %[3]v, %[4]v) VALUES (?, ?, ?)",
+	},
+	"postgres": {
+		name:      "postgres",
+		keyType:   "VARCHAR(255)",
+		valueType: "BYTEA",
+		upsert:    "INSERT INTO %[1]v (%[2]v, %[3]v, %[4]v) VALUES (?, ?, ?) ON CONFLICT (%[2]v) DO UPDATE SET %[3]v = EXCLUDED.%[3]v, %[4]v = EXCLUDED.%[4]v",
+		insertNx:  "INSERT INTO %[1]v (%[2]v, %[3]v, %[4]v) VALUES (?, ?, ?) ON CONFLICT (%[2]v) DO NOTHING",
+	},
+	"sqlite3": {
+		name:      "sqlite3",
+		keyType:   "VARCHAR(255)",
+		valueType: "BLOB",
+		upsert:    "INSERT INTO %[1]v (%[2]v, %[3]v, %[4]v) VALUES (?, ?, ?) ON CONFLICT (%[2]v) DO UPDATE SET %[3]v = excluded.%[3]v, %[4]v = excluded.%[4]v",
+		insertNx:  "INSERT INTO %[1]v (%[2]v, %[3]v, %[4]v) VALUES (?, ?, ?) ON CONFLICT (%[2]v) DO NOTHING",
+	},
+}
+
+func init() {
+	sqlDialects["pgx"] = sqlDialects["postgres"]
+	sqlDialects["sqlite"] = sqlDialects["sqlite3"]
+}
+
+// sqlQueries statements of a table
+type sqlQueries struct {
+	create     string
+	get        string
+	getBatch   string // format with the placeholders of keys
+	upsert     string
+	insertNx   string
+	del        string
+	delExpired string
+	purge      string
+}
+
+func (d *sqlDialect) queries(table, key, value, expire string) *sqlQueries {
+	q := &sqlQueries{
+		create: fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v (%v %v PRIMARY KEY, %v %v, %v BIGINT NOT NULL DEFAULT 0)",
+			table, key, d.keyType, value, d.valueType, expire),
+		get:        fmt.Sprintf("SELECT %[3]v FROM %[1]v WHERE %[2]v = ? AND (%[4]v = 0 OR %[4]v > ?)", table, key, value, expire),
+		upsert:     fmt.Sprintf(d.upsert, table, key, value, expire),
+		insertNx:   fmt.Sprintf(d.insertNx, table, key, value, expire),
+		del:        fmt.Sprintf("DELETE FROM %v WHERE %v = ?", table, key),
+		delExpired: fmt.Sprintf("DELETE FROM %[1]v WHERE %[2]v = ? AND %[3]v <> 0 AND %[3]v <= ?", table, key, expire),
+		purge:      fmt.Sprintf("DELETE FROM %[1]v WHERE %[2]v <> 0 AND %[2]v <= ?", table, expire),
+	}
+	// %% keeps the verb of the key placeholders
+	q.getBatch = fmt.Sprintf("SELECT %[2]v, %[3]v FROM %[1]v WHERE %[2]v IN (%%v) AND (%[4]v = 0 OR %[4]v > ?)", table, key, value, expire)
+	for _, s := range []*string{&q.create, &q.get, &q.upsert, &q.insertNx, &q.del, &q.delExpired, &q.purge} {
+		*s = d.rebind(*s)
+	}
+	return q
+}
+
+// rebind replace the ? placeholders with $1, $2 ... for postgres
+func (d *sqlDialect) rebind(query string) string {
+	if d.name != "postgres" {
+		return query
+	}
+	var buf strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			buf.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// SQLCache datasource, one row for each key in a table of a sql database. expired rows
+// are taken as not found and deleted by the background purge
+type SQLCache struct {
+	BaseCache
+
+	db         *sql.DB
+	owned      bool // the db is opened by the builder
+	queries    *sqlQueries
+	dialect    *sqlDialect
+	expiration time.Duration
+	batchSize  int
+	clock      Clock
+	done       chan struct{}
+	wg         sync.WaitGroup
+	closer     Closer
+}
+
+// Capabilities supported operations
+func (c *SQLCache) Capabilities() Capability {
+	return CapAll
+}
+
+// Close the purge and the db opened by the builder
+func (c *SQLCache) Close() error {
+	return c.closer.Close(func() error {
+		close(c.done)
+		c.wg.Wait()
+		return c.closeDB()
+	})
+}
+
+func (c *SQLCache) closeDB() error {
+	if !c.owned {
+		return nil
+	}
+	return c.db.Close()
+}
+
+func (c *SQLCache) now() int64 {
+	return c.clock.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// Get key
+func (c *SQLCache) Get(key string) ([]byte, error) {
+	var val []byte
+	err := c.db.QueryRow(c.queries.get, key, c.now()).Scan(&val)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if val == nil {
+		val = []byte{}
+	}
+	return val, nil
+}
+
+// Set key value
+func (c *SQLCache) Set(key string, val []byte) error {
+	return c.SetEx(key, val, c.expiration)
+}
+
+// SetEx set with expiration
+func (c *SQLCache) SetEx(key string, val []byte, expiration time.Duration) error {
+	_, err := c.db.Exec(c.queries.upsert, key, val, expireAt(c.clock.Now(), expiration))
+	return err
+}
+
+// Del key
+func (c *SQLCache) Del(key string) error {
+	_, err := c.db.Exec(c.queries.del, key)
+	return err
+}
+
+// SetBatch keys vals in one transaction
+func (c *SQLCache) SetBatch(keys []string, vals [][]byte) ([]error, error) {
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keys), len(vals))
+	}
+
+	errs := make([]error, len(keys))
+	tx, err := c.db.Begin()
+	if err != nil {
+		return errs, err
+	}
+	stmt, err := tx.Prepare(c.queries.upsert)
+	if err != nil {
+		tx.Rollback()
+		return errs, err
+	}
+	defer stmt.Close()
+	at := expireAt(c.clock.Now(), c.expiration)
+	for i := range keys {
+		if _, err := stmt.Exec(keys[i], vals[i], at); err != nil {
+			tx.Rollback()
+			return errs, err
+		}
+	}
+
+	return errs, tx.Commit()
+}
+
+// SetNx set if not exist
+func (c *SQLCache) SetNx(key string, val []byte) (bool, error) {
+	return c.SetExNx(key, val, c.expiration)
+}
+
+// SetExNx set with expiration if not exist, an expired row of the key is deleted first,
+// then the insert which ignores conflicts decides the winner
+func (c *SQLCache) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	now := c.clock.Now()
+	if _, err := c.db.Exec(c.queries.delExpired, key, now.UnixNano()/int64(time.Millisecond)); err != nil {
+		return false, err
+	}
+	res, err := c.db.Exec(c.queries.insertNx, key, val, expireAt(now, expiration))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// GetBatch keys with IN (...) queries of at most batchSize keys
+func (c *SQLCache) GetBatch(keys []string) ([][]byte, []error, error) {
+	vals := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	now := c.now()
+	for start := 0; start < len(keys); start += c.batchSize {
+		end := start + c.batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := c.getBatch(keys[start:end], vals[start:end], now); err != nil {
+			for i := start; i < end; i++ {
+				errs[i] = err
+			}
+			return vals, errs, err
+		}
+	}
+
+	return vals, errs, nil
+}
+
+// getBatch keys into vals in one query
+func (c *SQLCache) getBatch(keys []string, vals [][]byte, now int64) error {
+	index := map[string][]int{}
+	args := make([]interface{}, 0, len(keys)+1)
+	for i, key := range keys {
+		if _, ok := index[key]; !ok {
+			args = append(args, key)
+		}
+		index[key] = append(index[key], i)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	args = append(args, now)
+
+	rows, err := c.db.Query(c.dialect.rebind(fmt.Sprintf(c.queries.getBatch, placeholders)), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var val []byte
+		if err := rows.Scan(&key, &val); err != nil {
+			return err
+		}
+		if val == nil {
+			val = []byte{}
+		}
+		for _, i := range index[key] {
+			vals[i] = val
+		}
+	}
+
+	return rows.Err()
+}
+
+// purgeLoop run Purge every interval until Close
+func (c *SQLCache) purgeLoop(interval time.Duration) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.Purge()
+		}
+	}
+}
+
+// Purge delete expired rows, return the number of deleted rows
+func (c *SQLCache) Purge() (int64, error) {
+	res, err := c.db.Exec(c.queries.purge, c.now())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
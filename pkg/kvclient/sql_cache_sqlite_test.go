@@ -0,0 +1,90 @@
+//go:build cgo
+// +build cgo
+
+package kvclient_test
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+	// github.com/mattn/go-sqlite3 need cgo
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSQLCache(t *testing.T) {
+	directory, err := ioutil.TempDir("", "sqlcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	n := 0
+	dsn := func() string {
+		n++
+		return fmt.Sprintf("file:%v?_busy_timeout=5000&_journal_mode=WAL", filepath.Join(directory, fmt.Sprintf("%v.db", n)))
+	}
+
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewSQLCacheBuilder().WithDriver("sqlite3").WithDSN(dsn()).WithCreateTable(true).Build()
+	})
+
+	Convey("test sql cache", t, func() {
+		db, err := sql.Open("sqlite3", dsn())
+		So(err, ShouldBeNil)
+		defer db.Close()
+		_, err = db.Exec("CREATE TABLE reference (name VARCHAR(64) PRIMARY KEY, data BLOB, deadline BIGINT NOT NULL DEFAULT 0)")
+		So(err, ShouldBeNil)
+
+		clock := kvclienttest.NewFakeClock(time.Unix(1500000000, 0))
+		cache, err := kvclient.NewSQLCacheBuilder().
+			WithDB(db).
+			WithDialect("sqlite3").
+			WithTable("reference").
+			WithColumns("name", "data", "deadline").
+			WithBatchSize(2).
+			WithClock(clock).
+			Build()
+		So(err, ShouldBeNil)
+		defer cache.Close()
+
+		Convey("get batch in chunks with duplicate keys", func() {
+			_, err := cache.SetBatch([]string{"key1", "key2", "key3"}, [][]byte{[]byte("val1"), []byte("val2"), {}})
+			So(err, ShouldBeNil)
+			vals, errs, err := cache.GetBatch([]string{"key3", "key1", "key4", "key1", "key2"})
+			So(err, ShouldBeNil)
+			So(errs, ShouldResemble, []error{nil, nil, nil, nil, nil})
+			So(vals, ShouldResemble, [][]byte{{}, []byte("val1"), nil, []byte("val1"), []byte("val2")})
+		})
+
+		Convey("expired rows are purged", func() {
+			So(cache.SetEx("key1", []byte("val1"), time.Minute), ShouldBeNil)
+			So(cache.SetEx("key2", []byte("val2"), time.Hour), ShouldBeNil)
+			So(cache.Set("key3", []byte("val3")), ShouldBeNil)
+			clock.Add(time.Minute)
+			val, err := cache.Get("key1")
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+
+			n, err := cache.Purge()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			var count int
+			So(db.QueryRow("SELECT COUNT(*) FROM reference").Scan(&count), ShouldBeNil)
+			So(count, ShouldEqual, 2)
+		})
+
+		Convey("invalid names", func() {
+			_, err := kvclient.NewSQLCacheBuilder().WithDB(db).WithTable("reference; DROP TABLE reference").Build()
+			So(err, ShouldNotBeNil)
+			_, err = kvclient.NewSQLCacheBuilder().WithDB(db).WithDialect("oracle").Build()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,521 @@
+package kvclient
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+)
+
+// NewTinyLFUBuilder create a new TinyLFU builder
+func NewTinyLFUBuilder() *TinyLFUBuilder {
+	return &TinyLFUBuilder{
+		MaxBytes:         64 * 1024 * 1024,
+		WindowPercent:    1,
+		ProtectedPercent: 80,
+		Counters:         1 << 20,
+		clock:            SystemClock{},
+	}
+}
+
+// TinyLFUBuilder builder
+type TinyLFUBuilder struct {
+	MaxBytes         int           // memory limit of keys and values
+	Expiration       time.Duration // expire time of Set, 0 means never expire
+	WindowPercent    int           // percent of MaxBytes for the window lru, new keys enter the window
+	ProtectedPercent int           // percent of the main cache for the protected segment
+	Counters         int           // counters of the frequency sketch, about the number of keys expected
+
+	clock Clock
+}
+
+// WithMaxBytes option
+func (b *TinyLFUBuilder) WithMaxBytes(maxBytes int) *TinyLFUBuilder {
+	b.MaxBytes = maxBytes
+	return b
+}
+
+// WithExpiration option
+func (b *TinyLFUBuilder) WithExpiration(expiration time.Duration) *TinyLFUBuilder {
+	b.Expiration = expiration
+	return b
+}
+
+// WithWindowPercent option
+func (b *TinyLFUBuilder) WithWindowPercent(windowPercent int) *TinyLFUBuilder {
+	b.WindowPercent = windowPercent
+	return b
+}
+
+// WithProtectedPercent option
+func (b *TinyLFUBuilder) WithProtectedPercent(protectedPercent int) *TinyLFUBuilder {
+	b.ProtectedPercent = protectedPercent
+	return b
+}
+
+// WithCounters option
+func (b *TinyLFUBuilder) WithCounters(counters int) *TinyLFUBuilder {
+	b.Counters = counters
+	return b
+}
+
+// WithClock option, the clock to decide expiration
+func (b *TinyLFUBuilder) WithClock(clock Clock) *TinyLFUBuilder {
+	b.clock = clock
+	return b
+}
+
+// Build a new TinyLFU
+func (b *TinyLFUBuilder) Build() (*TinyLFU, error) {
+	if b.MaxBytes <= 0 || b.Counters <= 0 {
+		return nil, fmt.Errorf("max bytes [%v] and counters [%v] should be positive", b.MaxBytes, b.Counters)
+	}
+	if b.WindowPercent <= 0 || b.WindowPercent >= 100 || b.ProtectedPercent < 0 || b.ProtectedPercent >= 100 {
+		return nil, fmt.Errorf("window percent [%v] should be in (0, 100), protected percent [%v] in [0, 100)", b.WindowPercent, b.ProtectedPercent)
+	}
+
+	windowBytes := b.MaxBytes * b.WindowPercent / 100
+	if windowBytes == 0 {
+		windowBytes = 1
+	}
+	mainBytes := b.MaxBytes - windowBytes
+	return &TinyLFU{
+		items:          map[string]*list.Element{},
+		window:         list.New(),
+		probation:      list.New(),
+		protected:      list.New(),
+		maxBytes:       b.MaxBytes,
+		windowBytes:    windowBytes,
+		mainBytes:      mainBytes,
+		protectedBytes: mainBytes * b.ProtectedPercent / 100,
+		sketch:         newFrequencySketch(b.Counters),
+		expiration:     b.Expiration,
+		clock:          b.clock,
+	}, nil
+}
+
+// TinyLFU local cache with W-TinyLFU admission. new keys enter a small window lru,
+// keys evicted from the window are admitted into the main segmented lru only if they
+// are read more frequently than the keys they would evict, so one-off keys of scans
+// do not evict hot keys. memory is bounded by the sizes of keys and values
+type TinyLFU struct {
+	BaseCache
+
+	mutex     sync.Mutex
+	items     map[string]*list.Element
+	window    *list.List // front is the most recently used
+	probation *list.List
+	protected *list.List
+
+	maxBytes       int
+	windowBytes    int
+	mainBytes      int
+	protectedBytes int
+	used           [3]int // bytes of window, probation and protected
+
+	sketch     *frequencySketch
+	expiration time.Duration
+	clock      Clock
+	stats      TinyLFUStats
+}
+
+// TinyLFUStats stats of a TinyLFU
+type TinyLFUStats struct {
+	Hits       int64
+	Misses     int64
+	Admissions int64 // keys admitted from the window into the main cache
+	Rejections int64 // keys dropped from the window as less frequent than the victims
+	Evictions  int64 // keys evicted from the main cache
+}
+
+const (
+	segmentWindow = iota
+	segmentProbation
+	segmentProtected
+)
+
+type tinyLFUItem struct {
+	key      string
+	val      []byte
+	expireAt time.Time
+	segment  int
+}
+
+func (i *tinyLFUItem) size() int {
+	return len(i.key) + len(i.val)
+}
+
+// Capabilities supported operations
+func (c *TinyLFU) Capabilities() Capability {
+	return CapAll
+}
+
+// Stats of the cache
+func (c *TinyLFU) Stats() TinyLFUStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.stats
+}
+
+// Len number of keys, including expired keys not removed yet
+func (c *TinyLFU) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.items)
+}
+
+// Bytes memory used by keys and values
+func (c *TinyLFU) Bytes() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.used[segmentWindow] + c.used[segmentProbation] + c.used[segmentProtected]
+}
+
+// Close drop all keys
+func (c *TinyLFU) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.items = map[string]*list.Element{}
+	c.window.Init()
+	c.probation.Init()
+	c.protected.Init()
+	c.used = [3]int{}
+	return nil
+}
+
+// Get get a key
+func (c *TinyLFU) Get(key string) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.get(key), nil
+}
+
+// Set set a key
+func (c *TinyLFU) Set(key string, val []byte) error {
+	return c.SetEx(key, val, c.expiration)
+}
+
+// Del delete a key
+func (c *TinyLFU) Del(key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+	return nil
+}
+
+// SetEx set with expiration, 0 means never expire
+func (c *TinyLFU) SetEx(key string, val []byte, expiration time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.set(key, val, expiration)
+}
+
+// SetNx set if not exists
+func (c *TinyLFU) SetNx(key string, val []byte) (bool, error) {
+	return c.SetExNx(key, val, c.expiration)
+}
+
+// SetExNx set if not exists with expiration
+func (c *TinyLFU) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.get(key) != nil {
+		return false, nil
+	}
+	if err := c.set(key, val, expiration); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetBatch get keys
+func (c *TinyLFU) GetBatch(keys []string) ([][]byte, []error, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	vals := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		vals[i] = c.get(key)
+	}
+	return vals, errs, nil
+}
+
+// SetBatch set keys
+func (c *TinyLFU) SetBatch(keys []string, vals [][]byte) ([]error, error) {
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("assert len(keys)[%v] == len(vals)[%v] failed", len(keys), len(vals))
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	errs := make([]error, len(keys))
+	for i := range keys {
+		errs[i] = c.set(keys[i], vals[i], c.expiration)
+	}
+	return errs, nil
+}
+
+// get a copy of the value, nil if not exists or expired
+func (c *TinyLFU) get(key string) []byte {
+	c.sketch.increment(key)
+	elem, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return nil
+	}
+	item := elem.Value.(*tinyLFUItem)
+	if !item.expireAt.IsZero() && !c.clock.Now().Before(item.expireAt) {
+		c.remove(elem)
+		c.stats.Misses++
+		return nil
+	}
+
+	c.stats.Hits++
+	switch item.segment {
+	case segmentWindow:
+		c.window.MoveToFront(elem)
+	case segmentProbation:
+		// promote into protected, demote the least recently used protected keys
+		c.remove(elem)
+		item.segment = segmentProtected
+		c.push(item)
+		for c.used[segmentProtected] > c.protectedBytes && c.protected.Len() > 1 {
+			demoted := c.protected.Back().Value.(*tinyLFUItem)
+			c.remove(c.protected.Back())
+			demoted.segment = segmentProbation
+			c.push(demoted)
+		}
+	case segmentProtected:
+		c.protected.MoveToFront(elem)
+	}
+	return append([]byte{}, item.val...)
+}
+
+func (c *TinyLFU) set(key string, val []byte, expiration time.Duration) error {
+	item := &tinyLFUItem{key: key, val: append([]byte{}, val...), segment: segmentWindow}
+	if expiration > 0 {
+		item.expireAt = c.clock.Now().Add(expiration)
+	}
+	if item.size() > c.mainBytes {
+		return fmt.Errorf("size of key [%v] is [%v], larger than the main cache [%v]", key, item.size(), c.mainBytes)
+	}
+
+	c.sketch.increment(key)
+	if elem, ok := c.items[key]; ok {
+		// updated keys stay in their segment
+		item.segment = elem.Value.(*tinyLFUItem).segment
+		c.remove(elem)
+	}
+	c.push(item)
+
+	for c.used[segmentWindow] > c.windowBytes {
+		c.admit(c.window.Back())
+	}
+	for c.used[segmentProbation]+c.used[segmentProtected] > c.mainBytes {
+		c.evict(c.victim())
+	}
+	return nil
+}
+
+// admit the candidate evicted from the window into the main cache, if it is more
+// frequent than all the victims to evict for its room, otherwise drop it
+func (c *TinyLFU) admit(elem *list.Element) {
+	candidate := elem.Value.(*tinyLFUItem)
+	c.remove(elem)
+
+	need := c.used[segmentProbation] + c.used[segmentProtected] + candidate.size() - c.mainBytes
+	if need > 0 {
+		freq := c.sketch.estimate(candidate.key)
+		var victims []*list.Element
+		for _, l := range []*list.List{c.probation, c.protected} {
+			for e := l.Back(); e != nil && need > 0; e = e.Prev() {
+				victim := e.Value.(*tinyLFUItem)
+				if c.sketch.estimate(victim.key) >= freq {
+					c.stats.Rejections++
+					return
+				}
+				victims = append(victims, e)
+				need -= victim.size()
+			}
+		}
+		for _, e := range victims {
+			c.evict(e)
+		}
+	}
+
+	candidate.segment = segmentProbation
+	c.push(candidate)
+	c.stats.Admissions++
+}
+
+// victim the least recently used key of the main cache
+func (c *TinyLFU) victim() *list.Element {
+	if c.probation.Len() > 0 {
+		return c.probation.Back()
+	}
+	return c.protected.Back()
+}
+
+func (c *TinyLFU) evict(elem *list.Element) {
+	c.remove(elem)
+	c.stats.Evictions++
+}
+
+func (c *TinyLFU) segmentList(segment int) *list.List {
+	switch segment {
+	case segmentProbation:
+		return c.probation
+	case segmentProtected:
+		return c.protected
+	}
+	return c.window
+}
+
+func (c *TinyLFU) push(item *tinyLFUItem) {
+	c.items[item.key] = c.segmentList(item.segment).PushFront(item)
+	c.used[item.segment] += item.size()
+}
+
+func (c *TinyLFU) remove(elem *list.Element) {
+	item := elem.Value.(*tinyLFUItem)
+	c.segmentList(item.segment).Remove(elem)
+	delete(c.items, item.key)
+	c.used[item.segment] -= item.size()
+}
+
+// frequencySketch count-min sketch of 4 bit counters with a doorkeeper, all counts are
+// halved after 10 times of the counters increments, so old frequencies fade away
+type frequencySketch struct {
+	counters   []uint8 // depth rows, each counter is capped at 15
+	width      uint32
+	doorkeeper []uint64 // bloom filter of keys seen once since the last reset
+	additions  int
+	sampleSize int
+}
+
+const sketchDepth = 4
+
+func newFrequencySketch(counters int) *frequencySketch {
+	width := uint32(counters)
+	return &frequencySketch{
+		counters:   make([]uint8, int(width)*sketchDepth),
+		width:      width,
+		doorkeeper: make([]uint64, (counters+63)/64),
+		sampleSize: 10 * counters,
+	}
+}
+
+func (s *frequencySketch) hash(key string) (uint32, uint32) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return uint32(sum), uint32(sum>>32) | 1
+}
+
+// increment a key, the first time only sets the doorkeeper
+func (s *frequencySketch) increment(key string) {
+	h1, h2 := s.hash(key)
+	bits := uint32(len(s.doorkeeper) * 64)
+	seen := true
+	for i := uint32(0); i < 2; i++ {
+		bit := (h1 + i*h2) % bits
+		if s.doorkeeper[bit/64]&(1<<(bit%64)) == 0 {
+			seen = false
+			s.doorkeeper[bit/64] |= 1 << (bit % 64)
+		}
+	}
+	if seen {
+		for i := uint32(0); i < sketchDepth; i++ {
+			idx := i*s.width + (h1+i*h2)%s.width
+			if s.counters[idx] < 15 {
+				s.counters[idx]++
+			}
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// estimate the frequency of a key
+func (s *frequencySketch) estimate(key string) int {
+	h1, h2 := s.hash(key)
+	freq := 15
+	for i := uint32(0); i < sketchDepth; i++ {
+		if c := int(s.counters[i*s.width+(h1+i*h2)%s.width]); c < freq {
+			freq = c
+		}
+	}
+	bits := uint32(len(s.doorkeeper) * 64)
+	for i := uint32(0); i < 2; i++ {
+		bit := (h1 + i*h2) % bits
+		if s.doorkeeper[bit/64]&(1<<(bit%64)) == 0 {
+			return freq
+		}
+	}
+	return freq + 1
+}
+
+func (s *frequencySketch) reset() {
+	for i := range s.counters {
+		s.counters[i] /= 2
+	}
+	for i := range s.doorkeeper {
+		s.doorkeeper[i] = 0
+	}
+	s.additions /= 2
+}
+
+// Snapshot write the keys from the hottest, the protected segment first, then the
+// probation and the window segments, implement Snapshotter
+func (c *TinyLFU) Snapshot(w io.Writer) error {
+	writer, err := newDumpWriter(w)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := c.clock.Now()
+	for _, l := range []*list.List{c.protected, c.probation, c.window} {
+		for elem := l.Front(); elem != nil; elem = elem.Next() {
+			item := elem.Value.(*tinyLFUItem)
+			if !item.expireAt.IsZero() && !now.Before(item.expireAt) {
+				continue
+			}
+			if err := writer.write(item.key, item.val, unixMilli(item.expireAt)); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.close()
+}
+
+// Restore keys written by Snapshot into the probation segment behind the keys in the
+// cache, bypassing the admission which would reject them all as the sketch is empty.
+// keys that do not fit in the main cache are dropped, implement Snapshotter
+func (c *TinyLFU) Restore(r io.Reader) error {
+	return readDump(r, c.clock.Now(), func(key string, val []byte, expiration time.Duration) error {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if _, ok := c.items[key]; ok {
+			return nil
+		}
+		item := &tinyLFUItem{key: key, val: val, segment: segmentProbation}
+		if expiration > 0 {
+			item.expireAt = c.clock.Now().Add(expiration)
+		}
+		if c.used[segmentProbation]+c.used[segmentProtected]+item.size() > c.mainBytes {
+			return nil
+		}
+		c.sketch.increment(key)
+		c.items[key] = c.probation.PushBack(item)
+		c.used[segmentProbation] += item.size()
+		return nil
+	})
+}
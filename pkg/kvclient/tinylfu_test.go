@@ -0,0 +1,78 @@
+package kvclient_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTinyLFU(t *testing.T) {
+	kvclienttest.RunCacheConformance(t, func() (kvclient.Cache, error) {
+		return kvclient.NewTinyLFUBuilder().WithMaxBytes(1024 * 1024).WithCounters(1024).Build()
+	})
+
+	Convey("test tinylfu", t, func() {
+		Convey("hot keys survive a scan", func() {
+			// 100 hot keys of 20 bytes take 2000 of 4000 bytes
+			cache, err := kvclient.NewTinyLFUBuilder().WithMaxBytes(4000).WithWindowPercent(5).WithCounters(4096).Build()
+			So(err, ShouldBeNil)
+			lru := kvclient.NewMapCacheBuilder().WithMaxBytes(4000).Build()
+			hot := func(i int) string { return fmt.Sprintf("hot-%06d", i) }
+			for _, c := range []kvclient.Cache{cache, lru} {
+				for i := 0; i < 100; i++ {
+					So(c.Set(hot(i), []byte("0123456789")), ShouldBeNil)
+				}
+				for n := 0; n < 5; n++ {
+					for i := 0; i < 100; i++ {
+						c.Get(hot(i))
+					}
+				}
+				for i := 0; i < 1000; i++ {
+					So(c.Set(fmt.Sprintf("scan-%05d", i), []byte("0123456789")), ShouldBeNil)
+				}
+			}
+
+			hits := func(c kvclient.Cache) int {
+				n := 0
+				for i := 0; i < 100; i++ {
+					if val, _ := c.Get(hot(i)); val != nil {
+						n++
+					}
+				}
+				return n
+			}
+			So(hits(cache), ShouldEqual, 100)
+			So(hits(lru), ShouldEqual, 0)
+			So(cache.Bytes(), ShouldBeLessThanOrEqualTo, 4000)
+
+			stats := cache.Stats()
+			So(stats.Rejections, ShouldBeGreaterThan, 0)
+			So(stats.Hits, ShouldEqual, 600)
+		})
+
+		Convey("keys expire with the clock", func() {
+			clock := kvclienttest.NewFakeClock(time.Unix(1500000000, 0))
+			cache, err := kvclient.NewTinyLFUBuilder().WithClock(clock).WithExpiration(time.Minute).Build()
+			So(err, ShouldBeNil)
+			So(cache.Set("key1", []byte("val1")), ShouldBeNil)
+			So(cache.SetEx("key2", []byte("val2"), time.Hour), ShouldBeNil)
+			clock.Add(time.Minute)
+			vals, _, err := cache.GetBatch([]string{"key1", "key2"})
+			So(err, ShouldBeNil)
+			So(vals, ShouldResemble, [][]byte{nil, []byte("val2")})
+			So(cache.Stats().Misses, ShouldEqual, 1)
+		})
+
+		Convey("invalid options", func() {
+			_, err := kvclient.NewTinyLFUBuilder().WithWindowPercent(100).Build()
+			So(err, ShouldNotBeNil)
+			cache, err := kvclient.NewTinyLFUBuilder().WithMaxBytes(100).Build()
+			So(err, ShouldBeNil)
+			So(cache.Set("key", make([]byte, 100)), ShouldNotBeNil)
+		})
+	})
+}
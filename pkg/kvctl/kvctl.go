@@ -0,0 +1,612 @@
+package kvctl
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/spf13/pflag"
+)
+
+// output formats of values
+const (
+	FormatRaw  = "raw"
+	FormatHex  = "hex"
+	FormatJSON = "json"
+)
+
+// NewCtlBuilder create a new CtlBuilder
+func NewCtlBuilder() *CtlBuilder {
+	return &CtlBuilder{
+		Format: FormatRaw,
+		out:    os.Stdout,
+	}
+}
+
+// CtlBuilder builder
+type CtlBuilder struct {
+	Format     string // raw, hex or json
+	kvclient   kvclient.KVClient
+	names      []string
+	serializer kvclient.Serializer
+	newVal     func() interface{}
+	out        io.Writer
+}
+
+// WithFormat option
+func (b *CtlBuilder) WithFormat(format string) *CtlBuilder {
+	b.Format = format
+	return b
+}
+
+// WithKVClient option, keys and values of the client are set to raw bytes
+func (b *CtlBuilder) WithKVClient(client kvclient.KVClient) *CtlBuilder {
+	b.kvclient = client
+	return b
+}
+
+// WithNames option, names of the tiers, the indexes by default
+func (b *CtlBuilder) WithNames(names []string) *CtlBuilder {
+	b.names = names
+	return b
+}
+
+// WithSerializer option, values are decoded into newVal by the serializer in json
+// format, and the json values of set are encoded by it
+func (b *CtlBuilder) WithSerializer(serializer kvclient.Serializer, newVal func() interface{}) *CtlBuilder {
+	b.serializer = serializer
+	b.newVal = newVal
+	return b
+}
+
+// WithOutput option, os.Stdout by default
+func (b *CtlBuilder) WithOutput(out io.Writer) *CtlBuilder {
+	b.out = out
+	return b
+}
+
+// Build a Ctl
+func (b *CtlBuilder) Build() (*Ctl, error) {
+	if b.kvclient == nil {
+		return nil, fmt.Errorf("no kvclient")
+	}
+	switch b.Format {
+	case FormatRaw, FormatHex, FormatJSON:
+	default:
+		return nil, fmt.Errorf("unknown format [%v], should be one of raw, hex and json", b.Format)
+	}
+	caches := b.kvclient.Caches()
+	if len(caches) == 0 {
+		return nil, fmt.Errorf("no caches")
+	}
+	names := make([]string, len(caches))
+	for i := range caches {
+		if i < len(b.names) {
+			names[i] = b.names[i]
+		} else {
+			names[i] = strconv.Itoa(i)
+		}
+	}
+	b.kvclient.SetCompressor(kvclient.BytesCompressor{})
+	b.kvclient.SetSerializer(kvclient.BytesSerializer{})
+	return &Ctl{
+		format:     b.Format,
+		kvclient:   b.kvclient,
+		caches:     caches,
+		names:      names,
+		serializer: b.serializer,
+		newVal:     b.newVal,
+		out:        b.out,
+		tier:       -1,
+	}, nil
+}
+
+// Ctl run ad-hoc commands on a kvclient. keys are the keys stored in the caches, which
+// are compressed by the Compressor of the client
+type Ctl struct {
+	format     string
+	kvclient   kvclient.KVClient
+	caches     []kvclient.Cache
+	names      []string
+	serializer kvclient.Serializer
+	newVal     func() interface{}
+	out        io.Writer
+
+	// the commands operate on the tier only if tier >= 0, see Use
+	tier   int
+	target kvclient.KVClient
+}
+
+// Usage of the commands
+const Usage = `commands:
+  get <key>                                  get through the tiers
+  set <key> <val> [--ttl 10m] [--nx]         set into all the tiers, val is parsed by the format
+  del <key> [key ...]                        delete from all the tiers
+  mget <key> [key ...]                       get keys through the tiers
+  scan [--prefix p] [--tier t] [--limit n]   scan keys of a tier, the tier in use or the last tier by default
+  ttl <key>                                  time to live of the key in the first tier holding it
+  tiers <key>                                which tiers hold the key and its bytes
+  stats                                      types, capabilities and number of keys of the tiers
+`
+
+// Run a command, args are the command and its arguments
+func (c *Ctl) Run(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command\n%v", Usage)
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "get":
+		return c.get(args)
+	case "set":
+		return c.set(args)
+	case "del":
+		return c.del(args)
+	case "mget":
+		return c.mget(args)
+	case "scan":
+		return c.scan(args)
+	case "ttl":
+		return c.ttl(args)
+	case "tiers":
+		return c.tiers(args)
+	case "stats":
+		return c.stats(args)
+	}
+	return fmt.Errorf("unknown command [%v]\n%v", cmd, Usage)
+}
+
+// Close the kvclient
+func (c *Ctl) Close() error {
+	return c.kvclient.Close()
+}
+
+// Names of the tiers
+func (c *Ctl) Names() []string {
+	return c.names
+}
+
+// Tier name of the tier in use, empty if the commands go through all the tiers
+func (c *Ctl) Tier() string {
+	if c.tier < 0 {
+		return ""
+	}
+	return c.names[c.tier]
+}
+
+// Use a tier by the name or the index, so that the commands operate on it only, empty
+// name to go through all the tiers again
+func (c *Ctl) Use(name string) error {
+	if name == "" {
+		c.tier, c.target = -1, nil
+		return nil
+	}
+	i, err := c.tierIndex(name)
+	if err != nil {
+		return err
+	}
+	target, err := kvclient.NewBuilder().WithCaches([]kvclient.Cache{c.caches[i]}).Build()
+	if err != nil {
+		return err
+	}
+	target.SetCompressor(kvclient.BytesCompressor{})
+	target.SetSerializer(kvclient.BytesSerializer{})
+	c.tier, c.target = i, target
+	return nil
+}
+
+// Format of values
+func (c *Ctl) Format() string {
+	return c.format
+}
+
+// SetFormat of values, raw, hex or json
+func (c *Ctl) SetFormat(format string) error {
+	switch format {
+	case FormatRaw, FormatHex, FormatJSON:
+		c.format = format
+		return nil
+	}
+	return fmt.Errorf("unknown format [%v], should be one of raw, hex and json", format)
+}
+
+// client the tier in use or the whole kvclient. the target is never closed, it shares
+// the cache with the kvclient
+func (c *Ctl) client() kvclient.KVClient {
+	if c.target != nil {
+		return c.target
+	}
+	return c.kvclient
+}
+
+// scope indexes of the tiers in use
+func (c *Ctl) scope() []int {
+	if c.tier >= 0 {
+		return []int{c.tier}
+	}
+	indexes := make([]int, len(c.caches))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return indexes
+}
+
+// entry a key in json format
+type entry struct {
+	Key   string      `json:"key"`
+	Val   interface{} `json:"val"`
+	TTL   string      `json:"ttl,omitempty"`
+	Tier  string      `json:"tier,omitempty"`
+	Found *bool       `json:"found,omitempty"`
+	Bytes *int        `json:"bytes,omitempty"`
+}
+
+// formatVal the value in the format, json values are decoded by the serializer if
+// possible, otherwise strings for utf8 and base64 for binary
+func (c *Ctl) formatVal(val []byte) interface{} {
+	switch c.format {
+	case FormatHex:
+		return hex.EncodeToString(val)
+	case FormatJSON:
+		if c.serializer != nil && c.newVal != nil {
+			v := c.newVal()
+			if err := c.serializer.Unmarshal(val, v); err == nil {
+				return v
+			}
+		}
+		if utf8.Valid(val) {
+			return string(val)
+		}
+		return val
+	}
+	return string(val)
+}
+
+// parseVal the value of set in the format
+func (c *Ctl) parseVal(s string) ([]byte, error) {
+	switch c.format {
+	case FormatHex:
+		return hex.DecodeString(s)
+	case FormatJSON:
+		if c.serializer == nil || c.newVal == nil {
+			return nil, fmt.Errorf("no serializer and val to encode json values")
+		}
+		v := c.newVal()
+		if err := json.Unmarshal([]byte(s), v); err != nil {
+			return nil, err
+		}
+		return c.serializer.Marshal(v)
+	}
+	return []byte(s), nil
+}
+
+func formatTTL(ttl time.Duration) string {
+	if ttl == 0 {
+		return "never"
+	}
+	return ttl.String()
+}
+
+func (c *Ctl) printJSON(v interface{}) error {
+	return json.NewEncoder(c.out).Encode(v)
+}
+
+func (c *Ctl) println(a ...interface{}) error {
+	_, err := fmt.Fprintln(c.out, a...)
+	return err
+}
+
+// tierIndex by the name or the index
+func (c *Ctl) tierIndex(name string) (int, error) {
+	for i := range c.names {
+		if c.names[i] == name {
+			return i, nil
+		}
+	}
+	if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(c.caches) {
+		return i, nil
+	}
+	return -1, fmt.Errorf("no tier named [%v]", name)
+}
+
+func wrongArgs(cmd string) error {
+	return fmt.Errorf("wrong number of arguments for [%v]\n%v", cmd, Usage)
+}
+
+func (c *Ctl) get(args []string) error {
+	if len(args) != 1 {
+		return wrongArgs("get")
+	}
+	var val []byte
+	ok, err := c.client().Get(args[0], &val)
+	if err != nil {
+		return err
+	}
+	if c.format == FormatJSON {
+		e := &entry{Key: args[0]}
+		if ok {
+			e.Val = c.formatVal(val)
+		}
+		return c.printJSON(e)
+	}
+	if !ok {
+		return c.println("(nil)")
+	}
+	return c.println(c.formatVal(val))
+}
+
+func (c *Ctl) set(args []string) error {
+	flags := pflag.NewFlagSet("set", pflag.ContinueOnError)
+	ttl := flags.Duration("ttl", 0, "time to live, the default expiration of the tiers if 0")
+	nx := flags.Bool("nx", false, "set only if the key not exists")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return wrongArgs("set")
+	}
+	key := flags.Arg(0)
+	val, err := c.parseVal(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	ok := true
+	switch {
+	case *nx && *ttl > 0:
+		ok, err = c.client().SetExNx(key, val, *ttl)
+	case *nx:
+		ok, err = c.client().SetNx(key, val)
+	case *ttl > 0:
+		err = c.client().SetEx(key, val, *ttl)
+	default:
+		err = c.client().Set(key, val)
+	}
+	if err != nil {
+		return err
+	}
+	if c.format == FormatJSON {
+		return c.printJSON(map[string]bool{"ok": ok})
+	}
+	if !ok {
+		return c.println("(nil)")
+	}
+	return c.println("OK")
+}
+
+func (c *Ctl) del(args []string) error {
+	if len(args) == 0 {
+		return wrongArgs("del")
+	}
+	for _, key := range args {
+		if err := c.client().Del(key); err != nil {
+			return err
+		}
+	}
+	if c.format == FormatJSON {
+		return c.printJSON(map[string]bool{"ok": true})
+	}
+	return c.println("OK")
+}
+
+func (c *Ctl) mget(args []string) error {
+	if len(args) == 0 {
+		return wrongArgs("mget")
+	}
+	vals := make([][]byte, len(args))
+	oks := make([]bool, len(args))
+	if c.client().Capabilities().Has(kvclient.CapGetBatch) {
+		keys := make([]interface{}, len(args))
+		vs := make([]interface{}, len(args))
+		for i := range args {
+			keys[i] = args[i]
+			vs[i] = &vals[i]
+		}
+		var errs []error
+		var err error
+		if oks, errs, err = c.client().GetBatch(keys, vs); err != nil {
+			for i := range errs {
+				if errs[i] != nil {
+					return fmt.Errorf("get [%v] failed: %v", args[i], errs[i])
+				}
+			}
+			return err
+		}
+	} else {
+		for i := range args {
+			ok, err := c.client().Get(args[i], &vals[i])
+			if err != nil {
+				return fmt.Errorf("get [%v] failed: %v", args[i], err)
+			}
+			oks[i] = ok
+		}
+	}
+
+	if c.format == FormatJSON {
+		entries := make([]*entry, len(args))
+		for i := range args {
+			entries[i] = &entry{Key: args[i]}
+			if oks[i] {
+				entries[i].Val = c.formatVal(vals[i])
+			}
+		}
+		return c.printJSON(entries)
+	}
+	for i := range args {
+		if !oks[i] {
+			c.println("(nil)")
+			continue
+		}
+		c.println(c.formatVal(vals[i]))
+	}
+	return nil
+}
+
+func (c *Ctl) scan(args []string) error {
+	flags := pflag.NewFlagSet("scan", pflag.ContinueOnError)
+	prefix := flags.String("prefix", "", "prefix of the keys")
+	defaultTier := c.names[len(c.names)-1]
+	if c.tier >= 0 {
+		defaultTier = c.names[c.tier]
+	}
+	name := flags.String("tier", defaultTier, "name or index of the tier to scan, the tier in use by default")
+	limit := flags.Int("limit", 100, "max number of keys, 0 means no limit")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return wrongArgs("scan")
+	}
+	i, err := c.tierIndex(*name)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	var werr error
+	err = kvclient.Scan(c.caches[i], *prefix, func(key string, val []byte, ttl time.Duration) bool {
+		if len(val) == 0 {
+			return true
+		}
+		if c.format == FormatJSON {
+			werr = c.printJSON(&entry{Key: key, Val: c.formatVal(val), TTL: formatTTL(ttl)})
+		} else {
+			_, werr = fmt.Fprintf(c.out, "%v\t%v\n", key, c.formatVal(val))
+		}
+		n++
+		return werr == nil && (*limit <= 0 || n < *limit)
+	})
+	if err != nil {
+		return err
+	}
+	return werr
+}
+
+func (c *Ctl) ttl(args []string) error {
+	if len(args) != 1 {
+		return wrongArgs("ttl")
+	}
+	key := args[0]
+	for _, i := range c.scope() {
+		cache := c.caches[i]
+		val, err := cache.Get(key)
+		if err != nil {
+			return fmt.Errorf("get from tier [%v] failed: %v", c.names[i], err)
+		}
+		// empty values are the misses cached by the upper tiers
+		if len(val) == 0 {
+			continue
+		}
+		ttl, ok, err := kvclient.TTL(cache, key)
+		if err != nil {
+			return fmt.Errorf("tier [%v] holds the key: %v", c.names[i], err)
+		}
+		// expired just now
+		if !ok {
+			continue
+		}
+		if c.format == FormatJSON {
+			return c.printJSON(&entry{Key: key, Tier: c.names[i], TTL: formatTTL(ttl)})
+		}
+		return c.println(c.names[i], formatTTL(ttl))
+	}
+	if c.format == FormatJSON {
+		return c.printJSON(&entry{Key: key})
+	}
+	return c.println("(nil)")
+}
+
+func (c *Ctl) tiers(args []string) error {
+	if len(args) != 1 {
+		return wrongArgs("tiers")
+	}
+	key := args[0]
+	var entries []*entry
+	for i, cache := range c.caches {
+		val, err := cache.Get(key)
+		if err != nil {
+			return fmt.Errorf("get from tier [%v] failed: %v", c.names[i], err)
+		}
+		found, size := len(val) != 0, len(val)
+		e := &entry{Key: key, Tier: c.names[i], Found: &found}
+		if found {
+			e.Bytes = &size
+			e.Val = c.formatVal(val)
+			// tiers which can not tell the ttl leave it empty
+			if ttl, ok, err := kvclient.TTL(cache, key); err == nil && ok {
+				e.TTL = formatTTL(ttl)
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	if c.format == FormatJSON {
+		return c.printJSON(entries)
+	}
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIER\tFOUND\tBYTES\tTTL")
+	for _, e := range entries {
+		bytes, ttl := "-", "-"
+		if e.Bytes != nil {
+			bytes = strconv.Itoa(*e.Bytes)
+		}
+		if e.TTL != "" {
+			ttl = e.TTL
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", e.Tier, *e.Found, bytes, ttl)
+	}
+	return w.Flush()
+}
+
+// tierStats stats of a tier
+type tierStats struct {
+	Tier         string  `json:"tier"`
+	Type         string  `json:"type"`
+	Capabilities string  `json:"capabilities"`
+	Keys         *int    `json:"keys,omitempty"`
+	HitRate      float64 `json:"hitRate"`
+}
+
+func (c *Ctl) stats(args []string) error {
+	if len(args) != 0 {
+		return wrongArgs("stats")
+	}
+	rates := c.kvclient.CacheHitRate()
+	var stats []*tierStats
+	for i, cache := range c.caches {
+		s := &tierStats{
+			Tier:         c.names[i],
+			Type:         strings.TrimPrefix(fmt.Sprintf("%T", cache), "*"),
+			Capabilities: cache.Capabilities().String(),
+			HitRate:      rates[i],
+		}
+		// local caches tell the number of keys
+		if l, ok := cache.(interface{ Len() int }); ok {
+			n := l.Len()
+			s.Keys = &n
+		}
+		stats = append(stats, s)
+	}
+
+	if c.format == FormatJSON {
+		return c.printJSON(stats)
+	}
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIER\tTYPE\tKEYS\tCAPABILITIES")
+	for _, s := range stats {
+		keys := "-"
+		if s.Keys != nil {
+			keys = strconv.Itoa(*s.Keys)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", s.Tier, s.Type, keys, s.Capabilities)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,63 @@
+package kvctl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/mykv"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCtl(t *testing.T) {
+	Convey("test kvctl", t, func() {
+		local := kvclient.NewMapCacheBuilder().Build()
+		remote := kvclient.NewMapCacheBuilder().Build()
+		client, err := kvclient.NewBuilder().WithCaches([]kvclient.Cache{local, remote}).Build()
+		So(err, ShouldBeNil)
+		out := &bytes.Buffer{}
+		ctl, err := NewCtlBuilder().
+			WithKVClient(client).
+			WithNames([]string{"local", "remote"}).
+			WithSerializer(&mykv.Serializer{}, func() interface{} { return &mykv.Val{} }).
+			WithOutput(out).
+			Build()
+		So(err, ShouldBeNil)
+		defer ctl.Close()
+
+		run := func(args ...string) string {
+			out.Reset()
+			So(ctl.Run(args), ShouldBeNil)
+			return out.String()
+		}
+
+		So(run("set", "key1", "val1"), ShouldEqual, "OK\n")
+		So(run("set", "key1", "val2", "--nx"), ShouldEqual, "(nil)\n")
+		So(run("set", "--ttl", "1h", "key2", "val2"), ShouldEqual, "OK\n")
+		So(run("get", "key1"), ShouldEqual, "val1\n")
+		So(run("get", "key3"), ShouldEqual, "(nil)\n")
+		So(run("mget", "key1", "key3", "key2"), ShouldEqual, "val1\n(nil)\nval2\n")
+		So(run("scan", "--prefix", "key", "--limit", "1"), ShouldHaveLength, len("key1\tval1\n"))
+		So(run("ttl", "key1"), ShouldEqual, "local never\n")
+		So(run("ttl", "key3"), ShouldEqual, "(nil)\n")
+
+		So(local.Del("key1"), ShouldBeNil)
+		So(run("tiers", "key1"), ShouldEqual, "TIER    FOUND  BYTES  TTL\nlocal   false  -      -\nremote  true   4      never\n")
+		So(run("stats"), ShouldContainSubstring, "kvclient.MapCache")
+		So(run("del", "key1", "key2"), ShouldEqual, "OK\n")
+		So(run("get", "key2"), ShouldEqual, "(nil)\n")
+
+		ctl.format = FormatHex
+		So(run("set", "key1", "00ff"), ShouldEqual, "OK\n")
+		So(run("get", "key1"), ShouldEqual, "00ff\n")
+
+		ctl.format = FormatJSON
+		So(run("set", "key4", `{"message": "hello"}`), ShouldEqual, "{\"ok\":true}\n")
+		So(run("get", "key4"), ShouldEqual, "{\"key\":\"key4\",\"val\":{\"message\":\"hello\"}}\n")
+		So(run("get", "key5"), ShouldEqual, "{\"key\":\"key5\",\"val\":null}\n")
+
+		So(ctl.Run([]string{"unknown"}), ShouldNotBeNil)
+		So(ctl.Run([]string{"get"}), ShouldNotBeNil)
+		So(ctl.Run([]string{"scan", "--tier", "other"}), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,134 @@
+package kvctl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// maxHistory lines of history kept in memory
+const maxHistory = 1000
+
+// lineReader read lines with history and completion by term.Terminal if the input is
+// a terminal, otherwise line by line
+type lineReader struct {
+	in       *bufio.Reader
+	fd       int
+	terminal bool
+	tty      *term.Terminal
+	history  *history
+	// complete candidates of the last word of the line before the cursor
+	complete func(head string) []string
+}
+
+func newLineReader(in io.Reader, out io.Writer, complete func(head string) []string) *lineReader {
+	r := &lineReader{in: bufio.NewReader(in), fd: -1, history: &history{}, complete: complete}
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		r.fd, r.terminal = int(f.Fd()), true
+		r.tty = term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{in, out}, "")
+		r.tty.History = r.history
+		r.tty.AutoCompleteCallback = r.autoComplete
+	}
+	return r
+}
+
+// addHistory a line read from the history file
+func (r *lineReader) addHistory(line string) {
+	r.history.Add(line)
+}
+
+// readLine a line without the line break, io.EOF at the end of input, ctrl-c or ctrl-d
+func (r *lineReader) readLine(prompt string) (string, error) {
+	if !r.terminal {
+		line, err := r.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	state, err := term.MakeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(r.fd, state)
+
+	if width, height, err := term.GetSize(r.fd); err == nil && width > 0 {
+		r.tty.SetSize(width, height)
+	}
+	r.tty.SetPrompt(prompt)
+	line, err := r.tty.ReadLine()
+	if err == term.ErrPasteIndicator {
+		err = nil
+	}
+	return line, err
+}
+
+// autoComplete the word before the cursor on tab by the common prefix of the candidates,
+// or list them if the word can not be longer
+func (r *lineReader) autoComplete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || r.complete == nil {
+		return "", 0, false
+	}
+	head := line[:pos]
+	candidates := r.complete(head)
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+	word := head[strings.LastIndexAny(head, " \t")+1:]
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 {
+		prefix += " "
+	}
+	if len(prefix) > len(word) {
+		head += prefix[len(word):]
+		return head + line[pos:], len(head), true
+	}
+	sort.Strings(candidates)
+	// written above the prompt, which is redrawn by the terminal
+	fmt.Fprintf(r.tty, "%v\n", strings.Join(candidates, "  "))
+	return "", 0, false
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// history of the terminal, blank lines are dropped and consecutive duplicates are kept once
+type history struct {
+	lines []string
+}
+
+func (h *history) Add(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || (len(h.lines) != 0 && h.lines[len(h.lines)-1] == line) {
+		return
+	}
+	h.lines = append(h.lines, line)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+	}
+}
+
+func (h *history) Len() int {
+	return len(h.lines)
+}
+
+// At the idx-th most recent line
+func (h *history) At(idx int) string {
+	return h.lines[len(h.lines)-1-idx]
+}
@@ -0,0 +1,322 @@
+package kvctl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// NewShellBuilder create a new ShellBuilder
+func NewShellBuilder() *ShellBuilder {
+	return &ShellBuilder{
+		Timing: true,
+		in:     os.Stdin,
+	}
+}
+
+// ShellBuilder builder
+type ShellBuilder struct {
+	HistoryFile string // lines entered are appended to it, empty means no history file
+	Timing      bool   // print the time of each command
+	ctl         *Ctl
+	in          io.Reader
+}
+
+// WithHistoryFile option
+func (b *ShellBuilder) WithHistoryFile(filename string) *ShellBuilder {
+	b.HistoryFile = filename
+	return b
+}
+
+// WithTiming option
+func (b *ShellBuilder) WithTiming(timing bool) *ShellBuilder {
+	b.Timing = timing
+	return b
+}
+
+// WithCtl option, the output of the shell is the same as the ctl
+func (b *ShellBuilder) WithCtl(ctl *Ctl) *ShellBuilder {
+	b.ctl = ctl
+	return b
+}
+
+// WithInput option, os.Stdin by default, lines are edited with history and completion
+// only if it is a terminal
+func (b *ShellBuilder) WithInput(in io.Reader) *ShellBuilder {
+	b.in = in
+	return b
+}
+
+// Build a Shell
+func (b *ShellBuilder) Build() (*Shell, error) {
+	if b.ctl == nil {
+		return nil, fmt.Errorf("no ctl")
+	}
+	s := &Shell{
+		ctl:    b.ctl,
+		out:    b.ctl.out,
+		timing: b.Timing,
+	}
+	s.reader = newLineReader(b.in, s.out, s.complete)
+	if b.HistoryFile != "" {
+		if buf, err := ioutil.ReadFile(b.HistoryFile); err == nil {
+			for _, line := range strings.Split(string(buf), "\n") {
+				s.reader.addHistory(line)
+			}
+		}
+		fp, err := os.OpenFile(b.HistoryFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		s.history = fp
+	}
+	return s, nil
+}
+
+// Shell run the commands of a Ctl interactively, or from a script
+type Shell struct {
+	ctl     *Ctl
+	out     io.Writer
+	reader  *lineReader
+	history io.WriteCloser
+	timing  bool
+}
+
+// ShellUsage commands of the shell besides the ones of Ctl
+const ShellUsage = `shell commands:
+  use tier <name|index>                      get, set, del, mget, scan and ttl operate on the tier only
+  use all                                    go through all the tiers again
+  format [raw|hex|json]                      show or change the format of values
+  timing [on|off]                            print the time of each command
+  source <file>                              run the commands in the file, stop at the first error
+  help                                       show the commands
+  exit                                       exit the shell, or ctrl-c / ctrl-d
+`
+
+// Run read and run commands until exit or the end of the input. errors of the commands
+// are printed if the input is a terminal, otherwise the first one is returned
+func (s *Shell) Run() error {
+	for {
+		line, err := s.reader.readLine(s.prompt())
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// lines are added to the history of the terminal when read
+		if s.reader.terminal && s.history != nil && strings.TrimSpace(line) != "" {
+			fmt.Fprintln(s.history, strings.TrimSpace(line))
+		}
+
+		if comment(line) {
+			continue
+		}
+		now := time.Now()
+		exit, err := s.exec(line)
+		if err != nil {
+			if !s.reader.terminal {
+				return err
+			}
+			fmt.Fprintf(s.out, "(error) %v\n", err)
+		}
+		if exit {
+			return nil
+		}
+		s.printTiming(now)
+	}
+}
+
+// Source run the commands in the file, stop at the first error
+func (s *Shell) Source(filename string) error {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if comment(scanner.Text()) {
+			continue
+		}
+		now := time.Now()
+		exit, err := s.exec(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%v:%v: %v", filename, n, err)
+		}
+		if exit {
+			return nil
+		}
+		s.printTiming(now)
+	}
+	return scanner.Err()
+}
+
+// Close the history file, the ctl is closed by the caller
+func (s *Shell) Close() error {
+	if s.history != nil {
+		return s.history.Close()
+	}
+	return nil
+}
+
+func (s *Shell) prompt() string {
+	if tier := s.ctl.Tier(); tier != "" {
+		return fmt.Sprintf("kvctl[%v]> ", tier)
+	}
+	return "kvctl> "
+}
+
+// comment blank lines and comments starting with # are skipped
+func comment(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "#")
+}
+
+// exec a line, return true to exit
+func (s *Shell) exec(line string) (bool, error) {
+	args, err := splitArgs(line)
+	if err != nil {
+		return false, err
+	}
+
+	return s.builtin(args)
+}
+
+// printTiming the time since the command started
+func (s *Shell) printTiming(start time.Time) {
+	if s.timing {
+		fmt.Fprintf(s.out, "(%v)\n", time.Since(start).Round(time.Microsecond))
+	}
+}
+
+func (s *Shell) builtin(args []string) (bool, error) {
+	switch args[0] {
+	case "exit", "quit":
+		return true, nil
+	case "help":
+		fmt.Fprint(s.out, Usage, ShellUsage)
+		return false, nil
+	case "use":
+		switch {
+		case len(args) == 3 && args[1] == "tier":
+			return false, s.ctl.Use(args[2])
+		case len(args) == 2 && args[1] == "all":
+			return false, s.ctl.Use("")
+		}
+		return false, wrongArgs("use")
+	case "format":
+		switch len(args) {
+		case 1:
+			fmt.Fprintln(s.out, s.ctl.Format())
+			return false, nil
+		case 2:
+			return false, s.ctl.SetFormat(args[1])
+		}
+		return false, wrongArgs("format")
+	case "timing":
+		if len(args) != 2 || (args[1] != "on" && args[1] != "off") {
+			return false, wrongArgs("timing")
+		}
+		s.timing = args[1] == "on"
+		return false, nil
+	case "source":
+		if len(args) != 2 {
+			return false, wrongArgs("source")
+		}
+		return false, s.Source(args[1])
+	}
+	return false, s.ctl.Run(args)
+}
+
+// flags of the commands for completion
+var commandFlags = map[string][]string{
+	"set":  {"--ttl", "--nx"},
+	"scan": {"--prefix", "--tier", "--limit"},
+}
+
+var commands = []string{
+	"get", "set", "del", "mget", "scan", "ttl", "tiers", "stats",
+	"use", "format", "timing", "source", "help", "exit",
+}
+
+// complete candidates of the last word of head, commands, flags and the names of tiers
+func (s *Shell) complete(head string) []string {
+	words := strings.Fields(head)
+	// a new word after the space
+	if head == "" || strings.HasSuffix(head, " ") {
+		words = append(words, "")
+	}
+	word := words[len(words)-1]
+
+	var candidates []string
+	switch {
+	case len(words) == 1:
+		candidates = commands
+	case words[0] == "use" && len(words) == 2:
+		candidates = []string{"tier", "all"}
+	case words[0] == "use" && len(words) == 3 && words[1] == "tier",
+		words[len(words)-2] == "--tier":
+		candidates = s.ctl.Names()
+	case words[0] == "format" && len(words) == 2:
+		candidates = []string{FormatRaw, FormatHex, FormatJSON}
+	case words[0] == "timing" && len(words) == 2:
+		candidates = []string{"on", "off"}
+	case strings.HasPrefix(word, "-"):
+		candidates = commandFlags[words[0]]
+	}
+
+	var res []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			res = append(res, candidate)
+		}
+	}
+	return res
+}
+
+// splitArgs split a line into words by spaces, words can be quoted by ' or ", and \
+// escapes the next character out of single quotes
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord, escaped := false, false
+	var quote rune
+	for _, ch := range line {
+		switch {
+		case escaped:
+			word.WriteRune(ch)
+			escaped = false
+		case ch == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(ch)
+		case ch == '\'' || ch == '"':
+			quote, inWord = ch, true
+		case ch == ' ' || ch == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(ch)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
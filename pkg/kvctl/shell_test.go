@@ -0,0 +1,99 @@
+package kvctl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShell(t *testing.T) {
+	Convey("test kvctl shell", t, func() {
+		local := kvclient.NewMapCacheBuilder().Build()
+		remote := kvclient.NewMapCacheBuilder().Build()
+		client, err := kvclient.NewBuilder().WithCaches([]kvclient.Cache{local, remote}).Build()
+		So(err, ShouldBeNil)
+		out := &bytes.Buffer{}
+		ctl, err := NewCtlBuilder().WithKVClient(client).WithNames([]string{"local", "remote"}).WithOutput(out).Build()
+		So(err, ShouldBeNil)
+		defer ctl.Close()
+
+		Convey("run commands from the input", func() {
+			shell, err := NewShellBuilder().WithCtl(ctl).WithInput(strings.NewReader(`
+				timing off
+				# set into the remote tier only
+				use tier remote
+				set key1 "hello world"
+				get key1
+				use all
+				tiers key1
+				format hex
+				get key1
+				exit
+				get key2
+			`)).Build()
+			So(err, ShouldBeNil)
+			So(shell.Run(), ShouldBeNil)
+			So(out.String(), ShouldEqual, "OK\nhello world\n"+
+				"TIER    FOUND  BYTES  TTL\nlocal   false  -      -\nremote  true   11     never\n"+
+				"68656c6c6f20776f726c64\n")
+			So(ctl.Tier(), ShouldEqual, "")
+		})
+
+		Convey("stop at the first error of a script", func() {
+			directory, err := ioutil.TempDir("", "kvctl")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(directory)
+			filename := filepath.Join(directory, "script")
+			So(ioutil.WriteFile(filename, []byte("set key1 val1\nuse tier other\nset key2 val2\n"), 0644), ShouldBeNil)
+
+			shell, err := NewShellBuilder().WithCtl(ctl).Build()
+			So(err, ShouldBeNil)
+			So(shell.Source(filename), ShouldNotBeNil)
+			So(out.String(), ShouldStartWith, "OK\n(")
+			val, err := remote.Get("key2")
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+		})
+
+		Convey("complete commands and tiers", func() {
+			shell, err := NewShellBuilder().WithCtl(ctl).Build()
+			So(err, ShouldBeNil)
+			So(shell.complete("s"), ShouldResemble, []string{"set", "scan", "stats", "source"})
+			So(shell.complete("use tier "), ShouldResemble, []string{"local", "remote"})
+			So(shell.complete("scan --tier r"), ShouldResemble, []string{"remote"})
+			So(shell.complete("set key1 val1 --n"), ShouldResemble, []string{"--nx"})
+			So(commonPrefix([]string{"set", "scan", "stats"}), ShouldEqual, "s")
+
+			line, pos, ok := shell.reader.autoComplete("us key1", 2, '\t')
+			So(ok, ShouldBeTrue)
+			So(line, ShouldEqual, "use  key1")
+			So(pos, ShouldEqual, 4)
+			_, _, ok = shell.reader.autoComplete("us", 2, 'x')
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("history drops blank lines and consecutive duplicates", func() {
+			h := &history{}
+			for _, line := range []string{"get key1", "", "get key1 ", "get key2"} {
+				h.Add(line)
+			}
+			So(h.Len(), ShouldEqual, 2)
+			So(h.At(0), ShouldEqual, "get key2")
+			So(h.At(1), ShouldEqual, "get key1")
+		})
+
+		Convey("split args", func() {
+			args, err := splitArgs(`set 'key 1' "{\"message\": \"hi\"}" --ttl=1m`)
+			So(err, ShouldBeNil)
+			So(args, ShouldResemble, []string{"set", "key 1", `{"message": "hi"}`, "--ttl=1m"})
+			_, err = splitArgs(`set "key1`)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -23,9 +23,12 @@ func (b *MyKVCoderBuilder) Build() *MyKVCoder {
 // MyKVCoder coder for my
 type MyKVCoder struct{}
 
-// Decode decode info from a string
+// Decode decode info from a string, a line without a tab is a key without value
 func (c *MyKVCoder) Decode(line string) (*KVInfo, error) {
 	kv := strings.Split(line, "\t")
+	if len(kv) == 1 && kv[0] != "" {
+		return &KVInfo{Key: &mykv.Key{Message: kv[0]}}, nil
+	}
 	if len(kv) != 2 {
 		return nil, fmt.Errorf("len(kv) [%v] is not 2. line [%v]", len(kv), line)
 	}
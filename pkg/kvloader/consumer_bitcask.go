@@ -0,0 +1,164 @@
+package kvloader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/sirupsen/logrus"
+)
+
+// NewBitcaskKVConsumerBuilder create a new BitcaskKVConsumerBuilder
+func NewBitcaskKVConsumerBuilder() *BitcaskKVConsumerBuilder {
+	return &BitcaskKVConsumerBuilder{
+		Directory:   "bitcask/",
+		ThreadNum:   4,
+		Batch:       1000,
+		MaxFileSize: 256 * 1024 * 1024,
+	}
+}
+
+// BitcaskKVConsumerBuilder bitcask kv consumer builder
+type BitcaskKVConsumerBuilder struct {
+	Directory   string
+	ThreadNum   int
+	Batch       int
+	Verbose     bool
+	MaxFileSize int64
+	Expiration  time.Duration
+	compressor  kvclient.Compressor
+	serializer  kvclient.Serializer
+}
+
+// WithDirectory option
+func (b *BitcaskKVConsumerBuilder) WithDirectory(directory string) *BitcaskKVConsumerBuilder {
+	b.Directory = directory
+	return b
+}
+
+// WithThreadNum option
+func (b *BitcaskKVConsumerBuilder) WithThreadNum(threadNum int) *BitcaskKVConsumerBuilder {
+	b.ThreadNum = threadNum
+	return b
+}
+
+// WithBatch option
+func (b *BitcaskKVConsumerBuilder) WithBatch(batch int) *BitcaskKVConsumerBuilder {
+	b.Batch = batch
+	return b
+}
+
+// WithVerbose option
+func (b *BitcaskKVConsumerBuilder) WithVerbose(verbose bool) *BitcaskKVConsumerBuilder {
+	b.Verbose = verbose
+	return b
+}
+
+// WithMaxFileSize option
+func (b *BitcaskKVConsumerBuilder) WithMaxFileSize(maxFileSize int64) *BitcaskKVConsumerBuilder {
+	b.MaxFileSize = maxFileSize
+	return b
+}
+
+// WithExpiration option
+func (b *BitcaskKVConsumerBuilder) WithExpiration(expiration time.Duration) *BitcaskKVConsumerBuilder {
+	b.Expiration = expiration
+	return b
+}
+
+// WithCompressor option
+func (b *BitcaskKVConsumerBuilder) WithCompressor(compressor kvclient.Compressor) *BitcaskKVConsumerBuilder {
+	b.compressor = compressor
+	return b
+}
+
+// WithSerializer option
+func (b *BitcaskKVConsumerBuilder) WithSerializer(serializer kvclient.Serializer) *BitcaskKVConsumerBuilder {
+	b.serializer = serializer
+	return b
+}
+
+// Build a BitcaskKVConsumer
+func (b *BitcaskKVConsumerBuilder) Build() *BitcaskKVConsumer {
+	return &BitcaskKVConsumer{
+		threadNum: b.ThreadNum,
+		batch:     b.Batch,
+		verbose:   b.Verbose,
+		builder: kvclient.NewBitcaskBuilder().
+			WithDirectory(b.Directory).
+			WithMaxFileSize(b.MaxFileSize).
+			WithExpiration(b.Expiration).
+			WithCompactInterval(0),
+		compressor: b.compressor,
+		serializer: b.serializer,
+	}
+}
+
+// BitcaskKVConsumer consumer which imports infos into a bitcask directory directly,
+// keys and values are encoded the same way as a kvclient with the compressor and
+// serializer. the bitcask is closed when all infos are consumed, hint files included
+type BitcaskKVConsumer struct {
+	threadNum  int
+	batch      int
+	verbose    bool
+	builder    *kvclient.BitcaskBuilder
+	compressor kvclient.Compressor
+	serializer kvclient.Serializer
+}
+
+// Consume infos
+func (c *BitcaskKVConsumer) Consume(wg *sync.WaitGroup, infoChan <-chan *KVInfo) error {
+	bitcask, err := c.builder.Build()
+	if err != nil {
+		return err
+	}
+
+	var wgt sync.WaitGroup
+	for i := 0; i < c.threadNum; i++ {
+		wgt.Add(1)
+		go func() {
+			var keys []string
+			var vals [][]byte
+			for info := range infoChan {
+				val, err := c.serializer.Marshal(info.Val)
+				if err != nil {
+					logrus.WithFields(logrus.Fields{"error": err, "type": "BitcaskKVConsumer"}).Warn()
+					continue
+				}
+				keys = append(keys, c.compressor.Compress(info.Key))
+				vals = append(vals, val)
+				if len(keys) == c.batch {
+					c.setBatch(bitcask, keys, vals)
+					keys = keys[:0]
+					vals = vals[:0]
+				}
+			}
+			c.setBatch(bitcask, keys, vals)
+			wgt.Done()
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		wgt.Wait()
+		if err := bitcask.Close(); err != nil {
+			logrus.WithFields(logrus.Fields{"error": err, "type": "BitcaskKVConsumer"}).Warn("close failed")
+		}
+		wg.Done()
+	}()
+
+	return nil
+}
+
+func (c *BitcaskKVConsumer) setBatch(bitcask *kvclient.Bitcask, keys []string, vals [][]byte) {
+	if len(keys) == 0 {
+		return
+	}
+	if _, err := bitcask.SetBatch(keys, vals); err != nil {
+		logrus.WithFields(logrus.Fields{"error": err, "type": "BitcaskKVConsumer"}).Warn()
+		return
+	}
+	if c.verbose {
+		logrus.WithFields(logrus.Fields{"keys": len(keys), "type": "BitcaskKVConsumer"}).Info("imported")
+	}
+}
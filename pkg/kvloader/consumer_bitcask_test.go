@@ -0,0 +1,34 @@
+package kvloader
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/mykv"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBitcaskKVConsumer(t *testing.T) {
+	Convey("test bitcask kv consumer", t, func() {
+		directory, err := ioutil.TempDir("", "bitcask")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+
+		producer := NewFakeMyKVProducerBuilder().WithThreadNum(2).WithTotal(1000).Build()
+		consumer := NewBitcaskKVConsumerBuilder().
+			WithDirectory(directory).
+			WithBatch(64).
+			WithMaxFileSize(16 * 1024).
+			WithCompressor(&mykv.Compressor{}).
+			WithSerializer(&mykv.Serializer{}).
+			Build()
+		So(NewBuilder().WithProducer(producer).WithConsumer(consumer).Build().Load(), ShouldBeNil)
+
+		bitcask, err := kvclient.NewBitcaskBuilder().WithDirectory(directory).Build()
+		So(err, ShouldBeNil)
+		defer bitcask.Close()
+		So(bitcask.Len(), ShouldEqual, 1000)
+	})
+}
@@ -0,0 +1,151 @@
+package kvloader
+
+import (
+	"sync"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/sirupsen/logrus"
+)
+
+// NewSnapshotKVConsumerBuilder create a new SnapshotKVConsumerBuilder
+func NewSnapshotKVConsumerBuilder() *SnapshotKVConsumerBuilder {
+	return &SnapshotKVConsumerBuilder{
+		Filename:        "kvclient.snapshot",
+		ThreadNum:       4,
+		MemBytes:        256 * 1024 * 1024,
+		IndexInterval:   64,
+		BloomBitsPerKey: 10,
+	}
+}
+
+// SnapshotKVConsumerBuilder snapshot kv consumer builder
+type SnapshotKVConsumerBuilder struct {
+	Filename        string
+	TempDirectory   string
+	ThreadNum       int
+	MemBytes        int
+	IndexInterval   int
+	BloomBitsPerKey int
+	Verbose         bool
+	compressor      kvclient.Compressor
+	serializer      kvclient.Serializer
+}
+
+// WithFilename option
+func (b *SnapshotKVConsumerBuilder) WithFilename(filename string) *SnapshotKVConsumerBuilder {
+	b.Filename = filename
+	return b
+}
+
+// WithTempDirectory option
+func (b *SnapshotKVConsumerBuilder) WithTempDirectory(tempDirectory string) *SnapshotKVConsumerBuilder {
+	b.TempDirectory = tempDirectory
+	return b
+}
+
+// WithThreadNum option
+func (b *SnapshotKVConsumerBuilder) WithThreadNum(threadNum int) *SnapshotKVConsumerBuilder {
+	b.ThreadNum = threadNum
+	return b
+}
+
+// WithMemBytes option
+func (b *SnapshotKVConsumerBuilder) WithMemBytes(memBytes int) *SnapshotKVConsumerBuilder {
+	b.MemBytes = memBytes
+	return b
+}
+
+// WithIndexInterval option
+func (b *SnapshotKVConsumerBuilder) WithIndexInterval(indexInterval int) *SnapshotKVConsumerBuilder {
+	b.IndexInterval = indexInterval
+	return b
+}
+
+// WithBloomBitsPerKey option
+func (b *SnapshotKVConsumerBuilder) WithBloomBitsPerKey(bloomBitsPerKey int) *SnapshotKVConsumerBuilder {
+	b.BloomBitsPerKey = bloomBitsPerKey
+	return b
+}
+
+// WithVerbose option
+func (b *SnapshotKVConsumerBuilder) WithVerbose(verbose bool) *SnapshotKVConsumerBuilder {
+	b.Verbose = verbose
+	return b
+}
+
+// WithCompressor option
+func (b *SnapshotKVConsumerBuilder) WithCompressor(compressor kvclient.Compressor) *SnapshotKVConsumerBuilder {
+	b.compressor = compressor
+	return b
+}
+
+// WithSerializer option
+func (b *SnapshotKVConsumerBuilder) WithSerializer(serializer kvclient.Serializer) *SnapshotKVConsumerBuilder {
+	b.serializer = serializer
+	return b
+}
+
+// Build a SnapshotKVConsumer
+func (b *SnapshotKVConsumerBuilder) Build() *SnapshotKVConsumer {
+	return &SnapshotKVConsumer{
+		threadNum: b.ThreadNum,
+		verbose:   b.Verbose,
+		builder: kvclient.NewSnapshotWriterBuilder().
+			WithFilename(b.Filename).
+			WithTempDirectory(b.TempDirectory).
+			WithMemBytes(b.MemBytes).
+			WithIndexInterval(b.IndexInterval).
+			WithBloomBitsPerKey(b.BloomBitsPerKey),
+		compressor: b.compressor,
+		serializer: b.serializer,
+	}
+}
+
+// SnapshotKVConsumer consumer which writes infos into a snapshot file in one pass, keys
+// and values are encoded the same way as a kvclient with the compressor and serializer.
+// the file appears when all infos are consumed, a Snapshot cache may swap to it then
+type SnapshotKVConsumer struct {
+	threadNum  int
+	verbose    bool
+	builder    *kvclient.SnapshotWriterBuilder
+	compressor kvclient.Compressor
+	serializer kvclient.Serializer
+}
+
+// Consume infos
+func (c *SnapshotKVConsumer) Consume(wg *sync.WaitGroup, infoChan <-chan *KVInfo) error {
+	writer, err := c.builder.Build()
+	if err != nil {
+		return err
+	}
+
+	var wgt sync.WaitGroup
+	for i := 0; i < c.threadNum; i++ {
+		wgt.Add(1)
+		go func() {
+			for info := range infoChan {
+				val, err := c.serializer.Marshal(info.Val)
+				if err == nil {
+					err = writer.Add(c.compressor.Compress(info.Key), val)
+				}
+				if err != nil {
+					logrus.WithFields(logrus.Fields{"error": err, "type": "SnapshotKVConsumer"}).Warn()
+				}
+			}
+			wgt.Done()
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		wgt.Wait()
+		if err := writer.Close(); err != nil {
+			logrus.WithFields(logrus.Fields{"error": err, "type": "SnapshotKVConsumer"}).Warn("write snapshot failed")
+		} else if c.verbose {
+			logrus.WithFields(logrus.Fields{"type": "SnapshotKVConsumer"}).Info("snapshot written")
+		}
+		wg.Done()
+	}()
+
+	return nil
+}
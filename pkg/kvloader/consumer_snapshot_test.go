@@ -0,0 +1,35 @@
+package kvloader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/mykv"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSnapshotKVConsumer(t *testing.T) {
+	Convey("test snapshot kv consumer", t, func() {
+		directory, err := ioutil.TempDir("", "snapshot")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(directory)
+		filename := filepath.Join(directory, "20180601.snapshot")
+
+		producer := NewFakeMyKVProducerBuilder().WithThreadNum(2).WithTotal(1000).Build()
+		consumer := NewSnapshotKVConsumerBuilder().
+			WithFilename(filename).
+			WithMemBytes(8 * 1024).
+			WithCompressor(&mykv.Compressor{}).
+			WithSerializer(&mykv.Serializer{}).
+			Build()
+		So(NewBuilder().WithProducer(producer).WithConsumer(consumer).Build().Load(), ShouldBeNil)
+
+		snapshot, err := kvclient.NewSnapshotBuilder().WithFilename(filename).Build()
+		So(err, ShouldBeNil)
+		defer snapshot.Close()
+		So(snapshot.Count(), ShouldEqual, 1000)
+	})
+}
@@ -0,0 +1,266 @@
+package kvloader
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/sirupsen/logrus"
+)
+
+// NewWarmerBuilder create a new WarmerBuilder
+func NewWarmerBuilder() *WarmerBuilder {
+	return &WarmerBuilder{
+		ThreadNum: 10,
+	}
+}
+
+// WarmerBuilder warmer builder
+type WarmerBuilder struct {
+	ThreadNum int
+	QPS       int           // keys per second of all threads, 0 means no limit
+	Timeout   time.Duration // the warmer is ready after timeout even if not finished, 0 means no limit
+	Verbose   bool
+	kvclient  kvclient.KVClient
+	producer  KVProducer
+	newVal    func() interface{}
+}
+
+// WithThreadNum option
+func (b *WarmerBuilder) WithThreadNum(threadNum int) *WarmerBuilder {
+	b.ThreadNum = threadNum
+	return b
+}
+
+// WithQPS option
+func (b *WarmerBuilder) WithQPS(qps int) *WarmerBuilder {
+	b.QPS = qps
+	return b
+}
+
+// WithTimeout option
+func (b *WarmerBuilder) WithTimeout(timeout time.Duration) *WarmerBuilder {
+	b.Timeout = timeout
+	return b
+}
+
+// WithVerbose option
+func (b *WarmerBuilder) WithVerbose(verbose bool) *WarmerBuilder {
+	b.Verbose = verbose
+	return b
+}
+
+// WithKVClient option
+func (b *WarmerBuilder) WithKVClient(kvclient kvclient.KVClient) *WarmerBuilder {
+	b.kvclient = kvclient
+	return b
+}
+
+// WithProducer option
+func (b *WarmerBuilder) WithProducer(producer KVProducer) *WarmerBuilder {
+	b.producer = producer
+	return b
+}
+
+// WithNewVal option, create a value to Get into for the keys produced without a value,
+// which are read through the lower tiers and backfilled into the upper tiers
+func (b *WarmerBuilder) WithNewVal(newVal func() interface{}) *WarmerBuilder {
+	b.newVal = newVal
+	return b
+}
+
+// Build a Warmer
+func (b *WarmerBuilder) Build() *Warmer {
+	var interval time.Duration
+	if b.QPS > 0 {
+		interval = time.Second / time.Duration(b.QPS)
+	}
+	return &Warmer{
+		threadNum: b.ThreadNum,
+		interval:  interval,
+		timeout:   b.Timeout,
+		verbose:   b.Verbose,
+		kvclient:  b.kvclient,
+		producer:  b.producer,
+		newVal:    b.newVal,
+		ready:     make(chan struct{}),
+	}
+}
+
+// Warmup fill client with the infos of producer before it serves, block until ready
+func Warmup(client kvclient.KVClient, producer KVProducer, options *WarmerBuilder) (WarmerStats, error) {
+	warmer := options.WithKVClient(client).WithProducer(producer).Build()
+	err := warmer.Run()
+	return warmer.Stats(), err
+}
+
+// Warmer fill a kvclient with the infos of a producer. infos with a value are Set,
+// infos with only a key are read by Get through the lower tiers, so a key list warms
+// the local tiers from the remote ones
+type Warmer struct {
+	threadNum int
+	interval  time.Duration
+	timeout   time.Duration
+	verbose   bool
+	kvclient  kvclient.KVClient
+	producer  KVProducer
+	newVal    func() interface{}
+
+	mutex sync.Mutex
+	next  time.Time // the time of the next key when rate limited
+	once  sync.Once
+	ready chan struct{}
+	err   error
+	stats WarmerStats
+}
+
+// WarmerStats stats of a Warmer
+type WarmerStats struct {
+	Sets     int64
+	Gets     int64
+	Hits     int64 // keys found by Get
+	Errors   int64
+	TimedOut bool
+}
+
+// Ready closed when the warmer finished or timed out
+func (w *Warmer) Ready() <-chan struct{} {
+	return w.ready
+}
+
+// Err the error of the producer, valid after Ready
+func (w *Warmer) Err() error {
+	<-w.ready
+	return w.err
+}
+
+// Stats of the warmer, counters keep going until the producer finished
+func (w *Warmer) Stats() WarmerStats {
+	return WarmerStats{
+		Sets:     atomic.LoadInt64(&w.stats.Sets),
+		Gets:     atomic.LoadInt64(&w.stats.Gets),
+		Hits:     atomic.LoadInt64(&w.stats.Hits),
+		Errors:   atomic.LoadInt64(&w.stats.Errors),
+		TimedOut: w.timedOut(),
+	}
+}
+
+func (w *Warmer) timedOut() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.stats.TimedOut
+}
+
+// Start warming up in background, wait on Ready
+func (w *Warmer) Start() {
+	go w.Run()
+}
+
+// Run warm up and block until ready. after a timeout the infos left are drained
+// without being applied, so that the producer goroutines exit
+func (w *Warmer) Run() error {
+	w.once.Do(w.run)
+	<-w.ready
+	return w.err
+}
+
+func (w *Warmer) run() {
+	infoChan := make(chan *KVInfo, 10000)
+	var wgp sync.WaitGroup
+	if err := w.producer.Produce(&wgp, infoChan); err != nil {
+		w.err = err
+		close(w.ready)
+		return
+	}
+	go func() {
+		wgp.Wait()
+		close(infoChan)
+	}()
+
+	stop := make(chan struct{})
+	var wgc sync.WaitGroup
+	for i := 0; i < w.threadNum; i++ {
+		wgc.Add(1)
+		go func() {
+			defer wgc.Done()
+			for info := range infoChan {
+				select {
+				case <-stop:
+					// timed out, drain the infos left
+					continue
+				default:
+				}
+				w.wait()
+				w.warm(info)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wgc.Wait()
+		close(done)
+	}()
+
+	var timeout <-chan time.Time
+	if w.timeout > 0 {
+		timer := time.NewTimer(w.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-done:
+	case <-timeout:
+		close(stop)
+		w.mutex.Lock()
+		w.stats.TimedOut = true
+		w.mutex.Unlock()
+		if w.verbose {
+			logrus.WithFields(logrus.Fields{"timeout": w.timeout, "type": "Warmer"}).Warn("timed out")
+		}
+	}
+	if w.verbose {
+		logrus.WithFields(logrus.Fields{"stats": fmt.Sprintf("%+v", w.Stats()), "type": "Warmer"}).Info("ready")
+	}
+	close(w.ready)
+}
+
+// wait for the next key if rate limited
+func (w *Warmer) wait() {
+	if w.interval == 0 {
+		return
+	}
+	w.mutex.Lock()
+	now := time.Now()
+	if w.next.Before(now) {
+		w.next = now
+	}
+	d := w.next.Sub(now)
+	w.next = w.next.Add(w.interval)
+	w.mutex.Unlock()
+	time.Sleep(d)
+}
+
+func (w *Warmer) warm(info *KVInfo) {
+	var err error
+	if info.Val != nil {
+		atomic.AddInt64(&w.stats.Sets, 1)
+		err = w.kvclient.Set(info.Key, info.Val)
+	} else if w.newVal != nil {
+		atomic.AddInt64(&w.stats.Gets, 1)
+		var ok bool
+		if ok, err = w.kvclient.Get(info.Key, w.newVal()); ok {
+			atomic.AddInt64(&w.stats.Hits, 1)
+		}
+	} else {
+		err = fmt.Errorf("no value of key [%v] and no newVal to get it", info.Key)
+	}
+	if err != nil {
+		atomic.AddInt64(&w.stats.Errors, 1)
+		if w.verbose {
+			logrus.WithFields(logrus.Fields{"error": err, "type": "Warmer"}).Warn()
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package kvloader
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/mykv"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// keysProducer produce infos without value
+type keysProducer struct {
+	keys []string
+}
+
+func (p *keysProducer) Produce(wg *sync.WaitGroup, infoChan chan<- *KVInfo) error {
+	wg.Add(1)
+	go func() {
+		for _, key := range p.keys {
+			infoChan <- &KVInfo{Key: &mykv.Key{Message: key}}
+		}
+		wg.Done()
+	}()
+	return nil
+}
+
+func TestWarmer(t *testing.T) {
+	Convey("test warmer", t, func() {
+		local := kvclient.NewMapCacheBuilder().Build()
+		remote := kvclient.NewMapCacheBuilder().Build()
+		client, err := kvclient.NewBuilder().
+			WithCaches([]kvclient.Cache{local, remote}).
+			WithCompressor(&mykv.Compressor{}).
+			WithSerializer(&mykv.Serializer{}).
+			Build()
+		So(err, ShouldBeNil)
+
+		Convey("infos with value are set", func() {
+			producer := NewFakeMyKVProducerBuilder().WithThreadNum(2).WithTotal(1000).Build()
+			stats, err := Warmup(client, producer, NewWarmerBuilder().WithThreadNum(4))
+			So(err, ShouldBeNil)
+			So(stats.Sets, ShouldEqual, 1000)
+			So(stats.Errors, ShouldEqual, 0)
+			So(local.Len(), ShouldEqual, 1000)
+		})
+
+		Convey("keys are read through the lower tiers", func() {
+			var keys []string
+			for i := 0; i < 100; i++ {
+				keys = append(keys, fmt.Sprintf("key%v", i))
+				if i%2 == 0 {
+					So(remote.Set(keys[i], []byte("val")), ShouldBeNil)
+				}
+			}
+			warmer := NewWarmerBuilder().
+				WithKVClient(client).
+				WithProducer(&keysProducer{keys: keys}).
+				WithNewVal(func() interface{} { return &mykv.Val{} }).
+				Build()
+			warmer.Start()
+			<-warmer.Ready()
+			So(warmer.Err(), ShouldBeNil)
+			stats := warmer.Stats()
+			So(stats.Gets, ShouldEqual, 100)
+			So(stats.Hits, ShouldEqual, 50)
+			val, err := local.Get("key0")
+			So(err, ShouldBeNil)
+			So(val, ShouldResemble, []byte("val"))
+		})
+
+		Convey("keys without newVal are errors", func() {
+			stats, err := Warmup(client, &keysProducer{keys: []string{"key1"}}, NewWarmerBuilder())
+			So(err, ShouldBeNil)
+			So(stats.Errors, ShouldEqual, 1)
+		})
+
+		Convey("ready after timeout", func() {
+			producer := NewFakeMyKVProducerBuilder().WithThreadNum(2).WithTotal(1000).Build()
+			now := time.Now()
+			stats, err := Warmup(client, producer, NewWarmerBuilder().WithQPS(100).WithTimeout(100*time.Millisecond))
+			So(err, ShouldBeNil)
+			So(time.Since(now), ShouldBeLessThan, time.Second)
+			So(stats.TimedOut, ShouldBeTrue)
+			So(stats.Sets, ShouldBeLessThan, 100)
+		})
+	})
+}
+
+func TestMyKVCoder_DecodeKey(t *testing.T) {
+	Convey("a line without a tab is a key", t, func() {
+		info, err := NewMyKVCoderBuilder().Build().Decode("key1")
+		So(err, ShouldBeNil)
+		So(info.Key, ShouldResemble, &mykv.Key{Message: "key1"})
+		So(info.Val, ShouldBeNil)
+
+		_, err = NewMyKVCoderBuilder().Build().Decode("")
+		So(err, ShouldNotBeNil)
+	})
+}
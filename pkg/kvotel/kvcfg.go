@@ -0,0 +1,25 @@
+package kvotel
+
+import (
+	"github.com/hatlonely/kvclient/pkg/kvcfg"
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/spf13/viper"
+)
+
+// the OpenTelemetry tracing of kvcfg, import this package for side effects to use the
+// tracing section of a kvclient config
+//
+//	import _ "github.com/hatlonely/kvclient/pkg/kvotel"
+func init() {
+	kvcfg.RegisterTracingHook(func(config *viper.Viper) (kvclient.Hook, error) {
+		// {
+		//     "name": "github.com/hatlonely/kvclient",
+		//     "maxKeys": 10
+		// }
+		builder := NewTracingHookBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build(), nil
+	})
+}
@@ -0,0 +1,27 @@
+package kvotel
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hatlonely/kvclient/pkg/kvcfg"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+func TestNewKVClient(t *testing.T) {
+	Convey("test the tracing registered to kvcfg", t, func() {
+		config := viper.New()
+		config.SetConfigType("json")
+		So(config.ReadConfig(strings.NewReader(`{
+			"caches": ["local"],
+			"compressor": {"package": "mykv", "class": "Compressor"},
+			"serializer": {"package": "mykv", "class": "Serializer"},
+			"local": {"class": "MapCache"},
+			"tracing": {"name": "kvotel", "maxKeys": 10}
+		}`)), ShouldBeNil)
+		client, err := kvcfg.NewKVClient(config)
+		So(err, ShouldBeNil)
+		So(client.Close(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,111 @@
+package kvotel
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracingHookBuilder create a new TracingHook builder
+func NewTracingHookBuilder() *TracingHookBuilder {
+	return &TracingHookBuilder{
+		Name:    "github.com/hatlonely/kvclient",
+		MaxKeys: 10,
+	}
+}
+
+// TracingHookBuilder builder
+type TracingHookBuilder struct {
+	Name    string // name of the tracer
+	MaxKeys int    // max keys recorded in a span, 0 records no keys
+
+	provider trace.TracerProvider
+}
+
+// WithName option
+func (b *TracingHookBuilder) WithName(name string) *TracingHookBuilder {
+	b.Name = name
+	return b
+}
+
+// WithMaxKeys option
+func (b *TracingHookBuilder) WithMaxKeys(maxKeys int) *TracingHookBuilder {
+	b.MaxKeys = maxKeys
+	return b
+}
+
+// WithTracerProvider option, otel.GetTracerProvider() by default
+func (b *TracingHookBuilder) WithTracerProvider(provider trace.TracerProvider) *TracingHookBuilder {
+	b.provider = provider
+	return b
+}
+
+// Build a new TracingHook
+func (b *TracingHookBuilder) Build() *TracingHook {
+	provider := b.provider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &TracingHook{
+		tracer:  provider.Tracer(b.Name),
+		maxKeys: b.MaxKeys,
+	}
+}
+
+// TracingHook a kvclient.Hook creates a span for each operation of the client, named
+// like "kvclient.Get", with a child span for each call to a cache tier, named like
+// "kvclient.cache.Get". KVClient takes no context, so operation spans are root spans
+type TracingHook struct {
+	tracer  trace.Tracer
+	maxKeys int
+}
+
+// Before start a span
+func (h *TracingHook) Before(ctx context.Context, event *kvclient.HookEvent) context.Context {
+	name := "kvclient." + event.Operation.String()
+	kind := trace.SpanKindInternal
+	attrs := []attribute.KeyValue{
+		attribute.String("kvclient.operation", event.Operation.String()),
+		attribute.Int("kvclient.keys.count", len(event.Keys)),
+	}
+	if event.Tier >= 0 {
+		name = "kvclient.cache." + event.Operation.String()
+		kind = trace.SpanKindClient
+		attrs = append(attrs,
+			attribute.String("kvclient.cache.tier", strconv.Itoa(event.Tier)),
+			attribute.String("kvclient.cache.class", event.Cache.Class),
+			attribute.String("kvclient.cache.name", event.Cache.Name),
+			attribute.Bool("kvclient.cache.backfill", event.Backfill),
+		)
+	}
+	if h.maxKeys > 0 && len(event.Keys) > 0 {
+		keys := event.Keys
+		if len(keys) > h.maxKeys {
+			keys = keys[:h.maxKeys]
+		}
+		attrs = append(attrs, attribute.StringSlice("kvclient.keys", keys))
+	}
+
+	ctx, _ = h.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...), trace.WithTimestamp(event.Start))
+	return ctx
+}
+
+// After end the span
+func (h *TracingHook) After(ctx context.Context, event *kvclient.HookEvent) {
+	span := trace.SpanFromContext(ctx)
+	if event.Operation == kvclient.CapGet {
+		span.SetAttributes(attribute.Bool("kvclient.hit", event.OK))
+	} else if event.Operation == kvclient.CapSetNx || event.Operation == kvclient.CapSetExNx {
+		span.SetAttributes(attribute.Bool("kvclient.set", event.OK))
+	}
+	if event.Err != nil {
+		span.RecordError(event.Err)
+		span.SetStatus(codes.Error, event.Err.Error())
+	}
+	span.End(trace.WithTimestamp(event.Start.Add(event.Latency)))
+}
@@ -0,0 +1,99 @@
+package kvotel
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingHook(t *testing.T) {
+	Convey("test tracing hook", t, func() {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		hook := NewTracingHookBuilder().WithTracerProvider(provider).Build()
+
+		local := kvclient.NewMapCacheBuilder().Build()
+		remote := kvclient.NewMapCacheBuilder().Build()
+		client, err := kvclient.NewBuilder().
+			WithCaches([]kvclient.Cache{local, remote}).
+			WithCompressor(&compressor{}).
+			WithSerializer(&serializer{}).
+			WithHooks(hook).
+			Build()
+		So(err, ShouldBeNil)
+		So(remote.Set("key1", []byte("val1")), ShouldBeNil)
+
+		var val string
+		ok, err := client.Get("key1", &val)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+
+		spans := recorder.Ended()
+		So(len(spans), ShouldEqual, 4)
+		names := make([]string, len(spans))
+		for i, span := range spans {
+			names[i] = span.Name()
+		}
+		So(names, ShouldResemble, []string{"kvclient.cache.Get", "kvclient.cache.Get", "kvclient.cache.Set", "kvclient.Get"})
+		root := spans[3]
+		for _, span := range spans[:3] {
+			So(span.Parent().SpanID(), ShouldEqual, root.SpanContext().SpanID())
+			So(span.SpanContext().TraceID(), ShouldEqual, root.SpanContext().TraceID())
+		}
+		So(attr(spans[1], "kvclient.cache.tier"), ShouldEqual, "1")
+		So(attr(spans[1], "kvclient.cache.class"), ShouldEqual, "MapCache")
+		So(attr(spans[2], "kvclient.cache.backfill"), ShouldEqual, "true")
+		So(attr(root, "kvclient.hit"), ShouldEqual, "true")
+
+		Convey("errors are recorded", func() {
+			faulty, err := kvclient.NewFaultyCacheBuilder().
+				WithDefault(kvclient.Fault{ErrorRate: 1}).
+				WithCache(kvclient.NewMapCacheBuilder().Build()).
+				Build()
+			So(err, ShouldBeNil)
+			client, err := kvclient.NewBuilder().
+				WithCaches([]kvclient.Cache{faulty}).
+				WithCompressor(&compressor{}).
+				WithSerializer(&serializer{}).
+				WithHooks(hook).
+				Build()
+			So(err, ShouldBeNil)
+			So(client.Set("key2", "val2"), ShouldNotBeNil)
+
+			spans := recorder.Ended()
+			So(spans[len(spans)-1].Status().Code, ShouldEqual, codes.Error)
+			So(spans[len(spans)-2].Status().Code, ShouldEqual, codes.Error)
+		})
+	})
+}
+
+func attr(span sdktrace.ReadOnlySpan, key string) string {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return fmt.Sprintf("%v", kv.Value.Emit())
+		}
+	}
+	return ""
+}
+
+type compressor struct{}
+
+func (compressor) Compress(key interface{}) string {
+	return key.(string)
+}
+
+type serializer struct{}
+
+func (serializer) Marshal(val interface{}) ([]byte, error) {
+	return []byte(val.(string)), nil
+}
+
+func (serializer) Unmarshal(buf []byte, val interface{}) error {
+	*(val.(*string)) = string(buf)
+	return nil
+}
@@ -0,0 +1,27 @@
+package kvprom
+
+import (
+	"github.com/hatlonely/kvclient/pkg/kvcfg"
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/spf13/viper"
+)
+
+// the Prometheus metrics sink of kvcfg, import this package for side effects to use it
+// in the metrics section of a kvclient config
+//
+//	import _ "github.com/hatlonely/kvclient/pkg/kvprom"
+func init() {
+	kvcfg.RegisterMetricsSink("Prometheus", func(config *viper.Viper) (kvclient.MetricsSink, error) {
+		// {
+		//     "class": "Prometheus",
+		//     "buckets": {
+		//         "kvclient_cache_request_duration_seconds": [0.0005, 0.001, 0.005, 0.01, 0.05]
+		//     }
+		// }
+		builder := NewPrometheusSinkBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build(), nil
+	})
+}
@@ -0,0 +1,23 @@
+package kvprom
+
+import (
+	"testing"
+
+	"github.com/hatlonely/kvclient/pkg/kvcfg"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+func TestNewMetricsSink(t *testing.T) {
+	Convey("test the Prometheus sink registered to kvcfg", t, func() {
+		config := viper.New()
+		config.Set("class", "Prometheus")
+		sink, err := kvcfg.NewMetricsSink(config)
+		So(err, ShouldBeNil)
+		So(sink, ShouldHaveSameTypeAs, &PrometheusSink{})
+
+		config.Set("class", "Unknown")
+		_, err = kvcfg.NewMetricsSink(config)
+		So(err, ShouldNotBeNil)
+	})
+}
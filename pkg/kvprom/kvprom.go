@@ -0,0 +1,157 @@
+package kvprom
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NewPrometheusSinkBuilder create a new PrometheusSink builder
+func NewPrometheusSinkBuilder() *PrometheusSinkBuilder {
+	return &PrometheusSinkBuilder{
+		Buckets: map[string][]float64{
+			kvclient.MetricCacheDuration:  {.0001, .0002, .0005, .001, .002, .005, .01, .02, .05, .1, .2, .5, 1},
+			kvclient.MetricCacheValueSize: prometheus.ExponentialBuckets(16, 4, 10),
+		},
+		registerer: prometheus.DefaultRegisterer,
+	}
+}
+
+// PrometheusSinkBuilder builder
+type PrometheusSinkBuilder struct {
+	Buckets map[string][]float64 // histogram buckets by metric name, prometheus.DefBuckets for others
+
+	registerer prometheus.Registerer
+}
+
+// WithBuckets option
+func (b *PrometheusSinkBuilder) WithBuckets(name string, buckets []float64) *PrometheusSinkBuilder {
+	b.Buckets[name] = buckets
+	return b
+}
+
+// WithRegisterer option, prometheus.DefaultRegisterer by default
+func (b *PrometheusSinkBuilder) WithRegisterer(registerer prometheus.Registerer) *PrometheusSinkBuilder {
+	b.registerer = registerer
+	return b
+}
+
+// Build a new PrometheusSink
+func (b *PrometheusSinkBuilder) Build() *PrometheusSink {
+	return &PrometheusSink{
+		buckets:    b.Buckets,
+		registerer: b.registerer,
+		counters:   map[string]*prometheus.CounterVec{},
+		histograms: map[string]*prometheus.HistogramVec{},
+	}
+}
+
+// PrometheusSink a kvclient.MetricsSink of prometheus. metrics are registered when first
+// recorded, metrics already registered with the same name and labels are shared, so
+// clients in the same process can use their own sinks
+type PrometheusSink struct {
+	buckets    map[string][]float64
+	registerer prometheus.Registerer
+
+	mutex      sync.Mutex
+	counters   map[string]*prometheus.CounterVec
+	histograms map[string]*prometheus.HistogramVec
+}
+
+// Count add delta to a counter
+func (s *PrometheusSink) Count(name string, labels map[string]string, delta float64) {
+	counter, err := s.counter(name, labels)
+	if err != nil {
+		return
+	}
+	counter.With(labels).Add(delta)
+}
+
+// Observe add an observation to a histogram
+func (s *PrometheusSink) Observe(name string, labels map[string]string, value float64) {
+	histogram, err := s.histogram(name, labels)
+	if err != nil {
+		return
+	}
+	histogram.With(labels).Observe(value)
+}
+
+func (s *PrometheusSink) counter(name string, labels map[string]string) (*prometheus.CounterVec, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if counter, ok := s.counters[name]; ok {
+		return counter, nil
+	}
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: name,
+		Help: help(name),
+	}, labelNames(labels))
+	if err := s.registerer.Register(counter); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		if counter, ok = are.ExistingCollector.(*prometheus.CounterVec); !ok {
+			return nil, err
+		}
+	}
+	s.counters[name] = counter
+	return counter, nil
+}
+
+func (s *PrometheusSink) histogram(name string, labels map[string]string) (*prometheus.HistogramVec, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if histogram, ok := s.histograms[name]; ok {
+		return histogram, nil
+	}
+
+	buckets, ok := s.buckets[name]
+	if !ok {
+		buckets = prometheus.DefBuckets
+	}
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    name,
+		Help:    help(name),
+		Buckets: buckets,
+	}, labelNames(labels))
+	if err := s.registerer.Register(histogram); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		if histogram, ok = are.ExistingCollector.(*prometheus.HistogramVec); !ok {
+			return nil, err
+		}
+	}
+	s.histograms[name] = histogram
+	return histogram, nil
+}
+
+func labelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var helps = map[string]string{
+	kvclient.MetricCacheRequests:  "requests of each cache tier by operation and result",
+	kvclient.MetricCacheDuration:  "latency of each cache tier by operation in seconds",
+	kvclient.MetricCacheValueSize: "sizes of values read and written by each cache tier",
+	kvclient.MetricBackfills:      "keys set into a cache tier after found in a later tier",
+}
+
+func help(name string) string {
+	if h, ok := helps[name]; ok {
+		return h
+	}
+	return fmt.Sprintf("kvclient metric %v", strings.TrimPrefix(name, "kvclient_"))
+}
@@ -0,0 +1,61 @@
+package kvprom
+
+import (
+	"testing"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrometheusSink(t *testing.T) {
+	Convey("test prometheus sink", t, func() {
+		registry := prometheus.NewRegistry()
+		sink := NewPrometheusSinkBuilder().WithRegisterer(registry).Build()
+		client, err := kvclient.NewBuilder().
+			WithCaches([]kvclient.Cache{kvclient.NewMapCacheBuilder().Build()}).
+			WithMetricsSink(sink).
+			Build()
+		So(err, ShouldBeNil)
+		client.SetCompressor(&compressor{})
+		client.SetSerializer(&serializer{})
+
+		So(client.Set("key1", "val1"), ShouldBeNil)
+		var val string
+		client.Get("key1", &val)
+		client.Get("key2", &val)
+
+		labels := prometheus.Labels{"tier": "0", "class": "MapCache", "name": "cache0", "op": "Get"}
+		requests := sink.counters[kvclient.MetricCacheRequests]
+		labels["result"] = "hit"
+		So(testutil.ToFloat64(requests.With(labels)), ShouldEqual, 1)
+		labels["result"] = "miss"
+		So(testutil.ToFloat64(requests.With(labels)), ShouldEqual, 1)
+		So(testutil.CollectAndCount(registry, kvclient.MetricCacheDuration), ShouldEqual, 2)
+
+		Convey("sinks share registered metrics", func() {
+			other := NewPrometheusSinkBuilder().WithRegisterer(registry).Build()
+			other.Count(kvclient.MetricCacheRequests, map[string]string{"tier": "0", "class": "MapCache", "name": "cache0", "op": "Get", "result": "hit"}, 1)
+			labels["result"] = "hit"
+			So(testutil.ToFloat64(requests.With(labels)), ShouldEqual, 2)
+		})
+	})
+}
+
+type compressor struct{}
+
+func (compressor) Compress(key interface{}) string {
+	return key.(string)
+}
+
+type serializer struct{}
+
+func (serializer) Marshal(val interface{}) ([]byte, error) {
+	return []byte(val.(string)), nil
+}
+
+func (serializer) Unmarshal(buf []byte, val interface{}) error {
+	*(val.(*string)) = string(buf)
+	return nil
+}
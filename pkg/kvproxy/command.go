@@ -0,0 +1,297 @@
+package kvproxy
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvresp"
+)
+
+// execute a command and write the reply, return true if the connection should be closed
+func (s *Server) execute(w *kvresp.Writer, args [][]byte) bool {
+	var err error
+	switch strings.ToUpper(string(args[0])) {
+	case "GET":
+		err = s.get(w, args)
+	case "SET":
+		err = s.set(w, args)
+	case "DEL":
+		err = s.del(w, args)
+	case "MGET":
+		err = s.mget(w, args)
+	case "MSET":
+		err = s.mset(w, args)
+	case "PING":
+		if len(args) > 2 {
+			err = errWrongArgs(args[0])
+		} else if len(args) == 2 {
+			w.WriteBulk(args[1])
+		} else {
+			w.WriteSimpleString("PONG")
+		}
+	case "INFO":
+		w.WriteBulk(s.info())
+	case "COMMAND":
+		// redis-cli asks for the commands on connect
+		w.WriteArrayHeader(0)
+	case "QUIT":
+		w.WriteSimpleString("OK")
+		return true
+	default:
+		err = fmt.Errorf("ERR unknown command '%s'", args[0])
+	}
+	if err != nil {
+		atomic.AddInt64(&s.stats.errors, 1)
+		// errors of the caches are prefixed as generic errors
+		msg := err.Error()
+		if !strings.HasPrefix(msg, "ERR ") {
+			msg = "ERR " + msg
+		}
+		w.WriteError(strings.Replace(msg, "\r\n", " ", -1))
+	}
+	return false
+}
+
+func errWrongArgs(cmd []byte) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", bytes.ToLower(cmd))
+}
+
+// GET key
+func (s *Server) get(w *kvresp.Writer, args [][]byte) error {
+	if len(args) != 2 {
+		return errWrongArgs(args[0])
+	}
+	var val []byte
+	ok, err := s.kvclient.Get(string(args[1]), &val)
+	if err != nil {
+		return err
+	}
+	s.hit(ok)
+	if !ok {
+		w.WriteNull()
+		return nil
+	}
+	w.WriteBulk(val)
+	return nil
+}
+
+// SET key value [EX seconds|PX milliseconds] [NX]
+func (s *Server) set(w *kvresp.Writer, args [][]byte) error {
+	if len(args) < 3 {
+		return errWrongArgs(args[0])
+	}
+	key, val := string(args[1]), args[2]
+	var expiration time.Duration
+	nx := false
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX":
+			nx = true
+		case "EX", "PX":
+			if i+1 >= len(args) || expiration != 0 {
+				return fmt.Errorf("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			expiration = time.Duration(n) * unit
+			i++
+		default:
+			return fmt.Errorf("ERR syntax error")
+		}
+	}
+
+	var err error
+	ok := true
+	switch {
+	case nx && expiration > 0:
+		ok, err = s.kvclient.SetExNx(key, val, expiration)
+	case nx:
+		ok, err = s.kvclient.SetNx(key, val)
+	case expiration > 0:
+		err = s.kvclient.SetEx(key, val, expiration)
+	default:
+		err = s.kvclient.Set(key, val)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		w.WriteNull()
+		return nil
+	}
+	w.WriteSimpleString("OK")
+	return nil
+}
+
+// DEL key [key ...], reply the number of keys existed. the caches do not tell whether
+// a deleted key existed, the tiers are read before it is deleted until one holds the key,
+// without backfilling the upper tiers
+func (s *Server) del(w *kvresp.Writer, args [][]byte) error {
+	if len(args) < 2 {
+		return errWrongArgs(args[0])
+	}
+	var n int64
+	for _, key := range args[1:] {
+		ok, err := s.exists(string(key))
+		if err != nil {
+			return err
+		}
+		if err := s.kvclient.Del(string(key)); err != nil {
+			return err
+		}
+		if ok {
+			n++
+		}
+	}
+	w.WriteInteger(n)
+	return nil
+}
+
+// exists whether a tier holds the key, an empty value is the nil value backfilled for a miss
+func (s *Server) exists(key string) (bool, error) {
+	for _, cache := range s.kvclient.Caches() {
+		val, err := cache.Get(key)
+		if err != nil {
+			return false, err
+		}
+		if len(val) != 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MGET key [key ...], GetBatch if the client supports it, otherwise Get one by one
+func (s *Server) mget(w *kvresp.Writer, args [][]byte) error {
+	if len(args) < 2 {
+		return errWrongArgs(args[0])
+	}
+	n := len(args) - 1
+	bufs := make([][]byte, n)
+	oks := make([]bool, n)
+	if s.kvclient.Capabilities().Has(kvclient.CapGetBatch) {
+		keys := make([]interface{}, n)
+		vals := make([]interface{}, n)
+		for i := range keys {
+			keys[i] = string(args[i+1])
+			vals[i] = &bufs[i]
+		}
+		var err error
+		var errs []error
+		if oks, errs, err = s.kvclient.GetBatch(keys, vals); err != nil && errs == nil {
+			return err
+		}
+		// a key failed is replied as not found, like a key of another type in redis
+		for i := range errs {
+			if errs[i] != nil {
+				oks[i] = false
+			}
+		}
+	} else {
+		for i := range bufs {
+			ok, err := s.kvclient.Get(string(args[i+1]), &bufs[i])
+			if err != nil {
+				return err
+			}
+			oks[i] = ok
+		}
+	}
+
+	w.WriteArrayHeader(n)
+	for i := range bufs {
+		s.hit(oks[i])
+		if !oks[i] {
+			w.WriteNull()
+			continue
+		}
+		w.WriteBulk(bufs[i])
+	}
+	return nil
+}
+
+// MSET key value [key value ...], SetBatch if the client supports it, otherwise Set one by one
+func (s *Server) mset(w *kvresp.Writer, args [][]byte) error {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return errWrongArgs(args[0])
+	}
+	n := (len(args) - 1) / 2
+	if s.kvclient.Capabilities().Has(kvclient.CapSetBatch) {
+		keys := make([]interface{}, n)
+		vals := make([]interface{}, n)
+		for i := 0; i < n; i++ {
+			keys[i] = string(args[2*i+1])
+			vals[i] = args[2*i+2]
+		}
+		errs, err := s.kvclient.SetBatch(keys, vals)
+		if err != nil {
+			return err
+		}
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		for i := 0; i < n; i++ {
+			if err := s.kvclient.Set(string(args[2*i+1]), args[2*i+2]); err != nil {
+				return err
+			}
+		}
+	}
+	w.WriteSimpleString("OK")
+	return nil
+}
+
+func (s *Server) hit(ok bool) {
+	if ok {
+		atomic.AddInt64(&s.stats.hits, 1)
+	} else {
+		atomic.AddInt64(&s.stats.misses, 1)
+	}
+}
+
+// info sections of server, clients, stats and the hit rates of the tiers
+func (s *Server) info() []byte {
+	s.mutex.Lock()
+	conns := len(s.conns)
+	s.mutex.Unlock()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Server\r\n")
+	fmt.Fprintf(&buf, "go_version:%v\r\n", runtime.Version())
+	fmt.Fprintf(&buf, "tcp_port:%v\r\n", s.port())
+	fmt.Fprintf(&buf, "uptime_in_seconds:%v\r\n", int64(time.Since(s.start)/time.Second))
+	fmt.Fprintf(&buf, "\r\n# Clients\r\n")
+	fmt.Fprintf(&buf, "connected_clients:%v\r\n", conns)
+	fmt.Fprintf(&buf, "maxclients:%v\r\n", s.maxConns)
+	fmt.Fprintf(&buf, "\r\n# Stats\r\n")
+	fmt.Fprintf(&buf, "total_connections_received:%v\r\n", atomic.LoadInt64(&s.stats.connections))
+	fmt.Fprintf(&buf, "rejected_connections:%v\r\n", atomic.LoadInt64(&s.stats.rejected))
+	fmt.Fprintf(&buf, "total_commands_processed:%v\r\n", atomic.LoadInt64(&s.stats.commands))
+	fmt.Fprintf(&buf, "total_error_replies:%v\r\n", atomic.LoadInt64(&s.stats.errors))
+	fmt.Fprintf(&buf, "keyspace_hits:%v\r\n", atomic.LoadInt64(&s.stats.hits))
+	fmt.Fprintf(&buf, "keyspace_misses:%v\r\n", atomic.LoadInt64(&s.stats.misses))
+	fmt.Fprintf(&buf, "\r\n# Tiers\r\n")
+	for i, rate := range s.kvclient.CacheHitRate() {
+		fmt.Fprintf(&buf, "tier%v_hit_rate:%.4f\r\n", i, rate)
+	}
+	return buf.Bytes()
+}
+
+func (s *Server) port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
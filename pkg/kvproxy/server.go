@@ -0,0 +1,254 @@
+package kvproxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvresp"
+	"github.com/sirupsen/logrus"
+)
+
+// NewServerBuilder create a new ServerBuilder
+func NewServerBuilder() *ServerBuilder {
+	return &ServerBuilder{
+		Address:         ":6380",
+		MaxConns:        10000,
+		ShutdownTimeout: time.Duration(30) * time.Second,
+	}
+}
+
+// ServerBuilder builder
+type ServerBuilder struct {
+	Address         string
+	MaxConns        int           // connections over the limit are replied an error and closed, 0 means no limit
+	IdleTimeout     time.Duration // close connections idle for the time, 0 means never
+	ShutdownTimeout time.Duration // connections not finished in the time are closed forcibly by Close
+	Verbose         bool
+	kvclient        kvclient.KVClient
+}
+
+// WithAddress option
+func (b *ServerBuilder) WithAddress(address string) *ServerBuilder {
+	b.Address = address
+	return b
+}
+
+// WithMaxConns option
+func (b *ServerBuilder) WithMaxConns(maxConns int) *ServerBuilder {
+	b.MaxConns = maxConns
+	return b
+}
+
+// WithIdleTimeout option
+func (b *ServerBuilder) WithIdleTimeout(idleTimeout time.Duration) *ServerBuilder {
+	b.IdleTimeout = idleTimeout
+	return b
+}
+
+// WithShutdownTimeout option
+func (b *ServerBuilder) WithShutdownTimeout(shutdownTimeout time.Duration) *ServerBuilder {
+	b.ShutdownTimeout = shutdownTimeout
+	return b
+}
+
+// WithVerbose option
+func (b *ServerBuilder) WithVerbose(verbose bool) *ServerBuilder {
+	b.Verbose = verbose
+	return b
+}
+
+// WithKVClient option, keys and values of the client are set to raw bytes
+func (b *ServerBuilder) WithKVClient(kvclient kvclient.KVClient) *ServerBuilder {
+	b.kvclient = kvclient
+	return b
+}
+
+// Build a new Server, the address is listened on
+func (b *ServerBuilder) Build() (*Server, error) {
+	if b.kvclient == nil {
+		return nil, fmt.Errorf("no kvclient")
+	}
+	listener, err := net.Listen("tcp", b.Address)
+	if err != nil {
+		return nil, err
+	}
+	b.kvclient.SetCompressor(kvclient.BytesCompressor{})
+	b.kvclient.SetSerializer(kvclient.BytesSerializer{})
+	return &Server{
+		listener:        listener,
+		maxConns:        b.MaxConns,
+		idleTimeout:     b.IdleTimeout,
+		shutdownTimeout: b.ShutdownTimeout,
+		verbose:         b.Verbose,
+		kvclient:        b.kvclient,
+		conns:           map[net.Conn]struct{}{},
+		start:           time.Now(),
+	}, nil
+}
+
+// Server serve the redis RESP2 protocol in front of a KVClient, so that clients of
+// any language use the tiered caches as a redis. commands of a connection are
+// pipelined, replies are flushed when no more commands are buffered
+type Server struct {
+	listener        net.Listener
+	maxConns        int
+	idleTimeout     time.Duration
+	shutdownTimeout time.Duration
+	verbose         bool
+	kvclient        kvclient.KVClient
+	start           time.Time
+
+	mutex   sync.Mutex
+	conns   map[net.Conn]struct{}
+	closing int32
+	wg      sync.WaitGroup
+	stats   serverStats
+}
+
+type serverStats struct {
+	connections int64 // connections accepted
+	rejected    int64 // connections rejected by MaxConns
+	commands    int64
+	hits        int64 // GET and MGET keys found
+	misses      int64
+	errors      int64 // commands replied an error
+}
+
+// Addr address listened on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve accept connections until Shutdown, return nil after Shutdown
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if atomic.LoadInt32(&s.closing) == 1 {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		atomic.AddInt64(&s.stats.connections, 1)
+
+		s.mutex.Lock()
+		// accepted just before the listener closed
+		if atomic.LoadInt32(&s.closing) == 1 {
+			s.mutex.Unlock()
+			conn.Close()
+			return nil
+		}
+		if s.maxConns > 0 && len(s.conns) >= s.maxConns {
+			s.mutex.Unlock()
+			atomic.AddInt64(&s.stats.rejected, 1)
+			conn.Write([]byte("-ERR max number of clients reached\r\n"))
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mutex.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown stop accepting, let the connections finish the commands received and close
+// them, connections not finished in timeout are closed forcibly
+func (s *Server) Shutdown(timeout time.Duration) error {
+	if !atomic.CompareAndSwapInt32(&s.closing, 0, 1) {
+		return nil
+	}
+	err := s.listener.Close()
+
+	// wake up the connections waiting for commands, the commands buffered are still served
+	s.mutex.Lock()
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		s.mutex.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mutex.Unlock()
+		<-done
+	}
+	return err
+}
+
+// Close shutdown with ShutdownTimeout and close the kvclient
+func (s *Server) Close() error {
+	err := s.Shutdown(s.shutdownTimeout)
+	if cerr := s.kvclient.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		s.wg.Done()
+	}()
+
+	reader := kvresp.NewReader(conn)
+	writer := kvresp.NewWriter(conn)
+	for {
+		// the deadline is set before checking closing, so that Shutdown never misses a connection
+		if s.idleTimeout > 0 && reader.Buffered() == 0 {
+			conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		}
+		if atomic.LoadInt32(&s.closing) == 1 && reader.Buffered() == 0 {
+			writer.Flush()
+			return
+		}
+
+		args, err := reader.ReadCommand()
+		if err != nil {
+			writer.Flush()
+			if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+				if s.verbose && err != io.EOF {
+					logrus.WithFields(logrus.Fields{"error": err, "remote": conn.RemoteAddr().String(), "type": "kvproxy"}).Warn()
+				}
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		atomic.AddInt64(&s.stats.commands, 1)
+		quit := s.execute(writer, args)
+
+		if reader.Buffered() == 0 || quit {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
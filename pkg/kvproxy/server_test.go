@@ -0,0 +1,115 @@
+package kvproxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestServer(maxConns int) (*Server, chan error) {
+	local := kvclient.NewMapCacheBuilder().Build()
+	remote := kvclient.NewMapCacheBuilder().Build()
+	client, err := kvclient.NewBuilder().WithCaches([]kvclient.Cache{local, remote}).Build()
+	So(err, ShouldBeNil)
+	server, err := NewServerBuilder().WithAddress("127.0.0.1:0").WithMaxConns(maxConns).WithKVClient(client).Build()
+	So(err, ShouldBeNil)
+	done := make(chan error, 1)
+	go func() { done <- server.Serve() }()
+	return server, done
+}
+
+func TestServer(t *testing.T) {
+	Convey("test kvproxy server", t, func() {
+		server, done := newTestServer(0)
+		defer server.Shutdown(time.Second)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr().String()})
+		defer client.Close()
+
+		Convey("commands", func() {
+			So(client.Ping().Val(), ShouldEqual, "PONG")
+			So(client.Set("key1", "val1", 0).Err(), ShouldBeNil)
+			So(client.Get("key1").Val(), ShouldEqual, "val1")
+			So(client.Get("key2").Err(), ShouldEqual, redis.Nil)
+
+			ok, err := client.SetNX("key1", "val2", time.Minute).Result()
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			ok, err = client.SetNX("key2", "val2", time.Minute).Result()
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+
+			So(client.Set("key3", "val3", 100*time.Millisecond).Err(), ShouldBeNil)
+			time.Sleep(200 * time.Millisecond)
+			So(client.Get("key3").Err(), ShouldEqual, redis.Nil)
+
+			So(client.Del("key1", "key3").Val(), ShouldEqual, 1)
+			So(client.MSet("key4", "val4", "key5", "val5").Err(), ShouldBeNil)
+			So(client.MGet("key4", "key1", "key5").Val(), ShouldResemble, []interface{}{"val4", nil, "val5"})
+			So(client.Del("key4", "key5", "key6").Val(), ShouldEqual, 2)
+			// only the lower tier holds the key
+			So(server.kvclient.Caches()[1].Set("key7", []byte("val7")), ShouldBeNil)
+			So(client.Del("key7").Val(), ShouldEqual, 1)
+			So(client.Get("key7").Err(), ShouldEqual, redis.Nil)
+
+			So(client.Do("SET", "key1").Err(), ShouldNotBeNil)
+			So(client.Do("SET", "key1", "val1", "EX", "abc").Err(), ShouldNotBeNil)
+			So(client.Do("HGET", "key1", "field1").Err().Error(), ShouldStartWith, "ERR unknown command")
+
+			info := client.Info().Val()
+			So(info, ShouldContainSubstring, "connected_clients:1")
+			So(info, ShouldContainSubstring, "tier0_hit_rate:")
+			So(info, ShouldContainSubstring, "tier1_hit_rate:")
+		})
+
+		Convey("pipelining", func() {
+			pipe := client.Pipeline()
+			for i := 0; i < 100; i++ {
+				pipe.Set(fmt.Sprintf("key%v", i), fmt.Sprintf("val%v", i), 0)
+			}
+			var gets []*redis.StringCmd
+			for i := 0; i < 100; i++ {
+				gets = append(gets, pipe.Get(fmt.Sprintf("key%v", i)))
+			}
+			_, err := pipe.Exec()
+			So(err, ShouldBeNil)
+			for i, get := range gets {
+				So(get.Val(), ShouldEqual, fmt.Sprintf("val%v", i))
+			}
+		})
+
+		Convey("graceful shutdown", func() {
+			So(client.Ping().Err(), ShouldBeNil)
+			So(server.Shutdown(time.Second), ShouldBeNil)
+			So(<-done, ShouldBeNil)
+			So(client.Ping().Err(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestServer_MaxConns(t *testing.T) {
+	Convey("connections over the limit are rejected", t, func() {
+		server, _ := newTestServer(1)
+		defer server.Shutdown(time.Second)
+
+		conn1, err := net.Dial("tcp", server.Addr().String())
+		So(err, ShouldBeNil)
+		defer conn1.Close()
+		conn1.Write([]byte("PING\r\n"))
+		line, err := bufio.NewReader(conn1).ReadString('\n')
+		So(err, ShouldBeNil)
+		So(line, ShouldEqual, "+PONG\r\n")
+
+		conn2, err := net.Dial("tcp", server.Addr().String())
+		So(err, ShouldBeNil)
+		defer conn2.Close()
+		line, err = bufio.NewReader(conn2).ReadString('\n')
+		So(err, ShouldBeNil)
+		So(line, ShouldEqual, "-ERR max number of clients reached\r\n")
+	})
+}
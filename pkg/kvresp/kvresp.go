@@ -0,0 +1,271 @@
+package kvresp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Error a redis error reply
+type Error string
+
+// Error message
+func (e Error) Error() string {
+	return string(e)
+}
+
+// SimpleString a redis simple string reply, such as "OK"
+type SimpleString string
+
+// NewReader create a new Reader
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Reader read RESP2 values
+type Reader struct {
+	r *bufio.Reader
+}
+
+// Buffered number of bytes which can be read without blocking
+func (r *Reader) Buffered() int {
+	return r.r.Buffered()
+}
+
+// ReadValue read a value. the go type is
+// SimpleString for "+", Error for "-", int64 for ":", []byte for "$",
+// []interface{} for "*", and nil for null bulk or null array
+func (r *Reader) ReadValue() (interface{}, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("empty line")
+	}
+
+	switch line[0] {
+	case '+':
+		return SimpleString(line[1:]), nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		vals := make([]interface{}, n)
+		for i := range vals {
+			if vals[i], err = r.ReadValue(); err != nil {
+				return nil, err
+			}
+		}
+		return vals, nil
+	}
+
+	return nil, fmt.Errorf("unknown reply type [%c]", line[0])
+}
+
+// ReadCommand read a command sent by a client, an array of bulk strings or an inline command
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		var args [][]byte
+		for _, field := range splitInline(line) {
+			args = append(args, field)
+		}
+		return args, nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid multibulk length [%s]", line[1:])
+	}
+	args := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		val, err := r.ReadValue()
+		if err != nil {
+			return nil, err
+		}
+		buf, ok := val.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("expect bulk string, got [%v]", val)
+		}
+		args = append(args, buf)
+	}
+
+	return args, nil
+}
+
+// readLine read a line without "\r\n"
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		buf := append([]byte{}, line...)
+		for err == bufio.ErrBufferFull {
+			line, err = r.r.ReadSlice('\n')
+			buf = append(buf, line...)
+		}
+		line = buf
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("line not end with CRLF")
+	}
+	return line[:len(line)-2], nil
+}
+
+func splitInline(line []byte) [][]byte {
+	var fields [][]byte
+	start := -1
+	for i, c := range line {
+		if c == ' ' || c == '\t' {
+			if start >= 0 {
+				fields = append(fields, append([]byte{}, line[start:i]...))
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, append([]byte{}, line[start:]...))
+	}
+	return fields
+}
+
+// NewWriter create a new Writer
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Writer write RESP2 values, call Flush to send them
+type Writer struct {
+	w *bufio.Writer
+}
+
+// Flush buffered values
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// WriteCommand write a command as an array of bulk strings
+func (w *Writer) WriteCommand(args ...string) error {
+	w.WriteArrayHeader(len(args))
+	for _, arg := range args {
+		w.WriteBulk([]byte(arg))
+	}
+	return nil
+}
+
+// WriteSimpleString write "+s"
+func (w *Writer) WriteSimpleString(s string) {
+	w.w.WriteString("+")
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+// WriteError write "-msg"
+func (w *Writer) WriteError(msg string) {
+	w.w.WriteString("-")
+	w.w.WriteString(msg)
+	w.w.WriteString("\r\n")
+}
+
+// WriteInteger write ":n"
+func (w *Writer) WriteInteger(n int64) {
+	w.w.WriteString(":")
+	w.w.WriteString(strconv.FormatInt(n, 10))
+	w.w.WriteString("\r\n")
+}
+
+// WriteBulk write a bulk string, nil is written as null bulk
+func (w *Writer) WriteBulk(buf []byte) {
+	if buf == nil {
+		w.WriteNull()
+		return
+	}
+	w.w.WriteString("$")
+	w.w.WriteString(strconv.Itoa(len(buf)))
+	w.w.WriteString("\r\n")
+	w.w.Write(buf)
+	w.w.WriteString("\r\n")
+}
+
+// WriteNull write a null bulk string
+func (w *Writer) WriteNull() {
+	w.w.WriteString("$-1\r\n")
+}
+
+// WriteNullArray write a null array
+func (w *Writer) WriteNullArray() {
+	w.w.WriteString("*-1\r\n")
+}
+
+// WriteArrayHeader write "*n", followed by n values
+func (w *Writer) WriteArrayHeader(n int) {
+	w.w.WriteString("*")
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
+
+// WriteValue write a value of the go types returned by Reader.ReadValue,
+// string is written as bulk string and int as integer
+func (w *Writer) WriteValue(val interface{}) error {
+	switch v := val.(type) {
+	case nil:
+		w.WriteNull()
+	case SimpleString:
+		w.WriteSimpleString(string(v))
+	case Error:
+		w.WriteError(string(v))
+	case int64:
+		w.WriteInteger(v)
+	case int:
+		w.WriteInteger(int64(v))
+	case []byte:
+		w.WriteBulk(v)
+	case string:
+		w.WriteBulk([]byte(v))
+	case []interface{}:
+		w.WriteArrayHeader(len(v))
+		for _, e := range v {
+			if err := w.WriteValue(e); err != nil {
+				return err
+			}
+		}
+	case [][]byte:
+		w.WriteArrayHeader(len(v))
+		for _, e := range v {
+			w.WriteBulk(e)
+		}
+	default:
+		return fmt.Errorf("unsupported value type %T", val)
+	}
+	return nil
+}
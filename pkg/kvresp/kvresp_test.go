@@ -0,0 +1,47 @@
+package kvresp
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKVResp(t *testing.T) {
+	Convey("test resp", t, func() {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+
+		Convey("values round trip", func() {
+			So(w.WriteValue([]interface{}{
+				SimpleString("OK"), Error("ERR wrong"), int64(-3), []byte("a\r\nb"), nil, []interface{}{[]byte("x")},
+			}), ShouldBeNil)
+			w.WriteNullArray()
+			So(w.Flush(), ShouldBeNil)
+
+			r := NewReader(&buf)
+			val, err := r.ReadValue()
+			So(err, ShouldBeNil)
+			So(val, ShouldResemble, []interface{}{
+				SimpleString("OK"), Error("ERR wrong"), int64(-3), []byte("a\r\nb"), nil, []interface{}{[]byte("x")},
+			})
+			val, err = r.ReadValue()
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+		})
+
+		Convey("commands", func() {
+			So(w.WriteCommand("SET", "key", "val"), ShouldBeNil)
+			So(w.Flush(), ShouldBeNil)
+			buf.WriteString("PING  hello\r\n")
+
+			r := NewReader(&buf)
+			args, err := r.ReadCommand()
+			So(err, ShouldBeNil)
+			So(args, ShouldResemble, [][]byte{[]byte("SET"), []byte("key"), []byte("val")})
+			args, err = r.ReadCommand()
+			So(err, ShouldBeNil)
+			So(args, ShouldResemble, [][]byte{[]byte("PING"), []byte("hello")})
+		})
+	})
+}
@@ -0,0 +1,104 @@
+package kvserver
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative kvserver.proto
+
+// grpcService the service KVServer of kvserver.proto
+type grpcService struct {
+	UnimplementedKVServerServer
+
+	server *Server
+}
+
+// Get key of namespace
+func (g *grpcService) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	val, ok, err := g.server.get(req.Namespace, req.Key)
+	if err != nil {
+		return nil, g.server.grpcError(err)
+	}
+	return &GetResponse{Found: ok, Val: val}, nil
+}
+
+// GetBatch keys of namespace
+func (g *grpcService) GetBatch(ctx context.Context, req *GetBatchRequest) (*GetBatchResponse, error) {
+	vals, oks, err := g.server.getBatch(req.Namespace, req.Keys)
+	if err != nil {
+		return nil, g.server.grpcError(err)
+	}
+	res := &GetBatchResponse{Vals: make([]*GetResponse, len(vals))}
+	for i := range vals {
+		res.Vals[i] = &GetResponse{Found: oks[i]}
+		if oks[i] {
+			res.Vals[i].Val = vals[i]
+		}
+	}
+	return res, nil
+}
+
+// Set key val of namespace
+func (g *grpcService) Set(ctx context.Context, req *SetRequest) (*SetResponse, error) {
+	ok, err := g.server.set(req.Namespace, req.Key, req.Val, time.Duration(req.TtlMs)*time.Millisecond, req.Nx)
+	if err != nil {
+		return nil, g.server.grpcError(err)
+	}
+	return &SetResponse{Ok: ok}, nil
+}
+
+// Del key of namespace
+func (g *grpcService) Del(ctx context.Context, req *DelRequest) (*DelResponse, error) {
+	if err := g.server.del(req.Namespace, req.Key); err != nil {
+		return nil, g.server.grpcError(err)
+	}
+	return &DelResponse{}, nil
+}
+
+// grpcError status code by the type of err
+func (s *Server) grpcError(err error) error {
+	switch err.(type) {
+	case *errNoNamespace:
+		return status.Error(codes.NotFound, err.Error())
+	case *errInvalidArgument:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case *kvclient.ErrNotSupported:
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+	if s.verbose {
+		logrus.WithFields(logrus.Fields{"error": err, "type": "kvserver"}).Warn()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// grpcInterceptor record the metrics of the requests of KVServer
+func (s *Server) grpcInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	prefix := "/" + KVServer_ServiceDesc.ServiceName + "/"
+	if !strings.HasPrefix(info.FullMethod, prefix) {
+		// health checking
+		return handler(ctx, req)
+	}
+	start := time.Now()
+	res, err := handler(ctx, req)
+	var namespace string
+	switch r := req.(type) {
+	case *GetRequest:
+		namespace = r.Namespace
+	case *GetBatchRequest:
+		namespace = r.Namespace
+	case *SetRequest:
+		namespace = r.Namespace
+	case *DelRequest:
+		namespace = r.Namespace
+	}
+	s.observe("grpc", strings.TrimPrefix(info.FullMethod, prefix), namespace, status.Code(err).String(), start)
+	return res, err
+}
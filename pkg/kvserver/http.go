@@ -0,0 +1,208 @@
+package kvserver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+// BatchGetRequest body of POST /v1/batch/get
+type BatchGetRequest struct {
+	Namespace string   `json:"namespace"`
+	Keys      []string `json:"keys"`
+}
+
+// BatchGetResponse body of POST /v1/batch/get, vals are in the same order as keys,
+// null if not found, base64 encoded as []byte in json
+type BatchGetResponse struct {
+	Vals [][]byte `json:"vals"`
+}
+
+// ErrorResponse body of the requests failed
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// httpHandler routes
+//
+//	GET    /v1/{namespace}/{key}                 value as body, 404 if not found
+//	PUT    /v1/{namespace}/{key}?ttl=10s&nx=true value as body, 409 if nx and the key exists
+//	DELETE /v1/{namespace}/{key}
+//	POST   /v1/batch/get                         BatchGetRequest as body
+//	GET    /healthz                              200 if the process is alive
+//	GET    /readyz                               200 if serving, 503 after Shutdown
+//	GET    /metrics                              prometheus metrics
+func (s *Server) httpHandler(gatherer prometheus.Gatherer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !s.Ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/v1/batch/get", func(w http.ResponseWriter, r *http.Request) {
+		// a key named get of the namespace batch
+		if r.Method != http.MethodPost {
+			s.handleKey(w, r)
+			return
+		}
+		s.handleBatchGet(w, r)
+	})
+	mux.HandleFunc("/v1/", s.handleKey)
+	return mux
+}
+
+// statusWriter record the status code for metrics
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (s *Server) handleKey(rw http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	w := &statusWriter{ResponseWriter: rw, code: http.StatusOK}
+	// keys may contain '/'
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	idx := strings.Index(path, "/")
+	if idx <= 0 || idx == len(path)-1 {
+		writeError(w, http.StatusNotFound, "path should be /v1/{namespace}/{key}")
+		s.observe("http", r.Method, "", strconv.Itoa(w.code), start)
+		return
+	}
+	namespace, key := path[:idx], path[idx+1:]
+	defer func() {
+		s.observe("http", r.Method, namespace, strconv.Itoa(w.code), start)
+	}()
+
+	switch r.Method {
+	case http.MethodGet:
+		val, ok, err := s.get(namespace, key)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(val)
+	case http.MethodPut:
+		var ttl time.Duration
+		var nx bool
+		var err error
+		if v := r.URL.Query().Get("ttl"); v != "" {
+			if ttl, err = time.ParseDuration(v); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid ttl: "+err.Error())
+				return
+			}
+		}
+		if v := r.URL.Query().Get("nx"); v != "" {
+			if nx, err = strconv.ParseBool(v); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid nx: "+err.Error())
+				return
+			}
+		}
+		val, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodyBytes))
+		if err != nil {
+			writeError(w, bodyErrorCode(err), err.Error())
+			return
+		}
+		ok, err := s.set(namespace, key, val, ttl, nx)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusConflict, "key exists")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if err := s.del(namespace, key); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleBatchGet(rw http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	w := &statusWriter{ResponseWriter: rw, code: http.StatusOK}
+	var req BatchGetRequest
+	defer func() {
+		s.observe("http", "BatchGet", req.Namespace, strconv.Itoa(w.code), start)
+	}()
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBodyBytes)).Decode(&req); err != nil {
+		writeError(w, bodyErrorCode(err), "invalid body: "+err.Error())
+		return
+	}
+	vals, oks, err := s.getBatch(req.Namespace, req.Keys)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	for i := range vals {
+		if !oks[i] {
+			vals[i] = nil
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&BatchGetResponse{Vals: vals})
+}
+
+// writeError status code by the type of err
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch err.(type) {
+	case *errNoNamespace:
+		code = http.StatusNotFound
+	case *errInvalidArgument:
+		code = http.StatusBadRequest
+	case *kvclient.ErrNotSupported:
+		code = http.StatusNotImplemented
+	default:
+		if s.verbose {
+			logrus.WithFields(logrus.Fields{"error": err, "type": "kvserver"}).Warn()
+		}
+	}
+	writeError(w, code, err.Error())
+}
+
+// bodyErrorCode 413 if the body is larger than maxBodyBytes, otherwise 400. the error of
+// http.MaxBytesReader has no type to check before go1.19
+func bodyErrorCode(err error) int {
+	if strings.Contains(err.Error(), "request body too large") {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&ErrorResponse{Error: message})
+}
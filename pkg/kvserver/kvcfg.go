@@ -0,0 +1,100 @@
+package kvserver
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hatlonely/kvclient/pkg/kvcfg"
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// the RemoteCache of kvcfg, import this package for side effects to use it in a kvclient
+// config without the server
+//
+//	import _ "github.com/hatlonely/kvclient/pkg/kvserver"
+func init() {
+	kvcfg.RegisterCache("RemoteCache", func(config *viper.Viper) (kvclient.Cache, error) {
+		// a namespace of a kvserver over grpc
+		// {
+		//     "class": "RemoteCache",
+		//     "address": "127.0.0.1:8081",
+		//     "namespace": "user",
+		//     "timeout": "200ms",
+		//     "expiration": "24h",
+		//     "capabilities": ["Get", "GetBatch"]
+		// }
+		builder := NewRemoteCacheBuilder()
+		if err := config.Unmarshal(builder); err != nil {
+			return nil, err
+		}
+		return builder.Build()
+	})
+}
+
+// NewServerWithFile create a new kv server use config file
+func NewServerWithFile(filename string) (*Server, error) {
+	config := viper.New()
+	config.SetConfigType("json")
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.ReadConfig(fp); err != nil {
+		return nil, err
+	}
+
+	config.BindPFlags(pflag.CommandLine)
+	return NewServerWithConfig(config)
+}
+
+// NewServerWithConfig create a new kv server, the addresses are listened on. each namespace is
+// a kvclient configured in the section of its name
+func NewServerWithConfig(config *viper.Viper) (*Server, error) {
+	// {
+	// 	"httpAddress": ":8080",
+	// 	"grpcAddress": ":8081",
+	// 	"shutdownDelay": "5s",
+	// 	"shutdownTimeout": "30s",
+	// 	"maxBodyBytes": 4194304,
+	// 	"verbose": true,
+	// 	"namespaces": ["user"],
+	// 	"user": {
+	// 		"caches": ["freecache", "aerospike"],
+	// 		...
+	// 	}
+	// }
+	builder := NewServerBuilder()
+	if err := config.Unmarshal(builder); err != nil {
+		return nil, err
+	}
+
+	var clients []kvclient.KVClient
+	closeClients := func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}
+	for _, namespace := range config.GetStringSlice("namespaces") {
+		cf := config.Sub(namespace)
+		if cf == nil {
+			closeClients()
+			return nil, fmt.Errorf("no such namespace named [%v]", namespace)
+		}
+		client, err := kvcfg.NewKVClient(cf)
+		if err != nil {
+			closeClients()
+			return nil, err
+		}
+		clients = append(clients, client)
+		builder.WithKVClient(namespace, client)
+	}
+
+	server, err := builder.Build()
+	if err != nil {
+		closeClients()
+		return nil, err
+	}
+	return server, nil
+}
@@ -0,0 +1,55 @@
+package kvserver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hatlonely/kvclient/pkg/kvcfg"
+	"github.com/hatlonely/kvclient/pkg/mykv"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+func TestNewServerWithConfig(t *testing.T) {
+	Convey("test new kv server and a remote cache of it", t, func() {
+		config := viper.New()
+		config.SetConfigType("json")
+		So(config.ReadConfig(strings.NewReader(`{
+			"httpAddress": "127.0.0.1:0",
+			"grpcAddress": "127.0.0.1:0",
+			"namespaces": ["user"],
+			"user": {
+				"caches": ["local"],
+				"local": {"class": "MapCache"}
+			}
+		}`)), ShouldBeNil)
+		server, err := NewServerWithConfig(config)
+		So(err, ShouldBeNil)
+		So(server.Namespaces(), ShouldResemble, []string{"user"})
+		go server.Serve()
+		defer server.Close()
+
+		config = viper.New()
+		config.SetConfigType("json")
+		So(config.ReadConfig(strings.NewReader(fmt.Sprintf(`{
+			"caches": ["remote"],
+			"compressor": {"package": "mykv", "class": "Compressor"},
+			"serializer": {"package": "mykv", "class": "Serializer"},
+			"remote": {
+				"class": "RemoteCache",
+				"address": %q,
+				"namespace": "user"
+			}
+		}`, server.GRPCAddr().String()))), ShouldBeNil)
+		client, err := kvcfg.NewKVClient(config)
+		So(err, ShouldBeNil)
+		defer client.Close()
+		So(client.Set(&mykv.Key{Message: "key1"}, &mykv.Val{Message: "val1"}), ShouldBeNil)
+		val := &mykv.Val{}
+		ok, err := client.Get(&mykv.Key{Message: "key1"}, val)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(val.Message, ShouldEqual, "val1")
+	})
+}
@@ -0,0 +1,226 @@
+package kvserver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// NewRemoteCacheBuilder create a new RemoteCacheBuilder
+func NewRemoteCacheBuilder() *RemoteCacheBuilder {
+	return &RemoteCacheBuilder{
+		Address: "127.0.0.1:8081",
+		Timeout: time.Duration(200) * time.Millisecond,
+	}
+}
+
+// RemoteCacheBuilder builder
+type RemoteCacheBuilder struct {
+	Address    string // grpc address of a kvserver
+	Namespace  string
+	Timeout    time.Duration // timeout of each request, 0 means no limit
+	Expiration time.Duration // expiration of Set and SetNx, 0 means the default expiration of the namespace
+	// operations supported by the namespace, such as ["Get", "SetEx"], empty means all.
+	// the kvserver does not tell them, they should be the same as the caches of the namespace
+	Capabilities []string
+}
+
+// WithAddress option
+func (b *RemoteCacheBuilder) WithAddress(address string) *RemoteCacheBuilder {
+	b.Address = address
+	return b
+}
+
+// WithNamespace option
+func (b *RemoteCacheBuilder) WithNamespace(namespace string) *RemoteCacheBuilder {
+	b.Namespace = namespace
+	return b
+}
+
+// WithTimeout option
+func (b *RemoteCacheBuilder) WithTimeout(timeout time.Duration) *RemoteCacheBuilder {
+	b.Timeout = timeout
+	return b
+}
+
+// WithExpiration option
+func (b *RemoteCacheBuilder) WithExpiration(expiration time.Duration) *RemoteCacheBuilder {
+	b.Expiration = expiration
+	return b
+}
+
+// WithCapabilities option
+func (b *RemoteCacheBuilder) WithCapabilities(capabilities []string) *RemoteCacheBuilder {
+	b.Capabilities = capabilities
+	return b
+}
+
+// Build a RemoteCache, the connection is established lazily
+func (b *RemoteCacheBuilder) Build() (*RemoteCache, error) {
+	if b.Namespace == "" {
+		return nil, fmt.Errorf("no namespace")
+	}
+	capabilities := kvclient.CapAll
+	if len(b.Capabilities) != 0 {
+		var err error
+		if capabilities, err = kvclient.ParseCapabilities(b.Capabilities); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := grpc.NewClient(
+		b.Address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteCache{
+		conn:         conn,
+		client:       NewKVServerClient(conn),
+		namespace:    b.Namespace,
+		timeout:      b.Timeout,
+		expiration:   b.Expiration,
+		capabilities: capabilities,
+	}, nil
+}
+
+// RemoteCache a namespace of a kvserver over grpc, so that a kvserver is a tier of
+// another KVClient
+type RemoteCache struct {
+	kvclient.BaseCache
+
+	conn         *grpc.ClientConn
+	client       KVServerClient
+	closer       kvclient.Closer
+	namespace    string
+	timeout      time.Duration
+	expiration   time.Duration
+	capabilities kvclient.Capability
+}
+
+// Capabilities supported operations configured, the others return ErrNotSupported
+// without a request
+func (c *RemoteCache) Capabilities() kvclient.Capability {
+	return c.capabilities
+}
+
+// context of a request, with the timeout if any
+func (c *RemoteCache) context() (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(context.Background(), c.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// Get key
+func (c *RemoteCache) Get(key string) ([]byte, error) {
+	if !c.capabilities.Has(kvclient.CapGet) {
+		return nil, &kvclient.ErrNotSupported{Capability: kvclient.CapGet}
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	res, err := c.client.Get(ctx, &GetRequest{Namespace: c.namespace, Key: key})
+	if err != nil {
+		return nil, err
+	}
+	if !res.Found {
+		return nil, nil
+	}
+	return res.Val, nil
+}
+
+// GetBatch keys with one request
+func (c *RemoteCache) GetBatch(keys []string) ([][]byte, []error, error) {
+	if !c.capabilities.Has(kvclient.CapGetBatch) {
+		return nil, nil, &kvclient.ErrNotSupported{Capability: kvclient.CapGetBatch}
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	res, err := c.client.GetBatch(ctx, &GetBatchRequest{Namespace: c.namespace, Keys: keys})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(res.Vals) != len(keys) {
+		return nil, nil, fmt.Errorf("assert len(vals)[%v] == len(keys)[%v] failed", len(res.Vals), len(keys))
+	}
+	vals := make([][]byte, len(keys))
+	for i, val := range res.Vals {
+		if val.Found {
+			vals[i] = val.Val
+		}
+	}
+	return vals, make([]error, len(keys)), nil
+}
+
+func (c *RemoteCache) set(key string, val []byte, expiration time.Duration, nx bool) (bool, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	req := &SetRequest{Namespace: c.namespace, Key: key, Val: val, TtlMs: int64(expiration / time.Millisecond), Nx: nx}
+	res, err := c.client.Set(ctx, req)
+	if err != nil {
+		return false, err
+	}
+	return res.Ok, nil
+}
+
+// Set key value
+func (c *RemoteCache) Set(key string, val []byte) error {
+	if !c.capabilities.Has(kvclient.CapSet) {
+		return &kvclient.ErrNotSupported{Capability: kvclient.CapSet}
+	}
+	_, err := c.set(key, val, c.expiration, false)
+	return err
+}
+
+// SetBatch set keys values one by one
+func (c *RemoteCache) SetBatch(keys []string, vals [][]byte) ([]error, error) {
+	if !c.capabilities.Has(kvclient.CapSetBatch) {
+		return nil, &kvclient.ErrNotSupported{Capability: kvclient.CapSetBatch}
+	}
+	return kvclient.SetBatch(c, keys, vals)
+}
+
+// SetEx set with expiration
+func (c *RemoteCache) SetEx(key string, val []byte, expiration time.Duration) error {
+	if !c.capabilities.Has(kvclient.CapSetEx) {
+		return &kvclient.ErrNotSupported{Capability: kvclient.CapSetEx}
+	}
+	_, err := c.set(key, val, expiration, false)
+	return err
+}
+
+// SetNx set if not exists
+func (c *RemoteCache) SetNx(key string, val []byte) (bool, error) {
+	if !c.capabilities.Has(kvclient.CapSetNx) {
+		return false, &kvclient.ErrNotSupported{Capability: kvclient.CapSetNx}
+	}
+	return c.set(key, val, c.expiration, true)
+}
+
+// SetExNx set if not exists with expiration
+func (c *RemoteCache) SetExNx(key string, val []byte, expiration time.Duration) (bool, error) {
+	if !c.capabilities.Has(kvclient.CapSetExNx) {
+		return false, &kvclient.ErrNotSupported{Capability: kvclient.CapSetExNx}
+	}
+	return c.set(key, val, expiration, true)
+}
+
+// Del key
+func (c *RemoteCache) Del(key string) error {
+	if !c.capabilities.Has(kvclient.CapDel) {
+		return &kvclient.ErrNotSupported{Capability: kvclient.CapDel}
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.client.Del(ctx, &DelRequest{Namespace: c.namespace, Key: key})
+	return err
+}
+
+// Close the connection
+func (c *RemoteCache) Close() error {
+	return c.closer.Close(c.conn.Close)
+}
@@ -0,0 +1,462 @@
+package kvserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// NewServerBuilder create a new ServerBuilder
+func NewServerBuilder() *ServerBuilder {
+	return &ServerBuilder{
+		HTTPAddress:     ":8080",
+		GRPCAddress:     ":8081",
+		ShutdownTimeout: time.Duration(30) * time.Second,
+		MaxBodyBytes:    4 * 1024 * 1024,
+		registerer:      prometheus.DefaultRegisterer,
+		clients:         map[string]kvclient.KVClient{},
+	}
+}
+
+// ServerBuilder builder
+type ServerBuilder struct {
+	HTTPAddress     string        // empty means no http server
+	GRPCAddress     string        // empty means no grpc server
+	ShutdownDelay   time.Duration // keep serving with /readyz failing for the time on Shutdown, so that load balancers stop sending requests
+	ShutdownTimeout time.Duration // requests not finished in the time are aborted by Close
+	MaxBodyBytes    int64         // max size of a http request body, 4MB by default as the grpc max message size
+	Verbose         bool
+	registerer      prometheus.Registerer
+	clients         map[string]kvclient.KVClient
+}
+
+// WithHTTPAddress option
+func (b *ServerBuilder) WithHTTPAddress(address string) *ServerBuilder {
+	b.HTTPAddress = address
+	return b
+}
+
+// WithGRPCAddress option
+func (b *ServerBuilder) WithGRPCAddress(address string) *ServerBuilder {
+	b.GRPCAddress = address
+	return b
+}
+
+// WithShutdownDelay option
+func (b *ServerBuilder) WithShutdownDelay(shutdownDelay time.Duration) *ServerBuilder {
+	b.ShutdownDelay = shutdownDelay
+	return b
+}
+
+// WithShutdownTimeout option
+func (b *ServerBuilder) WithShutdownTimeout(shutdownTimeout time.Duration) *ServerBuilder {
+	b.ShutdownTimeout = shutdownTimeout
+	return b
+}
+
+// WithMaxBodyBytes option, larger bodies are rejected with 413
+func (b *ServerBuilder) WithMaxBodyBytes(maxBodyBytes int64) *ServerBuilder {
+	b.MaxBodyBytes = maxBodyBytes
+	return b
+}
+
+// WithVerbose option
+func (b *ServerBuilder) WithVerbose(verbose bool) *ServerBuilder {
+	b.Verbose = verbose
+	return b
+}
+
+// WithRegisterer option, prometheus.DefaultRegisterer by default, /metrics serves it
+// if it is also a prometheus.Gatherer, otherwise prometheus.DefaultGatherer
+func (b *ServerBuilder) WithRegisterer(registerer prometheus.Registerer) *ServerBuilder {
+	b.registerer = registerer
+	return b
+}
+
+// WithKVClient option, serve the client as namespace, keys and values of the client
+// are set to raw bytes
+func (b *ServerBuilder) WithKVClient(namespace string, client kvclient.KVClient) *ServerBuilder {
+	b.clients[namespace] = client
+	return b
+}
+
+// Build a new Server, the addresses are listened on
+func (b *ServerBuilder) Build() (*Server, error) {
+	if len(b.clients) == 0 {
+		return nil, fmt.Errorf("no kvclient")
+	}
+	if b.HTTPAddress == "" && b.GRPCAddress == "" {
+		return nil, fmt.Errorf("no address to listen on")
+	}
+	if b.MaxBodyBytes <= 0 {
+		return nil, fmt.Errorf("max body bytes should be positive, got [%v]", b.MaxBodyBytes)
+	}
+	metrics, err := newServerMetrics(b.registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		shutdownDelay:   b.ShutdownDelay,
+		shutdownTimeout: b.ShutdownTimeout,
+		maxBodyBytes:    b.MaxBodyBytes,
+		verbose:         b.Verbose,
+		clients:         b.clients,
+		metrics:         metrics,
+		health:          health.NewServer(),
+	}
+	gatherer, ok := b.registerer.(prometheus.Gatherer)
+	if !ok {
+		gatherer = prometheus.DefaultGatherer
+	}
+
+	if b.HTTPAddress != "" {
+		if s.httpListener, err = net.Listen("tcp", b.HTTPAddress); err != nil {
+			return nil, err
+		}
+		s.httpServer = &http.Server{Handler: s.httpHandler(gatherer)}
+	}
+	if b.GRPCAddress != "" {
+		if s.grpcListener, err = net.Listen("tcp", b.GRPCAddress); err != nil {
+			if s.httpListener != nil {
+				s.httpListener.Close()
+			}
+			return nil, err
+		}
+		s.grpcServer = grpc.NewServer(grpc.UnaryInterceptor(s.grpcInterceptor))
+		RegisterKVServerServer(s.grpcServer, &grpcService{server: s})
+		healthpb.RegisterHealthServer(s.grpcServer, s.health)
+	}
+	// not serving until Serve
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	for _, client := range b.clients {
+		client.SetCompressor(kvclient.BytesCompressor{})
+		client.SetSerializer(kvclient.BytesSerializer{})
+	}
+	return s, nil
+}
+
+// Server serve named KVClients over http/json and grpc, with health checking and
+// prometheus metrics. the grpc api is described in kvserver.proto, RemoteCache is
+// the go client of it
+type Server struct {
+	shutdownDelay   time.Duration
+	shutdownTimeout time.Duration
+	maxBodyBytes    int64
+	verbose         bool
+	clients         map[string]kvclient.KVClient
+	metrics         *serverMetrics
+	health          *health.Server
+
+	httpListener net.Listener
+	httpServer   *http.Server
+	grpcListener net.Listener
+	grpcServer   *grpc.Server
+
+	mutex   sync.Mutex
+	ready   bool
+	closing bool
+}
+
+// Namespaces names of the clients served
+func (s *Server) Namespaces() []string {
+	var namespaces []string
+	for namespace := range s.clients {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// HTTPAddr address of http listened on, nil if no http server
+func (s *Server) HTTPAddr() net.Addr {
+	if s.httpListener == nil {
+		return nil
+	}
+	return s.httpListener.Addr()
+}
+
+// GRPCAddr address of grpc listened on, nil if no grpc server
+func (s *Server) GRPCAddr() net.Addr {
+	if s.grpcListener == nil {
+		return nil
+	}
+	return s.grpcListener.Addr()
+}
+
+// Ready true after Serve and before Shutdown
+func (s *Server) Ready() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ready
+}
+
+// Serve http and grpc until Shutdown, return nil after Shutdown
+func (s *Server) Serve() error {
+	s.mutex.Lock()
+	if s.closing {
+		s.mutex.Unlock()
+		return nil
+	}
+	errs := make(chan error, 2)
+	n := 0
+	if s.httpServer != nil {
+		n++
+		go func() {
+			err := s.httpServer.Serve(s.httpListener)
+			if err == http.ErrServerClosed {
+				err = nil
+			}
+			errs <- err
+		}()
+	}
+	if s.grpcServer != nil {
+		n++
+		go func() {
+			errs <- s.grpcServer.Serve(s.grpcListener)
+		}()
+	}
+	s.ready = true
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	s.mutex.Unlock()
+
+	var err error
+	for i := 0; i < n; i++ {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+			// one of the servers failed, stop the other
+			go s.Shutdown(0)
+		}
+	}
+	return err
+}
+
+// Shutdown become not ready and keep serving for ShutdownDelay, then stop accepting and
+// wait for the requests in flight, requests not finished in timeout are aborted
+func (s *Server) Shutdown(timeout time.Duration) error {
+	s.mutex.Lock()
+	if s.closing {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closing = true
+	s.ready = false
+	s.mutex.Unlock()
+	s.health.Shutdown()
+	time.Sleep(s.shutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var err error
+	if s.httpServer != nil {
+		if err = s.httpServer.Shutdown(ctx); err == context.DeadlineExceeded {
+			err = s.httpServer.Close()
+		}
+		// in case of not served
+		s.httpListener.Close()
+	}
+	if s.grpcServer != nil {
+		done := make(chan struct{})
+		go func() {
+			s.grpcServer.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			s.grpcServer.Stop()
+			<-done
+		}
+		s.grpcListener.Close()
+	}
+	return err
+}
+
+// Close shutdown with ShutdownTimeout and close the kvclients
+func (s *Server) Close() error {
+	err := s.Shutdown(s.shutdownTimeout)
+	for _, client := range s.clients {
+		if cerr := client.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// errNoNamespace the namespace is not served
+type errNoNamespace struct {
+	namespace string
+}
+
+func (e *errNoNamespace) Error() string {
+	return fmt.Sprintf("no namespace named [%v]", e.namespace)
+}
+
+// errInvalidArgument the request is malformed
+type errInvalidArgument struct {
+	message string
+}
+
+func (e *errInvalidArgument) Error() string {
+	return e.message
+}
+
+func (s *Server) client(namespace string) (kvclient.KVClient, error) {
+	client, ok := s.clients[namespace]
+	if !ok {
+		return nil, &errNoNamespace{namespace: namespace}
+	}
+	return client, nil
+}
+
+// get key of namespace, return false if not found
+func (s *Server) get(namespace string, key string) ([]byte, bool, error) {
+	client, err := s.client(namespace)
+	if err != nil {
+		return nil, false, err
+	}
+	if key == "" {
+		return nil, false, &errInvalidArgument{message: "empty key"}
+	}
+	var val []byte
+	ok, err := client.Get(key, &val)
+	return val, ok, err
+}
+
+// getBatch keys of namespace, GetBatch if the client supports it, otherwise Get one by
+// one. a key failed is returned as not found
+func (s *Server) getBatch(namespace string, keys []string) ([][]byte, []bool, error) {
+	client, err := s.client(namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	vals := make([][]byte, len(keys))
+	oks := make([]bool, len(keys))
+	if !client.Capabilities().Has(kvclient.CapGetBatch) {
+		for i := range keys {
+			if oks[i], err = client.Get(keys[i], &vals[i]); err != nil {
+				return nil, nil, err
+			}
+		}
+		return vals, oks, nil
+	}
+
+	ks := make([]interface{}, len(keys))
+	vs := make([]interface{}, len(keys))
+	for i := range keys {
+		ks[i] = keys[i]
+		vs[i] = &vals[i]
+	}
+	oks, errs, err := client.GetBatch(ks, vs)
+	if err != nil && errs == nil {
+		return nil, nil, err
+	}
+	for i := range errs {
+		if errs[i] != nil {
+			oks[i] = false
+		}
+	}
+	return vals, oks, nil
+}
+
+// set key val of namespace, with expiration if ttl > 0, only if the key not exists if
+// nx. return false if nx and the key exists
+func (s *Server) set(namespace string, key string, val []byte, ttl time.Duration, nx bool) (bool, error) {
+	client, err := s.client(namespace)
+	if err != nil {
+		return false, err
+	}
+	if key == "" {
+		return false, &errInvalidArgument{message: "empty key"}
+	}
+	// an empty value reads as not found, it is the marker of the misses backfilled by a
+	// kvclient with RemoteCache as an upper tier. grpc decodes it as nil, which caches
+	// do not accept
+	if val == nil {
+		val = []byte{}
+	}
+	if ttl < 0 {
+		return false, &errInvalidArgument{message: fmt.Sprintf("negative ttl [%v]", ttl)}
+	}
+	switch {
+	case nx && ttl > 0:
+		return client.SetExNx(key, val, ttl)
+	case nx:
+		return client.SetNx(key, val)
+	case ttl > 0:
+		return true, client.SetEx(key, val, ttl)
+	}
+	return true, client.Set(key, val)
+}
+
+// del key of namespace
+func (s *Server) del(namespace string, key string) error {
+	client, err := s.client(namespace)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return &errInvalidArgument{message: "empty key"}
+	}
+	return client.Del(key)
+}
+
+// serverMetrics requests of http and grpc
+type serverMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func newServerMetrics(registerer prometheus.Registerer) (*serverMetrics, error) {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kvserver_requests_total",
+		Help: "requests of kvserver by protocol, method, namespace and status code",
+	}, []string{"protocol", "method", "namespace", "code"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kvserver_request_duration_seconds",
+		Help:    "latency of kvserver requests by protocol and method in seconds",
+		Buckets: []float64{.0001, .0002, .0005, .001, .002, .005, .01, .02, .05, .1, .2, .5, 1},
+	}, []string{"protocol", "method"})
+
+	// servers in the same process share the metrics
+	if err := registerer.Register(requests); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		if requests, ok = are.ExistingCollector.(*prometheus.CounterVec); !ok {
+			return nil, err
+		}
+	}
+	if err := registerer.Register(duration); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		if duration, ok = are.ExistingCollector.(*prometheus.HistogramVec); !ok {
+			return nil, err
+		}
+	}
+	return &serverMetrics{requests: requests, duration: duration}, nil
+}
+
+// observe a request, namespaces not served are recorded as empty to bound the labels
+func (s *Server) observe(protocol string, method string, namespace string, code string, start time.Time) {
+	if _, ok := s.clients[namespace]; !ok {
+		namespace = ""
+	}
+	s.metrics.requests.WithLabelValues(protocol, method, namespace, code).Inc()
+	s.metrics.duration.WithLabelValues(protocol, method).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,254 @@
+package kvserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hatlonely/kvclient/pkg/kvclient"
+	"github.com/hatlonely/kvclient/pkg/kvclient/kvclienttest"
+	"github.com/prometheus/client_golang/prometheus"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func newTestServer(shutdownDelay time.Duration) *Server {
+	var clients []kvclient.KVClient
+	for i := 0; i < 2; i++ {
+		client, err := kvclient.NewBuilder().WithCaches([]kvclient.Cache{kvclient.NewMapCacheBuilder().Build()}).Build()
+		So(err, ShouldBeNil)
+		clients = append(clients, client)
+	}
+	server, err := NewServerBuilder().
+		WithHTTPAddress("127.0.0.1:0").
+		WithGRPCAddress("127.0.0.1:0").
+		WithShutdownDelay(shutdownDelay).
+		WithMaxBodyBytes(1024).
+		WithRegisterer(prometheus.NewRegistry()).
+		WithKVClient("user", clients[0]).
+		WithKVClient("item", clients[1]).
+		Build()
+	So(err, ShouldBeNil)
+	return server
+}
+
+func httpDo(method string, url string, body []byte) (int, []byte) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	So(err, ShouldBeNil)
+	res, err := http.DefaultClient.Do(req)
+	So(err, ShouldBeNil)
+	defer res.Body.Close()
+	buf, err := ioutil.ReadAll(res.Body)
+	So(err, ShouldBeNil)
+	return res.StatusCode, buf
+}
+
+func TestServer_HTTP(t *testing.T) {
+	Convey("test kvserver http", t, func() {
+		server := newTestServer(200 * time.Millisecond)
+		defer server.Close()
+		url := fmt.Sprintf("http://%v", server.HTTPAddr())
+
+		go server.Serve()
+		for !server.Ready() {
+			time.Sleep(time.Millisecond)
+		}
+		code, _ := httpDo("GET", url+"/readyz", nil)
+		So(code, ShouldEqual, http.StatusOK)
+		code, _ = httpDo("GET", url+"/healthz", nil)
+		So(code, ShouldEqual, http.StatusOK)
+
+		code, _ = httpDo("PUT", url+"/v1/user/key1", []byte("val1"))
+		So(code, ShouldEqual, http.StatusNoContent)
+		code, body := httpDo("GET", url+"/v1/user/key1", nil)
+		So(code, ShouldEqual, http.StatusOK)
+		So(string(body), ShouldEqual, "val1")
+		code, _ = httpDo("GET", url+"/v1/item/key1", nil)
+		So(code, ShouldEqual, http.StatusNotFound)
+		code, _ = httpDo("GET", url+"/v1/order/key1", nil)
+		So(code, ShouldEqual, http.StatusNotFound)
+
+		code, _ = httpDo("PUT", url+"/v1/user/key1?nx=true", []byte("val2"))
+		So(code, ShouldEqual, http.StatusConflict)
+		code, _ = httpDo("PUT", url+"/v1/user/key2?nx=true&ttl=100ms", []byte("val2"))
+		So(code, ShouldEqual, http.StatusNoContent)
+		code, _ = httpDo("PUT", url+"/v1/user/key3?ttl=abc", []byte("val3"))
+		So(code, ShouldEqual, http.StatusBadRequest)
+		code, _ = httpDo("PUT", url+"/v1/user/key4", nil)
+		So(code, ShouldEqual, http.StatusNoContent)
+		code, _ = httpDo("GET", url+"/v1/user/key4", nil)
+		So(code, ShouldEqual, http.StatusNotFound)
+		code, _ = httpDo("PUT", url+"/v1/user/key3", bytes.Repeat([]byte("v"), 1025))
+		So(code, ShouldEqual, http.StatusRequestEntityTooLarge)
+		code, _ = httpDo("POST", url+"/v1/batch/get", bytes.Repeat([]byte(" "), 1025))
+		So(code, ShouldEqual, http.StatusRequestEntityTooLarge)
+
+		buf, _ := json.Marshal(&BatchGetRequest{Namespace: "user", Keys: []string{"key1", "key2", "key3"}})
+		code, body = httpDo("POST", url+"/v1/batch/get", buf)
+		So(code, ShouldEqual, http.StatusOK)
+		var res BatchGetResponse
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Vals, ShouldResemble, [][]byte{[]byte("val1"), []byte("val2"), nil})
+
+		time.Sleep(200 * time.Millisecond)
+		code, _ = httpDo("GET", url+"/v1/user/key2", nil)
+		So(code, ShouldEqual, http.StatusNotFound)
+		code, _ = httpDo("DELETE", url+"/v1/user/key1", nil)
+		So(code, ShouldEqual, http.StatusNoContent)
+		code, _ = httpDo("GET", url+"/v1/user/key1", nil)
+		So(code, ShouldEqual, http.StatusNotFound)
+
+		code, body = httpDo("GET", url+"/metrics", nil)
+		So(code, ShouldEqual, http.StatusOK)
+		So(string(body), ShouldContainSubstring, `kvserver_requests_total{code="204",method="PUT",namespace="user",protocol="http"} 3`)
+
+		done := make(chan error)
+		go func() { done <- server.Shutdown(time.Second) }()
+		time.Sleep(50 * time.Millisecond)
+		So(server.Ready(), ShouldBeFalse)
+		code, _ = httpDo("GET", url+"/readyz", nil)
+		So(code, ShouldEqual, http.StatusServiceUnavailable)
+		So(<-done, ShouldBeNil)
+	})
+}
+
+func TestServer_GRPC(t *testing.T) {
+	Convey("test kvserver grpc", t, func() {
+		server := newTestServer(0)
+		defer server.Close()
+		go server.Serve()
+		for !server.Ready() {
+			time.Sleep(time.Millisecond)
+		}
+
+		conn, err := grpc.NewClient(server.GRPCAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		res, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		So(err, ShouldBeNil)
+		So(res.Status, ShouldEqual, healthpb.HealthCheckResponse_SERVING)
+
+		remote, err := NewRemoteCacheBuilder().WithAddress(server.GRPCAddr().String()).WithNamespace("user").Build()
+		So(err, ShouldBeNil)
+
+		Convey("remote cache", func() {
+			So(remote.Set("key1", []byte("val1")), ShouldBeNil)
+			val, err := remote.Get("key1")
+			So(err, ShouldBeNil)
+			So(val, ShouldResemble, []byte("val1"))
+			val, err = remote.Get("key2")
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+
+			ok, err := remote.SetNx("key1", []byte("val2"))
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			ok, err = remote.SetExNx("key2", []byte("val2"), 100*time.Millisecond)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+
+			vals, errs, err := remote.GetBatch([]string{"key1", "key2", "key3"})
+			So(err, ShouldBeNil)
+			So(errs, ShouldResemble, []error{nil, nil, nil})
+			So(vals, ShouldResemble, [][]byte{[]byte("val1"), []byte("val2"), nil})
+
+			time.Sleep(200 * time.Millisecond)
+			val, err = remote.Get("key2")
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+
+			So(remote.Del("key1"), ShouldBeNil)
+			val, err = remote.Get("key1")
+			So(err, ShouldBeNil)
+			So(val, ShouldBeNil)
+
+			So(remote.Set("", []byte("val1")), ShouldNotBeNil)
+			other, err := NewRemoteCacheBuilder().WithAddress(server.GRPCAddr().String()).WithNamespace("order").Build()
+			So(err, ShouldBeNil)
+			defer other.Close()
+			_, err = other.Get("key1")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("remote cache with capabilities", func() {
+			_, err := NewRemoteCacheBuilder().WithNamespace("user").WithCapabilities([]string{"Get", "Lock"}).Build()
+			So(err, ShouldNotBeNil)
+
+			readonly, err := NewRemoteCacheBuilder().WithAddress(server.GRPCAddr().String()).WithNamespace("user").WithCapabilities([]string{"Get", "GetBatch"}).Build()
+			So(err, ShouldBeNil)
+			defer readonly.Close()
+			So(readonly.Capabilities(), ShouldEqual, kvclient.CapGet|kvclient.CapGetBatch)
+			So(kvclient.IsNotSupported(readonly.Set("key1", []byte("val1"))), ShouldBeTrue)
+			_, err = readonly.SetNx("key1", []byte("val1"))
+			So(kvclient.IsNotSupported(err), ShouldBeTrue)
+			So(remote.Set("key1", []byte("val1")), ShouldBeNil)
+			val, err := readonly.Get("key1")
+			So(err, ShouldBeNil)
+			So(val, ShouldResemble, []byte("val1"))
+
+			_, err = kvclient.NewBuilder().WithCaches([]kvclient.Cache{readonly}).WithCapabilities(kvclient.CapSet).Build()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("remote cache as a tier", func() {
+			local := kvclient.NewMapCacheBuilder().Build()
+			client, err := kvclient.NewBuilder().WithCaches([]kvclient.Cache{local, remote}).Build()
+			So(err, ShouldBeNil)
+			client.SetCompressor(kvclient.BytesCompressor{})
+			client.SetSerializer(kvclient.BytesSerializer{})
+			So(remote.Set("key1", []byte("val1")), ShouldBeNil)
+
+			var val []byte
+			ok, err := client.Get("key1", &val)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(val, ShouldResemble, []byte("val1"))
+			buf, err := local.Get("key1")
+			So(err, ShouldBeNil)
+			So(buf, ShouldResemble, []byte("val1"))
+		})
+
+		Convey("remote cache as an upper tier", func() {
+			lower := kvclient.NewMapCacheBuilder().Build()
+			client, err := kvclient.NewBuilder().WithCaches([]kvclient.Cache{remote, lower}).Build()
+			So(err, ShouldBeNil)
+			client.SetCompressor(kvclient.BytesCompressor{})
+			client.SetSerializer(kvclient.BytesSerializer{})
+
+			// the miss is backfilled into the remote cache as an empty value
+			So(remote.Set("key5", []byte{}), ShouldBeNil)
+			var val []byte
+			ok, err := client.Get("key6", &val)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			buf, err := remote.Get("key6")
+			So(err, ShouldBeNil)
+			So(buf, ShouldBeNil)
+		})
+
+		So(remote.Close(), ShouldBeNil)
+		So(remote.Close(), ShouldBeNil)
+		So(server.Shutdown(time.Second), ShouldBeNil)
+	})
+}
+
+func TestRemoteCache_Conformance(t *testing.T) {
+	var server *Server
+	Convey("start kvserver", t, func() {
+		server = newTestServer(0)
+	})
+	defer server.Close()
+	go server.Serve()
+
+	// namespaces are kvclients, an empty value reads as not found
+	kvclienttest.RunCacheConformanceWithOptions(t, func() (kvclient.Cache, error) {
+		return NewRemoteCacheBuilder().WithAddress(server.GRPCAddr().String()).WithNamespace("user").Build()
+	}, kvclienttest.ConformanceOptions{EmptyValueNotFound: true})
+}
@@ -0,0 +1,12 @@
+// Package kvsql register the database/sql drivers of SQLCache, import it for side effects
+// in the commands that use SQLCache
+//
+//	import _ "github.com/hatlonely/kvclient/pkg/kvsql"
+//
+// mysql and postgres are always registered, sqlite3 only if cgo is enabled
+package kvsql
+
+import (
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
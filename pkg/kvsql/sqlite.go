@@ -0,0 +1,9 @@
+//go:build cgo
+// +build cgo
+
+package kvsql
+
+import (
+	// github.com/mattn/go-sqlite3 need cgo
+	_ "github.com/mattn/go-sqlite3"
+)